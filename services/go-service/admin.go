@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// registerAdminRoutes mounts the operator-facing admin, debug and metrics
+// endpoints behind the optional admin credentials
+func registerAdminRoutes(mux *http.ServeMux) {
+	creds := loadAdminCredentials()
+
+	mux.Handle("/metrics", requireAdminAuth(creds, promhttp.Handler()))
+	mux.Handle("/admin/slow", requireAdminAuth(creds, http.HandlerFunc(adminSlowHandler)))
+	mux.Handle("/admin/latency", requireAdminAuth(creds, http.HandlerFunc(adminLatencyHandler)))
+	mux.Handle("/debug/traces", requireAdminAuth(creds, http.HandlerFunc(debugTracesHandler)))
+	mux.Handle("/debug/tracez", requireAdminAuth(creds, http.HandlerFunc(debugTracezHandler)))
+	mux.Handle("/debug/rpcz", requireAdminAuth(creds, http.HandlerFunc(debugRpczHandler)))
+	mux.Handle("/debug/sampling", requireAdminAuth(creds, http.HandlerFunc(debugSamplingHandler)))
+	mux.Handle("/admin/faults", requireAdminAuth(creds, http.HandlerFunc(adminFaultsHandler)))
+	mux.Handle("/admin/faults/", requireAdminAuth(creds, http.HandlerFunc(adminFaultsHandler)))
+	mux.Handle("/admin/captures", requireAdminAuth(creds, http.HandlerFunc(adminCapturesHandler)))
+	mux.Handle("/admin/captures/", requireAdminAuth(creds, http.HandlerFunc(adminCapturesHandler)))
+	mux.Handle("/selftest", requireAdminAuth(creds, http.HandlerFunc(selftestHandler)))
+}
+
+// serveAdmin runs the admin listener; its requests are deliberately not
+// traced. A binary upgrade drains it with the other servers, so an admin
+// request in flight finishes before the old process exits.
+func serveAdmin(addr string, mux *http.ServeMux) {
+	lis := socketActivation.admin
+	if lis == nil {
+		var err error
+		if lis, err = listen(addr); err != nil {
+			log.Fatalf("Admin server failed: %v", err)
+		}
+	}
+	server := &http.Server{Handler: secureHeaders(mux)}
+	binaryUpgrader.inherit("admin", lis)
+	binaryUpgrader.onDrain(func(ctx context.Context) { server.Shutdown(ctx) })
+	log.Printf("Admin endpoints listening on %s", lis.Addr())
+	if err := server.Serve(lis); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Admin server failed: %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	alertNotifications  metric.Int64Counter
+	alertWebhookRetries metric.Int64Counter
+)
+
+// initAlertMetrics creates the webhook notification instruments
+func initAlertMetrics() error {
+	var err error
+
+	alertNotifications, err = meter.Int64Counter(
+		"alert_notifications_total",
+		metric.WithDescription("Threshold alert webhooks by alert (error_rate, p99_latency), state (firing, resolved) and outcome"),
+	)
+	if err != nil {
+		return err
+	}
+
+	alertWebhookRetries, err = meter.Int64Counter(
+		"alert_webhook_retries_total",
+		metric.WithDescription("Alert webhook deliveries retried after a failed attempt, by alert"),
+	)
+	return err
+}
+
+// alertThreshold is one condition the notifier watches; value reads it from
+// the latency digest's window
+type alertThreshold struct {
+	name      string
+	threshold float64
+	unit      string
+	value     func(routeLatency) float64
+
+	firing bool
+}
+
+// alertNotifier posts a Slack-compatible webhook when the service's own
+// error rate or p99 latency over the latency digest window crosses its
+// threshold, and again when it recovers. It complements backend alerting
+// with an alert that works when the metrics pipeline does not.
+type alertNotifier struct {
+	url         string
+	interval    time.Duration
+	minRequests uint64
+	attempts    int
+	client      *http.Client
+	alerts      []*alertThreshold
+}
+
+// newAlertNotifier returns nil when ALERT_WEBHOOK_URL is unset
+func newAlertNotifier() *alertNotifier {
+	url := secrets.Get("ALERT_WEBHOOK_URL")
+	if url == "" {
+		return nil
+	}
+	n := &alertNotifier{
+		url:         url,
+		interval:    envDuration("ALERT_CHECK_INTERVAL", 15*time.Second),
+		minRequests: uint64(envInt("ALERT_MIN_REQUESTS", 20)),
+		attempts:    max(1, envInt("ALERT_WEBHOOK_ATTEMPTS", 3)),
+		client:      &http.Client{Timeout: 5 * time.Second, Transport: newInstrumentedTransport()},
+	}
+	if limit := envFloat("ALERT_ERROR_RATE", 0.05); limit > 0 {
+		n.alerts = append(n.alerts, &alertThreshold{
+			name:      "error_rate",
+			threshold: limit,
+			value:     func(rl routeLatency) float64 { return rl.ErrorRate },
+		})
+	}
+	if limit := envDuration("ALERT_P99_LATENCY", time.Second); limit > 0 {
+		n.alerts = append(n.alerts, &alertThreshold{
+			name:      "p99_latency",
+			threshold: durationMs(limit),
+			unit:      "ms",
+			value:     func(rl routeLatency) float64 { return rl.P99Ms },
+		})
+	}
+	return n
+}
+
+// run checks the thresholds every ALERT_CHECK_INTERVAL until ctx ends
+func (n *alertNotifier) run(ctx context.Context) {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.check(ctx)
+		}
+	}
+}
+
+// check notifies each alert whose state changed. A window with fewer than
+// ALERT_MIN_REQUESTS requests fires nothing, but resolves firing alerts. The
+// state only flips once the webhook is delivered, so an undelivered change is
+// sent again on the next check if it still holds.
+func (n *alertNotifier) check(ctx context.Context) {
+	total, ok := latencyDigests.total()
+	enough := ok && total.Count >= n.minRequests
+	for _, a := range n.alerts {
+		value := a.value(total)
+		breached := enough && value > a.threshold
+		if breached == a.firing {
+			continue
+		}
+		state := "resolved"
+		if breached {
+			state = "firing"
+		}
+		if n.notify(ctx, a, state, value, total.Count) {
+			a.firing = breached
+		}
+	}
+}
+
+// slackMessage is the body of an alert webhook; Slack incoming webhooks
+// and most chat tools accept the text field
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// notify delivers one state change in its own trace, retrying with a
+// growing pause; it reports whether the webhook accepted it
+func (n *alertNotifier) notify(ctx context.Context, a *alertThreshold, state string, value float64, requests uint64) bool {
+	ctx, span := tracer.Start(ctx, "alert_webhook", trace.WithNewRoot(), trace.WithAttributes(
+		attribute.String("alert.name", a.name),
+		attribute.String("alert.state", state),
+		attribute.Float64("alert.value", value),
+		attribute.Float64("alert.threshold", a.threshold),
+	))
+	defer span.End()
+
+	window := latencyDigests.window
+	text := fmt.Sprintf(":rotating_light: go-service %s is %s over the last %s (threshold %s, %d requests, %s)",
+		a.name, a.format(value), window, a.format(a.threshold), requests, deploymentEnvironment)
+	if state == "resolved" {
+		text = fmt.Sprintf(":white_check_mark: go-service %s recovered: %s over the last %s (threshold %s, %s)",
+			a.name, a.format(value), window, a.format(a.threshold), deploymentEnvironment)
+	}
+	body, _ := json.Marshal(slackMessage{Text: text})
+
+	var err error
+	for attempt := 1; attempt <= n.attempts; attempt++ {
+		if attempt > 1 {
+			alertWebhookRetries.Add(ctx, 1, metric.WithAttributes(attribute.String("alert", a.name)))
+		}
+		if err = n.send(ctx, body); err == nil {
+			break
+		}
+		span.AddEvent("attempt failed", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("error", err.Error()),
+		))
+		if attempt < n.attempts {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+	}
+
+	outcome := "success"
+	fields := map[string]interface{}{"alert": a.name, "state": state, "value": value, "threshold": a.threshold}
+	if err != nil {
+		outcome = "failure"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "alert webhook not delivered")
+		fields["error"] = err.Error()
+		logJSON(ctx, "WARN", "Failed to deliver alert webhook", fields)
+	} else {
+		logJSON(ctx, "INFO", "Delivered alert webhook", fields)
+	}
+	alertNotifications.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("alert", a.name),
+		attribute.String("state", state),
+		attribute.String("outcome", outcome),
+	))
+	return err == nil
+}
+
+// format renders a value of this alert for the message
+func (a *alertThreshold) format(v float64) string {
+	if a.unit == "" {
+		return fmt.Sprintf("%.1f%%", v*100)
+	}
+	return fmt.Sprintf("%.0f%s", v, a.unit)
+}
+
+func (n *alertNotifier) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	analyticsEvents         metric.Int64Counter
+	analyticsBatchSize      metric.Int64Histogram
+	analyticsInsertDuration metric.Float64Histogram
+)
+
+// initAnalyticsMetrics creates the wide event writer instruments
+func initAnalyticsMetrics() error {
+	var err error
+
+	analyticsEvents, err = meter.Int64Counter(
+		"analytics_events_total",
+		metric.WithDescription("Wide events by outcome (queued, dropped, written, failed)"),
+	)
+	if err != nil {
+		return err
+	}
+
+	analyticsBatchSize, err = meter.Int64Histogram(
+		"analytics_batch_size",
+		metric.WithDescription("Rows per ClickHouse insert"),
+	)
+	if err != nil {
+		return err
+	}
+
+	analyticsInsertDuration, err = meter.Float64Histogram(
+		"analytics_insert_duration_seconds",
+		metric.WithDescription("Duration of ClickHouse inserts by outcome"),
+		metric.WithUnit("s"),
+	)
+	return err
+}
+
+// wideEvent is one row per request, carrying enough context to slice
+// traffic by any dimension without pre-aggregating it into metrics
+type wideEvent struct {
+	Timestamp  string  `json:"timestamp"`
+	Service    string  `json:"service"`
+	Version    string  `json:"version"`
+	TraceID    string  `json:"trace_id"`
+	SpanID     string  `json:"span_id"`
+	Method     string  `json:"method"`
+	Route      string  `json:"route"`
+	Path       string  `json:"path"`
+	Status     int     `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+	Bytes      int64   `json:"response_bytes"`
+	ClientIP   string  `json:"client_ip"`
+	UserAgent  string  `json:"user_agent"`
+	Proto      string  `json:"protocol"`
+}
+
+// analyticsWriter batches wide events into ClickHouse over its HTTP
+// interface. Requests only enqueue; a full queue drops events rather than
+// slowing requests down.
+type analyticsWriter struct {
+	url           string
+	table         string
+	batchSize     int
+	flushInterval time.Duration
+	queue         chan wideEvent
+	client        *http.Client
+}
+
+// newAnalyticsWriter returns nil unless CLICKHOUSE_URL is set; it is read as
+// a secret since the URL may carry credentials
+func newAnalyticsWriter() *analyticsWriter {
+	endpoint := secrets.Get("CLICKHOUSE_URL")
+	if endpoint == "" {
+		return nil
+	}
+	return &analyticsWriter{
+		url:           strings.TrimSuffix(endpoint, "/"),
+		table:         envString("CLICKHOUSE_TABLE", "request_events"),
+		batchSize:     envInt("CLICKHOUSE_BATCH_SIZE", 500),
+		flushInterval: envDuration("CLICKHOUSE_FLUSH_INTERVAL", 5*time.Second),
+		queue:         make(chan wideEvent, envInt("CLICKHOUSE_QUEUE_SIZE", 10000)),
+		client: &http.Client{
+			Timeout:   envDuration("CLICKHOUSE_TIMEOUT", 10*time.Second),
+			Transport: newInstrumentedTransport(),
+		},
+	}
+}
+
+// enqueue hands an event to the writer without blocking
+func (a *analyticsWriter) enqueue(ctx context.Context, e wideEvent) {
+	outcome := "queued"
+	select {
+	case a.queue <- e:
+	default:
+		outcome = "dropped"
+		recordTelemetryDrop("wide_events", "queue_full", 1)
+	}
+	analyticsEvents.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", outcome)))
+}
+
+// run creates the table and flushes batches until ctx is cancelled, then
+// writes what is still queued
+func (a *analyticsWriter) run(ctx context.Context) {
+	if envBool("CLICKHOUSE_CREATE_TABLE", true) {
+		if err := a.createTable(ctx); err != nil {
+			logJSON(ctx, "ERROR", "Failed to create ClickHouse table", map[string]interface{}{
+				"table": a.table,
+				"error": err.Error(),
+			})
+		}
+	}
+
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+	batch := make([]wideEvent, 0, a.batchSize)
+	for {
+		select {
+		case e := <-a.queue:
+			batch = append(batch, e)
+			if len(batch) >= a.batchSize {
+				a.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				a.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ctx.Done():
+		drain:
+			for {
+				select {
+				case e := <-a.queue:
+					batch = append(batch, e)
+				default:
+					break drain
+				}
+			}
+			if len(batch) > 0 {
+				a.flush(batch)
+			}
+			return
+		}
+	}
+}
+
+func (a *analyticsWriter) createTable(ctx context.Context) error {
+	ddl := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	timestamp DateTime64(3),
+	service LowCardinality(String),
+	version LowCardinality(String),
+	trace_id String,
+	span_id String,
+	method LowCardinality(String),
+	route LowCardinality(String),
+	path String,
+	status UInt16,
+	duration_ms Float64,
+	response_bytes UInt64,
+	client_ip String,
+	user_agent String,
+	protocol LowCardinality(String)
+) ENGINE = MergeTree ORDER BY (route, timestamp)`, a.table)
+	return a.exec(ctx, ddl, nil)
+}
+
+// exec posts a statement, with body as its data for inserts
+func (a *analyticsWriter) exec(ctx context.Context, statement string, body []byte) error {
+	target := a.url + "/?" + url.Values{"query": {statement}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("clickhouse returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// flush inserts one batch as JSONEachRow under its own root span
+func (a *analyticsWriter) flush(batch []wideEvent) {
+	start := time.Now()
+	ctx, span := tracer.Start(context.Background(), "clickhouse.insert",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "clickhouse"),
+			attribute.String("db.operation", "INSERT"),
+			attribute.String("db.sql.table", a.table),
+			attribute.Int("db.batch.size", len(batch)),
+		),
+	)
+	defer span.End()
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range batch {
+		enc.Encode(e)
+	}
+	span.SetAttributes(attribute.Int("db.batch.bytes", body.Len()))
+
+	outcome := "written"
+	err := a.exec(ctx, "INSERT INTO "+a.table+" FORMAT JSONEachRow", body.Bytes())
+	if err != nil {
+		outcome = "failed"
+		recordTelemetryDrop("wide_events", "export_failed", len(batch))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "insert failed")
+		logJSON(ctx, "ERROR", "ClickHouse insert failed", map[string]interface{}{
+			"rows":  len(batch),
+			"error": err.Error(),
+		})
+	}
+
+	analyticsBatchSize.Record(ctx, int64(len(batch)))
+	analyticsInsertDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attribute.String("outcome", outcome)))
+	analyticsEvents.Add(ctx, int64(len(batch)), metric.WithAttributes(attribute.String("outcome", outcome)))
+}
+
+// recordWideEvents emits a wide event per request to the analytics writer
+func recordWideEvents(a *analyticsWriter, next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		ctx := r.Context()
+		sc := trace.SpanContextFromContext(ctx)
+		a.enqueue(ctx, wideEvent{
+			Timestamp:  start.UTC().Format("2006-01-02 15:04:05.000"),
+			Service:    "go-service",
+			Version:    version,
+			TraceID:    sc.TraceID().String(),
+			SpanID:     sc.SpanID().String(),
+			Method:     r.Method,
+			Route:      routeOf(r),
+			Path:       r.URL.Path,
+			Status:     rec.status,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			Bytes:      rec.bytes,
+			ClientIP:   clientIP(r),
+			UserAgent:  r.UserAgent(),
+			Proto:      r.Proto,
+		})
+	})
+}
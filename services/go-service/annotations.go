@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// grafanaAnnotationAttempts is how many times an annotation is posted before
+// giving up; Grafana often starts after the service in the compose stack
+const grafanaAnnotationAttempts = 3
+
+var grafanaAnnotationsPosted metric.Int64Counter
+
+// initGrafanaAnnotationMetrics creates the annotation outcome counter
+func initGrafanaAnnotationMetrics() error {
+	var err error
+	grafanaAnnotationsPosted, err = meter.Int64Counter(
+		"grafana_annotations_total",
+		metric.WithDescription("Deploy annotations posted to Grafana by event (startup, deploy) and outcome"),
+	)
+	return err
+}
+
+// grafanaAnnotator posts an annotation to Grafana when the service starts
+// and whenever DEPLOY_MARKER changes through CONFIG_FILE, so dashboards
+// show deploys without anyone adding them by hand
+type grafanaAnnotator struct {
+	url    string
+	token  string
+	tags   []string
+	client *http.Client
+
+	mu     sync.Mutex
+	marker string
+}
+
+// annotations is nil until runServe builds it, and stays nil when
+// GRAFANA_ANNOTATIONS_URL is unset
+var annotations *grafanaAnnotator
+
+func newGrafanaAnnotator() *grafanaAnnotator {
+	base := strings.TrimSuffix(os.Getenv("GRAFANA_ANNOTATIONS_URL"), "/")
+	if base == "" {
+		return nil
+	}
+	return &grafanaAnnotator{
+		url:    base + "/api/annotations",
+		token:  secrets.Get("GRAFANA_API_TOKEN"),
+		tags:   splitList(os.Getenv("GRAFANA_ANNOTATION_TAGS")),
+		client: &http.Client{Timeout: 5 * time.Second, Transport: newInstrumentedTransport()},
+		marker: os.Getenv("DEPLOY_MARKER"),
+	}
+}
+
+// started announces this process
+func (a *grafanaAnnotator) started(ctx context.Context) {
+	a.mu.Lock()
+	marker := a.marker
+	a.mu.Unlock()
+
+	text := fmt.Sprintf("go-service %s started (%s)", version, deploymentTrack)
+	goWithCrashReport("grafana_annotation", func() { a.post(ctx, "startup", marker, text) })
+}
+
+// deployMarker announces a deploy when marker differs from the last one seen
+func (a *grafanaAnnotator) deployMarker(ctx context.Context, marker string) {
+	a.mu.Lock()
+	previous := a.marker
+	a.marker = marker
+	a.mu.Unlock()
+	if marker == previous || marker == "" {
+		return
+	}
+
+	text := fmt.Sprintf("go-service deployed %s", marker)
+	if previous != "" {
+		text = fmt.Sprintf("go-service deployed %s (was %s)", marker, previous)
+	}
+	ctx = context.WithoutCancel(ctx)
+	goWithCrashReport("grafana_annotation", func() { a.post(ctx, "deploy", marker, text) })
+}
+
+// annotationTags are the tags dashboards filter deploy markers on
+func (a *grafanaAnnotator) annotationTags(event, marker string) []string {
+	tags := []string{
+		"go-service",
+		event,
+		"version:" + version,
+		"environment:" + deploymentEnvironment,
+		"track:" + deploymentTrack,
+	}
+	if marker != "" {
+		tags = append(tags, "deploy_marker:"+marker)
+	}
+	return append(tags, a.tags...)
+}
+
+// post sends the annotation, retrying with a growing pause
+func (a *grafanaAnnotator) post(ctx context.Context, event, marker, text string) {
+	ctx, span := tracer.Start(ctx, "grafana_annotation", trace.WithAttributes(
+		attribute.String("annotation.event", event),
+		attribute.String("deploy.marker", marker),
+	))
+	defer span.End()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"time": time.Now().UnixMilli(),
+		"tags": a.annotationTags(event, marker),
+		"text": text,
+	})
+
+	var err error
+	for attempt := 1; attempt <= grafanaAnnotationAttempts; attempt++ {
+		if err = a.send(ctx, body); err == nil {
+			break
+		}
+		span.AddEvent("attempt failed", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("error", err.Error()),
+		))
+		if attempt < grafanaAnnotationAttempts {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+	}
+
+	outcome := "success"
+	fields := map[string]interface{}{"event": event, "deploy_marker": marker, "text": text}
+	if err != nil {
+		outcome = "failure"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "annotation not posted")
+		fields["error"] = err.Error()
+		logJSON(ctx, "WARN", "Failed to post Grafana annotation", fields)
+	} else {
+		logJSON(ctx, "INFO", "Posted Grafana annotation", fields)
+	}
+	grafanaAnnotationsPosted.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("event", event),
+		attribute.String("outcome", outcome),
+	))
+}
+
+func (a *grafanaAnnotator) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
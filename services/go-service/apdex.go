@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// apdexCounts accumulates samples for one route between metric collections
+type apdexCounts struct {
+	satisfied  int64
+	tolerating int64
+	frustrated int64
+}
+
+// apdexTracker classifies request latencies against a per-route T threshold
+type apdexTracker struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	overrides map[string]time.Duration
+	routes    map[string]*apdexCounts
+}
+
+var apdex = newApdexTracker()
+
+// newApdexTracker reads APDEX_THRESHOLD and APDEX_ROUTE_THRESHOLDS ("/data=200ms,/burn=10s")
+func newApdexTracker() *apdexTracker {
+	return &apdexTracker{
+		threshold: envDuration("APDEX_THRESHOLD", 500*time.Millisecond),
+		overrides: routeDurations(envString("APDEX_ROUTE_THRESHOLDS", "")),
+		routes:    map[string]*apdexCounts{},
+	}
+}
+
+func (t *apdexTracker) thresholdFor(route string) time.Duration {
+	if d, ok := t.overrides[route]; ok {
+		return d
+	}
+	return t.threshold
+}
+
+// record classifies a sample; server errors always count as frustrated
+func (t *apdexTracker) record(route string, latency time.Duration, status int) {
+	threshold := t.thresholdFor(route)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.routes[route]
+	if !ok {
+		c = &apdexCounts{}
+		t.routes[route] = c
+	}
+
+	switch {
+	case status >= 500 || latency > 4*threshold:
+		c.frustrated++
+	case latency > threshold:
+		c.tolerating++
+	default:
+		c.satisfied++
+	}
+}
+
+// drain returns the counts gathered since the previous call and resets them
+func (t *apdexTracker) drain() map[string]apdexCounts {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make(map[string]apdexCounts, len(t.routes))
+	for route, c := range t.routes {
+		out[route] = *c
+	}
+	t.routes = map[string]*apdexCounts{}
+	return out
+}
+
+// initApdexMetrics exports the Apdex score per route over each collection interval
+func initApdexMetrics() error {
+	score, err := meter.Float64ObservableGauge(
+		"apdex_score",
+		metric.WithDescription("Apdex score per route over the last collection interval"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for route, c := range apdex.drain() {
+			total := c.satisfied + c.tolerating + c.frustrated
+			if total == 0 {
+				continue
+			}
+			value := (float64(c.satisfied) + float64(c.tolerating)/2) / float64(total)
+			o.ObserveFloat64(score, value, metric.WithAttributes(
+				attribute.String("endpoint", route),
+				attribute.Float64("threshold_seconds", apdex.thresholdFor(route).Seconds()),
+			))
+		}
+		return nil
+	}, score)
+	return err
+}
+
+// trackApdex feeds every request's latency and status into the Apdex tracker
+func trackApdex(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if telemetryExcluded(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := newStatusRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		if route, ok := metricRoute(routeOf(r)); ok {
+			apdex.record(route, time.Since(start), rec.status)
+		}
+	})
+}
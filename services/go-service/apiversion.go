@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type apiVersionContextKey struct{}
+
+var deprecatedRequests metric.Int64Counter
+
+// initAPIVersionMetrics creates the deprecated API usage instrument
+func initAPIVersionMetrics() error {
+	var err error
+
+	deprecatedRequests, err = meter.Int64Counter(
+		"api_deprecated_requests_total",
+		metric.WithDescription("Requests to deprecated API versions by version, route and hashed client"),
+	)
+	return err
+}
+
+// apiVersionFromContext returns the API version of the current request, or
+// "" for unversioned routes
+func apiVersionFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(apiVersionContextKey{}).(string)
+	return v
+}
+
+// apiDeprecation is what a deprecated version advertises: RFC 9745
+// Deprecation, RFC 8594 Sunset and a successor-version link
+type apiDeprecation struct {
+	successor    string
+	deprecatedAt time.Time
+	sunset       time.Time
+	clients      *clientLabeler
+}
+
+func loadV1Deprecation() *apiDeprecation {
+	d := &apiDeprecation{successor: "v2", clients: newClientLabeler()}
+	if t, err := time.Parse(time.RFC3339, envString("API_V1_DEPRECATED_AT", "")); err == nil {
+		d.deprecatedAt = t
+	}
+	if t, err := time.Parse(time.RFC3339, envString("API_V1_SUNSET", "")); err == nil {
+		d.sunset = t
+	}
+	return d
+}
+
+func (d *apiDeprecation) setHeaders(w http.ResponseWriter, r *http.Request, version string) {
+	if d.deprecatedAt.IsZero() {
+		w.Header().Set("Deprecation", "true")
+	} else {
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(d.deprecatedAt.Unix(), 10))
+	}
+	if !d.sunset.IsZero() {
+		w.Header().Set("Sunset", d.sunset.UTC().Format(http.TimeFormat))
+	}
+	successor := "/" + d.successor + strings.TrimPrefix(r.URL.Path, "/"+version)
+	w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+}
+
+// versionedRoutes mounts every versioned API route under /<version>. v1 is
+// the legacy group and answers with deprecation headers; v2 also stamps the
+// stable HTTP semantic convention attributes on the server span.
+func versionedRoutes(mux *http.ServeMux, routes []apiRoute) {
+	v1 := loadV1Deprecation()
+	for _, route := range routes {
+		if route.unversioned {
+			continue
+		}
+		mux.Handle("/v1"+route.pattern, withAPIVersion("v1", v1, route.handler))
+		mux.Handle("/v2"+route.pattern, withAPIVersion("v2", nil, route.handler))
+	}
+}
+
+// withAPIVersion strips the version prefix so handlers see the paths they
+// always served, and tags the span and request metrics with api.version
+func withAPIVersion(version string, deprecation *apiDeprecation, next http.Handler) http.Handler {
+	next = http.StripPrefix("/"+version, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), apiVersionContextKey{}, version)
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.String("api.version", version))
+
+		if deprecation != nil {
+			client, _ := deprecation.clients.label(r)
+			deprecatedRequests.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("api.version", version),
+				attribute.String("route", routeFromContext(ctx)),
+				attribute.String("client", client),
+			))
+			span.SetAttributes(attribute.Bool("api.deprecated", true))
+			deprecation.setHeaders(w, r, version)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		rec := newStatusRecorder(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", routeFromContext(ctx)),
+			attribute.String("url.path", r.URL.Path),
+			attribute.Int("http.response.status_code", rec.status),
+		)
+		if rec.status >= 500 {
+			span.SetAttributes(attribute.String("error.type", strconv.Itoa(rec.status)))
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// attrSlices reuses the attribute slices built for every request metric and
+// every ended span. attribute.NewSet and span.SetAttributes copy what they
+// are given, so a slice can go back as soon as the call returns.
+var attrSlices = sync.Pool{
+	New: func() interface{} {
+		attrs := make([]attribute.KeyValue, 0, 8)
+		return &attrs
+	},
+}
+
+func getAttrs() *[]attribute.KeyValue {
+	attrs := attrSlices.Get().(*[]attribute.KeyValue)
+	*attrs = (*attrs)[:0]
+	return attrs
+}
+
+// putAttrs returns a slice to the pool, dropping its values so pooled slices
+// do not keep request strings alive
+func putAttrs(attrs *[]attribute.KeyValue) {
+	clear(*attrs)
+	attrSlices.Put(attrs)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func BenchmarkRequestAttributes(b *testing.B) {
+	ctx := tracedContext()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		requestAttributes(ctx, "GET", "/data")
+	}
+}
+
+func BenchmarkCountRequest(b *testing.B) {
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewManualReader()))
+	defer provider.Shutdown(context.Background())
+	saved := requestCounter
+	defer func() { requestCounter = saved }()
+	var err error
+	if requestCounter, err = provider.Meter("bench").Int64Counter("http_requests_total"); err != nil {
+		b.Fatal(err)
+	}
+	ctx := tracedContext()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		countRequest(ctx, "GET", "/data")
+	}
+}
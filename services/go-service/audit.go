@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var auditEvents metric.Int64Counter
+
+// initAuditMetrics creates the audit event counter
+func initAuditMetrics() error {
+	var err error
+	auditEvents, err = meter.Int64Counter(
+		"audit_events_total",
+		metric.WithDescription("Security-relevant events written to the audit log, by event and outcome"),
+	)
+	return err
+}
+
+// auditRecord is one line of the audit stream. Every record carries the
+// mandatory fields, a gap-free sequence number and a hash chained to the
+// previous record, so deleted or edited lines are detectable. With
+// AUDIT_HMAC_KEY the hash is an HMAC-SHA256, so only holders of the key
+// can rebuild a chain over edited lines.
+type auditRecord struct {
+	Stream    string                 `json:"log_stream"`
+	Seq       uint64                 `json:"seq"`
+	Timestamp string                 `json:"timestamp"`
+	Event     string                 `json:"event"`
+	Actor     string                 `json:"actor"`
+	Outcome   string                 `json:"outcome"`
+	Source    string                 `json:"source"`
+	Service   string                 `json:"service"`
+	TraceID   string                 `json:"trace_id,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	PrevHash  string                 `json:"prev_hash"`
+	Hash      string                 `json:"hash"`
+}
+
+// auditLogger serialises records so sequence numbers and the hash chain stay
+// ordered. With a file sink, file is locked around every append and size is
+// its length after this process's last record: a different length means
+// another process appended, and the chain is picked up from its last record.
+type auditLogger struct {
+	mu       sync.Mutex
+	out      io.Writer
+	file     *os.File
+	size     int64
+	key      []byte
+	seq      uint64
+	prevHash string
+}
+
+// auditLog is nil until runServe opens it; events before then are dropped
+var auditLog *auditLogger
+
+// auditTailBytes is how much of an existing audit file is read to find the
+// record the chain continues from
+const auditTailBytes = 64 << 10
+
+// newAuditLogger opens AUDIT_LOG_SINK: "stdout" (default; application logs
+// go to stderr), "stderr", or "file:<path>". A file sink continues the
+// sequence and chain of the last record already in it; supervised workers
+// each write their own file, suffixed with the worker ID.
+func newAuditLogger() *auditLogger {
+	a := &auditLogger{out: os.Stdout, key: []byte(secrets.Get("AUDIT_HMAC_KEY")), prevHash: strings.Repeat("0", 64)}
+	if len(a.key) == 0 {
+		logJSON(context.Background(), "WARN", "AUDIT_HMAC_KEY is not set, audit records are chained with plain SHA-256", nil)
+	}
+	sink := envString("AUDIT_LOG_SINK", "stdout")
+	switch {
+	case sink == "stderr":
+		a.out = os.Stderr
+	case strings.HasPrefix(sink, "file:"):
+		path := strings.TrimPrefix(sink, "file:")
+		if workerID != "" {
+			ext := filepath.Ext(path)
+			path = strings.TrimSuffix(path, ext) + "-" + workerID + ext
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+		if err != nil {
+			logJSON(context.Background(), "ERROR", "Failed to open audit log, using stdout", map[string]interface{}{
+				"sink":  sink,
+				"error": err.Error(),
+			})
+			break
+		}
+		a.out, a.file, a.size = f, f, -1
+	}
+	return a
+}
+
+// resume reads the last record of the audit file when another process has
+// appended since this one last wrote, or on the first write. The file must be
+// locked.
+func (a *auditLogger) resume() {
+	info, err := a.file.Stat()
+	if err == nil && info.Size() == a.size {
+		return
+	}
+	var last *auditRecord
+	if err == nil {
+		last, err = lastAuditRecord(a.file, info.Size())
+		a.size = info.Size()
+	}
+	if err != nil {
+		logJSON(context.Background(), "ERROR", "Failed to read the audit log tail, starting a new chain", map[string]interface{}{
+			"file":  a.file.Name(),
+			"error": err.Error(),
+		})
+		// Read the tail again on the next write
+		a.size = -1
+	}
+	if last != nil {
+		a.seq, a.prevHash = last.Seq, last.Hash
+	}
+}
+
+// lastAuditRecord returns the last complete record of the audit file f of
+// the given size, or nil when there is none yet
+func lastAuditRecord(f *os.File, size int64) (*auditRecord, error) {
+	offset := max(0, size-auditTailBytes)
+	tail := make([]byte, size-offset)
+	if _, err := f.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(tail), "\n"), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		var rec auditRecord
+		if json.Unmarshal([]byte(lines[i]), &rec) == nil && rec.Stream == "audit" && rec.Hash != "" {
+			return &rec, nil
+		}
+	}
+	return nil, nil
+}
+
+// audit writes a security-relevant event. actor identifies who acted
+// ("system" for the process itself) and outcome is e.g. success, failure or denied.
+func audit(ctx context.Context, event, actor, outcome, source string, details map[string]interface{}) {
+	rec := auditRecord{
+		Stream:    "audit",
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Event:     event,
+		Actor:     actor,
+		Outcome:   outcome,
+		Source:    source,
+		Service:   "go-service",
+		Details:   map[string]interface{}{},
+	}
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		rec.TraceID = sc.TraceID().String()
+	}
+	for k, v := range details {
+		if s, ok := v.(string); ok {
+			v = secrets.Redact(s)
+		}
+		rec.Details[k] = v
+	}
+
+	if auditLog == nil {
+		return
+	}
+	auditLog.write(&rec)
+	auditEvents.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("event", event),
+		attribute.String("outcome", outcome),
+	))
+}
+
+func (a *auditLogger) write(rec *auditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file != nil {
+		unlock, err := lockAuditFile(a.file)
+		if err != nil {
+			logJSON(context.Background(), "ERROR", "Failed to lock the audit log", map[string]interface{}{
+				"file":  a.file.Name(),
+				"error": err.Error(),
+			})
+		} else {
+			defer unlock()
+		}
+		a.resume()
+	}
+
+	a.seq++
+	rec.Seq = a.seq
+	rec.PrevHash = a.prevHash
+	rec.Hash = ""
+	unsigned, _ := json.Marshal(rec)
+	rec.Hash = a.sum(unsigned)
+	a.prevHash = rec.Hash
+
+	line, _ := json.Marshal(rec)
+	n, _ := a.out.Write(append(line, '\n'))
+	if a.file != nil && a.size >= 0 {
+		a.size += int64(n)
+	}
+}
+
+// sum is the chain hash of an unsigned record: an HMAC-SHA256 under
+// AUDIT_HMAC_KEY, or a plain SHA-256 without one
+func (a *auditLogger) sum(unsigned []byte) string {
+	if len(a.key) == 0 {
+		sum := sha256.Sum256(unsigned)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write(unsigned)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// adminActor names the caller of an admin endpoint without revealing credentials
+func adminActor(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return "basic:" + user
+	}
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return "token"
+	}
+	return "anonymous"
+}
+
+// auditSource returns the connection's remote address as the source of an
+// audited request. X-Forwarded-For is added to details as forwarded_for only
+// when the connection comes from TRUSTED_PROXIES; anyone else could forge it.
+func auditSource(r *http.Request, details map[string]interface{}) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" && fromTrustedProxy(r) {
+		details["forwarded_for"] = fwd
+	}
+	return r.RemoteAddr
+}
+
+// auditAdminCalls records calls to /admin/ endpoints and any state-changing
+// admin request; read-only /metrics and /debug/ scrapes are not audited
+func auditAdminCalls(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+		if readOnly && !strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := newStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		outcome := "success"
+		if rec.status >= 400 {
+			outcome = "failure"
+		}
+		details := map[string]interface{}{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"status": rec.status,
+		}
+		audit(r.Context(), "admin_request", adminActor(r), outcome, auditSource(r, details), details)
+	})
+}
@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import "os"
+
+// lockAuditFile is a no-op: without flock the file is only shared by a
+// binary upgrade, which these platforms do not support
+func lockAuditFile(f *os.File) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockAuditFile takes an exclusive lock on the audit file, shared with any
+// other process appending to it, such as the old or new process of a binary
+// upgrade
+func lockAuditFile(f *os.File) (unlock func(), err error) {
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		return nil, err
+	}
+	return func() { unix.Flock(int(f.Fd()), unix.LOCK_UN) }, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAuditLoggersShareFile interleaves two loggers on one file, as the old
+// and new process of a binary upgrade do, and checks the chain stays whole
+func TestAuditLoggersShareFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	t.Setenv("AUDIT_LOG_SINK", "file:"+path)
+	first, second := newAuditLogger(), newAuditLogger()
+	for _, a := range []*auditLogger{first, second, second, first} {
+		a.write(&auditRecord{Stream: "audit", Event: "test"})
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	prev, seq := strings.Repeat("0", 64), uint64(0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		seq++
+		if rec.Seq != seq || rec.PrevHash != prev {
+			t.Fatalf("record %d: seq %d, prev_hash %s; want seq %d, prev_hash %s", seq, rec.Seq, rec.PrevHash, seq, prev)
+		}
+		prev = rec.Hash
+	}
+	if seq != 4 {
+		t.Fatalf("read %d records, want 4", seq)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var authFailures metric.Int64Counter
+
+// initAuthMetrics creates the admin authentication failure counter
+func initAuthMetrics() error {
+	var err error
+	authFailures, err = meter.Int64Counter(
+		"admin_auth_failures_total",
+		metric.WithDescription("Rejected requests to admin, debug and metrics endpoints"),
+	)
+	return err
+}
+
+// adminCredentials holds the optional static token and basic auth pair
+type adminCredentials struct {
+	token    string
+	user     string
+	password string
+}
+
+func loadAdminCredentials() adminCredentials {
+	creds := adminCredentials{token: secrets.Get("ADMIN_TOKEN")}
+	if basic := secrets.Get("ADMIN_BASIC_AUTH"); basic != "" {
+		creds.user, creds.password, _ = strings.Cut(basic, ":")
+	}
+	return creds
+}
+
+func (c adminCredentials) enabled() bool {
+	return c.token != "" || c.user != ""
+}
+
+// check returns an empty reason when the request carries valid credentials
+func (c adminCredentials) check(r *http.Request) string {
+	if c.token != "" {
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			if subtle.ConstantTimeCompare([]byte(bearer), []byte(c.token)) == 1 {
+				return ""
+			}
+			return "invalid_token"
+		}
+	}
+
+	if c.user != "" {
+		if user, password, ok := r.BasicAuth(); ok {
+			userOK := subtle.ConstantTimeCompare([]byte(user), []byte(c.user)) == 1
+			passOK := subtle.ConstantTimeCompare([]byte(password), []byte(c.password)) == 1
+			if userOK && passOK {
+				return ""
+			}
+			return "invalid_basic_auth"
+		}
+	}
+
+	return "missing_credentials"
+}
+
+// requireAdminAuth protects a handler with the configured token or basic auth;
+// without credentials, or for a ROUTE_MIDDLEWARE group switched to -auth, it
+// only audits. Authorized calls and failures are both written to the audit
+// log.
+func requireAdminAuth(creds adminCredentials, next http.Handler) http.Handler {
+	next = auditAdminCalls(next)
+	if !creds.enabled() {
+		return next
+	}
+	protected := authenticate(creds, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if routeMiddleware(r, "auth", true) {
+			protected.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate rejects requests without valid credentials with a 401,
+// counting, logging and auditing the failure
+func authenticate(creds adminCredentials, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reason := creds.check(r)
+		if reason == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		authFailures.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("reason", reason),
+		))
+		logJSON(ctx, "WARN", "Admin authentication failed", map[string]interface{}{
+			"path":        r.URL.Path,
+			"reason":      reason,
+			"remote_addr": r.RemoteAddr,
+		})
+		details := map[string]interface{}{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"reason": reason,
+		}
+		audit(ctx, "auth_failure", adminActor(r), "denied", auditSource(r, details), details)
+
+		if creds.user != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="go-service admin"`)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(errorResponse{Error: "Unauthorized"})
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sensitiveJSONField matches string values of commonly sensitive JSON keys,
+// including in truncated payloads that no longer parse
+var sensitiveJSONField = regexp.MustCompile(`(?i)("(?:password|passwd|secret|token|access_token|refresh_token|api_key|apikey|authorization|credit_card|ssn)"\s*:\s*)"[^"]*"?`)
+
+// redactBody masks sensitive fields and known secret values in a captured body
+func redactBody(body []byte) string {
+	masked := sensitiveJSONField.ReplaceAll(body, []byte(`$1"`+redacted+`"`))
+	return secrets.Redact(string(masked))
+}
+
+// bodyCaptureConfig selects which routes and content types have bodies attached to spans
+type bodyCaptureConfig struct {
+	routes       map[string]bool
+	contentTypes map[string]bool
+	maxBytes     int
+}
+
+func loadBodyCaptureConfig() bodyCaptureConfig {
+	cfg := bodyCaptureConfig{
+		routes:       map[string]bool{},
+		contentTypes: map[string]bool{},
+		maxBytes:     envInt("BODY_CAPTURE_MAX_BYTES", 1024),
+	}
+	for _, route := range splitList(envString("BODY_CAPTURE_ROUTES", "")) {
+		cfg.routes[route] = true
+	}
+	for _, ct := range splitList(envString("BODY_CAPTURE_CONTENT_TYPES", "application/json,text/plain")) {
+		cfg.contentTypes[ct] = true
+	}
+	return cfg
+}
+
+func (c bodyCaptureConfig) captures(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && c.contentTypes[mediaType]
+}
+
+// bodyRecorder keeps the first maxBytes written to the response
+type bodyRecorder struct {
+	http.ResponseWriter
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *bodyRecorder) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+			b.truncated = true
+		} else {
+			b.buf.Write(p)
+		}
+	} else if len(p) > 0 {
+		b.truncated = true
+	}
+	return b.ResponseWriter.Write(p)
+}
+
+func (b *bodyRecorder) Flush() {
+	if f, ok := b.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (b *bodyRecorder) Unwrap() http.ResponseWriter {
+	return b.ResponseWriter
+}
+
+// captureBodies attaches truncated, redacted request and response bodies to the
+// span for routes listed in BODY_CAPTURE_ROUTES or in a ROUTE_MIDDLEWARE
+// group switched to +bodycapture; it is off by default
+func captureBodies(next http.Handler) http.Handler {
+	cfg := loadBodyCaptureConfig()
+	if (len(cfg.routes) == 0 && !middlewareGroupsEnable("bodycapture")) || cfg.maxBytes <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Capture pauses in protective mode
+		if !routeMiddleware(r, "bodycapture", cfg.routes[routeOf(r)]) || protectiveMode() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		span := trace.SpanFromContext(r.Context())
+
+		if r.Body != nil && cfg.captures(r.Header.Get("Content-Type")) {
+			head, err := io.ReadAll(io.LimitReader(r.Body, int64(cfg.maxBytes)+1))
+			if err == nil {
+				truncated := len(head) > cfg.maxBytes
+				// Hand the full body back to the handler
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+				if truncated {
+					head = head[:cfg.maxBytes]
+				}
+				span.SetAttributes(
+					attribute.String("http.request.body", redactBody(head)),
+					attribute.Bool("http.request.body.truncated", truncated),
+				)
+			}
+		}
+
+		rec := &bodyRecorder{ResponseWriter: w, max: cfg.maxBytes}
+		next.ServeHTTP(rec, r)
+
+		if rec.buf.Len() > 0 && cfg.captures(w.Header().Get("Content-Type")) {
+			span.SetAttributes(
+				attribute.String("http.response.body", redactBody(rec.buf.Bytes())),
+				attribute.Bool("http.response.body.truncated", rec.truncated),
+			)
+		}
+	})
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errBulkheadFull is returned when a dependency's bulkhead has no free slot
+var errBulkheadFull = errors.New("bulkhead full")
+
+var (
+	bulkheadRejections metric.Int64Counter
+	bulkheadWait       metric.Float64Histogram
+)
+
+// initBulkheadMetrics creates the per-dependency bulkhead instruments
+func initBulkheadMetrics() error {
+	var err error
+
+	bulkheadRejections, err = meter.Int64Counter(
+		"bulkhead_rejections_total",
+		metric.WithDescription("Calls rejected because the dependency's bulkhead was full"),
+	)
+	if err != nil {
+		return err
+	}
+
+	bulkheadWait, err = meter.Float64Histogram(
+		"bulkhead_wait_seconds",
+		metric.WithDescription("Time spent waiting for a bulkhead slot, by dependency and outcome"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	inUse, err := meter.Int64ObservableGauge(
+		"bulkhead_in_use",
+		metric.WithDescription("Bulkhead slots held by in-flight calls per dependency"),
+	)
+	if err != nil {
+		return err
+	}
+	capacity, err := meter.Int64ObservableGauge(
+		"bulkhead_capacity",
+		metric.WithDescription("Bulkhead size per dependency"),
+	)
+	if err != nil {
+		return err
+	}
+	utilization, err := meter.Float64ObservableGauge(
+		"bulkhead_utilization_ratio",
+		metric.WithDescription("Share of the bulkhead's slots in use per dependency"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, b := range bulkheads.list() {
+			attrs := metric.WithAttributes(attribute.String("dependency", b.name))
+			used := len(b.slots)
+			o.ObserveInt64(inUse, int64(used), attrs)
+			o.ObserveInt64(capacity, int64(cap(b.slots)), attrs)
+			o.ObserveFloat64(utilization, float64(used)/float64(cap(b.slots)), attrs)
+		}
+		return nil
+	}, inUse, capacity, utilization)
+	return err
+}
+
+// bulkhead caps concurrent calls to one dependency so a slow dependency can
+// only tie up its own slots, not every request goroutine
+type bulkhead struct {
+	name    string
+	slots   chan struct{}
+	maxWait time.Duration
+}
+
+// acquire takes a slot, waiting at most maxWait, and annotates the current
+// span with the bulkhead it went through
+func (b *bulkhead) acquire(ctx context.Context) (release func(), err error) {
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+	outcome := "acquired"
+	defer func() {
+		waited := time.Since(start)
+		bulkheadWait.Record(ctx, waited.Seconds(), metric.WithAttributes(
+			attribute.String("dependency", b.name),
+			attribute.String("outcome", outcome),
+		))
+		span.SetAttributes(
+			attribute.String("bulkhead.name", b.name),
+			attribute.Float64("bulkhead.wait_ms", float64(waited.Microseconds())/1000),
+			attribute.Int("bulkhead.in_use", len(b.slots)),
+		)
+		if errors.Is(err, errBulkheadFull) {
+			span.SetAttributes(attribute.Bool("bulkhead.rejected", true))
+			span.AddEvent("bulkhead_rejected", trace.WithAttributes(attribute.String("bulkhead.name", b.name)))
+			bulkheadRejections.Add(ctx, 1, metric.WithAttributes(attribute.String("dependency", b.name)))
+		}
+	}()
+
+	release = func() { <-b.slots }
+	select {
+	case b.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if b.maxWait <= 0 {
+		outcome = "rejected"
+		return nil, errBulkheadFull
+	}
+
+	timer := time.NewTimer(b.maxWait)
+	defer timer.Stop()
+	select {
+	case b.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		outcome = "rejected"
+		return nil, errBulkheadFull
+	case <-ctx.Done():
+		outcome = "canceled"
+		return nil, ctx.Err()
+	}
+}
+
+// bulkheadRegistry creates a bulkhead per dependency on first use, sized by
+// BULKHEAD_LIMITS ("search:9200=10,datastore=20") or BULKHEAD_DEFAULT_LIMIT
+type bulkheadRegistry struct {
+	mu           sync.Mutex
+	limits       map[string]int
+	defaultLimit int
+	maxWait      time.Duration
+	heads        map[string]*bulkhead
+}
+
+var bulkheads = newBulkheadRegistry()
+
+func newBulkheadRegistry() *bulkheadRegistry {
+	r := &bulkheadRegistry{
+		limits:       map[string]int{},
+		defaultLimit: envInt("BULKHEAD_DEFAULT_LIMIT", 0),
+		maxWait:      envDuration("BULKHEAD_MAX_WAIT", 0),
+		heads:        map[string]*bulkhead{},
+	}
+	for _, pair := range splitList(envString("BULKHEAD_LIMITS", "")) {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			r.limits[strings.TrimSpace(name)] = n
+		}
+	}
+	return r
+}
+
+// get returns the bulkhead for a dependency, or nil when it is unlimited
+func (r *bulkheadRegistry) get(name string) *bulkhead {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, ok := r.heads[name]; ok {
+		return b
+	}
+	limit, ok := r.limits[name]
+	if !ok {
+		limit = r.defaultLimit
+	}
+	var b *bulkhead
+	if limit > 0 {
+		b = &bulkhead{name: name, slots: make(chan struct{}, limit), maxWait: r.maxWait}
+	}
+	r.heads[name] = b
+	return b
+}
+
+func (r *bulkheadRegistry) list() []*bulkhead {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*bulkhead
+	for _, b := range r.heads {
+		if b != nil {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// bulkheadTransport holds a slot of the host's bulkhead from the request
+// until its response body is closed
+type bulkheadTransport struct {
+	base http.RoundTripper
+}
+
+func (t *bulkheadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := bulkheads.get(req.URL.Host)
+	if b == nil {
+		return t.base.RoundTrip(req)
+	}
+	release, err := b.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseOnClose frees a bulkhead slot once, when the body is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// bulkheadStore runs data store queries through the "datastore" bulkhead
+type bulkheadStore struct {
+	dataStore
+	bulkhead *bulkhead
+}
+
+// withBulkhead wraps s when a "datastore" bulkhead is configured
+func withBulkhead(s dataStore) dataStore {
+	if b := bulkheads.get("datastore"); b != nil {
+		return bulkheadStore{dataStore: s, bulkhead: b}
+	}
+	return s
+}
+
+func (s bulkheadStore) items(ctx context.Context, limit int) ([]dataItem, error) {
+	release, err := s.bulkhead.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return s.dataStore.items(ctx, limit)
+}
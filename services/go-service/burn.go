@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultBurnSeconds = 5
+	maxBurnSeconds     = 60
+)
+
+var (
+	burnActiveCores metric.Int64UpDownCounter
+	burnCoreSeconds metric.Float64Counter
+)
+
+// initBurnMetrics creates the instruments describing induced CPU load
+func initBurnMetrics() error {
+	var err error
+
+	burnActiveCores, err = meter.Int64UpDownCounter(
+		"cpu_burn_active_cores",
+		metric.WithDescription("Number of cores currently saturated by /burn"),
+	)
+	if err != nil {
+		return err
+	}
+
+	burnCoreSeconds, err = meter.Float64Counter(
+		"cpu_burn_core_seconds_total",
+		metric.WithDescription("Total CPU core-seconds induced by /burn"),
+		metric.WithUnit("s"),
+	)
+	return err
+}
+
+// parseBoundedInt reads an integer query parameter clamped to [1, max]
+func parseBoundedInt(r *http.Request, name string, def, max int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || v < 1 {
+		return def
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// spin keeps one core busy until the deadline passes or ctx is cancelled
+func spin(ctx context.Context, deadline time.Time) {
+	x := 0
+	for time.Now().Before(deadline) {
+		if ctx.Err() != nil {
+			return
+		}
+		for i := 0; i < 100000; i++ {
+			x += i * i
+		}
+	}
+	_ = x
+}
+
+// burnResponse is the body of GET /burn
+type burnResponse struct {
+	Seconds        int     `json:"seconds"`
+	Cores          int     `json:"cores"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+func burnHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ctx := r.Context()
+
+	seconds := parseBoundedInt(r, "seconds", defaultBurnSeconds, maxBurnSeconds)
+	cores := parseBoundedInt(r, "cores", 1, runtime.NumCPU())
+
+	ctx, span := tracer.Start(ctx, "cpu_burn")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("http.method", r.Method),
+		attribute.String("http.route", "/burn"),
+		attribute.Int("burn.seconds", seconds),
+		attribute.Int("burn.cores", cores),
+	)
+
+	logJSON(ctx, "WARN", "Starting CPU burn", map[string]interface{}{
+		"seconds": seconds,
+		"cores":   cores,
+	})
+
+	burnActiveCores.Add(ctx, int64(cores))
+	deadline := start.Add(time.Duration(seconds) * time.Second)
+
+	var wg sync.WaitGroup
+	for i := 0; i < cores; i++ {
+		wg.Add(1)
+		goWithCrashReport("burn_worker", func() {
+			defer wg.Done()
+			spin(ctx, deadline)
+		})
+	}
+	wg.Wait()
+
+	burnActiveCores.Add(ctx, -int64(cores))
+	elapsed := time.Since(start).Seconds()
+	burnCoreSeconds.Add(ctx, elapsed*float64(cores))
+
+	if err := ctx.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "burn interrupted")
+	}
+
+	logJSON(ctx, "INFO", "CPU burn finished", map[string]interface{}{
+		"elapsed_seconds": elapsed,
+		"cores":           cores,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(burnResponse{
+		Seconds:        seconds,
+		Cores:          cores,
+		ElapsedSeconds: elapsed,
+	})
+
+	countRequest(ctx, r.Method, "/burn")
+	observeRequestDuration(ctx, r.Method, "/burn", elapsed)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const canaryTrack = "canary"
+
+// deploymentTrack is this instance's release track: DEPLOYMENT_TRACK, or
+// "canary" when CANARY is true, otherwise "stable"
+var deploymentTrack = loadDeploymentTrack()
+
+func loadDeploymentTrack() string {
+	if track := os.Getenv("DEPLOYMENT_TRACK"); track != "" {
+		return track
+	}
+	if envBool("CANARY", false) {
+		return canaryTrack
+	}
+	return "stable"
+}
+
+var canaryRequests metric.Int64Counter
+
+// initCanaryMetrics creates the counter of requests that asked for the canary
+func initCanaryMetrics() error {
+	var err error
+	canaryRequests, err = meter.Int64Counter(
+		"canary_requests_total",
+		metric.WithDescription("Requests carrying the canary header, by how they were served"),
+	)
+	return err
+}
+
+// routeCanary labels requests that carry the canary header and, on a stable
+// instance with CANARY_UPSTREAM set, forwards them to the canary deployment
+func routeCanary(next http.Handler) http.Handler {
+	header := envString("CANARY_HEADER", "X-Canary")
+
+	var upstream *httputil.ReverseProxy
+	if target := os.Getenv("CANARY_UPSTREAM"); target != "" && deploymentTrack != canaryTrack {
+		u, err := url.Parse(target)
+		if err != nil {
+			logJSON(context.Background(), "ERROR", "Invalid CANARY_UPSTREAM", map[string]interface{}{"error": err.Error()})
+		} else {
+			upstream = httputil.NewSingleHostReverseProxy(u)
+			// Forwarded requests continue the trace on the canary
+			upstream.Transport = newInstrumentedTransport()
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		canary, _ := strconv.ParseBool(r.Header.Get(header))
+		if !canary {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		served := "local"
+		if upstream != nil {
+			served = "forwarded"
+		}
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.Bool("canary.requested", true),
+			attribute.String("canary.served", served),
+		)
+		canaryRequests.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("served", served),
+			attribute.String("track", deploymentTrack),
+		))
+
+		if upstream != nil {
+			upstream.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
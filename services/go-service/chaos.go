@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var chaosInjections metric.Int64Counter
+
+// initChaosMetrics creates the fault injection counter
+func initChaosMetrics() error {
+	var err error
+	chaosInjections, err = meter.Int64Counter(
+		"chaos_injections_total",
+		metric.WithDescription("Faults injected into requests, by endpoint, type (delay, error) and source"),
+	)
+	return err
+}
+
+// fault is what to inject into one request
+type fault struct {
+	source string
+	ruleID string
+	delay  time.Duration
+	status int
+}
+
+func (f fault) empty() bool {
+	return f.delay <= 0 && f.status == 0
+}
+
+// chaosHeaderFault reads x-chaos-delay-ms and x-chaos-fail. The fail header
+// takes a 4xx/5xx status, or any true value for a 500.
+func chaosHeaderFault(r *http.Request, maxDelay time.Duration) fault {
+	f := fault{source: "header"}
+	if ms, err := strconv.Atoi(r.Header.Get("X-Chaos-Delay-Ms")); err == nil && ms > 0 {
+		f.delay = time.Duration(ms) * time.Millisecond
+		if f.delay > maxDelay {
+			f.delay = maxDelay
+		}
+	}
+	if v := r.Header.Get("X-Chaos-Fail"); v != "" {
+		if status, err := strconv.Atoi(v); err == nil && status >= 400 && status <= 599 {
+			f.status = status
+		} else if fail, _ := strconv.ParseBool(v); fail {
+			f.status = http.StatusInternalServerError
+		}
+	}
+	return f
+}
+
+// chaosHeaderSettings are CHAOS_HEADERS and CHAOS_MAX_DELAY
+type chaosHeaderSettings struct {
+	enabled  bool
+	maxDelay time.Duration
+}
+
+// chaosHeaders starts from the environment; a config reload swaps it
+var chaosHeaders atomic.Pointer[chaosHeaderSettings]
+
+func init() {
+	configureChaosHeaders(envBool("CHAOS_HEADERS", false), envDuration("CHAOS_MAX_DELAY", 10*time.Second))
+}
+
+func configureChaosHeaders(enabled bool, maxDelay time.Duration) {
+	chaosHeaders.Store(&chaosHeaderSettings{enabled: enabled, maxDelay: maxDelay})
+}
+
+// injectFaults applies requested faults before the handler runs: the delay
+// first, then the error in place of the real response. Header faults are only
+// honoured with CHAOS_HEADERS=true and take precedence over /admin/faults rules.
+func injectFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var f fault
+		if settings := chaosHeaders.Load(); settings.enabled {
+			f = chaosHeaderFault(r, settings.maxDelay)
+		}
+		if f.empty() {
+			f, _ = faultRules.match(r, routeOf(r))
+		}
+		if f.empty() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if applyFault(w, r, f) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// applyFault records and injects f; it returns false when the request was
+// answered with the injected error or abandoned by the client
+func applyFault(w http.ResponseWriter, r *http.Request, f fault) bool {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	route := routeOf(r)
+	record := func(kind string) {
+		chaosInjections.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("endpoint", route),
+			attribute.String("type", kind),
+			attribute.String("source", f.source),
+		))
+	}
+
+	span.SetAttributes(attribute.Bool("chaos.injected", true), attribute.String("chaos.source", f.source))
+	if f.ruleID != "" {
+		span.SetAttributes(attribute.String("chaos.rule_id", f.ruleID))
+	}
+	logJSON(ctx, "INFO", "Injecting fault", map[string]interface{}{
+		"endpoint": route,
+		"source":   f.source,
+		"rule_id":  f.ruleID,
+		"delay_ms": f.delay.Milliseconds(),
+		"status":   f.status,
+	})
+
+	if f.delay > 0 {
+		record("delay")
+		span.SetAttributes(attribute.Int64("chaos.delay_ms", f.delay.Milliseconds()))
+		span.AddEvent("chaos_delay", trace.WithAttributes(attribute.Int64("delay_ms", f.delay.Milliseconds())))
+		timer := time.NewTimer(f.delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+
+	if f.status == 0 {
+		return true
+	}
+	record("error")
+	span.SetAttributes(attribute.Int("chaos.fail_status", f.status))
+	span.AddEvent("chaos_error", trace.WithAttributes(attribute.Int("status", f.status)))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(f.status)
+	json.NewEncoder(w).Encode(errorResponse{Error: "Injected fault"})
+	return false
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+// checkResult is one line of the preflight report
+type checkResult struct {
+	name   string
+	err    error
+	detail string
+}
+
+// runCheck validates the telemetry configuration and, unless -export=false,
+// pushes a test span and a metric export through the collector
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 5*time.Second, "Timeout for each network check")
+	export := fs.Bool("export", true, "Send a test span and metrics to the collector")
+	fs.Parse(args)
+
+	var results []checkResult
+	add := func(name string, err error, detail string) {
+		results = append(results, checkResult{name: name, err: err, detail: detail})
+	}
+
+	reachable := func(addr string) error {
+		conn, err := net.DialTimeout("tcp", addr, *timeout)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	if err := checkTelemetryProfile(); err != nil {
+		add("telemetry_profile", err, "")
+	} else if collectorless {
+		add("tempo_reachable", reachable(traceEndpoint()), traceEndpoint())
+		for _, backend := range [][2]string{{"mimir_reachable", mimirURL()}, {"loki_reachable", lokiPushURL()}} {
+			addr, err := urlHostPort(backend[1])
+			if err == nil {
+				err = reachable(addr)
+			}
+			add(backend[0], err, backend[1])
+		}
+	} else {
+		add("collector_reachable", reachable(traceEndpoint()), traceEndpoint())
+	}
+
+	headers := exportHeaders()
+	add("exporter_headers", nil, fmt.Sprintf("%d header(s)", len(headers)))
+
+	if v := os.Getenv("TRACE_SAMPLE_RATIO"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err == nil && (ratio < 0 || ratio > 1) {
+			err = fmt.Errorf("ratio %v outside [0, 1]", ratio)
+		}
+		add("trace_sample_ratio", err, v)
+	}
+
+	if os.Getenv("TLS_CERT_FILE") != "" {
+		certs, err := loadServerCertificates()
+		detail := ""
+		if certs != nil {
+			detail = "expires " + certs.expiry().Format(time.RFC3339)
+		}
+		add("tls_certificate", err, detail)
+	}
+
+	_, err := loadCORSPolicy()
+	add("cors_policy", err, "")
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		_, err := parseConfigFile(path)
+		add("config_file", err, path)
+	}
+
+	if *export {
+		results = append(results, checkExport(*timeout)...)
+	}
+
+	failed := 0
+	for _, r := range results {
+		status := "PASS"
+		detail := r.detail
+		if r.err != nil {
+			status = "FAIL"
+			failed++
+			detail = r.err.Error()
+		}
+		fmt.Printf("%-4s %-22s %s\n", status, r.name, detail)
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d of %d checks failed\n", failed, len(results))
+		return 1
+	}
+	return 0
+}
+
+// checkExport initializes the real pipelines and flushes a test span and the
+// current metrics, relying on the export trackers to confirm delivery
+func checkExport(timeout time.Duration) []checkResult {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	shutdown, err := initTelemetry(ctx)
+	if err != nil {
+		return []checkResult{{name: "telemetry_export", err: err}}
+	}
+	defer shutdown(context.Background())
+
+	_, span := tracer.Start(ctx, "telemetry_preflight")
+	sampled := span.SpanContext().IsSampled()
+	traceID := span.SpanContext().TraceID().String()
+	span.End()
+	heartbeats.Add(ctx, 1)
+
+	otel.GetTracerProvider().(flusher).ForceFlush(ctx)
+	otel.GetMeterProvider().(flusher).ForceFlush(ctx)
+
+	var results []checkResult
+	var traceErr, metricErr error
+	traceDetail := "trace_id " + traceID
+	if !sampled {
+		// A low TRACE_SAMPLE_RATIO can drop the test span; that is not a delivery failure
+		traceDetail = "skipped, test span not sampled"
+	} else if lastTraceExport.Load() == 0 {
+		traceErr = fmt.Errorf("test span was not accepted by %s", traceEndpoint())
+	}
+	if lastMetricExport.Load() == 0 {
+		metricErr = fmt.Errorf("metrics were not accepted by %s", metricEndpoint())
+	}
+	results = append(results,
+		checkResult{name: "trace_export", err: traceErr, detail: traceDetail},
+		checkResult{name: "metric_export", err: metricErr, detail: "heartbeat_total"},
+	)
+	return results
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// version is the service version reported in telemetry; override it at build
+// time with -ldflags "-X main.version=..."
+var version = "1.0.0"
+
+// subcommand is one mode of the go-service binary. Each one lives in its
+// own file of package main (serve in main.go, loadgen.go, check.go, ...)
+// rather than under cmd/<name>: serve, check, replay and version share the
+// telemetry setup, capture format and build info of the service, which a
+// cmd/ package could only reach once the service itself moved out of
+// package main. This table is the single place subcommands are registered.
+type subcommand struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var subcommands = []subcommand{
+	{"serve", "Run the HTTP service (default)", runServe},
+	{"supervise", "Run the HTTP service as several worker processes sharing its ports", runSupervise},
+	{"loadgen", "Send synthetic traffic to a running service", runLoadgen},
+	{"check", "Verify telemetry configuration and collector connectivity", runCheck},
+	{"replay", "Re-issue captured requests against a service", runReplay},
+	{"logverify", "Verify a service log line reaches Loki with its labels and trace ID", runLogverify},
+	{"version", "Print version and build information", runVersion},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: go-service <command> [flags]\n\nCommands:")
+	for _, c := range subcommands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'go-service <command> -h' for the flags of a command.")
+}
+
+func main() {
+	// No arguments keeps the container entrypoint serving as before
+	if len(os.Args) < 2 {
+		os.Exit(runServe(nil))
+	}
+
+	name, args := os.Args[1], os.Args[2:]
+	for _, c := range subcommands {
+		if c.name == name {
+			os.Exit(c.run(args))
+		}
+	}
+
+	if name != "-h" && name != "-help" && name != "--help" && name != "help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	}
+	usage()
+	os.Exit(2)
+}
+
+func runVersion(args []string) int {
+	fmt.Printf("go-service %s (%s, %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if buildInfo.Commit != "" {
+		fmt.Printf("vcs.revision: %s\n", buildInfo.Commit)
+	}
+	if buildInfo.CommitTime != "" {
+		fmt.Printf("vcs.time: %s\n", buildInfo.CommitTime)
+	}
+	fmt.Printf("vcs.modified: %t\n", buildInfo.Dirty)
+	if buildInfo.Builder != "" {
+		fmt.Printf("builder: %s\n", buildInfo.Builder)
+	}
+	return 0
+}
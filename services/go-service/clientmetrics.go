@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// overflowClient labels every client seen after the cardinality cap is reached
+const overflowClient = "other"
+
+var (
+	clientRequests metric.Int64Counter
+	clientDuration metric.Float64Histogram
+	clientOverflow metric.Int64Counter
+)
+
+// initClientMetrics creates the per-client instruments
+func initClientMetrics() error {
+	var err error
+
+	clientRequests, err = meter.Int64Counter(
+		"client_requests_total",
+		metric.WithDescription("Requests per hashed client identity"),
+	)
+	if err != nil {
+		return err
+	}
+
+	clientDuration, err = meter.Float64Histogram(
+		"client_request_duration_seconds",
+		metric.WithDescription("Request duration per hashed client identity"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	clientOverflow, err = meter.Int64Counter(
+		"client_metrics_overflow_total",
+		metric.WithDescription("Requests from clients beyond CLIENT_METRICS_MAX_CLIENTS, recorded as client=\"other\""),
+	)
+	return err
+}
+
+// clientLabeler derives a short, salted hash for a client so metrics never
+// carry raw API keys or addresses, and caps how many distinct hashes appear
+// in each export window
+type clientLabeler struct {
+	source    string
+	keyHeader string
+	keyPrefix int
+	salt      string
+	max       int
+	window    time.Duration
+
+	mu      sync.Mutex
+	seen    map[string]bool
+	resetAt time.Time
+}
+
+func newClientLabeler() *clientLabeler {
+	return &clientLabeler{
+		source:    envString("CLIENT_METRICS_IDENTITY", "ip"),
+		keyHeader: envString("CLIENT_METRICS_API_KEY_HEADER", "X-API-Key"),
+		keyPrefix: envInt("CLIENT_METRICS_API_KEY_PREFIX", 8),
+		salt:      secrets.Get("CLIENT_METRICS_SALT"),
+		max:       envInt("CLIENT_METRICS_MAX_CLIENTS", 100),
+		// The SDK's periodic reader reads the same variable
+		window: time.Duration(envInt("OTEL_METRIC_EXPORT_INTERVAL", 60000)) * time.Millisecond,
+		seen:   map[string]bool{},
+	}
+}
+
+// bucket returns the raw value identifying a client: an API key prefix or
+// the client's IPv4 /24 (IPv6 /48), so clients behind one subnet share a series
+func (c *clientLabeler) bucket(r *http.Request) string {
+	if c.source == "api_key" {
+		key := r.Header.Get(c.keyHeader)
+		if key == "" {
+			return "anonymous"
+		}
+		if len(key) > c.keyPrefix {
+			key = key[:c.keyPrefix]
+		}
+		return "key:" + key
+	}
+
+	ip := net.ParseIP(clientIP(r))
+	if ip == nil {
+		return "unknown"
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return "ip:" + v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return "ip:" + ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// label hashes the bucket and admits it only while under the cap; ok is false
+// when the client was folded into the overflow series. The admitted set is
+// cleared every export window, so clients that stop sending (or one-off
+// forged addresses) do not hold their slots for the life of the process.
+func (c *clientLabeler) label(r *http.Request) (label string, ok bool) {
+	sum := sha256.Sum256([]byte(c.salt + c.bucket(r)))
+	id := hex.EncodeToString(sum[:])[:12]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now := time.Now(); now.After(c.resetAt) {
+		clear(c.seen)
+		c.resetAt = now.Add(c.window)
+	}
+	if c.seen[id] {
+		return id, true
+	}
+	if len(c.seen) >= c.max {
+		return overflowClient, false
+	}
+	c.seen[id] = true
+	return id, true
+}
+
+// trackClients records request count and duration per hashed client when
+// CLIENT_METRICS is enabled
+func trackClients(next http.Handler) http.Handler {
+	if !envBool("CLIENT_METRICS", false) {
+		return next
+	}
+	clients := newClientLabeler()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if telemetryExcluded(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		ctx := r.Context()
+
+		client, ok := clients.label(r)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("client.hash", client))
+		if !ok {
+			clientOverflow.Add(ctx, 1)
+		}
+
+		next.ServeHTTP(w, r)
+
+		attrs := metric.WithAttributes(attribute.String("client", client))
+		clientRequests.Add(ctx, 1, attrs)
+		clientDuration.Record(ctx, time.Since(start).Seconds(), attrs)
+	})
+}
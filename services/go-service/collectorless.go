@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collectorless is the single-node profile, TELEMETRY_PROFILE=collectorless:
+// traces go straight to Tempo over OTLP/gRPC, metrics to Mimir's OTLP/HTTP
+// endpoint and logs to Loki's push API, so no collector has to run
+var collectorless = envString("TELEMETRY_PROFILE", "collector") == "collectorless"
+
+// checkTelemetryProfile rejects a TELEMETRY_PROFILE typo instead of quietly
+// exporting to a collector that is not there
+func checkTelemetryProfile() error {
+	switch profile := envString("TELEMETRY_PROFILE", "collector"); profile {
+	case "collector", "collectorless":
+		return nil
+	default:
+		return fmt.Errorf("TELEMETRY_PROFILE: unknown profile %q (want collector or collectorless)", profile)
+	}
+}
+
+// traceEndpoint is where spans are exported over OTLP/gRPC
+func traceEndpoint() string {
+	if collectorless {
+		return envString("TEMPO_OTLP_ENDPOINT", "tempo:4317")
+	}
+	return envString("OTEL_EXPORTER_OTLP_ENDPOINT", "otel-collector:4317")
+}
+
+// metricEndpoint is where metrics are exported, for messages and checks
+func metricEndpoint() string {
+	if collectorless {
+		return mimirURL()
+	}
+	return envString("OTEL_EXPORTER_OTLP_ENDPOINT", "otel-collector:4317")
+}
+
+func mimirURL() string {
+	return envString("MIMIR_OTLP_URL", "http://mimir:9009/otlp/v1/metrics")
+}
+
+func lokiPushURL() string {
+	return envString("LOKI_PUSH_URL", "http://loki:3100/loki/api/v1/push")
+}
+
+// exportHeaders are sent with every export. Without a collector to add it,
+// TELEMETRY_TENANT becomes the X-Scope-OrgID that Tempo, Mimir and Loki
+// use to pick the tenant.
+func exportHeaders() map[string]string {
+	headers := parseHeaders(secrets.Get("OTEL_EXPORTER_OTLP_HEADERS"))
+	if tenant := envString("TELEMETRY_TENANT", ""); collectorless && tenant != "" {
+		headers["X-Scope-OrgID"] = tenant
+	}
+	return headers
+}
+
+// urlHostPort is the host:port an http(s) URL connects to, for reachability checks
+func urlHostPort(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443"), nil
+	}
+	return net.JoinHostPort(u.Hostname(), "80"), nil
+}
+
+// mimirExporter sends metrics to Mimir's OTLP/HTTP endpoint as gzipped
+// protobuf. The SDK only ships the gRPC exporter here, which Mimir does not
+// accept.
+type mimirExporter struct {
+	url         string
+	headers     map[string]string
+	temporality sdkmetric.TemporalitySelector
+	client      *http.Client
+}
+
+func newMimirExporter(temporality sdkmetric.TemporalitySelector) *mimirExporter {
+	return &mimirExporter{
+		url:         mimirURL(),
+		headers:     exportHeaders(),
+		temporality: temporality,
+		// Not instrumented: an export must not produce spans of its own
+		client: &http.Client{Timeout: envDuration("MIMIR_TIMEOUT", 10*time.Second)},
+	}
+}
+
+func (e *mimirExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return e.temporality(kind)
+}
+
+func (e *mimirExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+func (e *mimirExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	payload, err := proto.Marshal(&collectormetrics.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{otlpResourceMetrics(rm)},
+	})
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write(payload)
+	zw.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("mimir returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (e *mimirExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *mimirExporter) Shutdown(context.Context) error { return nil }
+
+// otlpResourceMetrics converts one SDK collection to its OTLP message
+func otlpResourceMetrics(rm *metricdata.ResourceMetrics) *metricspb.ResourceMetrics {
+	out := &metricspb.ResourceMetrics{
+		Resource:  &resourcepb.Resource{Attributes: otlpAttributes(rm.Resource.Attributes())},
+		SchemaUrl: rm.Resource.SchemaURL(),
+	}
+	for _, sm := range rm.ScopeMetrics {
+		scope := &metricspb.ScopeMetrics{
+			Scope:     &commonpb.InstrumentationScope{Name: sm.Scope.Name, Version: sm.Scope.Version},
+			SchemaUrl: sm.Scope.SchemaURL,
+		}
+		for _, m := range sm.Metrics {
+			if pm := otlpMetric(m); pm != nil {
+				scope.Metrics = append(scope.Metrics, pm)
+			}
+		}
+		out.ScopeMetrics = append(out.ScopeMetrics, scope)
+	}
+	return out
+}
+
+func otlpMetric(m metricdata.Metrics) *metricspb.Metric {
+	out := &metricspb.Metric{Name: m.Name, Description: m.Description, Unit: m.Unit}
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[int64]:
+		out.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: otlpNumberPoints(data.DataPoints)}}
+	case metricdata.Gauge[float64]:
+		out.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: otlpNumberPoints(data.DataPoints)}}
+	case metricdata.Sum[int64]:
+		out.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			DataPoints:             otlpNumberPoints(data.DataPoints),
+			AggregationTemporality: otlpTemporality(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+		}}
+	case metricdata.Sum[float64]:
+		out.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			DataPoints:             otlpNumberPoints(data.DataPoints),
+			AggregationTemporality: otlpTemporality(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+		}}
+	case metricdata.Histogram[int64]:
+		out.Data = &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			DataPoints:             otlpHistogramPoints(data.DataPoints),
+			AggregationTemporality: otlpTemporality(data.Temporality),
+		}}
+	case metricdata.Histogram[float64]:
+		out.Data = &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			DataPoints:             otlpHistogramPoints(data.DataPoints),
+			AggregationTemporality: otlpTemporality(data.Temporality),
+		}}
+	case metricdata.ExponentialHistogram[int64]:
+		out.Data = &metricspb.Metric_ExponentialHistogram{ExponentialHistogram: &metricspb.ExponentialHistogram{
+			DataPoints:             otlpExponentialPoints(data.DataPoints),
+			AggregationTemporality: otlpTemporality(data.Temporality),
+		}}
+	case metricdata.ExponentialHistogram[float64]:
+		out.Data = &metricspb.Metric_ExponentialHistogram{ExponentialHistogram: &metricspb.ExponentialHistogram{
+			DataPoints:             otlpExponentialPoints(data.DataPoints),
+			AggregationTemporality: otlpTemporality(data.Temporality),
+		}}
+	case metricdata.Summary:
+		out.Data = &metricspb.Metric_Summary{Summary: &metricspb.Summary{DataPoints: otlpSummaryPoints(data.DataPoints)}}
+	default:
+		return nil
+	}
+	return out
+}
+
+func otlpTemporality(t metricdata.Temporality) metricspb.AggregationTemporality {
+	if t == metricdata.DeltaTemporality {
+		return metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	}
+	return metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+}
+
+func otlpNumberPoints[N int64 | float64](points []metricdata.DataPoint[N]) []*metricspb.NumberDataPoint {
+	out := make([]*metricspb.NumberDataPoint, 0, len(points))
+	for _, p := range points {
+		dp := &metricspb.NumberDataPoint{
+			Attributes:        otlpAttributes(p.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(p.StartTime),
+			TimeUnixNano:      unixNano(p.Time),
+			Exemplars:         otlpExemplars(p.Exemplars),
+		}
+		switch v := any(p.Value).(type) {
+		case int64:
+			dp.Value = &metricspb.NumberDataPoint_AsInt{AsInt: v}
+		case float64:
+			dp.Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: v}
+		}
+		out = append(out, dp)
+	}
+	return out
+}
+
+func otlpHistogramPoints[N int64 | float64](points []metricdata.HistogramDataPoint[N]) []*metricspb.HistogramDataPoint {
+	out := make([]*metricspb.HistogramDataPoint, 0, len(points))
+	for _, p := range points {
+		dp := &metricspb.HistogramDataPoint{
+			Attributes:        otlpAttributes(p.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(p.StartTime),
+			TimeUnixNano:      unixNano(p.Time),
+			Count:             p.Count,
+			Sum:               proto.Float64(float64(p.Sum)),
+			BucketCounts:      p.BucketCounts,
+			ExplicitBounds:    p.Bounds,
+			Exemplars:         otlpExemplars(p.Exemplars),
+		}
+		if v, ok := p.Min.Value(); ok {
+			dp.Min = proto.Float64(float64(v))
+		}
+		if v, ok := p.Max.Value(); ok {
+			dp.Max = proto.Float64(float64(v))
+		}
+		out = append(out, dp)
+	}
+	return out
+}
+
+func otlpExponentialPoints[N int64 | float64](points []metricdata.ExponentialHistogramDataPoint[N]) []*metricspb.ExponentialHistogramDataPoint {
+	out := make([]*metricspb.ExponentialHistogramDataPoint, 0, len(points))
+	for _, p := range points {
+		dp := &metricspb.ExponentialHistogramDataPoint{
+			Attributes:        otlpAttributes(p.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(p.StartTime),
+			TimeUnixNano:      unixNano(p.Time),
+			Count:             p.Count,
+			Sum:               proto.Float64(float64(p.Sum)),
+			Scale:             p.Scale,
+			ZeroCount:         p.ZeroCount,
+			ZeroThreshold:     p.ZeroThreshold,
+			Positive: &metricspb.ExponentialHistogramDataPoint_Buckets{
+				Offset:       p.PositiveBucket.Offset,
+				BucketCounts: p.PositiveBucket.Counts,
+			},
+			Negative: &metricspb.ExponentialHistogramDataPoint_Buckets{
+				Offset:       p.NegativeBucket.Offset,
+				BucketCounts: p.NegativeBucket.Counts,
+			},
+			Exemplars: otlpExemplars(p.Exemplars),
+		}
+		if v, ok := p.Min.Value(); ok {
+			dp.Min = proto.Float64(float64(v))
+		}
+		if v, ok := p.Max.Value(); ok {
+			dp.Max = proto.Float64(float64(v))
+		}
+		out = append(out, dp)
+	}
+	return out
+}
+
+func otlpSummaryPoints(points []metricdata.SummaryDataPoint) []*metricspb.SummaryDataPoint {
+	out := make([]*metricspb.SummaryDataPoint, 0, len(points))
+	for _, p := range points {
+		dp := &metricspb.SummaryDataPoint{
+			Attributes:        otlpAttributes(p.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(p.StartTime),
+			TimeUnixNano:      unixNano(p.Time),
+			Count:             p.Count,
+			Sum:               p.Sum,
+		}
+		for _, q := range p.QuantileValues {
+			dp.QuantileValues = append(dp.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{Quantile: q.Quantile, Value: q.Value})
+		}
+		out = append(out, dp)
+	}
+	return out
+}
+
+// otlpExemplars keeps the trace links Mimir stores with each series
+func otlpExemplars[N int64 | float64](exemplars []metricdata.Exemplar[N]) []*metricspb.Exemplar {
+	var out []*metricspb.Exemplar
+	for _, e := range exemplars {
+		ex := &metricspb.Exemplar{
+			FilteredAttributes: otlpAttributes(e.FilteredAttributes),
+			TimeUnixNano:       unixNano(e.Time),
+			SpanId:             e.SpanID,
+			TraceId:            e.TraceID,
+		}
+		switch v := any(e.Value).(type) {
+		case int64:
+			ex.Value = &metricspb.Exemplar_AsInt{AsInt: v}
+		case float64:
+			ex.Value = &metricspb.Exemplar_AsDouble{AsDouble: v}
+		}
+		out = append(out, ex)
+	}
+	return out
+}
+
+func otlpAttributes(attrs []attribute.KeyValue) []*commonpb.KeyValue {
+	out := make([]*commonpb.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		out = append(out, &commonpb.KeyValue{Key: string(kv.Key), Value: otlpValue(kv.Value)})
+	}
+	return out
+}
+
+func otlpValue(v attribute.Value) *commonpb.AnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.AsBool()}}
+	case attribute.INT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.AsInt64()}}
+	case attribute.FLOAT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}}
+	case attribute.BOOLSLICE, attribute.INT64SLICE, attribute.FLOAT64SLICE, attribute.STRINGSLICE:
+		var values []*commonpb.AnyValue
+		switch v.Type() {
+		case attribute.BOOLSLICE:
+			for _, b := range v.AsBoolSlice() {
+				values = append(values, otlpValue(attribute.BoolValue(b)))
+			}
+		case attribute.INT64SLICE:
+			for _, i := range v.AsInt64Slice() {
+				values = append(values, otlpValue(attribute.Int64Value(i)))
+			}
+		case attribute.FLOAT64SLICE:
+			for _, f := range v.AsFloat64Slice() {
+				values = append(values, otlpValue(attribute.Float64Value(f)))
+			}
+		default:
+			for _, s := range v.AsStringSlice() {
+				values = append(values, otlpValue(attribute.StringValue(s)))
+			}
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	default:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Emit()}}
+	}
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// lokiEntry is one log line waiting to be pushed
+type lokiEntry struct {
+	time  time.Time
+	level string
+	line  string
+}
+
+// lokiPusher tees the service's log output to Loki's push API in batches,
+// one stream per level. Writes only enqueue; a full queue drops lines
+// rather than blocking the caller, and stderr still gets every line.
+type lokiPusher struct {
+	url           string
+	headers       map[string]string
+	labels        map[string]string
+	batchSize     int
+	flushInterval time.Duration
+	queue         chan lokiEntry
+	client        *http.Client
+	stop          chan struct{}
+	done          chan struct{}
+}
+
+// newLokiPusher returns nil outside the collectorless profile
+func newLokiPusher() *lokiPusher {
+	if !collectorless {
+		return nil
+	}
+	labels := map[string]string{
+		"service_name":           "go-service",
+		"deployment_environment": deploymentEnvironment,
+	}
+	if workerID != "" {
+		labels["worker_id"] = workerID
+	}
+	return &lokiPusher{
+		url:           lokiPushURL(),
+		headers:       exportHeaders(),
+		labels:        labels,
+		batchSize:     envInt("LOKI_BATCH_SIZE", 500),
+		flushInterval: envDuration("LOKI_FLUSH_INTERVAL", time.Second),
+		queue:         make(chan lokiEntry, envInt("LOKI_QUEUE_SIZE", 10000)),
+		// Not instrumented: pushing a log line must not log or trace
+		client: &http.Client{Timeout: envDuration("LOKI_TIMEOUT", 10*time.Second)},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// levelField finds the level logJSON wrote, without decoding the line
+var levelField = []byte(`"level":"`)
+
+// Write queues one line from the log package, which reuses p afterwards
+func (l *lokiPusher) Write(p []byte) (int, error) {
+	line := bytes.TrimRight(p, "\n")
+	level := "info"
+	// Drop the log package's date prefix so the line is logJSON's JSON
+	if i := bytes.IndexByte(line, '{'); i >= 0 {
+		if j := bytes.Index(line, levelField); j > i {
+			rest := line[j+len(levelField):]
+			if k := bytes.IndexByte(rest, '"'); k > 0 {
+				level = strings.ToLower(string(rest[:k]))
+				line = line[i:]
+			}
+		}
+	}
+	select {
+	case l.queue <- lokiEntry{time: time.Now(), level: level, line: string(line)}:
+	default:
+		recordTelemetryDrop("logs", "queue_full", 1)
+	}
+	return len(p), nil
+}
+
+// run pushes batches until close, then pushes what is still queued
+func (l *lokiPusher) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+	batch := make([]lokiEntry, 0, l.batchSize)
+	for {
+		select {
+		case e := <-l.queue:
+			batch = append(batch, e)
+			if len(batch) >= l.batchSize {
+				l.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				l.flush(batch)
+				batch = batch[:0]
+			}
+		case <-l.stop:
+		drain:
+			for {
+				select {
+				case e := <-l.queue:
+					batch = append(batch, e)
+				default:
+					break drain
+				}
+			}
+			if len(batch) > 0 {
+				l.flush(batch)
+			}
+			return
+		}
+	}
+}
+
+// close pushes the remaining lines and waits for run to return
+func (l *lokiPusher) close() {
+	close(l.stop)
+	<-l.done
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// flush pushes one batch. A failed push is reported on stderr only, since a
+// logged error would come back through this pusher.
+func (l *lokiPusher) flush(batch []lokiEntry) {
+	streams := map[string]*lokiStream{}
+	var order []string
+	for _, e := range batch {
+		s, ok := streams[e.level]
+		if !ok {
+			labels := make(map[string]string, len(l.labels)+1)
+			for k, v := range l.labels {
+				labels[k] = v
+			}
+			labels["level"] = e.level
+			s = &lokiStream{Stream: labels}
+			streams[e.level] = s
+			order = append(order, e.level)
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(e.time.UnixNano(), 10), e.line})
+	}
+	push := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, level := range order {
+		push.Streams = append(push.Streams, streams[level])
+	}
+	body, _ := json.Marshal(push)
+
+	if err := l.post(body); err != nil {
+		recordTelemetryDrop("logs", "export_failed", len(batch))
+		fmt.Fprintf(os.Stderr, "loki push of %d lines failed: %v\n", len(batch), err)
+	}
+}
+
+func (l *lokiPusher) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, l.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range l.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("loki returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envString returns the value of an environment variable or a default
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt returns an integer environment variable or a default
+func envInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envFloat returns a float environment variable or a default
+func envFloat(key string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envBool returns a boolean environment variable or a default
+func envBool(key string, def bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envDuration returns a duration environment variable (e.g. "250ms") or a default
+func envDuration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// routeDurations parses per-route durations such as "/data=200ms,/burn=10s"
+func routeDurations(value string) map[string]time.Duration {
+	durations := map[string]time.Duration{}
+	for _, pair := range splitList(value) {
+		route, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if d, err := time.ParseDuration(strings.TrimSpace(v)); err == nil {
+			durations[strings.TrimSpace(route)] = d
+		}
+	}
+	return durations
+}
+
+// keyValue is one "key=value" entry of a list setting
+type keyValue struct {
+	key, value string
+}
+
+// keyValues parses "key=value" lists such as "a=1,b=2" in order, skipping
+// entries without "="
+func keyValues(value string) []keyValue {
+	var pairs []keyValue
+	for _, pair := range splitList(value) {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		pairs = append(pairs, keyValue{strings.TrimSpace(k), strings.TrimSpace(v)})
+	}
+	return pairs
+}
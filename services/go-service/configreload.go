@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var configReloads metric.Int64Counter
+
+// initConfigReloadMetrics creates the reload outcome counter
+func initConfigReloadMetrics() error {
+	var err error
+	configReloads, err = meter.Int64Counter(
+		"config_reloads_total",
+		metric.WithDescription("Configuration reload attempts by trigger and result"),
+	)
+	return err
+}
+
+// reloadableKeys are the settings that can change without a restart; any
+// other key in CONFIG_FILE is reported and ignored until the next start
+var reloadableKeys = map[string]bool{
+	"LOG_LEVEL":                 true,
+	"TRACE_SAMPLE_RATIO":        true,
+	"TRACE_ROUTE_SAMPLE_RATIOS": true,
+	"MAX_IN_FLIGHT":             true,
+	"MAX_QUEUE_WAIT":            true,
+	"DEPLOY_MARKER":             true,
+	"CHAOS_HEADERS":             true,
+	"CHAOS_MAX_DELAY":           true,
+}
+
+// configReloadDebounce lets a burst of writes to the file settle into one
+// reload, so a file being written is not read half-way
+const configReloadDebounce = 100 * time.Millisecond
+
+// configReloader applies CONFIG_FILE (KEY=value lines, as in an env file) on
+// top of the environment whenever the file changes or on SIGHUP
+type configReloader struct {
+	path string
+
+	mu      sync.Mutex
+	info    os.FileInfo
+	applied map[string]string
+}
+
+// newConfigReloader returns nil when CONFIG_FILE is unset
+func newConfigReloader() *configReloader {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return nil
+	}
+	return &configReloader{path: path, applied: map[string]string{}}
+}
+
+// parseConfigFile reads KEY=value lines, skipping blanks and # comments
+func parseConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", path, line)
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return values, scanner.Err()
+}
+
+// setting returns the file value for key, falling back to the environment
+// so that removing a line from the file restores the startup value
+func setting(file map[string]string, key string) string {
+	if v, ok := file[key]; ok {
+		return v
+	}
+	return os.Getenv(key)
+}
+
+// apply validates every reloadable setting before changing any of them
+func (c *configReloader) apply(file map[string]string) (changed, ignored []string, err error) {
+	ratio := 1.0
+	if v := setting(file, "TRACE_SAMPLE_RATIO"); v != "" {
+		if ratio, err = strconv.ParseFloat(v, 64); err != nil || ratio < 0 || ratio > 1 {
+			return nil, nil, fmt.Errorf("invalid TRACE_SAMPLE_RATIO %q", v)
+		}
+	}
+	level := setting(file, "LOG_LEVEL")
+	if level == "" {
+		level = "INFO"
+	}
+	if _, ok := logLevels[strings.ToUpper(level)]; !ok {
+		return nil, nil, fmt.Errorf("invalid LOG_LEVEL %q", level)
+	}
+	maxInFlight := 0
+	if v := setting(file, "MAX_IN_FLIGHT"); v != "" {
+		if maxInFlight, err = strconv.Atoi(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid MAX_IN_FLIGHT %q", v)
+		}
+	}
+	maxWait := 100 * time.Millisecond
+	if v := setting(file, "MAX_QUEUE_WAIT"); v != "" {
+		if maxWait, err = time.ParseDuration(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid MAX_QUEUE_WAIT %q", v)
+		}
+	}
+	chaosEnabled := false
+	if v := setting(file, "CHAOS_HEADERS"); v != "" {
+		if chaosEnabled, err = strconv.ParseBool(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid CHAOS_HEADERS %q", v)
+		}
+	}
+	chaosMaxDelay := 10 * time.Second
+	if v := setting(file, "CHAOS_MAX_DELAY"); v != "" {
+		if chaosMaxDelay, err = time.ParseDuration(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid CHAOS_MAX_DELAY %q", v)
+		}
+	}
+
+	setLogLevel(level)
+	traceSampler.configure(ratio, setting(file, "TRACE_ROUTE_SAMPLE_RATIOS"))
+	if limiter != nil {
+		limiter.reconfigure(maxInFlight, maxWait)
+	}
+	configureChaosHeaders(chaosEnabled, chaosMaxDelay)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range reloadableKeys {
+		if v := setting(file, key); v != c.applied[key] {
+			changed = append(changed, key)
+			c.applied[key] = v
+		}
+	}
+	for key := range file {
+		if !reloadableKeys[key] {
+			ignored = append(ignored, key)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(ignored)
+	return changed, ignored, nil
+}
+
+// reload reads the file and applies it inside a config_reload span
+func (c *configReloader) reload(ctx context.Context, trigger string) {
+	ctx, span := tracer.Start(ctx, "config_reload")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("config.file", c.path),
+		attribute.String("config.trigger", trigger),
+	)
+
+	fields := map[string]interface{}{"trigger": trigger, "config_file": c.path}
+	result := "success"
+
+	file, err := parseConfigFile(c.path)
+	var changed, ignored []string
+	if err == nil {
+		changed, ignored, err = c.apply(file)
+	}
+	if err != nil {
+		result = "failure"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "config reload failed")
+		fields["error"] = err.Error()
+		logJSON(ctx, "ERROR", "Configuration reload failed", fields)
+	} else {
+		span.SetAttributes(
+			attribute.StringSlice("config.changed", changed),
+			attribute.StringSlice("config.ignored", ignored),
+		)
+		fields["changed"] = changed
+		if len(ignored) > 0 {
+			fields["requires_restart"] = ignored
+		}
+		logJSON(ctx, "INFO", "Configuration reloaded", fields)
+		if annotations != nil {
+			annotations.deployMarker(ctx, setting(file, "DEPLOY_MARKER"))
+		}
+	}
+
+	configReloads.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("trigger", trigger),
+		attribute.String("result", result),
+	))
+	audit(ctx, "config_reload", "system", result, trigger, fields)
+}
+
+// modified reports whether the file on disk differs from the one last
+// reloaded: another file renamed over it, or a new modification time or size
+func (c *configReloader) modified() bool {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.info != nil && os.SameFile(info, c.info) && info.ModTime().Equal(c.info.ModTime()) && info.Size() == c.info.Size() {
+		return false
+	}
+	c.info = info
+	return true
+}
+
+// watch applies the file at startup, then on SIGHUP and whenever it changes.
+// The directory is watched rather than the file, so editors and config
+// management that write a new file and rename it over the old one, and
+// Kubernetes ConfigMap volumes that swap a symlink, are seen too.
+func (c *configReloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var (
+		events chan fsnotify.Event
+		errs   chan error
+	)
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = watcher.Add(filepath.Dir(c.path)); err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		logJSON(ctx, "ERROR", "Failed to watch the config file, reloading on SIGHUP only", map[string]interface{}{
+			"config_file": c.path,
+			"error":       err.Error(),
+		})
+	} else {
+		defer watcher.Close()
+		events, errs = watcher.Events, watcher.Errors
+	}
+
+	c.modified()
+	c.reload(ctx, "startup")
+
+	settle := time.NewTimer(configReloadDebounce)
+	settle.Stop()
+	defer settle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			c.modified()
+			c.reload(ctx, "sighup")
+		case <-events:
+			// Events name whichever directory entry changed, which for a
+			// symlink swap is not the file, so any of them is checked
+			settle.Reset(configReloadDebounce)
+		case err := <-errs:
+			logJSON(ctx, "WARN", "Config file watch error", map[string]interface{}{
+				"config_file": c.path,
+				"error":       err.Error(),
+			})
+		case <-settle.C:
+			if c.modified() {
+				c.reload(ctx, "file_change")
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	connsOpened  metric.Int64Counter
+	connsClosed  metric.Int64Counter
+	connsAcquire metric.Int64Counter
+)
+
+// initConnPoolMetrics creates the outbound connection pool instruments
+func initConnPoolMetrics() error {
+	var err error
+
+	connsOpened, err = meter.Int64Counter(
+		"http_client_connections_opened_total",
+		metric.WithDescription("Outbound connections dialed, by host"),
+	)
+	if err != nil {
+		return err
+	}
+
+	connsClosed, err = meter.Int64Counter(
+		"http_client_connections_closed_total",
+		metric.WithDescription("Outbound connections closed, by host"),
+	)
+	if err != nil {
+		return err
+	}
+
+	connsAcquire, err = meter.Int64Counter(
+		"http_client_connection_acquisitions_total",
+		metric.WithDescription("Connections handed to outbound requests, by host and whether they were reused from the pool"),
+	)
+	if err != nil {
+		return err
+	}
+
+	conns, err := meter.Int64ObservableGauge(
+		"http_client_connections",
+		metric.WithDescription("Open outbound connections by host and state (active, idle)"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for host, s := range connPool.snapshot() {
+			o.ObserveInt64(conns, s.active, metric.WithAttributes(attribute.String("host", host), attribute.String("state", "active")))
+			o.ObserveInt64(conns, s.idle(), metric.WithAttributes(attribute.String("host", host), attribute.String("state", "idle")))
+		}
+		return nil
+	}, conns)
+	return err
+}
+
+// hostConns counts the connections to one host; idle is whatever is open but
+// not handed to a request
+type hostConns struct {
+	open   int64
+	active int64
+}
+
+func (h hostConns) idle() int64 {
+	if idle := h.open - h.active; idle > 0 {
+		return idle
+	}
+	return 0
+}
+
+// connPoolStats tracks outbound connections per dialed host:port, since
+// http.Transport does not expose its pool
+type connPoolStats struct {
+	mu    sync.Mutex
+	hosts map[string]*hostConns
+}
+
+var connPool = &connPoolStats{hosts: map[string]*hostConns{}}
+
+func (p *connPoolStats) add(host string, open, active int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.hosts[host]
+	if !ok {
+		h = &hostConns{}
+		p.hosts[host] = h
+	}
+	h.open += open
+	h.active += active
+}
+
+func (p *connPoolStats) snapshot() map[string]hostConns {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[string]hostConns, len(p.hosts))
+	for host, h := range p.hosts {
+		out[host] = *h
+	}
+	return out
+}
+
+// countedConn reports its close to the pool stats exactly once
+type countedConn struct {
+	net.Conn
+	host string
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		connPool.add(c.host, -1, 0)
+		connsClosed.Add(context.Background(), 1, metric.WithAttributes(attribute.String("host", c.host)))
+	})
+	return c.Conn.Close()
+}
+
+// outboundTransport is the pool shared by instrumented clients; its dialer
+// counts connections as they are opened and closed
+var outboundTransport = newOutboundTransport()
+
+func newOutboundTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dial := t.DialContext
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		connPool.add(addr, 1, 0)
+		connsOpened.Add(ctx, 1, metric.WithAttributes(attribute.String("host", addr)))
+		return &countedConn{Conn: conn, host: addr}, nil
+	}
+	return t
+}
+
+// poolTrackingTransport marks a connection active from the moment a request
+// gets it until the response body is closed
+type poolTrackingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *poolTrackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := dialAddr(req)
+	var acquired bool
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			acquired = true
+			connPool.add(host, 0, 1)
+			connsAcquire.Add(req.Context(), 1, metric.WithAttributes(
+				attribute.String("host", host),
+				attribute.Bool("reused", info.Reused),
+			))
+		},
+	})
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if !acquired {
+		return resp, err
+	}
+	// Upgraded connections leave the pool, and the proxy needs the writable body
+	if err != nil || resp.StatusCode == http.StatusSwitchingProtocols {
+		connPool.add(host, 0, -1)
+		return resp, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { connPool.add(host, 0, -1) }}
+	return resp, nil
+}
+
+// releasingBody returns the connection to the idle count when the body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
+
+// dialAddr returns the host:port the transport dials for req, matching the
+// address seen by the dialer
+func dialAddr(req *http.Request) string {
+	host := req.URL.Host
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	if req.URL.Scheme == "https" {
+		return net.JoinHostPort(host, "443")
+	}
+	return net.JoinHostPort(host, "80")
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newInstrumentedTransport returns the transport used for outbound calls: a
+// client span per request with connection phase timings attached to it, over
+// the shared pool whose connections are counted, a per-host bulkhead and
+// optional hedging with a client span per attempt
+func newInstrumentedTransport() http.RoundTripper {
+	return newHedgingTransport(&bulkheadTransport{
+		base: otelhttp.NewTransport(&connTimingTransport{base: &poolTrackingTransport{base: outboundTransport}}),
+	})
+}
+
+// connTimingTransport sits under the otelhttp transport so the request
+// context already holds the client span when the httptrace hooks fire
+type connTimingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *connTimingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timing := &connTiming{span: trace.SpanFromContext(req.Context()), start: time.Now()}
+	ctx := httptrace.WithClientTrace(req.Context(), timing.clientTrace())
+	return t.base.RoundTrip(req.WithContext(ctx))
+}
+
+// connTiming turns httptrace callbacks into span events and phase duration
+// attributes. Dials run on their own goroutines, hence the mutex.
+type connTiming struct {
+	span  trace.Span
+	start time.Time
+
+	mu           sync.Mutex
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+}
+
+// phase records a completed phase as a span event and a "<name>_ms" attribute
+func (c *connTiming) phase(name string, started time.Time, err error, attrs ...attribute.KeyValue) {
+	if started.IsZero() {
+		return
+	}
+	ms := float64(time.Since(started).Microseconds()) / 1000
+	attrs = append(attrs, attribute.Float64("duration_ms", ms))
+	if err != nil {
+		attrs = append(attrs, attribute.String("error", err.Error()))
+		c.span.SetStatus(codes.Error, name+" failed")
+	}
+	c.span.AddEvent(name+"_done", trace.WithAttributes(attrs...))
+	c.span.SetAttributes(attribute.Float64("http.client."+name+"_ms", ms))
+}
+
+func (c *connTiming) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c.span.SetAttributes(
+				attribute.Bool("http.client.conn_reused", info.Reused),
+				attribute.Bool("http.client.conn_was_idle", info.WasIdle),
+			)
+			if info.WasIdle {
+				c.span.SetAttributes(attribute.Float64("http.client.conn_idle_ms", float64(info.IdleTime.Microseconds())/1000))
+			}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			c.mu.Lock()
+			c.dnsStart = time.Now()
+			c.mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.phase("dns", c.dnsStart, info.Err, attribute.Int("addresses", len(info.Addrs)))
+		},
+		ConnectStart: func(network, addr string) {
+			c.mu.Lock()
+			// With several addresses only the first attempt's start is kept
+			if c.connectStart.IsZero() {
+				c.connectStart = time.Now()
+			}
+			c.mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.phase("connect", c.connectStart, err, attribute.String("net.peer.addr", addr))
+		},
+		TLSHandshakeStart: func() {
+			c.mu.Lock()
+			c.tlsStart = time.Now()
+			c.mu.Unlock()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.phase("tls", c.tlsStart, err,
+				attribute.String("tls.version", tls.VersionName(state.Version)),
+				attribute.Bool("tls.resumed", state.DidResume),
+			)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			c.mu.Lock()
+			c.wroteRequest = time.Now()
+			c.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			// TTFB is measured from the start of the round trip; server time
+			// is the part after the request was fully written
+			c.phase("ttfb", c.start, nil)
+			if !c.wroteRequest.IsZero() {
+				c.span.SetAttributes(attribute.Float64("http.client.server_ms", float64(time.Since(c.wroteRequest).Microseconds())/1000))
+			}
+		},
+	}
+}
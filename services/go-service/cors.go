@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var corsPreflights metric.Int64Counter
+
+// initCORSMetrics creates the preflight request counter
+func initCORSMetrics() error {
+	var err error
+	corsPreflights, err = meter.Int64Counter(
+		"cors_preflight_requests_total",
+		metric.WithDescription("CORS preflight requests by outcome"),
+	)
+	return err
+}
+
+// corsPolicy is the CORS configuration read from CORS_* environment variables
+type corsPolicy struct {
+	origins     map[string]bool
+	anyOrigin   bool
+	methods     string
+	headers     string
+	credentials bool
+	maxAge      int
+}
+
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// loadCORSPolicy reads the CORS_* variables. Credentials with any origin
+// would let every site make authenticated calls with the visitor's cookies,
+// so that combination is refused and the origins must be listed.
+func loadCORSPolicy() (corsPolicy, error) {
+	p := corsPolicy{
+		origins:     map[string]bool{},
+		methods:     envString("CORS_ALLOWED_METHODS", "GET, POST, OPTIONS"),
+		headers:     envString("CORS_ALLOWED_HEADERS", "*"),
+		credentials: envBool("CORS_ALLOW_CREDENTIALS", false),
+		maxAge:      envInt("CORS_MAX_AGE", 0),
+	}
+	for _, origin := range splitList(envString("CORS_ALLOWED_ORIGINS", "*")) {
+		if origin == "*" {
+			p.anyOrigin = true
+		}
+		p.origins[origin] = true
+	}
+	if p.credentials && p.anyOrigin {
+		return p, errors.New("CORS_ALLOW_CREDENTIALS=true requires CORS_ALLOWED_ORIGINS to list the allowed origins instead of *")
+	}
+	return p, nil
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for a request origin
+func (p corsPolicy) allowOrigin(origin string) string {
+	if p.anyOrigin {
+		return "*"
+	}
+	if p.origins[origin] {
+		return origin
+	}
+	return ""
+}
+
+// enableCORS applies the CORS policy and answers preflight requests
+func enableCORS(policy corsPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			allowed := policy.allowOrigin(origin)
+
+			if allowed != "" {
+				w.Header().Set("Access-Control-Allow-Origin", allowed)
+				if allowed != "*" {
+					w.Header().Add("Vary", "Origin")
+				}
+				if policy.credentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if r.Method != http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result := "allowed"
+			if allowed == "" {
+				result = "rejected_origin"
+			} else {
+				headers := policy.headers
+				if headers == "*" && policy.credentials {
+					headers = r.Header.Get("Access-Control-Request-Headers")
+				}
+				w.Header().Set("Access-Control-Allow-Methods", policy.methods)
+				if headers != "" {
+					w.Header().Set("Access-Control-Allow-Headers", headers)
+				}
+				if policy.maxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(policy.maxAge))
+				}
+			}
+
+			corsPreflights.Add(r.Context(), 1, metric.WithAttributes(
+				attribute.String("result", result),
+			))
+
+			if allowed == "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// crashReport is the structured postmortem written when a background goroutine panics
+type crashReport struct {
+	Timestamp    time.Time         `json:"timestamp"`
+	Service      string            `json:"service"`
+	Version      string            `json:"version"`
+	GoVersion    string            `json:"go_version"`
+	Goroutine    string            `json:"goroutine"`
+	Panic        string            `json:"panic"`
+	Stack        string            `json:"stack"`
+	Goroutines   string            `json:"goroutines"`
+	NumGoroutine int               `json:"num_goroutine"`
+	ActiveSpans  []runningSpan     `json:"active_spans"`
+	TraceIDs     []string          `json:"active_trace_ids"`
+	Build        map[string]string `json:"build"`
+}
+
+func newCrashReport(name string, value interface{}, stack []byte) crashReport {
+	report := crashReport{
+		Timestamp:    time.Now().UTC(),
+		Service:      "go-service",
+		Version:      version,
+		GoVersion:    runtime.Version(),
+		Goroutine:    name,
+		Panic:        secrets.Redact(fmt.Sprint(value)),
+		Stack:        string(stack),
+		NumGoroutine: runtime.NumGoroutine(),
+		ActiveSpans:  tracez.running(),
+		Build:        map[string]string{},
+	}
+
+	// Dump every goroutine, growing the buffer until the dump fits
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			report.Goroutines = string(buf[:n])
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	seen := map[string]bool{}
+	for _, s := range report.ActiveSpans {
+		if !seen[s.TraceID] {
+			seen[s.TraceID] = true
+			report.TraceIDs = append(report.TraceIDs, s.TraceID)
+		}
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		report.Build["path"] = info.Path
+		for _, s := range info.Settings {
+			report.Build[s.Key] = s.Value
+		}
+	}
+	return report
+}
+
+// writeCrashReport sends the report to CRASH_REPORT_SINK: "stderr" (default),
+// "file:<dir>" or an http(s) URL receiving a POST. stderr always gets a copy
+// when another sink fails, so the report is never lost.
+func writeCrashReport(report crashReport) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "crash report encoding failed: %v\n", err)
+		return
+	}
+
+	sink := envString("CRASH_REPORT_SINK", "stderr")
+	switch {
+	case strings.HasPrefix(sink, "file:"):
+		name := fmt.Sprintf("crash-%s-%d.json", report.Timestamp.Format("20060102T150405Z"), os.Getpid())
+		path := filepath.Join(strings.TrimPrefix(sink, "file:"), name)
+		if err = os.WriteFile(path, data, 0o600); err == nil {
+			fmt.Fprintf(os.Stderr, "crash report written to %s\n", path)
+		}
+	case strings.HasPrefix(sink, "http://"), strings.HasPrefix(sink, "https://"):
+		client := &http.Client{Timeout: 5 * time.Second}
+		var resp *http.Response
+		if resp, err = client.Post(sink, "application/json", bytes.NewReader(data)); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("crash report sink returned %s", resp.Status)
+			}
+		}
+	default:
+		err = nil
+		sink = "stderr"
+	}
+
+	if err != nil || sink == "stderr" {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "crash report sink %s failed: %v\n", sink, err)
+		}
+		os.Stderr.Write(append(data, '\n'))
+	}
+}
+
+// goWithCrashReport runs fn in a goroutine; if it panics, a crash report is
+// written before the process exits instead of leaving only a raw stack
+func goWithCrashReport(name string, fn func()) {
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				writeCrashReport(newCrashReport(name, v, debug.Stack()))
+				os.Exit(2)
+			}
+		}()
+		fn()
+	}()
+}
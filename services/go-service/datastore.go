@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// dataStore is the data layer behind /data
+type dataStore interface {
+	name() string
+	items(ctx context.Context, limit int) ([]dataItem, error)
+	close(ctx context.Context) error
+}
+
+// dataStores maps DATA_STORE values to constructors; database backends
+// register themselves from files built with their tag (e.g. -tags mongo)
+var dataStores = map[string]func(ctx context.Context) (dataStore, error){
+	"simulated": func(context.Context) (dataStore, error) { return simulatedStore{}, nil },
+}
+
+// dataLayer serves /data; runServe replaces it with the DATA_STORE backend
+var dataLayer dataStore = simulatedStore{}
+
+// openDataStore returns the backend selected by DATA_STORE with its schema
+// migrated, falling back to the simulated store when it is unknown, not
+// built in or unreachable. A failed migration is returned rather than
+// served around, since the backend's data may be half migrated.
+func openDataStore(ctx context.Context) (dataStore, error) {
+	backend := envString("DATA_STORE", "simulated")
+	open, ok := dataStores[backend]
+	if !ok {
+		logJSON(ctx, "ERROR", "Unknown DATA_STORE or backend not built in, using simulated", map[string]interface{}{
+			"backend": backend,
+		})
+		return simulatedStore{}, nil
+	}
+	store, err := open(ctx)
+	if err != nil {
+		logJSON(ctx, "ERROR", "Failed to open data store, using simulated", map[string]interface{}{
+			"backend": backend,
+			"error":   err.Error(),
+		})
+		return simulatedStore{}, nil
+	}
+	if err := migrateDataStore(ctx, store); err != nil {
+		store.close(context.Background())
+		return nil, err
+	}
+	return store, nil
+}
+
+// simulatedStore generates items after a random query-like delay
+type simulatedStore struct{}
+
+func (simulatedStore) name() string { return "simulated" }
+
+func (simulatedStore) items(ctx context.Context, limit int) ([]dataItem, error) {
+	_, span := tracer.Start(ctx, "database_query")
+	defer span.End()
+	time.Sleep(time.Duration(workloadRand.Intn(100)) * time.Millisecond)
+
+	data := make([]dataItem, limit)
+	for i := range data {
+		data[i] = dataItem{ID: int64(i), Value: "item-" + strconv.Itoa(i)}
+	}
+	return data, nil
+}
+
+func (simulatedStore) close(context.Context) error { return nil }
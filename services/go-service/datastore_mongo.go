@@ -0,0 +1,296 @@
+//go:build mongo
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+func init() {
+	dataStores["mongo"] = openMongoStore
+}
+
+// mongoStore reads /data items from a MongoDB collection. Every command gets
+// a client span from the otelmongo monitor and the pool monitor feeds the
+// mongodb_pool_* metrics.
+type mongoStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+	schema     *mongo.Collection
+	pool       *mongoPoolStats
+}
+
+func openMongoStore(ctx context.Context) (dataStore, error) {
+	pool, err := newMongoPoolStats()
+	if err != nil {
+		return nil, err
+	}
+
+	// The URI may carry credentials
+	uri := secrets.Get("MONGO_URI")
+	if uri == "" {
+		uri = "mongodb://mongo:27017"
+	}
+	opts := options.Client().
+		ApplyURI(uri).
+		SetAppName("go-service").
+		SetMonitor(otelmongo.NewMonitor()).
+		SetPoolMonitor(&event.PoolMonitor{Event: pool.observe}).
+		SetMaxPoolSize(uint64(envInt("MONGO_MAX_POOL_SIZE", 20)))
+
+	connectCtx, cancel := context.WithTimeout(ctx, envDuration("MONGO_CONNECT_TIMEOUT", 10*time.Second))
+	defer cancel()
+	client, err := mongo.Connect(connectCtx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(connectCtx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+
+	db := client.Database(envString("MONGO_DATABASE", "go_service"))
+	return &mongoStore{
+		client:     client,
+		collection: db.Collection("items"),
+		schema:     db.Collection("schema_migrations"),
+		pool:       pool,
+	}, nil
+}
+
+// migrations are the items collection's schema steps, applied at startup
+func (s *mongoStore) migrations() []migration {
+	return []migration{
+		{version: 1, description: "seed demo items", up: s.seed},
+		{version: 2, description: "unique index on items.id", up: func(ctx context.Context) error {
+			_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			})
+			return err
+		}},
+	}
+}
+
+// schemaVersion reads the version from the "items" document of the
+// schema_migrations collection; 0 when it does not exist yet
+func (s *mongoStore) schemaVersion(ctx context.Context) (int, error) {
+	var doc struct {
+		Version int `bson:"version"`
+	}
+	err := s.schema.FindOne(ctx, bson.M{"_id": "items"}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return doc.Version, err
+}
+
+func (s *mongoStore) setSchemaVersion(ctx context.Context, version int) error {
+	_, err := s.schema.UpdateOne(ctx,
+		bson.M{"_id": "items"},
+		bson.M{"$set": bson.M{"version": version, "applied_at": time.Now().UTC()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// schemaLockTTL is how long the migration lease lasts without renewal, so a
+// process that dies while migrating holds up the others for at most this long
+const schemaLockTTL = time.Minute
+
+// lockSchema leases the migration lock on the "items" document of
+// schema_migrations: a findOneAndUpdate that only matches while the lease is
+// free or expired. When another process holds it, the upsert collides with
+// the existing _id and ok is false. The lease is renewed until unlock.
+func (s *mongoStore) lockSchema(ctx context.Context) (func(), bool, error) {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s/%d", host, os.Getpid())
+	now := time.Now().UTC()
+	err := s.schema.FindOneAndUpdate(ctx,
+		bson.M{"_id": "items", "$or": bson.A{
+			bson.M{"locked_until": bson.M{"$exists": false}},
+			bson.M{"locked_until": bson.M{"$lt": now}},
+		}},
+		bson.M{"$set": bson.M{"locked_by": owner, "locked_until": now.Add(schemaLockTTL)}},
+		options.FindOneAndUpdate().SetUpsert(true),
+	).Err()
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, false, nil
+	}
+	// A lock document created by the upsert returns no previous document
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, false, err
+	}
+
+	held := bson.M{"_id": "items", "locked_by": owner}
+	stop, done := make(chan struct{}), make(chan struct{})
+	goWithCrashReport("schema_lock_renewal", func() {
+		defer close(done)
+		ticker := time.NewTicker(schemaLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				renewCtx, cancel := context.WithTimeout(context.Background(), schemaLockTTL/3)
+				_, err := s.schema.UpdateOne(renewCtx, held, bson.M{"$set": bson.M{"locked_until": time.Now().UTC().Add(schemaLockTTL)}})
+				cancel()
+				if err != nil {
+					logJSON(context.Background(), "WARN", "Failed to renew the migration lock", map[string]interface{}{"error": err.Error()})
+				}
+			}
+		}
+	})
+	unlock := func() {
+		close(stop)
+		<-done
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := s.schema.UpdateOne(releaseCtx, held, bson.M{"$unset": bson.M{"locked_by": "", "locked_until": ""}}); err != nil {
+			logJSON(context.Background(), "WARN", "Failed to release the migration lock", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	return unlock, true, nil
+}
+
+// seed inserts the demo items into an empty collection; databases seeded
+// before migrations existed are left as they are
+func (s *mongoStore) seed(ctx context.Context) error {
+	n, err := s.collection.EstimatedDocumentCount(ctx)
+	if err != nil || n > 0 {
+		return err
+	}
+	docs := make([]interface{}, 100)
+	for i := range docs {
+		docs[i] = bson.M{"id": i, "value": fmt.Sprintf("item-%d", i)}
+	}
+	_, err = s.collection.InsertMany(ctx, docs)
+	return err
+}
+
+func (s *mongoStore) name() string { return "mongo" }
+
+func (s *mongoStore) items(ctx context.Context, limit int) ([]dataItem, error) {
+	cur, err := s.collection.Find(ctx, bson.M{}, options.Find().
+		SetSort(bson.D{{Key: "id", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"_id": 0}))
+	if err != nil {
+		return nil, err
+	}
+	// Decoded straight into dataItem; the driver converts int32, int64 and
+	// integral double ids alike
+	var data []dataItem
+	if err := cur.All(ctx, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *mongoStore) close(ctx context.Context) error {
+	s.pool.callback.Unregister()
+	return s.client.Disconnect(ctx)
+}
+
+// mongoPoolStats turns driver pool events into connection pool metrics
+type mongoPoolStats struct {
+	mu    sync.Mutex
+	open  map[string]int64
+	inUse map[string]int64
+
+	checkouts       metric.Int64Counter
+	checkoutLatency metric.Float64Histogram
+	cleared         metric.Int64Counter
+	callback        metric.Registration
+}
+
+func newMongoPoolStats() (*mongoPoolStats, error) {
+	p := &mongoPoolStats{open: map[string]int64{}, inUse: map[string]int64{}}
+	var err error
+
+	p.checkouts, err = meter.Int64Counter(
+		"mongodb_pool_checkouts_total",
+		metric.WithDescription("Connection checkouts from the MongoDB pool, by server and outcome"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	p.checkoutLatency, err = meter.Float64Histogram(
+		"mongodb_pool_checkout_duration_seconds",
+		metric.WithDescription("Time spent waiting for a pooled MongoDB connection"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	p.cleared, err = meter.Int64Counter(
+		"mongodb_pool_cleared_total",
+		metric.WithDescription("Times a server's MongoDB pool was cleared after an error"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	connections, err := meter.Int64ObservableGauge(
+		"mongodb_pool_connections",
+		metric.WithDescription("MongoDB pool connections by server and state (open, in_use)"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.callback, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for server, n := range p.open {
+			o.ObserveInt64(connections, n, metric.WithAttributes(
+				attribute.String("server", server), attribute.String("state", "open")))
+			o.ObserveInt64(connections, p.inUse[server], metric.WithAttributes(
+				attribute.String("server", server), attribute.String("state", "in_use")))
+		}
+		return nil
+	}, connections)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *mongoPoolStats) observe(e *event.PoolEvent) {
+	ctx := context.Background()
+	server := attribute.String("server", e.Address)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch e.Type {
+	case event.ConnectionCreated:
+		p.open[e.Address]++
+	case event.ConnectionClosed:
+		p.open[e.Address]--
+	case event.GetSucceeded:
+		p.inUse[e.Address]++
+		p.checkouts.Add(ctx, 1, metric.WithAttributes(server, attribute.String("outcome", "success")))
+		p.checkoutLatency.Record(ctx, e.Duration.Seconds(), metric.WithAttributes(server))
+	case event.GetFailed:
+		p.checkouts.Add(ctx, 1, metric.WithAttributes(server, attribute.String("outcome", e.Reason)))
+		p.checkoutLatency.Record(ctx, e.Duration.Seconds(), metric.WithAttributes(server))
+	case event.ConnectionReturned:
+		p.inUse[e.Address]--
+	case event.PoolCleared:
+		p.cleared.Add(ctx, 1, metric.WithAttributes(server))
+	}
+}
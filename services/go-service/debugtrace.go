@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// debugTraceBaggageKey carries a forced debug trace to downstream services
+const debugTraceBaggageKey = "debug.trace"
+
+var debugTraceRequests metric.Int64Counter
+
+// initDebugTraceMetrics creates the forced debug trace counter
+func initDebugTraceMetrics() error {
+	var err error
+
+	debugTraceRequests, err = meter.Int64Counter(
+		"debug_trace_requests_total",
+		metric.WithDescription("Requests force-sampled by the debug trace header or baggage, by route and source"),
+	)
+	return err
+}
+
+type debugTraceContextKey struct{}
+
+// debugTraceConfig names the header that forces a trace and the token it
+// must carry. Without DEBUG_TRACE_TOKEN the header is ignored unless
+// DEBUG_TRACE_ALLOW_UNAUTHENTICATED opts in, since any client could
+// otherwise force every span of its requests to be kept.
+type debugTraceConfig struct {
+	header               string
+	token                string
+	allowUnauthenticated bool
+	trustBaggage         bool
+}
+
+func loadDebugTraceConfig() debugTraceConfig {
+	return debugTraceConfig{
+		header:               envString("DEBUG_TRACE_HEADER", "X-Debug-Trace"),
+		token:                secrets.Get("DEBUG_TRACE_TOKEN"),
+		allowUnauthenticated: envBool("DEBUG_TRACE_ALLOW_UNAUTHENTICATED", false),
+		trustBaggage:         envBool("DEBUG_TRACE_BAGGAGE", false),
+	}
+}
+
+// source reports what forces r to be traced: "header", "baggage" set by an
+// upstream service, or "" when nothing does
+func (c debugTraceConfig) source(r *http.Request) string {
+	if v := r.Header.Get(c.header); v != "" {
+		switch {
+		case c.token != "":
+			if subtle.ConstantTimeCompare([]byte(v), []byte(c.token)) == 1 {
+				return "header"
+			}
+		case c.allowUnauthenticated:
+			if on, _ := strconv.ParseBool(v); on {
+				return "header"
+			}
+		}
+	}
+	if c.trustBaggage {
+		// otelhttp has not extracted the baggage yet
+		bag := baggage.FromContext(propagation.Baggage{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header)))
+		if on, _ := strconv.ParseBool(bag.Member(debugTraceBaggageKey).Value()); on {
+			return "baggage"
+		}
+	}
+	return ""
+}
+
+// debugTraced reports whether the request behind ctx asked for a debug trace
+func debugTraced(ctx context.Context) bool {
+	source, _ := ctx.Value(debugTraceContextKey{}).(string)
+	return source != ""
+}
+
+// markDebugTraces runs before the server span starts and flags requests with
+// the debug header, or debug baggage, so debugSampler keeps their trace and
+// logJSON logs at DEBUG for them
+func markDebugTraces(next http.Handler) http.Handler {
+	cfg := loadDebugTraceConfig()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source := cfg.source(r)
+		if source == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := context.WithValue(r.Context(), debugTraceContextKey{}, source)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tagDebugTraces runs inside the server span: it marks the span, counts the
+// request and puts the flag in the baggage so downstream services trace and
+// log the request the same way
+func tagDebugTraces(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		source, _ := ctx.Value(debugTraceContextKey{}).(string)
+		if source == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if member, err := baggage.NewMember(debugTraceBaggageKey, "1"); err == nil {
+			if bag, err := baggage.FromContext(ctx).SetMember(member); err == nil {
+				ctx = baggage.ContextWithBaggage(ctx, bag)
+			}
+		}
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.Bool("debug.forced", true),
+			attribute.String("debug.source", source),
+		)
+		debugTraceRequests.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("route", routeOf(r)),
+			attribute.String("source", source),
+		))
+		logJSON(ctx, "DEBUG", "Debug trace forced", map[string]interface{}{
+			"endpoint": r.URL.Path,
+			"source":   source,
+		})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// debugSampler samples every span of a debug-traced request, overriding the
+// ratios and an unsampled parent
+type debugSampler struct {
+	sdktrace.Sampler
+}
+
+func (s debugSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if !debugTraced(p.ParentContext) {
+		return s.Sampler.ShouldSample(p)
+	}
+	return sdktrace.SamplingResult{
+		Decision:   sdktrace.RecordAndSample,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s debugSampler) Description() string {
+	return "Debug{" + s.Sampler.Description() + "}"
+}
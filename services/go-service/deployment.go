@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// deploymentEnvironment names where this instance runs, e.g. "production"
+var deploymentEnvironment = envString("DEPLOYMENT_ENVIRONMENT", "development")
+
+// volatileEnv changes between otherwise identical deployments, so it is left
+// out of the config hash
+var volatileEnv = map[string]bool{
+	"HOSTNAME": true,
+	"PWD":      true,
+	"OLDPWD":   true,
+	"SHLVL":    true,
+	"_":        true,
+	// Set by the supervisor, so its workers hash alike
+	"WORKER_ID": true,
+}
+
+var deploymentEvents metric.Int64Counter
+
+// initDeploymentMetrics creates the deployment marker counter
+func initDeploymentMetrics() error {
+	var err error
+	deploymentEvents, err = meter.Int64Counter(
+		"deployment_event",
+		metric.WithDescription("Incremented once at startup with the version, previous version and config hash, to correlate changes with their effects"),
+	)
+	return err
+}
+
+// deploymentState is what one start leaves behind for the next, in
+// DEPLOYMENT_STATE_FILE
+type deploymentState struct {
+	Version    string `json:"version"`
+	ConfigHash string `json:"config_hash"`
+	StartedAt  string `json:"started_at"`
+}
+
+// configHash fingerprints the environment and CONFIG_FILE, so two starts
+// with the same hash ran the same configuration
+func configHash() string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); !volatileEnv[name] {
+			env = append(env, kv)
+		}
+	}
+	sort.Strings(env)
+
+	h := sha256.New()
+	for _, kv := range env {
+		h.Write([]byte(kv))
+		h.Write([]byte{0})
+	}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			h.Write(data)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// recordDeployment emits the startup marker: a root "deployment" span, kept
+// whatever the sampling ratio, and one deployment_event. The previous
+// version and config hash come from the state the last start left.
+func recordDeployment(ctx context.Context) {
+	path := envString("DEPLOYMENT_STATE_FILE", filepath.Join(os.TempDir(), "go-service-deployment.json"))
+	// Supervised workers each keep their own history
+	if workerID != "" {
+		path = strings.TrimSuffix(path, ".json") + "-" + workerID + ".json"
+	}
+	var previous deploymentState
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &previous)
+	}
+	current := deploymentState{
+		Version:    version,
+		ConfigHash: configHash(),
+		StartedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+
+	previousVersion := previous.Version
+	if previousVersion == "" {
+		previousVersion = "unknown"
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("service.version", current.Version),
+		attribute.String("deployment.previous_version", previousVersion),
+		attribute.String("deployment.config_hash", current.ConfigHash),
+		attribute.String("deployment.environment", deploymentEnvironment),
+		attribute.String("deployment.track", deploymentTrack),
+	}
+
+	ctx = context.WithValue(ctx, debugTraceContextKey{}, "deployment")
+	ctx, span := tracer.Start(ctx, "deployment", trace.WithNewRoot(), trace.WithAttributes(attrs...))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("deployment.previous_config_hash", previous.ConfigHash),
+		attribute.Bool("deployment.version_changed", previous.Version != "" && previous.Version != current.Version),
+		attribute.Bool("deployment.config_changed", previous.ConfigHash != "" && previous.ConfigHash != current.ConfigHash),
+	)
+
+	deploymentEvents.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("version", current.Version),
+		attribute.String("previous_version", previousVersion),
+		attribute.String("config_hash", current.ConfigHash),
+		attribute.String("environment", deploymentEnvironment),
+	))
+	logJSON(ctx, "INFO", "Deployment started", map[string]interface{}{
+		"version":          current.Version,
+		"previous_version": previousVersion,
+		"config_hash":      current.ConfigHash,
+		"previous_started": previous.StartedAt,
+	})
+
+	data, _ := json.Marshal(current)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		span.RecordError(err)
+		logJSON(ctx, "WARN", "Failed to save deployment state", map[string]interface{}{
+			"path":  path,
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// statusClientClosedRequest is nginx's non-standard 499, recorded for
+// requests the client abandoned so they stay out of the 5xx rate
+const statusClientClosedRequest = 499
+
+var clientDisconnects metric.Int64Counter
+
+// initDisconnectMetrics creates the client-aborted request instrument
+func initDisconnectMetrics() error {
+	var err error
+
+	clientDisconnects, err = meter.Int64Counter(
+		"http_client_disconnects_total",
+		metric.WithDescription("Requests abandoned by the client by route and phase (before_response, during_response)"),
+	)
+	return err
+}
+
+// clientDisconnected reports whether ctx was canceled because the client went
+// away, as opposed to a deadline or no error at all
+func clientDisconnected(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// disconnectRecorder rewrites server errors written after the client went
+// away to 499, so outer middleware and otelhttp see a client-side status
+type disconnectRecorder struct {
+	http.ResponseWriter
+	ctx   context.Context
+	wrote bool
+}
+
+func (d *disconnectRecorder) WriteHeader(code int) {
+	if d.wrote {
+		return
+	}
+	d.wrote = true
+	if code >= 500 && clientDisconnected(d.ctx) {
+		code = statusClientClosedRequest
+	}
+	d.ResponseWriter.WriteHeader(code)
+}
+
+func (d *disconnectRecorder) Write(b []byte) (int, error) {
+	if !d.wrote {
+		d.WriteHeader(http.StatusOK)
+	}
+	return d.ResponseWriter.Write(b)
+}
+
+func (d *disconnectRecorder) Flush() {
+	if f, ok := d.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (d *disconnectRecorder) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
+
+// trackClientDisconnects marks requests whose client disconnected before the
+// handler finished: the span gets http.client_disconnected, the response is
+// recorded as 499 instead of a 5xx or an empty 200, and
+// http_client_disconnects_total counts them apart from server errors
+func trackClientDisconnects(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		rec := &disconnectRecorder{ResponseWriter: w, ctx: ctx}
+		next.ServeHTTP(rec, r)
+		if !clientDisconnected(ctx) {
+			return
+		}
+
+		phase := "during_response"
+		if !rec.wrote {
+			phase = "before_response"
+			rec.WriteHeader(statusClientClosedRequest)
+		}
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(
+			attribute.Bool("http.client_disconnected", true),
+			attribute.String("http.client_disconnect.phase", phase),
+		)
+		span.AddEvent("client_disconnected")
+		clientDisconnects.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("route", routeOf(r)),
+			attribute.String("phase", phase),
+		))
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultDownloadMB = 10
+	bytesPerMB        = 1 << 20
+)
+
+var (
+	downloadBytes      metric.Int64Counter
+	downloadThroughput metric.Float64Histogram
+)
+
+// initDownloadMetrics creates the instruments describing streamed downloads
+func initDownloadMetrics() error {
+	var err error
+
+	downloadBytes, err = meter.Int64Counter(
+		"download_bytes_total",
+		metric.WithDescription("Total bytes streamed by /download"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
+
+	downloadThroughput, err = meter.Float64Histogram(
+		"download_throughput_bytes_per_second",
+		metric.WithDescription("Throughput of completed or aborted /download streams"),
+		metric.WithUnit("By/s"),
+	)
+	return err
+}
+
+func downloadHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ctx := r.Context()
+
+	mb := parseBoundedInt(r, "mb", defaultDownloadMB, envInt("DOWNLOAD_MAX_MB", 100))
+	chunkSize := envInt("DOWNLOAD_CHUNK_KB", 64) * 1024
+	if chunkSize <= 0 {
+		chunkSize = 64 * 1024
+	}
+	total := int64(mb) * bytesPerMB
+
+	ctx, span := tracer.Start(ctx, "stream_download")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("http.method", r.Method),
+		attribute.String("http.route", "/download"),
+		attribute.Int("download.mb", mb),
+		attribute.Int("download.chunk_bytes", chunkSize),
+	)
+
+	chunk := make([]byte, chunkSize)
+	workloadRand.Read(chunk)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(total, 10))
+	flusher, canFlush := w.(http.Flusher)
+	if !canFlush {
+		span.AddEvent("flush_unsupported")
+	}
+
+	var sent int64
+	var writeErr error
+	nextMark := int64(bytesPerMB)
+	for sent < total {
+		n := int64(chunkSize)
+		if remaining := total - sent; remaining < n {
+			n = remaining
+		}
+		written, err := w.Write(chunk[:n])
+		sent += int64(written)
+		if err != nil {
+			writeErr = err
+			break
+		}
+		if canFlush {
+			flusher.Flush()
+		}
+		// One event per MB keeps the span readable for large downloads
+		if sent >= nextMark {
+			span.AddEvent("flushed", trace.WithAttributes(
+				attribute.Int64("download.bytes_sent", sent),
+				attribute.Float64("download.elapsed_seconds", time.Since(start).Seconds()),
+			))
+			nextMark += bytesPerMB
+		}
+	}
+
+	elapsed := time.Since(start).Seconds()
+	throughput := float64(sent) / elapsed
+	outcome := "complete"
+	if writeErr != nil {
+		outcome = "aborted"
+		span.RecordError(writeErr)
+		span.SetStatus(codes.Error, "client stopped reading")
+	}
+
+	span.SetAttributes(
+		attribute.Int64("download.bytes_sent", sent),
+		attribute.Float64("download.throughput_bytes_per_second", throughput),
+		attribute.String("download.outcome", outcome),
+	)
+	attrs := metric.WithAttributes(attribute.String("outcome", outcome))
+	downloadBytes.Add(ctx, sent, attrs)
+	downloadThroughput.Record(ctx, throughput, attrs)
+
+	logJSON(ctx, "INFO", "Download finished", map[string]interface{}{
+		"bytes_sent":      sent,
+		"elapsed_seconds": elapsed,
+		"outcome":         outcome,
+	})
+
+	countRequest(ctx, r.Method, "/download", attribute.String("outcome", outcome))
+	observeRequestDuration(ctx, r.Method, "/download", elapsed)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errorBudgetSlices is how many slices the SLO window rotates in
+const errorBudgetSlices = 60
+
+var errorBudgetRejections metric.Int64Counter
+
+// initErrorBudgetMetrics creates the SLO budget instruments
+func initErrorBudgetMetrics() error {
+	var err error
+
+	errorBudgetRejections, err = meter.Int64Counter(
+		"error_budget_rejections_total",
+		metric.WithDescription("Requests rejected in protective mode by priority"),
+	)
+	if err != nil {
+		return err
+	}
+
+	remaining, err := meter.Float64ObservableGauge(
+		"error_budget_remaining_ratio",
+		metric.WithDescription("Share of the SLO error budget left over the SLO window; negative once overspent"),
+	)
+	if err != nil {
+		return err
+	}
+	protective, err := meter.Int64ObservableGauge(
+		"slo_protective_mode",
+		metric.WithDescription("1 while the exhausted error budget has switched the service into protective mode"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		ratio, _, _ := sloBudget.remaining()
+		target := metric.WithAttributes(attribute.Float64("slo_target", sloBudget.target))
+		o.ObserveFloat64(remaining, ratio, target)
+		var mode int64
+		if protectiveMode() {
+			mode = 1
+		}
+		o.ObserveInt64(protective, mode, target)
+		return nil
+	}, remaining, protective)
+	return err
+}
+
+// sloSlice counts the requests served during one slice of the SLO window
+type sloSlice struct {
+	start  time.Time
+	total  uint64
+	failed uint64
+}
+
+// errorBudget tracks the share of requests that may fail over SLO_WINDOW
+// while meeting SLO_TARGET. With ERROR_BUDGET_ENFORCEMENT it switches the
+// service into protective mode once the budget is spent: batch priority
+// traffic is rejected and shadow traffic, body capture and request capture
+// pause, until ERROR_BUDGET_RECOVERY of the budget is back.
+type errorBudget struct {
+	target      float64
+	window      time.Duration
+	slice       time.Duration
+	minRequests uint64
+	recovery    float64
+	enforce     bool
+	interval    time.Duration
+
+	mu     sync.Mutex
+	slices []*sloSlice
+
+	protective atomic.Bool
+}
+
+var sloBudget = newErrorBudget()
+
+func newErrorBudget() *errorBudget {
+	window := envDuration("SLO_WINDOW", time.Hour)
+	return &errorBudget{
+		target:      envFloat("SLO_TARGET", 0.99),
+		window:      window,
+		slice:       window / errorBudgetSlices,
+		minRequests: uint64(envInt("ERROR_BUDGET_MIN_REQUESTS", 100)),
+		recovery:    envFloat("ERROR_BUDGET_RECOVERY", 0.1),
+		enforce:     envBool("ERROR_BUDGET_ENFORCEMENT", false),
+		interval:    envDuration("ERROR_BUDGET_CHECK_INTERVAL", 10*time.Second),
+	}
+}
+
+// protectiveMode reports whether the exhausted error budget has switched the
+// service into protective mode
+func protectiveMode() bool {
+	return sloBudget.protective.Load()
+}
+
+// expire drops slices that fell out of the window; callers hold b.mu
+func (b *errorBudget) expire(now time.Time) {
+	kept := b.slices[:0]
+	for _, s := range b.slices {
+		if now.Sub(s.start) < b.window {
+			kept = append(kept, s)
+		}
+	}
+	b.slices = kept
+}
+
+func (b *errorBudget) record(failed bool) {
+	if b.window <= 0 {
+		return
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire(now)
+	var current *sloSlice
+	if n := len(b.slices); n > 0 && now.Sub(b.slices[n-1].start) < b.slice {
+		current = b.slices[n-1]
+	} else {
+		current = &sloSlice{start: now}
+		b.slices = append(b.slices, current)
+	}
+	current.total++
+	if failed {
+		current.failed++
+	}
+}
+
+// remaining returns the share of the budget left over the window, 1 when
+// nothing failed, along with the counts it is based on
+func (b *errorBudget) remaining() (ratio float64, total, failed uint64) {
+	b.mu.Lock()
+	b.expire(time.Now())
+	for _, s := range b.slices {
+		total += s.total
+		failed += s.failed
+	}
+	b.mu.Unlock()
+
+	allowed := (1 - b.target) * float64(total)
+	if allowed <= 0 {
+		if failed > 0 {
+			return 0, total, failed
+		}
+		return 1, total, failed
+	}
+	return 1 - float64(failed)/allowed, total, failed
+}
+
+// run re-evaluates the mode every ERROR_BUDGET_CHECK_INTERVAL until ctx ends
+func (b *errorBudget) run(ctx context.Context) {
+	if !b.enforce {
+		return
+	}
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.evaluate(ctx)
+		}
+	}
+}
+
+// evaluate enters protective mode once the budget is spent over at least
+// ERROR_BUDGET_MIN_REQUESTS requests and leaves it once enough is back, so
+// the mode does not flap around zero
+func (b *errorBudget) evaluate(ctx context.Context) {
+	ratio, total, failed := b.remaining()
+	fields := map[string]interface{}{
+		"budget_remaining": ratio,
+		"requests":         total,
+		"failed":           failed,
+		"slo_target":       b.target,
+		"slo_window":       b.window.String(),
+	}
+
+	if !b.protective.Load() {
+		if total >= b.minRequests && ratio <= 0 {
+			b.protective.Store(true)
+			logJSON(ctx, "WARN", "Error budget exhausted, entering protective mode", fields)
+		}
+		return
+	}
+	if ratio >= b.recovery || total < b.minRequests {
+		b.protective.Store(false)
+		logJSON(ctx, "INFO", "Error budget recovered, leaving protective mode", fields)
+	}
+}
+
+// enforceErrorBudget counts each request against the error budget and, in
+// protective mode, rejects batch priority requests with a 503. Its own
+// rejections are not counted, so shedding cannot keep the budget spent.
+func enforceErrorBudget(next http.Handler) http.Handler {
+	classifier := newPriorityClassifier()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if telemetryExcluded(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+
+		if protectiveMode() {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("slo.protective_mode", true))
+			if priority, _ := classifier.classify(r); priority == priorityBatch {
+				errorBudgetRejections.Add(ctx, 1, metric.WithAttributes(attribute.String("priority", priority)))
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(errorResponse{Error: "Shedding batch traffic while the error budget is exhausted"})
+				return
+			}
+		}
+
+		rec := newStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+		sloBudget.record(rec.status >= 500)
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	conditionalRequests metric.Int64Counter
+	conditionalSaved    metric.Int64Counter
+)
+
+// initConditionalMetrics creates the HTTP cache validation instruments
+func initConditionalMetrics() error {
+	var err error
+
+	conditionalRequests, err = meter.Int64Counter(
+		"http_conditional_requests_total",
+		metric.WithDescription("Requests to ETag-enabled routes by result (hit answered with 304, miss, unconditional)"),
+	)
+	if err != nil {
+		return err
+	}
+
+	conditionalSaved, err = meter.Int64Counter(
+		"http_conditional_saved_bytes_total",
+		metric.WithDescription("Response body bytes not sent thanks to 304 Not Modified"),
+		metric.WithUnit("By"),
+	)
+	return err
+}
+
+// etagMatches reports whether an If-None-Match value lists etag, using the
+// weak comparison RFC 9110 requires for If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeWithETag writes an encoded body with a strong ETag derived from it,
+// and answers 304 Not Modified when the request's If-None-Match already has
+// it. It returns the status written.
+func writeWithETag(ctx context.Context, w http.ResponseWriter, r *http.Request, endpoint, contentType string, body []byte) int {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	result := "unconditional"
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch != "" {
+		result = "miss"
+		if etagMatches(ifNoneMatch, etag) {
+			result = "hit"
+		}
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("http.response.etag", etag),
+		attribute.String("http.conditional.result", result),
+	)
+	conditionalRequests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("endpoint", endpoint),
+		attribute.String("result", result),
+	))
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if result == "hit" {
+		conditionalSaved.Add(ctx, int64(len(body)), metric.WithAttributes(attribute.String("endpoint", endpoint)))
+		w.WriteHeader(http.StatusNotModified)
+		return http.StatusNotModified
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+	return http.StatusOK
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+
+	"go-service/events"
+)
+
+// pollEventsTopic carries the simulated events that wake long-pollers
+const pollEventsTopic = "poll.events"
+
+// eventBusBackends maps EVENT_BUS values to constructors; broker backends
+// register themselves from files built with their tag (e.g. -tags nats)
+var eventBusBackends = map[string]func() (events.Bus, error){
+	"memory": func() (events.Bus, error) {
+		return events.NewMemoryBus(envInt("EVENT_BUS_QUEUE_SIZE", 256)), nil
+	},
+}
+
+// newEventBus returns the traced bus selected by EVENT_BUS, falling back to
+// the in-memory bus when the backend is unknown, not built in or unreachable
+func newEventBus() events.Bus {
+	backend := envString("EVENT_BUS", "memory")
+	if open, ok := eventBusBackends[backend]; ok {
+		bus, err := open()
+		if err == nil {
+			return events.Traced(bus)
+		}
+		logJSON(context.Background(), "ERROR", "Failed to open event bus, using memory", map[string]interface{}{
+			"backend": backend,
+			"error":   err.Error(),
+		})
+	} else {
+		logJSON(context.Background(), "ERROR", "Unknown EVENT_BUS or backend not built in, using memory", map[string]interface{}{
+			"backend": backend,
+		})
+	}
+	bus, _ := eventBusBackends["memory"]()
+	return events.Traced(bus)
+}
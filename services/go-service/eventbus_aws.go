@@ -0,0 +1,36 @@
+//go:build aws
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+
+	"go-service/events"
+)
+
+func init() {
+	eventBusBackends["sqs"] = func() (events.Bus, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		// Credentials and region come from the usual AWS_* variables; LocalStack
+		// accepts any credentials
+		awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(envString("AWS_REGION", "us-east-1")))
+		if err != nil {
+			return nil, err
+		}
+		// Every SNS and SQS call gets an aws-api client span
+		otelaws.AppendMiddlewares(&awsCfg.APIOptions)
+
+		return events.NewSQSBus(awsCfg, envString("AWS_ENDPOINT_URL", ""), events.SQSConfig{
+			Prefix:            envString("SQS_PREFIX", "go-service"),
+			VisibilityTimeout: envDuration("SQS_VISIBILITY_TIMEOUT", 30*time.Second),
+			WaitTime:          envDuration("SQS_WAIT_TIME", 20*time.Second),
+			MaxDeliver:        envInt("SQS_MAX_DELIVER", 5),
+			RetryDelay:        envDuration("SQS_RETRY_DELAY", time.Second),
+		}), nil
+	}
+}
@@ -0,0 +1,22 @@
+//go:build nats
+
+package main
+
+import (
+	"time"
+
+	"go-service/events"
+)
+
+func init() {
+	eventBusBackends["nats"] = func() (events.Bus, error) {
+		return events.NewNATSBus(events.NATSConfig{
+			URL:           envString("NATS_URL", "nats://nats:4222"),
+			Stream:        envString("NATS_STREAM", "EVENTS"),
+			SubjectPrefix: envString("NATS_SUBJECT_PREFIX", "events"),
+			AckWait:       envDuration("NATS_ACK_WAIT", 30*time.Second),
+			MaxDeliver:    envInt("NATS_MAX_DELIVER", 5),
+			NakDelay:      envDuration("NATS_NAK_DELAY", time.Second),
+		})
+	}
+}
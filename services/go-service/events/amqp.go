@@ -0,0 +1,381 @@
+//go:build amqp
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers set by the AMQP backend next to the trace context
+const (
+	amqpKeyHeader         = "Event-Key"
+	amqpPublishedAtHeader = "Event-Published-At"
+)
+
+// errPublishNacked is returned when the broker refuses a publisher confirm
+var errPublishNacked = errors.New("events: broker nacked the publish")
+
+// AMQPConfig describes the RabbitMQ topology that backs the bus
+type AMQPConfig struct {
+	URL string
+	// Exchange is a durable topic exchange; topics are its routing keys
+	Exchange string
+	// ManagementURL enables queue depth metrics; credentials go in the userinfo
+	ManagementURL string
+	Prefetch      int
+	// MaxDeliver bounds deliveries of grouped (quorum queue) messages;
+	// ungrouped queues retry a failed message once
+	MaxDeliver int
+}
+
+// AMQPBus publishes with publisher confirms and consumes with manual
+// acknowledgements. Grouped subscribers share a durable quorum queue named
+// <exchange>.<topic>.<group>; ungrouped ones get an exclusive queue each.
+type AMQPBus struct {
+	cfg   AMQPConfig
+	conn  *amqp.Connection
+	vhost string
+
+	pubMu sync.Mutex
+	pub   *amqp.Channel
+
+	mu       sync.Mutex
+	subs     map[*amqpSubscription]bool
+	wg       sync.WaitGroup
+	callback metric.Registration
+}
+
+type amqpSubscription struct {
+	bus   *AMQPBus
+	ch    *amqp.Channel
+	tag   string
+	topic string
+	group string
+	queue string
+	once  sync.Once
+}
+
+// NewAMQPBus connects to RabbitMQ and declares the exchange
+func NewAMQPBus(cfg AMQPConfig) (*AMQPBus, error) {
+	uri, err := amqp.ParseURI(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := amqp.DialConfig(cfg.URL, amqp.Config{
+		Properties: amqp.Table{"connection_name": "go-service"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	pub, err := conn.Channel()
+	if err == nil {
+		err = pub.Confirm(false)
+	}
+	if err == nil {
+		err = pub.ExchangeDeclare(cfg.Exchange, amqp.ExchangeTopic, true, false, false, false, nil)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	b := &AMQPBus{cfg: cfg, conn: conn, vhost: uri.Vhost, pub: pub, subs: map[*amqpSubscription]bool{}}
+	if cfg.ManagementURL != "" {
+		if err := b.registerDepthGauge(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (b *AMQPBus) System() string { return "rabbitmq" }
+
+func (b *AMQPBus) Publish(ctx context.Context, topic string, msg Message) error {
+	headers := amqp.Table{}
+	for k, v := range msg.Metadata {
+		headers[k] = v
+	}
+	if msg.Key != "" {
+		headers[amqpKeyHeader] = msg.Key
+	}
+	if !msg.PublishedAt.IsZero() {
+		headers[amqpPublishedAtHeader] = msg.PublishedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	b.pubMu.Lock()
+	confirm, err := b.pub.PublishWithDeferredConfirmWithContext(ctx, b.cfg.Exchange, topic, false, false, amqp.Publishing{
+		Headers:      headers,
+		MessageId:    msg.ID,
+		Timestamp:    msg.PublishedAt,
+		DeliveryMode: amqp.Persistent,
+		Body:         msg.Payload,
+	})
+	b.pubMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// The confirm wait is its own span so broker-side latency is visible
+	// separately from the client write
+	ctx, span := tracer.Start(ctx, topic+" confirm", trace.WithAttributes(
+		attribute.String("messaging.system", b.System()),
+		attribute.String("messaging.operation", "confirm"),
+		attribute.String("messaging.destination.name", topic),
+	))
+	defer span.End()
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "confirm not received")
+		return err
+	}
+	span.SetAttributes(attribute.Bool("messaging.rabbitmq.confirm.acked", acked))
+	if !acked {
+		span.SetStatus(codes.Error, "publish nacked")
+		return errPublishNacked
+	}
+	return nil
+}
+
+func (b *AMQPBus) Subscribe(ctx context.Context, topic, group string, handler Handler) (Subscription, error) {
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Qos(b.cfg.Prefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	var q amqp.Queue
+	if group != "" {
+		q, err = ch.QueueDeclare(b.cfg.Exchange+"."+topic+"."+group, true, false, false, false, amqp.Table{
+			amqp.QueueTypeArg:  amqp.QueueTypeQuorum,
+			"x-delivery-limit": int64(b.cfg.MaxDeliver - 1),
+		})
+	} else {
+		q, err = ch.QueueDeclare("", false, true, true, false, nil)
+	}
+	if err == nil {
+		err = ch.QueueBind(q.Name, topic, b.cfg.Exchange, false, nil)
+	}
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	s := &amqpSubscription{bus: b, ch: ch, tag: "go-service-" + newMessageID(), topic: topic, group: group, queue: q.Name}
+	deliveries, err := ch.Consume(q.Name, s.tag, false, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.subs[s] = true
+	b.wg.Add(1)
+	b.mu.Unlock()
+
+	go func() {
+		defer b.wg.Done()
+		for d := range deliveries {
+			s.handle(ctx, d, handler)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		s.Unsubscribe()
+	}()
+	return s, nil
+}
+
+// handle runs the handler and settles the delivery: ack on success, nack
+// with requeue on failure while deliveries remain
+func (s *amqpSubscription) handle(ctx context.Context, d amqp.Delivery, handler Handler) {
+	msg := Message{
+		ID:          d.MessageId,
+		Topic:       s.topic,
+		Payload:     d.Body,
+		Metadata:    map[string]string{},
+		PublishedAt: d.Timestamp,
+		Attempt:     1,
+	}
+	for k, v := range d.Headers {
+		str, ok := v.(string)
+		if !ok || strings.HasPrefix(k, "x-") {
+			continue
+		}
+		switch k {
+		case amqpKeyHeader:
+			msg.Key = str
+		case amqpPublishedAtHeader:
+			if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+				msg.PublishedAt = t
+			}
+		default:
+			msg.Metadata[k] = str
+		}
+	}
+	// Quorum queues count earlier deliveries; classic queues only flag them
+	if n, ok := deliveryCount(d.Headers["x-delivery-count"]); ok {
+		msg.Attempt = n + 1
+	} else if d.Redelivered {
+		msg.Attempt = 2
+	}
+	msg.Redelivered = msg.Attempt > 1
+
+	err := handler(ctx, msg)
+	requeue := err != nil && (s.group != "" || !d.Redelivered)
+
+	operation := "ack"
+	if err != nil {
+		operation = "nack"
+	}
+	_, span := tracer.Start(Extract(ctx, msg), s.topic+" "+operation, trace.WithAttributes(
+		attribute.String("messaging.system", s.bus.System()),
+		attribute.String("messaging.operation", "settle"),
+		attribute.String("messaging.destination.name", s.topic),
+		attribute.String("messaging.message.id", msg.ID),
+		attribute.String("messaging.rabbitmq.settlement", operation),
+		attribute.Bool("messaging.rabbitmq.requeue", requeue),
+		attribute.Int("messaging.delivery.attempt", msg.Attempt),
+	))
+	defer span.End()
+
+	var settleErr error
+	if err == nil {
+		settleErr = d.Ack(false)
+	} else {
+		settleErr = d.Nack(false, requeue)
+	}
+	if settleErr != nil {
+		span.RecordError(settleErr)
+		span.SetStatus(codes.Error, operation+" failed")
+	}
+}
+
+// deliveryCount reads x-delivery-count, whose integer type varies by broker version
+func deliveryCount(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int64:
+		return int(n), true
+	case int32:
+		return int(n), true
+	case int:
+		return n, true
+	}
+	return 0, false
+}
+
+func (s *amqpSubscription) Unsubscribe() error {
+	var err error
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		// Cancel lets in-flight deliveries finish; Close requeues unacked ones
+		s.ch.Cancel(s.tag, false)
+		err = s.ch.Close()
+	})
+	return err
+}
+
+// registerDepthGauge reports, per subscribed queue, the messages ready for
+// delivery and those delivered but not yet acknowledged, as seen by the
+// management API
+func (b *AMQPBus) registerDepthGauge() error {
+	depth, err := meter.Int64ObservableGauge(
+		"events_queue_depth",
+		metric.WithDescription("Messages in a consumer queue, by state (ready, unacked)"),
+	)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	base := strings.TrimSuffix(b.cfg.ManagementURL, "/")
+	b.callback, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		b.mu.Lock()
+		subs := make([]*amqpSubscription, 0, len(b.subs))
+		for s := range b.subs {
+			subs = append(subs, s)
+		}
+		b.mu.Unlock()
+
+		for _, s := range subs {
+			stats, err := queueStats(ctx, client, base, b.vhost, s.queue)
+			if err != nil {
+				continue
+			}
+			attrs := []attribute.KeyValue{
+				attribute.String("system", b.System()),
+				attribute.String("topic", s.topic),
+				attribute.String("group", s.group),
+				attribute.String("queue", s.queue),
+			}
+			o.ObserveInt64(depth, stats.Ready, metric.WithAttributes(append(attrs, attribute.String("state", "ready"))...))
+			o.ObserveInt64(depth, stats.Unacked, metric.WithAttributes(append(attrs, attribute.String("state", "unacked"))...))
+		}
+		return nil
+	}, depth)
+	return err
+}
+
+type amqpQueueStats struct {
+	Ready   int64 `json:"messages_ready"`
+	Unacked int64 `json:"messages_unacknowledged"`
+}
+
+// queueStats fetches /api/queues/{vhost}/{queue} from the management API
+func queueStats(ctx context.Context, client *http.Client, base, vhost, queue string) (amqpQueueStats, error) {
+	var stats amqpQueueStats
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/api/queues/"+url.PathEscape(vhost)+"/"+url.PathEscape(queue), nil)
+	if err != nil {
+		return stats, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return stats, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return stats, fmt.Errorf("management API returned %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	return stats, err
+}
+
+// Close stops consumers, waits for in-flight handlers and disconnects
+func (b *AMQPBus) Close() error {
+	if b.callback != nil {
+		b.callback.Unregister()
+	}
+	b.mu.Lock()
+	subs := make([]*amqpSubscription, 0, len(b.subs))
+	for s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.Unsubscribe()
+	}
+	b.wg.Wait()
+	return b.conn.Close()
+}
@@ -0,0 +1,58 @@
+// Package events is a small pub/sub abstraction for go-service. Backends move
+// messages; Traced adds trace propagation through message metadata and
+// PRODUCER/CONSUMER spans, so brokers can be swapped without touching callers.
+package events
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrClosed is returned by operations on a closed bus
+var ErrClosed = errors.New("events: bus closed")
+
+// Message is one event. Metadata travels with the payload and carries the
+// trace context; backends map it onto their native headers.
+type Message struct {
+	ID          string
+	Topic       string
+	Key         string
+	Payload     []byte
+	Metadata    map[string]string
+	PublishedAt time.Time
+
+	// Redelivered is set by backends that know a message was delivered before
+	Redelivered bool
+	// Attempt counts deliveries of this message, starting at 1
+	Attempt int
+}
+
+// Handler processes one message; an error asks the backend to redeliver it
+// where the backend supports that
+type Handler func(ctx context.Context, msg Message) error
+
+// Publisher sends messages to a topic
+type Publisher interface {
+	Publish(ctx context.Context, topic string, msg Message) error
+}
+
+// Subscription stops delivery when cancelled
+type Subscription interface {
+	Unsubscribe() error
+}
+
+// Subscriber delivers a topic's messages to a handler. group names a set of
+// subscribers sharing the messages; an empty group receives every message.
+type Subscriber interface {
+	Subscribe(ctx context.Context, topic, group string, handler Handler) (Subscription, error)
+}
+
+// Bus is a backend that both publishes and subscribes
+type Bus interface {
+	Publisher
+	Subscriber
+	// System names the backend for the messaging.system attribute
+	System() string
+	Close() error
+}
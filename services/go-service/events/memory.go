@@ -0,0 +1,177 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBus delivers messages in-process. Each subscription has its own
+// buffered queue; subscribers sharing a group take turns, and a failed
+// handler gets the message again up to MaxDeliveries times.
+type MemoryBus struct {
+	MaxDeliveries int
+	queueSize     int
+
+	mu     sync.Mutex
+	topics map[string]map[string]*memoryGroup
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// memoryGroup round-robins a topic's messages across its subscriptions
+type memoryGroup struct {
+	subs []*memorySubscription
+	next int
+}
+
+type memorySubscription struct {
+	bus    *MemoryBus
+	topic  string
+	group  string
+	queue  chan Message
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewMemoryBus returns an in-process bus whose subscriptions buffer up to
+// queueSize messages each; publishing to a full queue blocks
+func NewMemoryBus(queueSize int) *MemoryBus {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	return &MemoryBus{MaxDeliveries: 3, topics: map[string]map[string]*memoryGroup{}, queueSize: queueSize}
+}
+
+func (b *MemoryBus) System() string { return "memory" }
+
+func (b *MemoryBus) Publish(ctx context.Context, topic string, msg Message) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	// Pick the receiving subscription of each group while holding the lock
+	var targets []*memorySubscription
+	for _, g := range b.topics[topic] {
+		if len(g.subs) == 0 {
+			continue
+		}
+		targets = append(targets, g.subs[g.next%len(g.subs)])
+		g.next++
+	}
+	b.mu.Unlock()
+
+	for _, sub := range targets {
+		select {
+		case sub.queue <- msg:
+		case <-sub.ctx.Done():
+			// Unsubscribed after being picked; the message is dropped for it
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(ctx context.Context, topic, group string, handler Handler) (Subscription, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &memorySubscription{
+		bus:    b,
+		topic:  topic,
+		group:  group,
+		queue:  make(chan Message, b.queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		cancel()
+		return nil, ErrClosed
+	}
+	groups, ok := b.topics[topic]
+	if !ok {
+		groups = map[string]*memoryGroup{}
+		b.topics[topic] = groups
+	}
+	// Ungrouped subscribers each get their own group so they see every message
+	key := group
+	if key == "" {
+		key = "\x00" + newMessageID()
+		sub.group = key
+	}
+	g, ok := groups[key]
+	if !ok {
+		g = &memoryGroup{}
+		groups[key] = g
+	}
+	g.subs = append(g.subs, sub)
+	b.wg.Add(1)
+	b.mu.Unlock()
+
+	go sub.run(ctx, handler)
+	return sub, nil
+}
+
+func (s *memorySubscription) run(ctx context.Context, handler Handler) {
+	defer s.bus.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-s.queue:
+			for attempt := 1; attempt <= s.bus.MaxDeliveries && ctx.Err() == nil; attempt++ {
+				msg.Attempt = attempt
+				msg.Redelivered = attempt > 1
+				if handler(ctx, msg) == nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+func (s *memorySubscription) Unsubscribe() error {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		if g, ok := s.bus.topics[s.topic][s.group]; ok {
+			for i, sub := range g.subs {
+				if sub == s {
+					g.subs = append(g.subs[:i], g.subs[i+1:]...)
+					break
+				}
+			}
+			if len(g.subs) == 0 {
+				delete(s.bus.topics[s.topic], s.group)
+			}
+		}
+		s.bus.mu.Unlock()
+		s.cancel()
+	})
+	return nil
+}
+
+// Close stops every subscription and waits for in-flight handlers
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	var subs []*memorySubscription
+	for _, groups := range b.topics {
+		for _, g := range groups {
+			subs = append(subs, g.subs...)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.Unsubscribe()
+	}
+	b.wg.Wait()
+	return nil
+}
@@ -0,0 +1,232 @@
+//go:build nats
+
+package events
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Metadata headers set by the NATS backend next to the trace context
+const (
+	natsKeyHeader         = "Event-Key"
+	natsPublishedAtHeader = "Event-Published-At"
+)
+
+// NATSConfig describes the JetStream stream that backs the bus
+type NATSConfig struct {
+	URL string
+	// Stream captures SubjectPrefix.> and is created when missing
+	Stream        string
+	SubjectPrefix string
+	// AckWait is how long a delivery may stay unacknowledged before redelivery
+	AckWait    time.Duration
+	MaxDeliver int
+	// NakDelay postpones the redelivery of a message whose handler failed
+	NakDelay time.Duration
+}
+
+// NATSBus publishes to and consumes from a JetStream stream. Handler errors
+// nak the message so JetStream redelivers it, up to MaxDeliver attempts.
+type NATSBus struct {
+	cfg NATSConfig
+	nc  *nats.Conn
+	js  nats.JetStreamContext
+
+	mu       sync.Mutex
+	subs     map[*natsSubscription]bool
+	callback metric.Registration
+}
+
+type natsSubscription struct {
+	bus   *NATSBus
+	sub   *nats.Subscription
+	topic string
+	group string
+	once  sync.Once
+}
+
+// NewNATSBus connects to NATS and makes sure the stream exists
+func NewNATSBus(cfg NATSConfig) (*NATSBus, error) {
+	nc, err := nats.Connect(cfg.URL, nats.Name("go-service"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	if _, err := js.StreamInfo(cfg.Stream); errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     cfg.Stream,
+			Subjects: []string{cfg.SubjectPrefix + ".>"},
+		})
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+	} else if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	b := &NATSBus{cfg: cfg, nc: nc, js: js, subs: map[*natsSubscription]bool{}}
+	if err := b.registerLagGauge(); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// registerLagGauge reports, per consumer, the stream messages not yet
+// delivered and the deliveries not yet acknowledged
+func (b *NATSBus) registerLagGauge() error {
+	lag, err := meter.Int64ObservableGauge(
+		"events_consumer_lag",
+		metric.WithDescription("Messages waiting for a consumer, by state (pending, ack_pending)"),
+	)
+	if err != nil {
+		return err
+	}
+
+	b.callback, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		b.mu.Lock()
+		subs := make([]*natsSubscription, 0, len(b.subs))
+		for s := range b.subs {
+			subs = append(subs, s)
+		}
+		b.mu.Unlock()
+
+		for _, s := range subs {
+			info, err := s.sub.ConsumerInfo()
+			if err != nil {
+				continue
+			}
+			attrs := []attribute.KeyValue{
+				attribute.String("system", b.System()),
+				attribute.String("topic", s.topic),
+				attribute.String("group", s.group),
+			}
+			o.ObserveInt64(lag, int64(info.NumPending), metric.WithAttributes(append(attrs, attribute.String("state", "pending"))...))
+			o.ObserveInt64(lag, int64(info.NumAckPending), metric.WithAttributes(append(attrs, attribute.String("state", "ack_pending"))...))
+		}
+		return nil
+	}, lag)
+	return err
+}
+
+func (b *NATSBus) System() string { return "nats" }
+
+func (b *NATSBus) subject(topic string) string {
+	return b.cfg.SubjectPrefix + "." + topic
+}
+
+func (b *NATSBus) Publish(ctx context.Context, topic string, msg Message) error {
+	m := nats.NewMsg(b.subject(topic))
+	m.Data = msg.Payload
+	for k, v := range msg.Metadata {
+		m.Header.Set(k, v)
+	}
+	if msg.ID != "" {
+		// JetStream drops duplicates of the same ID within its window
+		m.Header.Set(nats.MsgIdHdr, msg.ID)
+	}
+	if msg.Key != "" {
+		m.Header.Set(natsKeyHeader, msg.Key)
+	}
+	if !msg.PublishedAt.IsZero() {
+		m.Header.Set(natsPublishedAtHeader, msg.PublishedAt.UTC().Format(time.RFC3339Nano))
+	}
+
+	_, err := b.js.PublishMsg(m, nats.Context(ctx))
+	return err
+}
+
+func (b *NATSBus) Subscribe(ctx context.Context, topic, group string, handler Handler) (Subscription, error) {
+	s := &natsSubscription{bus: b, topic: topic, group: group}
+
+	cb := func(m *nats.Msg) {
+		msg := Message{
+			ID:       m.Header.Get(nats.MsgIdHdr),
+			Topic:    topic,
+			Key:      m.Header.Get(natsKeyHeader),
+			Payload:  m.Data,
+			Metadata: map[string]string{},
+		}
+		for k := range m.Header {
+			if !strings.HasPrefix(k, "Nats-") {
+				msg.Metadata[k] = m.Header.Get(k)
+			}
+		}
+		if meta, err := m.Metadata(); err == nil {
+			msg.Attempt = int(meta.NumDelivered)
+			msg.Redelivered = meta.NumDelivered > 1
+			msg.PublishedAt = meta.Timestamp
+		}
+		if t, err := time.Parse(time.RFC3339Nano, m.Header.Get(natsPublishedAtHeader)); err == nil {
+			msg.PublishedAt = t
+		}
+
+		if err := handler(ctx, msg); err != nil {
+			m.NakWithDelay(b.cfg.NakDelay)
+			return
+		}
+		m.Ack()
+	}
+
+	opts := []nats.SubOpt{
+		nats.ManualAck(),
+		nats.AckExplicit(),
+		nats.AckWait(b.cfg.AckWait),
+		nats.MaxDeliver(b.cfg.MaxDeliver),
+		nats.DeliverNew(),
+	}
+	var err error
+	if group != "" {
+		// A durable queue consumer is shared by every instance in the group
+		s.sub, err = b.js.QueueSubscribe(b.subject(topic), group, cb, append(opts, nats.Durable(group))...)
+	} else {
+		s.sub, err = b.js.Subscribe(b.subject(topic), cb, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.subs[s] = true
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.Unsubscribe()
+	}()
+	return s, nil
+}
+
+func (s *natsSubscription) Unsubscribe() error {
+	var err error
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		err = s.sub.Unsubscribe()
+	})
+	return err
+}
+
+// Close drains subscriptions so in-flight handlers finish, then disconnects
+func (b *NATSBus) Close() error {
+	if b.callback != nil {
+		b.callback.Unregister()
+	}
+	return b.nc.Drain()
+}
@@ -0,0 +1,382 @@
+//go:build aws
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Message attributes set by the SQS backend next to the trace context
+const (
+	sqsKeyAttribute         = "Event-Key"
+	sqsIDAttribute          = "Event-Id"
+	sqsPublishedAtAttribute = "Event-Published-At"
+)
+
+var (
+	visibilityUsed, _ = meter.Float64Histogram(
+		"events_visibility_timeout_used_ratio",
+		metric.WithDescription("Handler time as a fraction of the SQS visibility timeout; above 1 the message became visible again mid-processing"),
+	)
+	visibilityExpired, _ = meter.Int64Counter(
+		"events_visibility_timeout_expired_total",
+		metric.WithDescription("Messages whose visibility timeout ran out before the handler finished"),
+	)
+)
+
+// SQSConfig describes the SNS topics and SQS queues that back the bus
+type SQSConfig struct {
+	// Prefix namespaces the topic and queue names created by the bus
+	Prefix string
+	// VisibilityTimeout hides a received message from other consumers
+	VisibilityTimeout time.Duration
+	// WaitTime is the long-poll duration of each receive (at most 20s)
+	WaitTime   time.Duration
+	MaxDeliver int
+	// RetryDelay is the visibility given to a message whose handler failed
+	RetryDelay time.Duration
+}
+
+// SQSBus publishes to one SNS topic per event topic and consumes through SQS
+// queues subscribed to it with raw delivery, so message attributes (and the
+// trace context in them) reach the consumer untouched. Grouped subscribers
+// share the queue <prefix>-<topic>-<group>; ungrouped ones get their own
+// queue, deleted on unsubscribe.
+type SQSBus struct {
+	cfg SQSConfig
+	sns *sns.Client
+	sqs *sqs.Client
+
+	mu     sync.Mutex
+	topics map[string]string
+	subs   map[*sqsSubscription]bool
+	wg     sync.WaitGroup
+}
+
+type sqsSubscription struct {
+	bus             *SQSBus
+	topic           string
+	group           string
+	queueURL        string
+	subscriptionARN string
+	cancel          context.CancelFunc
+	done            chan struct{}
+	once            sync.Once
+}
+
+// NewSQSBus builds the SNS and SQS clients from awsCfg, which carries the
+// region, credentials and any SDK middleware such as tracing
+func NewSQSBus(awsCfg aws.Config, endpoint string, cfg SQSConfig) *SQSBus {
+	b := &SQSBus{cfg: cfg, topics: map[string]string{}, subs: map[*sqsSubscription]bool{}}
+	b.sns = sns.NewFromConfig(awsCfg, func(o *sns.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	b.sqs = sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	return b
+}
+
+func (b *SQSBus) System() string { return "aws_sqs" }
+
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// resourceName builds an SNS/SQS-safe name from parts
+func (b *SQSBus) resourceName(parts ...string) string {
+	name := b.cfg.Prefix
+	for _, p := range parts {
+		name += "-" + p
+	}
+	name = invalidNameChars.ReplaceAllString(name, "_")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	return name
+}
+
+// topicARN creates the topic's SNS topic on first use; CreateTopic is idempotent
+func (b *SQSBus) topicARN(ctx context.Context, topic string) (string, error) {
+	b.mu.Lock()
+	arn, ok := b.topics[topic]
+	b.mu.Unlock()
+	if ok {
+		return arn, nil
+	}
+
+	out, err := b.sns.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String(b.resourceName(topic))})
+	if err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	b.topics[topic] = *out.TopicArn
+	b.mu.Unlock()
+	return *out.TopicArn, nil
+}
+
+func (b *SQSBus) Publish(ctx context.Context, topic string, msg Message) error {
+	arn, err := b.topicARN(ctx, topic)
+	if err != nil {
+		return err
+	}
+
+	attrs := map[string]snstypes.MessageAttributeValue{}
+	set := func(k, v string) {
+		attrs[k] = snstypes.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+	}
+	for k, v := range msg.Metadata {
+		set(k, v)
+	}
+	if msg.ID != "" {
+		set(sqsIDAttribute, msg.ID)
+	}
+	if msg.Key != "" {
+		set(sqsKeyAttribute, msg.Key)
+	}
+	if !msg.PublishedAt.IsZero() {
+		set(sqsPublishedAtAttribute, msg.PublishedAt.UTC().Format(time.RFC3339Nano))
+	}
+
+	_, err = b.sns.Publish(ctx, &sns.PublishInput{
+		TopicArn:          aws.String(arn),
+		Message:           aws.String(string(msg.Payload)),
+		MessageAttributes: attrs,
+	})
+	return err
+}
+
+func (b *SQSBus) Subscribe(ctx context.Context, topic, group string, handler Handler) (Subscription, error) {
+	arn, err := b.topicARN(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	name := group
+	if name == "" {
+		name = newMessageID()
+	}
+	queue, err := b.sqs.CreateQueue(ctx, &sqs.CreateQueueInput{
+		QueueName: aws.String(b.resourceName(topic, name)),
+		Attributes: map[string]string{
+			string(sqstypes.QueueAttributeNameVisibilityTimeout): strconv.Itoa(int(b.cfg.VisibilityTimeout.Seconds())),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	queueAttrs, err := b.sqs.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		return nil, err
+	}
+	queueARN := queueAttrs.Attributes[string(sqstypes.QueueAttributeNameQueueArn)]
+
+	// Let the SNS topic, and only it, deliver into the queue
+	policy, _ := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Effect":    "Allow",
+			"Principal": map[string]string{"Service": "sns.amazonaws.com"},
+			"Action":    "sqs:SendMessage",
+			"Resource":  queueARN,
+			"Condition": map[string]interface{}{"ArnEquals": map[string]string{"aws:SourceArn": arn}},
+		}},
+	})
+	_, err = b.sqs.SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl:   queue.QueueUrl,
+		Attributes: map[string]string{string(sqstypes.QueueAttributeNamePolicy): string(policy)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := b.sns.Subscribe(ctx, &sns.SubscribeInput{
+		TopicArn:              aws.String(arn),
+		Protocol:              aws.String("sqs"),
+		Endpoint:              aws.String(queueARN),
+		Attributes:            map[string]string{"RawMessageDelivery": "true"},
+		ReturnSubscriptionArn: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &sqsSubscription{
+		bus:             b,
+		topic:           topic,
+		group:           group,
+		queueURL:        *queue.QueueUrl,
+		subscriptionARN: aws.ToString(sub.SubscriptionArn),
+		cancel:          cancel,
+		done:            make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	b.subs[s] = true
+	b.wg.Add(1)
+	b.mu.Unlock()
+
+	go s.receive(ctx, handler)
+	go func() {
+		<-ctx.Done()
+		s.Unsubscribe()
+	}()
+	return s, nil
+}
+
+// receive long-polls the queue until the subscription is cancelled
+func (s *sqsSubscription) receive(ctx context.Context, handler Handler) {
+	defer s.bus.wg.Done()
+	defer close(s.done)
+	for ctx.Err() == nil {
+		out, err := s.bus.sqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(s.queueURL),
+			MaxNumberOfMessages:   10,
+			WaitTimeSeconds:       int32(s.bus.cfg.WaitTime.Seconds()),
+			MessageAttributeNames: []string{"All"},
+			MessageSystemAttributeNames: []sqstypes.MessageSystemAttributeName{
+				sqstypes.MessageSystemAttributeNameApproximateReceiveCount,
+				sqstypes.MessageSystemAttributeNameSentTimestamp,
+			},
+		})
+		if err != nil {
+			// Back off instead of spinning while the endpoint is unreachable
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, m := range out.Messages {
+			s.handle(ctx, m, handler)
+		}
+	}
+}
+
+// handle runs the handler, deletes the message on success and otherwise
+// shortens its visibility so it is retried after RetryDelay, giving up once
+// MaxDeliver receives are reached
+func (s *sqsSubscription) handle(ctx context.Context, m sqstypes.Message, handler Handler) {
+	received := time.Now()
+	msg := Message{
+		ID:       aws.ToString(m.MessageId),
+		Topic:    s.topic,
+		Payload:  []byte(aws.ToString(m.Body)),
+		Metadata: map[string]string{},
+		Attempt:  1,
+	}
+	if n, err := strconv.Atoi(m.Attributes[string(sqstypes.MessageSystemAttributeNameApproximateReceiveCount)]); err == nil {
+		msg.Attempt = n
+	}
+	msg.Redelivered = msg.Attempt > 1
+	if ms, err := strconv.ParseInt(m.Attributes[string(sqstypes.MessageSystemAttributeNameSentTimestamp)], 10, 64); err == nil {
+		msg.PublishedAt = time.UnixMilli(ms)
+	}
+	for k, v := range m.MessageAttributes {
+		str := aws.ToString(v.StringValue)
+		switch k {
+		case sqsIDAttribute:
+			msg.ID = str
+		case sqsKeyAttribute:
+			msg.Key = str
+		case sqsPublishedAtAttribute:
+			if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+				msg.PublishedAt = t
+			}
+		default:
+			msg.Metadata[k] = str
+		}
+	}
+
+	err := handler(ctx, msg)
+
+	held := time.Since(received)
+	labels := metric.WithAttributes(
+		attribute.String("system", s.bus.System()),
+		attribute.String("topic", s.topic),
+	)
+	if timeout := s.bus.cfg.VisibilityTimeout; timeout > 0 {
+		visibilityUsed.Record(ctx, held.Seconds()/timeout.Seconds(), labels)
+		if held > timeout {
+			visibilityExpired.Add(ctx, 1, labels)
+		}
+	}
+
+	// Settle with a fresh context so a cancelled subscription still deletes
+	// what it already handled
+	settleCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err == nil || msg.Attempt >= s.bus.cfg.MaxDeliver {
+		s.bus.sqs.DeleteMessage(settleCtx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(s.queueURL),
+			ReceiptHandle: m.ReceiptHandle,
+		})
+		return
+	}
+	s.bus.sqs.ChangeMessageVisibility(settleCtx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(s.queueURL),
+		ReceiptHandle:     m.ReceiptHandle,
+		VisibilityTimeout: int32(s.bus.cfg.RetryDelay.Seconds()),
+	})
+}
+
+// Unsubscribe stops receiving; an ungrouped subscription also removes its
+// SNS subscription and queue, since nothing else will drain it
+func (s *sqsSubscription) Unsubscribe() error {
+	var err error
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		s.cancel()
+		<-s.done
+
+		if s.group != "" {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if s.subscriptionARN != "" {
+			_, err = s.bus.sns.Unsubscribe(ctx, &sns.UnsubscribeInput{SubscriptionArn: aws.String(s.subscriptionARN)})
+		}
+		if _, delErr := s.bus.sqs.DeleteQueue(ctx, &sqs.DeleteQueueInput{QueueUrl: aws.String(s.queueURL)}); err == nil {
+			err = delErr
+		}
+	})
+	return err
+}
+
+// Close stops every subscription and waits for in-flight handlers
+func (b *SQSBus) Close() error {
+	b.mu.Lock()
+	subs := make([]*sqsSubscription, 0, len(b.subs))
+	for s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.Unsubscribe()
+	}
+	b.wg.Wait()
+	return nil
+}
@@ -0,0 +1,187 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "go-service/events"
+
+var (
+	tracer = otel.Tracer(instrumentationName)
+	meter  = otel.Meter(instrumentationName)
+
+	published, _ = meter.Int64Counter(
+		"events_published_total",
+		metric.WithDescription("Messages published, by system, topic and outcome"),
+	)
+	consumed, _ = meter.Int64Counter(
+		"events_consumed_total",
+		metric.WithDescription("Messages handled, by system, topic and outcome"),
+	)
+	processing, _ = meter.Float64Histogram(
+		"events_process_duration_seconds",
+		metric.WithDescription("Time spent in message handlers"),
+		metric.WithUnit("s"),
+	)
+	redeliveries, _ = meter.Int64Counter(
+		"events_redeliveries_total",
+		metric.WithDescription("Messages delivered again after a failed or unacknowledged attempt"),
+	)
+	endToEnd, _ = meter.Float64Histogram(
+		"events_end_to_end_latency_seconds",
+		metric.WithDescription("Time from publish to the start of processing"),
+		metric.WithUnit("s"),
+	)
+)
+
+// MetadataCarrier adapts message metadata to the text map propagator
+type MetadataCarrier map[string]string
+
+func (c MetadataCarrier) Get(key string) string { return c[key] }
+func (c MetadataCarrier) Set(key, value string) { c[key] = value }
+func (c MetadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+var _ propagation.TextMapCarrier = MetadataCarrier(nil)
+
+// Extract returns ctx with the trace context carried in msg
+func Extract(ctx context.Context, msg Message) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, MetadataCarrier(msg.Metadata))
+}
+
+// Attributes are the messaging semantic convention attributes for msg
+func Attributes(system, operation string, msg Message) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.operation", operation),
+		attribute.String("messaging.destination.name", msg.Topic),
+		attribute.String("messaging.message.id", msg.ID),
+		attribute.Int("messaging.message.body.size", len(msg.Payload)),
+	}
+	if msg.Key != "" {
+		attrs = append(attrs, attribute.String("messaging.message.key", msg.Key))
+	}
+	return attrs
+}
+
+func newMessageID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// traced wraps a backend with producer and consumer instrumentation
+type traced struct {
+	Bus
+}
+
+// Traced instruments bus: Publish starts a PRODUCER span and injects its
+// context into the metadata, and handlers run under a CONSUMER span that is a
+// child of the publisher's span. A redelivery starts its own trace linked to
+// the original publish, so retries do not pile up under one parent.
+func Traced(bus Bus) Bus {
+	return traced{Bus: bus}
+}
+
+func (t traced) Publish(ctx context.Context, topic string, msg Message) error {
+	msg.Topic = topic
+	if msg.ID == "" {
+		msg.ID = newMessageID()
+	}
+	if msg.PublishedAt.IsZero() {
+		msg.PublishedAt = time.Now()
+	}
+	metadata := make(map[string]string, len(msg.Metadata)+2)
+	for k, v := range msg.Metadata {
+		metadata[k] = v
+	}
+	msg.Metadata = metadata
+
+	ctx, span := tracer.Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(Attributes(t.System(), "publish", msg)...),
+	)
+	defer span.End()
+	otel.GetTextMapPropagator().Inject(ctx, MetadataCarrier(msg.Metadata))
+
+	outcome := "success"
+	err := t.Bus.Publish(ctx, topic, msg)
+	if err != nil {
+		outcome = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "publish failed")
+	}
+	published.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("system", t.System()),
+		attribute.String("topic", topic),
+		attribute.String("outcome", outcome),
+	))
+	return err
+}
+
+func (t traced) Subscribe(ctx context.Context, topic, group string, handler Handler) (Subscription, error) {
+	system := t.System()
+	return t.Bus.Subscribe(ctx, topic, group, func(ctx context.Context, msg Message) error {
+		ctx = Extract(ctx, msg)
+		attrs := Attributes(system, "process", msg)
+		if group != "" {
+			attrs = append(attrs, attribute.String("messaging.consumer.group.name", group))
+		}
+		if msg.Attempt > 0 {
+			attrs = append(attrs, attribute.Int("messaging.delivery.attempt", msg.Attempt))
+		}
+		opts := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindConsumer)}
+		if msg.Redelivered {
+			attrs = append(attrs, attribute.Bool("messaging.redelivered", true))
+			opts = append(opts, trace.WithNewRoot(), trace.WithLinks(trace.Link{
+				SpanContext: trace.SpanContextFromContext(ctx),
+				Attributes:  []attribute.KeyValue{attribute.String("messaging.link", "original_publish")},
+			}))
+			redeliveries.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("system", system),
+				attribute.String("topic", topic),
+			))
+		}
+		ctx, span := tracer.Start(ctx, topic+" process", append(opts, trace.WithAttributes(attrs...))...)
+		defer span.End()
+
+		start := time.Now()
+		if !msg.PublishedAt.IsZero() {
+			endToEnd.Record(ctx, start.Sub(msg.PublishedAt).Seconds(), metric.WithAttributes(
+				attribute.String("system", system),
+				attribute.String("topic", topic),
+			))
+		}
+
+		outcome := "success"
+		err := handler(ctx, msg)
+		if err != nil {
+			outcome = "error"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "handler failed")
+		}
+		labels := metric.WithAttributes(
+			attribute.String("system", system),
+			attribute.String("topic", topic),
+			attribute.String("outcome", outcome),
+		)
+		consumed.Add(ctx, 1, labels)
+		processing.Record(ctx, time.Since(start).Seconds(), labels)
+		return err
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otherVariant labels variants outside EXPERIMENT_VARIANTS in metrics
+const otherVariant = "other"
+
+type variantContextKey struct{}
+
+// experimentConfig names where the variant comes from and which values are
+// kept as-is on metrics
+type experimentConfig struct {
+	header      string
+	baggageKey  string
+	variants    map[string]bool
+	echoHeaders bool
+}
+
+func loadExperimentConfig() experimentConfig {
+	c := experimentConfig{
+		header:      envString("EXPERIMENT_HEADER", "X-Experiment-Variant"),
+		baggageKey:  envString("EXPERIMENT_BAGGAGE_KEY", "experiment.variant"),
+		variants:    map[string]bool{},
+		echoHeaders: envBool("EXPERIMENT_ECHO_HEADER", false),
+	}
+	for _, v := range splitList(envString("EXPERIMENT_VARIANTS", "A,B,control")) {
+		c.variants[strings.ToLower(v)] = true
+	}
+	return c
+}
+
+// variant reads the header, then the incoming baggage, and folds unknown
+// values into "other" so metric cardinality stays bounded
+func (c experimentConfig) variant(r *http.Request) string {
+	v := r.Header.Get(c.header)
+	if v == "" {
+		v = baggage.FromContext(r.Context()).Member(c.baggageKey).Value()
+	}
+	if v == "" {
+		return ""
+	}
+	if !c.variants[strings.ToLower(v)] {
+		return otherVariant
+	}
+	return strings.ToLower(v)
+}
+
+// variantFromContext returns the experiment variant of the current request, if any
+func variantFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(variantContextKey{}).(string)
+	return v
+}
+
+// tagExperimentVariant stamps the request's experiment variant on the server
+// span and the request metrics, and puts it in the baggage so instrumented
+// outbound calls carry it downstream
+func tagExperimentVariant(next http.Handler) http.Handler {
+	cfg := loadExperimentConfig()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		variant := cfg.variant(r)
+		if variant == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), variantContextKey{}, variant)
+		if member, err := baggage.NewMember(cfg.baggageKey, variant); err == nil {
+			if bag, err := baggage.FromContext(ctx).SetMember(member); err == nil {
+				ctx = baggage.ContextWithBaggage(ctx, bag)
+			}
+		}
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("experiment.variant", variant))
+		if cfg.echoHeaders {
+			w.Header().Set(cfg.header, variant)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// expvarExcluded are never exported: cmdline may carry secrets and memstats
+// duplicates the runtime metrics
+var expvarExcluded = map[string]bool{"cmdline": true, "memstats": true}
+
+// expvarAllowed reports whether a variable is selected by EXPVAR_INCLUDE
+// (comma-separated names, empty meaning every variable)
+func expvarAllowed(name string, include map[string]bool) bool {
+	if expvarExcluded[name] {
+		return false
+	}
+	return len(include) == 0 || include[name]
+}
+
+// flattenExpvar observes numeric values, descending one level into maps
+func flattenExpvar(name string, raw string, observe func(key string, value float64)) {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		return
+	}
+
+	switch v := decoded.(type) {
+	case float64:
+		observe(name, v)
+	case map[string]interface{}:
+		for key, inner := range v {
+			if f, ok := inner.(float64); ok {
+				observe(name+"."+key, f)
+			}
+		}
+	}
+}
+
+// initExpvarBridge publishes selected expvar values as an OTel gauge on every collection
+func initExpvarBridge() error {
+	include := map[string]bool{}
+	for _, name := range strings.Split(envString("EXPVAR_INCLUDE", ""), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			include[name] = true
+		}
+	}
+
+	gauge, err := meter.Float64ObservableGauge(
+		"expvar_value",
+		metric.WithDescription("Numeric values published through the expvar package"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		expvar.Do(func(kv expvar.KeyValue) {
+			if !expvarAllowed(kv.Key, include) {
+				return
+			}
+			flattenExpvar(kv.Key, kv.Value.String(), func(key string, value float64) {
+				o.ObserveFloat64(gauge, value, metric.WithAttributes(attribute.String("name", key)))
+			})
+		})
+		return nil
+	}, gauge)
+	return err
+}
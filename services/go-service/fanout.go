@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+// storeSource is the fan-out branch backed by the DATA_STORE data layer
+const storeSource = "store"
+
+var dataSourceDuration metric.Float64Histogram
+
+// initFanoutMetrics creates the /data fan-out instrument
+func initFanoutMetrics() error {
+	var err error
+
+	dataSourceDuration, err = meter.Float64Histogram(
+		"data_source_fetch_duration_seconds",
+		metric.WithDescription("Time to fetch one /data source by source and outcome (ok, error, timeout, canceled)"),
+		metric.WithUnit("s"),
+	)
+	return err
+}
+
+// dataSource is one branch of the /data fan-out. Only a required source
+// failing fails the request; the others are left out of a partial response.
+type dataSource struct {
+	name     string
+	required bool
+	fetch    func(ctx context.Context) ([]dataItem, error)
+}
+
+// dataFanout is the /data source configuration, read once at startup
+var dataFanout = loadFanoutConfig()
+
+// fanoutConfig describes the simulated sources fetched next to the data store
+type fanoutConfig struct {
+	sources     []string
+	items       int
+	failureRate float64
+	timeout     time.Duration
+}
+
+func loadFanoutConfig() fanoutConfig {
+	return fanoutConfig{
+		sources:     splitList(envString("DATA_FANOUT_SOURCES", "inventory,pricing")),
+		items:       envInt("DATA_FANOUT_ITEMS", 5),
+		failureRate: envFloat("DATA_FANOUT_FAILURE_RATE", 0.05),
+		timeout:     envDuration("DATA_FANOUT_TIMEOUT", 150*time.Millisecond),
+	}
+}
+
+// dataSources are the /data branches: the data store, then each of
+// DATA_FANOUT_SOURCES
+func (c fanoutConfig) dataSources(limit int) []dataSource {
+	sources := []dataSource{{
+		name:     storeSource,
+		required: true,
+		fetch: func(ctx context.Context) ([]dataItem, error) {
+			start := time.Now()
+			items, err := dataLayer.items(ctx, limit)
+			recordTiming(ctx, "db", time.Since(start))
+			return items, err
+		},
+	}}
+	for _, name := range c.sources {
+		sources = append(sources, dataSource{name: name, fetch: c.simulatedSource(name)})
+	}
+	return sources
+}
+
+// simulatedSource answers after a random delay and fails at
+// DATA_FANOUT_FAILURE_RATE
+func (c fanoutConfig) simulatedSource(name string) func(ctx context.Context) ([]dataItem, error) {
+	return func(ctx context.Context) ([]dataItem, error) {
+		select {
+		case <-time.After(time.Duration(workloadRand.Intn(100)) * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if workloadRand.Float64() < c.failureRate {
+			return nil, fmt.Errorf("simulated %s failure", name)
+		}
+		items := make([]dataItem, c.items)
+		for i := range items {
+			items[i] = dataItem{ID: int64(i), Value: fmt.Sprintf("%s-%d", name, i)}
+		}
+		return items, nil
+	}
+}
+
+// fanoutResult merges the items of every source that answered, in source order
+type fanoutResult struct {
+	items  []dataItem
+	failed []string
+}
+
+// fetchDataSources queries the sources concurrently, each under its own
+// "fetch_data_source" span. A required source failing cancels the others
+// and is returned; an optional one failing or running past
+// DATA_FANOUT_TIMEOUT is only listed in failed.
+func (c fanoutConfig) fetchDataSources(ctx context.Context, sources []dataSource) (fanoutResult, error) {
+	g, gctx := errgroup.WithContext(ctx)
+	fetched := make([][]dataItem, len(sources))
+	failed := make([]bool, len(sources))
+
+	for i, src := range sources {
+		i, src := i, src
+		g.Go(func() error {
+			items, err := c.fetchDataSource(gctx, src)
+			if err == nil {
+				fetched[i] = items
+				return nil
+			}
+			if src.required {
+				return fmt.Errorf("%s: %w", src.name, err)
+			}
+			failed[i] = true
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return fanoutResult{}, err
+	}
+
+	var result fanoutResult
+	for i, src := range sources {
+		if failed[i] {
+			result.failed = append(result.failed, src.name)
+			continue
+		}
+		for _, item := range fetched[i] {
+			item.Source = src.name
+			result.items = append(result.items, item)
+		}
+	}
+	return result, nil
+}
+
+func (c fanoutConfig) fetchDataSource(ctx context.Context, src dataSource) ([]dataItem, error) {
+	ctx, span := tracer.Start(ctx, "fetch_data_source", trace.WithAttributes(
+		attribute.String("data.source", src.name),
+		attribute.Bool("data.source.required", src.required),
+	))
+	defer span.End()
+
+	if !src.required && c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	items, err := src.fetch(ctx)
+	outcome := "ok"
+	switch {
+	case err == nil:
+		span.SetAttributes(attribute.Int("data.source.items", len(items)))
+	case errors.Is(err, context.DeadlineExceeded):
+		outcome = "timeout"
+	case errors.Is(err, context.Canceled):
+		outcome = "canceled"
+	default:
+		outcome = "error"
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, outcome)
+	}
+	span.SetAttributes(attribute.String("data.source.outcome", outcome))
+	dataSourceDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("source", src.name),
+		attribute.String("outcome", outcome),
+	))
+	return items, err
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// faultRule injects a delay and/or error into a share of the requests it matches
+type faultRule struct {
+	ID          string     `json:"id"`
+	Route       string     `json:"route"`
+	Method      string     `json:"method,omitempty"`
+	Probability float64    `json:"probability"`
+	DelayMs     int        `json:"delay_ms,omitempty"`
+	Status      int        `json:"status,omitempty"`
+	TTL         string     `json:"ttl,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// validate normalizes a rule submitted through the admin API
+func (f *faultRule) validate(maxDelay time.Duration) error {
+	if f.Route == "" {
+		return fmt.Errorf("route is required")
+	}
+	if _, err := path.Match(f.Route, "/"); err != nil {
+		return fmt.Errorf("invalid route pattern: %v", err)
+	}
+	if f.Probability < 0 || f.Probability > 1 {
+		return fmt.Errorf("probability must be between 0 and 1")
+	}
+	if f.Probability == 0 {
+		f.Probability = 1
+	}
+	if f.DelayMs < 0 || time.Duration(f.DelayMs)*time.Millisecond > maxDelay {
+		return fmt.Errorf("delay_ms must be between 0 and %d", maxDelay.Milliseconds())
+	}
+	if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+		return fmt.Errorf("status must be a 4xx or 5xx code")
+	}
+	if f.DelayMs == 0 && f.Status == 0 {
+		return fmt.Errorf("a rule needs delay_ms and/or status")
+	}
+	f.Method = strings.ToUpper(f.Method)
+	f.ExpiresAt = nil
+	if f.TTL != "" {
+		ttl, err := time.ParseDuration(f.TTL)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid ttl %q", f.TTL)
+		}
+		expires := time.Now().Add(ttl)
+		f.ExpiresAt = &expires
+	}
+	return nil
+}
+
+func (f *faultRule) expired(now time.Time) bool {
+	return f.ExpiresAt != nil && now.After(*f.ExpiresAt)
+}
+
+// matches reports whether the rule covers r: route is either the registered
+// pattern serving r, "*", or a path.Match glob over the request path. Admin,
+// debug and probe endpoints are never matched so a rule cannot lock operators out.
+func (f *faultRule) matches(r *http.Request, route string) bool {
+	if f.Method != "" && f.Method != r.Method {
+		return false
+	}
+	for _, prefix := range []string{"/admin/", "/debug/", "/metrics", "/healthz", "/readyz"} {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+	if f.Route == "*" || f.Route == route {
+		return true
+	}
+	ok, _ := path.Match(f.Route, r.URL.Path)
+	return ok
+}
+
+// faultRuleSet holds the rules managed through /admin/faults
+type faultRuleSet struct {
+	mu    sync.RWMutex
+	rules map[string]*faultRule
+}
+
+var faultRules = &faultRuleSet{rules: map[string]*faultRule{}}
+
+// initFaultRuleMetrics reports how many rules are active
+func initFaultRuleMetrics() error {
+	active, err := meter.Int64ObservableGauge(
+		"chaos_fault_rules",
+		metric.WithDescription("Active fault injection rules"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(active, int64(len(faultRules.list())))
+		return nil
+	}, active)
+	return err
+}
+
+func (s *faultRuleSet) list() []*faultRule {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules := make([]*faultRule, 0, len(s.rules))
+	for id, rule := range s.rules {
+		if rule.expired(now) {
+			delete(s.rules, id)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].CreatedAt.Before(rules[j].CreatedAt) })
+	return rules
+}
+
+func (s *faultRuleSet) put(rule *faultRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules[rule.ID] = rule
+}
+
+func (s *faultRuleSet) get(id string) (*faultRule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rule, ok := s.rules[id]
+	return rule, ok && !rule.expired(time.Now())
+}
+
+func (s *faultRuleSet) remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.rules[id]
+	delete(s.rules, id)
+	return ok
+}
+
+// match returns the fault of the first matching rule that fires for r
+func (s *faultRuleSet) match(r *http.Request, route string) (fault, bool) {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, rule := range s.rules {
+		if rule.expired(now) || !rule.matches(r, route) || workloadRand.Float64() >= rule.Probability {
+			continue
+		}
+		return fault{
+			source: "rule",
+			ruleID: rule.ID,
+			delay:  time.Duration(rule.DelayMs) * time.Millisecond,
+			status: rule.Status,
+		}, true
+	}
+	return fault{}, false
+}
+
+func newFaultRuleID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// faultRulesResponse is the body of GET /admin/faults
+type faultRulesResponse struct {
+	Count int          `json:"count"`
+	Rules []*faultRule `json:"rules"`
+}
+
+// adminFaultsHandler serves /admin/faults (GET list, POST create) and
+// /admin/faults/{id} (GET, PUT replace, DELETE)
+func adminFaultsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/faults"), "/")
+	maxDelay := envDuration("CHAOS_MAX_DELAY", 10*time.Second)
+
+	writeJSON := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	writeError := func(status int, msg string) {
+		writeJSON(status, errorResponse{Error: msg})
+	}
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		rules := faultRules.list()
+		writeJSON(http.StatusOK, faultRulesResponse{Count: len(rules), Rules: rules})
+
+	case id == "" && r.Method == http.MethodPost, id != "" && r.Method == http.MethodPut:
+		var rule faultRule
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&rule); err != nil {
+			writeError(http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if err := rule.validate(maxDelay); err != nil {
+			writeError(http.StatusBadRequest, err.Error())
+			return
+		}
+		status := http.StatusCreated
+		rule.ID, rule.CreatedAt = newFaultRuleID(), time.Now()
+		if id != "" {
+			existing, ok := faultRules.get(id)
+			if !ok {
+				writeError(http.StatusNotFound, "fault rule not found")
+				return
+			}
+			status = http.StatusOK
+			rule.ID, rule.CreatedAt = id, existing.CreatedAt
+		}
+		faultRules.put(&rule)
+		logJSON(ctx, "WARN", "Fault rule saved", map[string]interface{}{
+			"rule_id":     rule.ID,
+			"route":       rule.Route,
+			"probability": rule.Probability,
+			"delay_ms":    rule.DelayMs,
+			"status":      rule.Status,
+			"ttl":         rule.TTL,
+		})
+		writeJSON(status, &rule)
+
+	case id != "" && r.Method == http.MethodGet:
+		rule, ok := faultRules.get(id)
+		if !ok {
+			writeError(http.StatusNotFound, "fault rule not found")
+			return
+		}
+		writeJSON(http.StatusOK, rule)
+
+	case id != "" && r.Method == http.MethodDelete:
+		if !faultRules.remove(id) {
+			writeError(http.StatusNotFound, "fault rule not found")
+			return
+		}
+		logJSON(ctx, "WARN", "Fault rule deleted", map[string]interface{}{"rule_id": id})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
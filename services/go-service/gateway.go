@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	upstreamRequests metric.Int64Counter
+	upstreamDuration metric.Float64Histogram
+	upstreamRetries  metric.Int64Counter
+)
+
+// initGatewayMetrics creates the per-upstream instruments
+func initGatewayMetrics() error {
+	var err error
+
+	upstreamRequests, err = meter.Int64Counter(
+		"upstream_requests_total",
+		metric.WithDescription("Proxied requests by upstream and response status class"),
+	)
+	if err != nil {
+		return err
+	}
+
+	upstreamDuration, err = meter.Float64Histogram(
+		"upstream_request_duration_seconds",
+		metric.WithDescription("Proxied request duration by upstream, including retries"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	upstreamRetries, err = meter.Int64Counter(
+		"upstream_retries_total",
+		metric.WithDescription("Retried upstream attempts"),
+	)
+	return err
+}
+
+// retryTransport retries idempotent, bodiless requests on connection errors
+// and gateway statuses while the upstream's retry budget allows; each attempt
+// gets its own client span
+type retryTransport struct {
+	base     http.RoundTripper
+	upstream string
+	retries  int
+	backoff  time.Duration
+	budget   *retryBudget
+}
+
+func (t *retryTransport) retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0
+	}
+	return false
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	span := trace.SpanFromContext(ctx)
+	t.budget.request()
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		retry := err != nil && ctx.Err() == nil
+		if resp != nil {
+			switch resp.StatusCode {
+			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				retry = true
+			}
+		}
+		if !retry || attempt >= t.retries || !t.retryable(req) {
+			span.SetAttributes(attribute.Int("upstream.attempts", attempt+1))
+			return resp, err
+		}
+		if !t.budget.tryRetry() {
+			// Retrying now would add load to an upstream that is already failing
+			span.SetAttributes(
+				attribute.Int("upstream.attempts", attempt+1),
+				attribute.Bool("retry.suppressed", true),
+			)
+			span.AddEvent("retry_suppressed", trace.WithAttributes(attribute.String("reason", "retry budget exhausted")))
+			retriesSuppressed.Add(ctx, 1, metric.WithAttributes(attribute.String("upstream", t.upstream)))
+			return resp, err
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+		upstreamRetries.Add(ctx, 1, metric.WithAttributes(attribute.String("upstream", t.upstream)))
+		span.AddEvent("upstream_retry", trace.WithAttributes(attribute.Int("attempt", attempt+1)))
+
+		select {
+		case <-time.After(t.backoff * time.Duration(attempt+1)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// gatewayRoute forwards a path prefix to one upstream
+type gatewayRoute struct {
+	prefix   string
+	upstream *url.URL
+	timeout  time.Duration
+	proxy    *httputil.ReverseProxy
+}
+
+// newGatewayRoute builds an instrumented reverse proxy for target. Outbound
+// requests carry the trace context and baggage, and X-Forwarded-* headers
+// describe the original client.
+func newGatewayRoute(prefix string, target *url.URL) *gatewayRoute {
+	route := &gatewayRoute{
+		prefix:   prefix,
+		upstream: target,
+		timeout:  envDuration("GATEWAY_TIMEOUT", 30*time.Second),
+	}
+	route.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		Transport: &retryTransport{
+			base:     newInstrumentedTransport(),
+			upstream: target.Host,
+			retries:  envInt("GATEWAY_RETRIES", 2),
+			backoff:  envDuration("GATEWAY_RETRY_BACKOFF", 100*time.Millisecond),
+			budget:   newRetryBudget(target.Host),
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if clientDisconnected(r.Context()) {
+				logJSON(r.Context(), "INFO", "Client disconnected before the upstream responded", map[string]interface{}{
+					"upstream": target.Host,
+				})
+				w.WriteHeader(statusClientClosedRequest)
+				return
+			}
+			span := trace.SpanFromContext(r.Context())
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "upstream request failed")
+			logJSON(r.Context(), "ERROR", "Upstream request failed", map[string]interface{}{
+				"upstream": target.Host,
+				"error":    err.Error(),
+			})
+			status := http.StatusBadGateway
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				status = http.StatusGatewayTimeout
+			case errors.Is(err, errBulkheadFull):
+				status = http.StatusServiceUnavailable
+			}
+			w.WriteHeader(status)
+		},
+	}
+	return route
+}
+
+func (g *gatewayRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ctx := r.Context()
+
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("upstream", g.upstream.Host),
+		attribute.String("upstream.prefix", g.prefix),
+	)
+
+	rec := newStatusRecorder(w)
+	g.proxy.ServeHTTP(rec, r.WithContext(ctx))
+
+	elapsed := time.Since(start).Seconds()
+	upstream := attribute.String("upstream", g.upstream.Host)
+	upstreamRequests.Add(ctx, 1, metric.WithAttributes(
+		upstream,
+		attribute.String("status_class", fmt.Sprintf("%dxx", rec.status/100)),
+	))
+	upstreamDuration.Record(ctx, elapsed, metric.WithAttributes(upstream))
+	countRequest(ctx, r.Method, g.prefix)
+	observeRequestDuration(ctx, r.Method, g.prefix, elapsed)
+}
+
+// loadGatewayRoutes parses GATEWAY_ROUTES ("/api/=http://backend:8080,...").
+// A "/" entry turns the service into a pure gateway in front of one upstream.
+func loadGatewayRoutes() ([]*gatewayRoute, error) {
+	var routes []*gatewayRoute
+	for _, pair := range splitList(envString("GATEWAY_ROUTES", "")) {
+		prefix, raw, ok := strings.Cut(pair, "=")
+		prefix = strings.TrimSpace(prefix)
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("invalid GATEWAY_ROUTES entry %q", pair)
+		}
+		target, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			return nil, fmt.Errorf("invalid upstream URL for %s: %q", prefix, raw)
+		}
+		routes = append(routes, newGatewayRoute(prefix, target))
+	}
+	return routes, nil
+}
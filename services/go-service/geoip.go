@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	geoRequests metric.Int64Counter
+	geoDuration metric.Float64Histogram
+)
+
+// initGeoMetrics creates the per-country request instruments
+func initGeoMetrics() error {
+	var err error
+
+	geoRequests, err = meter.Int64Counter(
+		"geo_requests_total",
+		metric.WithDescription("Requests by client country"),
+	)
+	if err != nil {
+		return err
+	}
+
+	geoDuration, err = meter.Float64Histogram(
+		"geo_request_duration_seconds",
+		metric.WithDescription("Request duration by client country"),
+		metric.WithUnit("s"),
+	)
+	return err
+}
+
+// geoLocation is the coarse location of a client
+type geoLocation struct {
+	Country string
+	Region  string
+}
+
+// geoResolver maps a request and its client address to a location; resolvers
+// are chained so a database can back up edge-provided headers
+type geoResolver interface {
+	lookup(r *http.Request, ip net.IP) (geoLocation, bool)
+}
+
+// headerGeoResolver reads location headers set by a CDN or edge proxy. Any
+// client can send them, so they are only read from connections whose peer
+// is in TRUSTED_PROXIES.
+type headerGeoResolver struct {
+	countryHeader string
+	regionHeader  string
+}
+
+func (h headerGeoResolver) lookup(r *http.Request, _ net.IP) (geoLocation, bool) {
+	if h.countryHeader == "" || !fromTrustedProxy(r) {
+		return geoLocation{}, false
+	}
+	// Only ISO alpha-2 codes are accepted so a forged header cannot add series
+	country := r.Header.Get(h.countryHeader)
+	if len(country) != 2 {
+		return geoLocation{}, false
+	}
+	loc := geoLocation{Country: strings.ToUpper(country)}
+	if h.regionHeader != "" {
+		loc.Region = r.Header.Get(h.regionHeader)
+	}
+	return loc, true
+}
+
+// privateGeoResolver labels loopback and private addresses as "internal"
+type privateGeoResolver struct{}
+
+func (privateGeoResolver) lookup(_ *http.Request, ip net.IP) (geoLocation, bool) {
+	if ip != nil && (ip.IsLoopback() || ip.IsPrivate()) {
+		return geoLocation{Country: "internal"}, true
+	}
+	return geoLocation{}, false
+}
+
+// cidrGeoEntry is one network from the GEOIP_CSV database
+type cidrGeoEntry struct {
+	network *net.IPNet
+	loc     geoLocation
+}
+
+// cidrGeoResolver looks addresses up in a "network,country[,region]" CSV,
+// the shape of a flattened MaxMind GeoLite2 country/city export
+type cidrGeoResolver struct {
+	entries []cidrGeoEntry
+}
+
+func loadCIDRGeoResolver(path string) (*cidrGeoResolver, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := &cidrGeoResolver{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ",")
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		_, network, err := net.ParseCIDR(strings.TrimSpace(fields[0]))
+		if err != nil {
+			// Header rows and malformed lines are skipped
+			continue
+		}
+		entry := cidrGeoEntry{network: network, loc: geoLocation{Country: strings.ToUpper(strings.TrimSpace(fields[1]))}}
+		if len(fields) > 2 {
+			entry.loc.Region = strings.TrimSpace(fields[2])
+		}
+		res.entries = append(res.entries, entry)
+	}
+
+	// Most specific networks first so the first match wins
+	sort.Slice(res.entries, func(i, j int) bool {
+		a, _ := res.entries[i].network.Mask.Size()
+		b, _ := res.entries[j].network.Mask.Size()
+		return a > b
+	})
+	return res, scanner.Err()
+}
+
+func (c *cidrGeoResolver) lookup(_ *http.Request, ip net.IP) (geoLocation, bool) {
+	if ip == nil {
+		return geoLocation{}, false
+	}
+	for _, e := range c.entries {
+		if e.network.Contains(ip) {
+			return e.loc, true
+		}
+	}
+	return geoLocation{}, false
+}
+
+// geoResolvers tries each resolver in order
+type geoResolvers []geoResolver
+
+func (g geoResolvers) locate(r *http.Request) geoLocation {
+	ip := net.ParseIP(clientIP(r))
+	for _, res := range g {
+		if loc, ok := res.lookup(r, ip); ok {
+			return loc
+		}
+	}
+	return geoLocation{Country: "unknown"}
+}
+
+// geoIP is shared by the geo middleware and the OTLP proxy
+var geoIP = newGeoResolvers()
+
+// newGeoResolvers chains edge headers from trusted proxies, the optional
+// GEOIP_CSV database and the private address check
+func newGeoResolvers() geoResolvers {
+	resolvers := geoResolvers{headerGeoResolver{
+		countryHeader: envString("GEOIP_COUNTRY_HEADER", envString("OTLP_PROXY_GEO_HEADER", "CF-IPCountry")),
+		regionHeader:  envString("GEOIP_REGION_HEADER", ""),
+	}}
+	if path := os.Getenv("GEOIP_CSV"); path != "" {
+		db, err := loadCIDRGeoResolver(path)
+		if err != nil {
+			logJSON(context.Background(), "ERROR", "Failed to load GeoIP database", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+		} else {
+			resolvers = append(resolvers, db)
+		}
+	}
+	return append(resolvers, privateGeoResolver{})
+}
+
+// trackGeo adds client country and region attributes to the server span and
+// records coarse per-country request metrics when GEOIP is enabled
+func trackGeo(next http.Handler) http.Handler {
+	if !envBool("GEOIP", false) {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if telemetryExcluded(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		ctx := r.Context()
+
+		loc := geoIP.locate(r)
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.String("client.geo.country_iso_code", loc.Country))
+		if loc.Region != "" {
+			span.SetAttributes(attribute.String("client.geo.region", loc.Region))
+		}
+
+		next.ServeHTTP(w, r)
+
+		// Regions stay on spans only; countries keep the series count bounded
+		attrs := metric.WithAttributes(attribute.String("country", loc.Country))
+		geoRequests.Add(ctx, 1, attrs)
+		geoDuration.Record(ctx, time.Since(start).Seconds(), attrs)
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-service/events"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// grpcErrorKind is where an internal error lands in the gRPC status space;
+// retryable kinds carry a RetryInfo hint so clients back off sensibly
+type grpcErrorKind struct {
+	code      codes.Code
+	reason    string
+	retryable bool
+}
+
+// grpcErrorDomain identifies the service in ErrorInfo details
+const grpcErrorDomain = "go-service"
+
+// classifyGRPCError maps the internal error taxonomy (context errors, the
+// search dependency's error kinds, object store and event bus errors)
+func classifyGRPCError(err error) grpcErrorKind {
+	var se *searchError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return grpcErrorKind{codes.DeadlineExceeded, "TIMEOUT", true}
+	case errors.Is(err, context.Canceled):
+		return grpcErrorKind{codes.Canceled, "CANCELED", false}
+	case errors.Is(err, errBulkheadFull):
+		return grpcErrorKind{codes.ResourceExhausted, "BULKHEAD_FULL", true}
+	case errors.Is(err, errNoSuchObject), errors.Is(err, errNoSuchBucket):
+		return grpcErrorKind{codes.NotFound, "OBJECT_NOT_FOUND", false}
+	case errors.Is(err, events.ErrClosed):
+		return grpcErrorKind{codes.Unavailable, "EVENT_BUS_CLOSED", true}
+	case errors.As(err, &se):
+		switch se.kind {
+		case "canceled":
+			return grpcErrorKind{codes.Canceled, "CANCELED", false}
+		case "timeout":
+			return grpcErrorKind{codes.DeadlineExceeded, "SEARCH_TIMEOUT", true}
+		case "connection":
+			return grpcErrorKind{codes.Unavailable, "SEARCH_UNREACHABLE", true}
+		case "rejected":
+			return grpcErrorKind{codes.ResourceExhausted, "SEARCH_REJECTED", true}
+		case "bad_query":
+			return grpcErrorKind{codes.InvalidArgument, "SEARCH_BAD_QUERY", false}
+		case "index_not_found":
+			return grpcErrorKind{codes.NotFound, "SEARCH_INDEX_NOT_FOUND", false}
+		case "unauthorized":
+			return grpcErrorKind{codes.PermissionDenied, "SEARCH_UNAUTHORIZED", false}
+		default:
+			return grpcErrorKind{codes.Internal, "SEARCH_SERVER_ERROR", false}
+		}
+	}
+	return grpcErrorKind{codes.Unknown, "UNKNOWN", false}
+}
+
+// grpcStatusError turns err into a status error with an ErrorInfo detail
+// (reason and the Go error type) and, when retryable, a RetryInfo detail.
+// Errors that already are statuses pass through unchanged.
+func grpcStatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	kind := classifyGRPCError(err)
+	st := status.New(kind.code, err.Error())
+	if withInfo, derr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   kind.reason,
+		Domain:   grpcErrorDomain,
+		Metadata: map[string]string{"error_type": fmt.Sprintf("%T", err)},
+	}); derr == nil {
+		st = withInfo
+	}
+	if kind.retryable {
+		delay := envDuration("GRPC_RETRY_DELAY", time.Second)
+		// Overloaded dependencies get a longer pause than transient failures
+		if kind.code == codes.ResourceExhausted {
+			delay *= 2
+		}
+		if withRetry, derr := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}); derr == nil {
+			st = withRetry
+		}
+	}
+	return st.Err()
+}
+
+// unaryStatusErrors converts handler errors into rich status errors
+func unaryStatusErrors(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	return resp, grpcStatusError(err)
+}
+
+// streamStatusErrors converts stream handler errors into rich status errors
+func streamStatusErrors(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return grpcStatusError(handler(srv, ss))
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// grpcHealth implements grpc.health.v1 for Kubernetes gRPC probes and
+// grpcurl; its statuses follow the same readiness as /readyz
+var grpcHealth = health.NewServer()
+
+// grpcHealthServices are reported next to the overall ("") status, so probes
+// may name a service or leave it empty
+var grpcHealthServices = splitList(envString("GRPC_HEALTH_SERVICES", "go-service"))
+
+// setReady flips readiness for /readyz and every gRPC health service
+func setReady(ok bool) {
+	ready.Store(ok)
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if ok {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	grpcHealth.SetServingStatus("", status)
+	for _, service := range grpcHealthServices {
+		grpcHealth.SetServingStatus(service, status)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	goservicev1 "go-service/proto/goservice/v1"
+)
+
+// goService implements the generated GoService API on top of the same data
+// layer as the HTTP handlers
+type goService struct {
+	goservicev1.UnimplementedGoServiceServer
+}
+
+func (goService) GetInfo(ctx context.Context, _ *goservicev1.GetInfoRequest) (*goservicev1.GetInfoResponse, error) {
+	logJSON(ctx, "INFO", "Processing GetInfo", nil)
+	return &goservicev1.GetInfoResponse{
+		Service:   "go",
+		Message:   "Hello from Go service!",
+		Version:   version,
+		Timestamp: time.Now().Unix(),
+	}, nil
+}
+
+func (goService) GetData(ctx context.Context, req *goservicev1.GetDataRequest) (*goservicev1.GetDataResponse, error) {
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = 10
+	}
+	if limit < 0 || limit > 100 {
+		return nil, status.Error(codes.InvalidArgument, "limit must be between 0 and 100")
+	}
+
+	data, err := dataLayer.items(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	resp := &goservicev1.GetDataResponse{Store: dataLayer.name()}
+	for _, item := range data {
+		resp.Items = append(resp.Items, &goservicev1.Item{Id: item.ID, Value: item.Value})
+	}
+	logJSON(ctx, "INFO", "Retrieved items", map[string]interface{}{"item_count": len(resp.Items)})
+	return resp, nil
+}
+
+func (goService) TriggerError(ctx context.Context, _ *goservicev1.TriggerErrorRequest) (*goservicev1.TriggerErrorResponse, error) {
+	logJSON(ctx, "ERROR", "Simulated error occurred", map[string]interface{}{
+		"error_type": "SimulatedError",
+	})
+	return nil, status.Error(codes.Internal, "This is a simulated error")
+}
+
+// serveGRPC runs the gRPC listener on GRPC_ADDR, or a systemd "grpc" socket;
+// it is off when neither is set.
+// Calls get server spans and rpc_* metrics from otelgrpc.
+func serveGRPC(ctx context.Context) {
+	addr := envString("GRPC_ADDR", "")
+	lis := socketActivation.grpc
+	if lis == nil {
+		if addr == "" {
+			return
+		}
+		var err error
+		if lis, err = listen(addr); err != nil {
+			logJSON(ctx, "ERROR", "Failed to listen for gRPC", map[string]interface{}{
+				"addr":  addr,
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
+	server := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(unaryStatusErrors),
+		grpc.ChainStreamInterceptor(streamStatusErrors),
+	)
+	healthpb.RegisterHealthServer(server, grpcHealth)
+	goservicev1.RegisterGoServiceServer(server, goService{})
+	// Reflection lets grpcurl list and call services without the proto files
+	if envBool("GRPC_REFLECTION", true) {
+		reflection.Register(server)
+	}
+
+	binaryUpgrader.inherit("grpc", lis)
+	binaryUpgrader.onDrain(func(ctx context.Context) {
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			server.Stop()
+		}
+	})
+
+	logJSON(ctx, "INFO", "gRPC server starting", map[string]interface{}{"addr": lis.Addr().String()})
+	if err := server.Serve(lis); err != nil {
+		logJSON(ctx, "ERROR", "gRPC server stopped", map[string]interface{}{"error": err.Error()})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sensitiveHeaders are recorded as redacted even when allowlisted
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+// appendHeaderAttributes appends http.{request,response}.header.<name>
+// attributes following the semantic conventions (lowercase name, string
+// array value)
+func appendHeaderAttributes(attrs []attribute.KeyValue, prefix string, names []string, h http.Header) []attribute.KeyValue {
+	for _, name := range names {
+		values := h.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		if sensitiveHeaders[name] {
+			values = []string{redacted}
+		}
+		attrs = append(attrs, attribute.StringSlice(prefix+name, values))
+	}
+	return attrs
+}
+
+func lowerList(value string) []string {
+	names := splitList(value)
+	for i, name := range names {
+		names[i] = strings.ToLower(name)
+	}
+	return names
+}
+
+// captureHeaders records the allowlisted request and response headers on the span
+func captureHeaders(next http.Handler) http.Handler {
+	requestHeaders := lowerList(envString("HTTP_CAPTURE_REQUEST_HEADERS", "user-agent,x-request-id"))
+	responseHeaders := lowerList(envString("HTTP_CAPTURE_RESPONSE_HEADERS", "content-type"))
+
+	if len(requestHeaders) == 0 && len(responseHeaders) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		attrs := getAttrs()
+		defer putAttrs(attrs)
+
+		*attrs = appendHeaderAttributes(*attrs, "http.request.header.", requestHeaders, r.Header)
+		span.SetAttributes(*attrs...)
+
+		next.ServeHTTP(w, r)
+
+		*attrs = appendHeaderAttributes((*attrs)[:0], "http.response.header.", responseHeaders, w.Header())
+		span.SetAttributes(*attrs...)
+	})
+}
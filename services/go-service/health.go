@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// ready flips to true once telemetry and routes are initialized
+var ready atomic.Bool
+
+// statusResponse is the body of /healthz and /readyz
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statusResponse{Status: "ok"})
+}
+
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(statusResponse{Status: "starting"})
+		return
+	}
+	json.NewEncoder(w).Encode(statusResponse{Status: "ready"})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// processStart is used for the uptime gauge
+var processStart = time.Now()
+
+var (
+	heartbeats metric.Int64Counter
+
+	// Unix nanoseconds of the last export the collector accepted, per signal
+	lastTraceExport  atomic.Int64
+	lastMetricExport atomic.Int64
+)
+
+// initHeartbeatMetrics creates the uptime, heartbeat and export freshness instruments
+func initHeartbeatMetrics() error {
+	var err error
+
+	heartbeats, err = meter.Int64Counter(
+		"heartbeat_total",
+		metric.WithDescription("Incremented every HEARTBEAT_INTERVAL while the process is alive"),
+	)
+	if err != nil {
+		return err
+	}
+
+	uptime, err := meter.Float64ObservableGauge(
+		"process_uptime_seconds",
+		metric.WithDescription("Seconds since the process started"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	lastExport, err := meter.Float64ObservableGauge(
+		"telemetry_last_successful_export_timestamp_seconds",
+		metric.WithDescription("Unix time of the last export accepted by the collector, by signal"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveFloat64(uptime, time.Since(processStart).Seconds())
+		for signal, last := range map[string]*atomic.Int64{"traces": &lastTraceExport, "metrics": &lastMetricExport} {
+			// Nothing is reported until the first export succeeds, so absence alerts fire
+			if ns := last.Load(); ns > 0 {
+				o.ObserveFloat64(lastExport, float64(ns)/1e9, metric.WithAttributes(attribute.String("signal", signal)))
+			}
+		}
+		return nil
+	}, uptime, lastExport)
+	return err
+}
+
+// beat increments the heartbeat counter until ctx is cancelled
+func beat(ctx context.Context) {
+	ticker := time.NewTicker(envDuration("HEARTBEAT_INTERVAL", 15*time.Second))
+	defer ticker.Stop()
+
+	for {
+		heartbeats.Add(ctx, 1)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// exportTrackingSpanExporter records when span exports succeed and counts
+// the spans of failed ones
+type exportTrackingSpanExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (e exportTrackingSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err == nil {
+		lastTraceExport.Store(time.Now().UnixNano())
+	} else {
+		recordTelemetryDrop("traces", "export_failed", len(spans))
+	}
+	return err
+}
+
+// exportTrackingMetricExporter records when metric exports succeed and
+// counts the data points of failed ones
+type exportTrackingMetricExporter struct {
+	sdkmetric.Exporter
+}
+
+func (e exportTrackingMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	err := e.Exporter.Export(ctx, rm)
+	if err == nil {
+		lastMetricExport.Store(time.Now().UnixNano())
+	} else {
+		recordTelemetryDrop("metrics", "export_failed", dataPoints(rm))
+	}
+	return err
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// hedgeLatencySamples is how many recent latencies per host the hedge delay
+// percentile is computed from
+const hedgeLatencySamples = 256
+
+var hedges metric.Int64Counter
+
+// initHedgeMetrics creates the request hedging instrument
+func initHedgeMetrics() error {
+	var err error
+
+	hedges, err = meter.Int64Counter(
+		"http_client_hedges_total",
+		metric.WithDescription("Hedged outbound requests by host and outcome (fired, won, wasted)"),
+	)
+	return err
+}
+
+// hostLatency keeps a ring of recent successful attempt latencies for a host
+type hostLatency struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (h *hostLatency) record(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) < hedgeLatencySamples {
+		h.samples = append(h.samples, d)
+		return
+	}
+	h.samples[h.next] = d
+	h.next = (h.next + 1) % hedgeLatencySamples
+}
+
+// percentile returns the p-th latency, or fallback until minSamples are known
+func (h *hostLatency) percentile(p float64, minSamples int, fallback time.Duration) time.Duration {
+	h.mu.Lock()
+	sorted := append([]time.Duration(nil), h.samples...)
+	h.mu.Unlock()
+	if len(sorted) < minSamples {
+		return fallback
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+}
+
+// hedgingTransport sends a second attempt of an idempotent request when the
+// first has not answered within the host's pN latency, and returns whichever
+// succeeds first. Every attempt runs under its own "HTTP attempt" span.
+type hedgingTransport struct {
+	base       http.RoundTripper
+	hosts      map[string]bool
+	percentile float64
+	minSamples int
+	fallback   time.Duration
+	minDelay   time.Duration
+
+	mu      sync.Mutex
+	latency map[string]*hostLatency
+}
+
+// newHedgingTransport wraps base for the hosts in HEDGE_HOSTS ("*" for all);
+// hedging is off when it is empty
+func newHedgingTransport(base http.RoundTripper) http.RoundTripper {
+	hosts := routeSet(envString("HEDGE_HOSTS", ""))
+	if len(hosts) == 0 {
+		return base
+	}
+	percentile := envFloat("HEDGE_PERCENTILE", 0.95)
+	if percentile <= 0 || percentile > 1 {
+		percentile = 0.95
+	}
+	return &hedgingTransport{
+		base:       base,
+		hosts:      hosts,
+		percentile: percentile,
+		minSamples: envInt("HEDGE_MIN_SAMPLES", 20),
+		fallback:   envDuration("HEDGE_DELAY", 100*time.Millisecond),
+		minDelay:   envDuration("HEDGE_MIN_DELAY", 10*time.Millisecond),
+		latency:    map[string]*hostLatency{},
+	}
+}
+
+func (t *hedgingTransport) hedges(req *http.Request) bool {
+	if !t.hosts["*"] && !t.hosts[req.URL.Host] && !t.hosts[req.URL.Hostname()] {
+		return false
+	}
+	// Only requests that are safe to send twice
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return req.Body == nil || req.Body == http.NoBody
+	}
+	return false
+}
+
+func (t *hedgingTransport) hostLatency(host string) *hostLatency {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.latency[host]
+	if !ok {
+		h = &hostLatency{}
+		t.latency[host] = h
+	}
+	return h
+}
+
+// hedgeAttempt is the outcome of one attempt
+type hedgeAttempt struct {
+	number int
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+	span   trace.Span
+}
+
+func (a hedgeAttempt) succeeded() bool {
+	return a.err == nil && a.resp.StatusCode < 500
+}
+
+// discard releases a losing or failed attempt
+func (a hedgeAttempt) discard() {
+	a.cancel()
+	if a.resp != nil {
+		a.resp.Body.Close()
+	}
+	a.span.SetAttributes(attribute.Bool("hedge.won", false))
+	a.span.End()
+}
+
+func (t *hedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.hedges(req) {
+		return t.base.RoundTrip(req)
+	}
+	ctx := req.Context()
+	host := req.URL.Host
+	latency := t.hostLatency(host)
+	delay := latency.percentile(t.percentile, t.minSamples, t.fallback)
+	if delay < t.minDelay {
+		delay = t.minDelay
+	}
+
+	results := make(chan hedgeAttempt, 2)
+	cancels := map[int]context.CancelFunc{}
+	launch := func(number int) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		attemptCtx, span := tracer.Start(attemptCtx, "HTTP attempt", trace.WithAttributes(
+			attribute.Int("hedge.attempt", number),
+			attribute.String("server.address", host),
+			attribute.Float64("hedge.delay_ms", float64(delay.Microseconds())/1000),
+		))
+		cancels[number] = cancel
+		go func() {
+			start := time.Now()
+			resp, err := t.base.RoundTrip(req.Clone(attemptCtx))
+			a := hedgeAttempt{number: number, resp: resp, err: err, cancel: cancel, span: span}
+			if a.succeeded() {
+				latency.record(time.Since(start))
+			}
+			results <- a
+		}()
+	}
+
+	launch(1)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending, fired := 1, false
+	for {
+		select {
+		case <-timer.C:
+			fired = true
+			pending++
+			hedges.Add(ctx, 1, metric.WithAttributes(attribute.String("host", host), attribute.String("outcome", "fired")))
+			trace.SpanFromContext(ctx).AddEvent("hedge_fired", trace.WithAttributes(attribute.Float64("delay_ms", float64(delay.Microseconds())/1000)))
+			launch(2)
+			continue
+		case a := <-results:
+			pending--
+			if !a.succeeded() && pending > 0 {
+				a.discard()
+				continue
+			}
+			timer.Stop()
+
+			// a is the answer; cancel and drain the attempt still in flight
+			for number, cancel := range cancels {
+				if number != a.number {
+					cancel()
+				}
+			}
+			if pending > 0 {
+				go func() { (<-results).discard() }()
+			}
+			if fired {
+				outcome := "wasted"
+				if a.number == 2 {
+					outcome = "won"
+				}
+				hedges.Add(ctx, 1, metric.WithAttributes(attribute.String("host", host), attribute.String("outcome", outcome)))
+			}
+			a.span.SetAttributes(attribute.Bool("hedge.won", a.succeeded()))
+			a.span.End()
+			if a.err != nil {
+				a.cancel()
+				return nil, a.err
+			}
+			a.resp.Body = &cancelOnClose{ReadCloser: a.resp.Body, cancel: a.cancel}
+			return a.resp, nil
+		}
+	}
+}
+
+// cancelOnClose releases the winning attempt's context once its body is done
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// durationUnits are the units of the latency histograms: ours record
+// seconds, otelhttp and otelgrpc record milliseconds
+var durationUnits = map[string]bool{"s": true, "ms": true}
+
+// exponentialHistogramView switches duration histograms to base-2 exponential
+// aggregation when METRICS_HISTOGRAM_AGGREGATION=exponential, so OTLP backends
+// and Prometheus native histograms get percentiles without fixed bucket
+// boundaries. METRICS_EXPONENTIAL_INSTRUMENTS limits it to a list of
+// instrument names; ok is false when explicit buckets are kept.
+func exponentialHistogramView() (view sdkmetric.View, ok bool) {
+	mode := strings.ToLower(envString("METRICS_HISTOGRAM_AGGREGATION", "explicit"))
+	if mode != "exponential" {
+		return nil, false
+	}
+
+	aggregation := sdkmetric.AggregationBase2ExponentialHistogram{
+		MaxSize:  int32(envInt("METRICS_EXPONENTIAL_MAX_SIZE", 160)),
+		MaxScale: int32(envInt("METRICS_EXPONENTIAL_MAX_SCALE", 20)),
+	}
+	names := routeSet(envString("METRICS_EXPONENTIAL_INSTRUMENTS", ""))
+
+	return func(inst sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+		if inst.Kind != sdkmetric.InstrumentKindHistogram {
+			return sdkmetric.Stream{}, false
+		}
+		if len(names) > 0 {
+			if !names[inst.Name] {
+				return sdkmetric.Stream{}, false
+			}
+		} else if !durationUnits[inst.Unit] {
+			return sdkmetric.Stream{}, false
+		}
+		return sdkmetric.Stream{
+			Name:        inst.Name,
+			Description: inst.Description,
+			Unit:        inst.Unit,
+			Aggregation: aggregation,
+		}, true
+	}, true
+}
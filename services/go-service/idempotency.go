@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// idempotencyHeader is the request header naming a retry-safe operation
+const idempotencyHeader = "Idempotency-Key"
+
+// replayedHeaders are the response headers stored with a cached response;
+// per-request headers such as Server-Timing belong to the replay itself
+var replayedHeaders = []string{"Content-Type", "Content-Disposition", "Location", "ETag"}
+
+var idempotencyRequests metric.Int64Counter
+
+// initIdempotencyMetrics creates the idempotency key instruments
+func initIdempotencyMetrics() error {
+	var err error
+
+	idempotencyRequests, err = meter.Int64Counter(
+		"idempotency_requests_total",
+		metric.WithDescription("Requests carrying an Idempotency-Key by route and outcome (original, replayed, conflict, mismatch, uncached)"),
+	)
+	if err != nil {
+		return err
+	}
+
+	entries, err := meter.Int64ObservableGauge(
+		"idempotency_cache_entries",
+		metric.WithDescription("Idempotency keys currently cached, including in-flight requests"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(entries, int64(idempotencyCache.size()))
+		return nil
+	}, entries)
+	return err
+}
+
+// idempotentResponse is a response remembered for an Idempotency-Key; it is
+// pending until the original request completes
+type idempotentResponse struct {
+	fingerprint [32]byte
+	pending     bool
+	status      int
+	header      http.Header
+	body        []byte
+	traceID     string
+	expires     time.Time
+}
+
+// idempotencyStore keeps responses to mutating requests for IDEMPOTENCY_TTL
+type idempotencyStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*idempotentResponse
+}
+
+var idempotencyCache = &idempotencyStore{
+	ttl:        envDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+	maxEntries: envInt("IDEMPOTENCY_MAX_ENTRIES", 10000),
+	entries:    map[string]*idempotentResponse{},
+}
+
+func (s *idempotencyStore) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// begin returns the cached entry for key, or reserves key for a new request
+// with fingerprint; reserved is false when the store is full
+func (s *idempotencyStore) begin(key string, fingerprint [32]byte) (cached idempotentResponse, found, reserved bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := s.entries[key]; ok && (e.pending || now.Before(e.expires)) {
+		return *e, true, false
+	}
+	if len(s.entries) >= s.maxEntries {
+		for k, e := range s.entries {
+			if !e.pending && now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		if len(s.entries) >= s.maxEntries {
+			return idempotentResponse{}, false, false
+		}
+	}
+	s.entries[key] = &idempotentResponse{fingerprint: fingerprint, pending: true}
+	return idempotentResponse{}, false, true
+}
+
+// finish stores the original response, or forgets key when the response
+// should not be replayed
+func (s *idempotencyStore) finish(key string, resp *idempotentResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if resp == nil {
+		delete(s.entries, key)
+		return
+	}
+	resp.expires = time.Now().Add(s.ttl)
+	s.entries[key] = resp
+}
+
+// idempotentRequests makes mutating requests carrying an Idempotency-Key
+// safe to retry: the first response is cached and replayed to retries with
+// the same key and body, a retry racing the original gets 409 and reusing a
+// key for a different request gets 422. Server errors are not cached so the
+// operation can be retried.
+func idempotentRequests(next http.Handler) http.Handler {
+	maxBody := envInt("IDEMPOTENCY_MAX_BODY_BYTES", 1<<20)
+	apiKeyHeader := envString("CLIENT_METRICS_API_KEY_HEADER", "X-API-Key")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		span := trace.SpanFromContext(ctx)
+		route := routeOf(r)
+		outcome := func(o string) {
+			span.SetAttributes(attribute.String("idempotency.outcome", o))
+			idempotencyRequests.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("route", route),
+				attribute.String("outcome", o),
+			))
+		}
+		span.SetAttributes(attribute.String("idempotency.key", key))
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, int64(maxBody)+1))
+		if err != nil {
+			writeIdempotencyError(w, http.StatusBadRequest, "could not read request body")
+			return
+		}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if len(body) > maxBody {
+			// Too large to fingerprint; serve it without replay protection
+			outcome("uncached")
+			next.ServeHTTP(w, r)
+			return
+		}
+		fingerprint := sha256.Sum256(append([]byte(r.Method+" "+r.URL.Path+"\n"), body...))
+
+		// Keys are chosen by clients, so each caller gets its own namespace:
+		// another caller reusing a key neither sees this response nor blocks it
+		key = idempotencyPrincipal(r, apiKeyHeader) + "\x00" + key
+
+		cached, found, reserved := idempotencyCache.begin(key, fingerprint)
+		switch {
+		case found && cached.fingerprint != fingerprint:
+			outcome("mismatch")
+			writeIdempotencyError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			return
+		case found && cached.pending:
+			outcome("conflict")
+			writeIdempotencyError(w, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+			return
+		case found:
+			outcome("replayed")
+			span.SetAttributes(
+				attribute.Bool("idempotency.replayed", true),
+				attribute.String("idempotency.original_trace_id", cached.traceID),
+			)
+			for name, values := range cached.header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(cached.status)
+			w.Write(cached.body)
+			return
+		case !reserved:
+			outcome("uncached")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		outcome("original")
+		span.SetAttributes(attribute.Bool("idempotency.replayed", false))
+		status := newStatusRecorder(w)
+		rec := &bodyRecorder{ResponseWriter: status, max: maxBody}
+		completed := false
+		defer func() {
+			// A panicking handler releases the key instead of caching a response
+			if !completed || status.status >= 500 || rec.truncated {
+				idempotencyCache.finish(key, nil)
+				return
+			}
+			header := http.Header{}
+			for _, name := range replayedHeaders {
+				if v := w.Header().Values(name); len(v) > 0 {
+					header[name] = v
+				}
+			}
+			idempotencyCache.finish(key, &idempotentResponse{
+				fingerprint: fingerprint,
+				status:      status.status,
+				header:      header,
+				body:        rec.buf.Bytes(),
+				traceID:     span.SpanContext().TraceID().String(),
+			})
+		}()
+		next.ServeHTTP(rec, r)
+		completed = true
+	})
+}
+
+// idempotencyPrincipal identifies the caller that owns an Idempotency-Key: a
+// hash of its Authorization header or API key, or its address when it sends
+// neither
+func idempotencyPrincipal(r *http.Request, apiKeyHeader string) string {
+	for _, name := range []string{"Authorization", apiKeyHeader} {
+		if v := r.Header.Get(name); v != "" {
+			sum := sha256.Sum256([]byte(v))
+			return name + ":" + hex.EncodeToString(sum[:])
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+func writeIdempotencyError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: msg})
+}
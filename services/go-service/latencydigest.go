@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyBucketGrowth is the ratio between neighbouring digest buckets, so
+// reported percentiles are within 1% of the recorded latency
+const latencyBucketGrowth = 1.02
+
+// latencySlice holds the latencies recorded during one slice of the window,
+// bucketed logarithmically by microseconds like an HDR histogram
+type latencySlice struct {
+	start   time.Time
+	buckets map[int]uint64
+	count   uint64
+	errors  uint64 // 5xx responses among count
+	sum     time.Duration
+	max     time.Duration
+}
+
+// latencyDigest keeps a sliding window of per-route latency histograms made
+// of rotating slices, so /admin/latency can answer percentiles in process
+// when the metrics backend is lagging or down
+type latencyDigest struct {
+	mu     sync.Mutex
+	window time.Duration
+	slice  time.Duration
+	routes map[string][]*latencySlice
+}
+
+var latencyDigests = newLatencyDigest(
+	envDuration("LATENCY_DIGEST_WINDOW", time.Minute),
+	envInt("LATENCY_DIGEST_SLICES", 6),
+)
+
+func newLatencyDigest(window time.Duration, slices int) *latencyDigest {
+	if slices < 1 {
+		slices = 1
+	}
+	return &latencyDigest{
+		window: window,
+		slice:  window / time.Duration(slices),
+		routes: map[string][]*latencySlice{},
+	}
+}
+
+func latencyBucket(d time.Duration) int {
+	us := float64(d.Microseconds())
+	if us < 1 {
+		return 0
+	}
+	return int(math.Ceil(math.Log(us) / math.Log(latencyBucketGrowth)))
+}
+
+// bucketUpper is the largest latency a bucket holds
+func bucketUpper(bucket int) time.Duration {
+	return time.Duration(math.Pow(latencyBucketGrowth, float64(bucket)) * float64(time.Microsecond))
+}
+
+// expire drops slices that fell out of the window; callers hold d.mu
+func (d *latencyDigest) expire(route string, now time.Time) []*latencySlice {
+	slices := d.routes[route]
+	kept := slices[:0]
+	for _, s := range slices {
+		if now.Sub(s.start) < d.window {
+			kept = append(kept, s)
+		}
+	}
+	d.routes[route] = kept
+	return kept
+}
+
+func (d *latencyDigest) record(route string, latency time.Duration, failed bool) {
+	if d.window <= 0 {
+		return
+	}
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	slices := d.expire(route, now)
+	var current *latencySlice
+	if n := len(slices); n > 0 && now.Sub(slices[n-1].start) < d.slice {
+		current = slices[n-1]
+	} else {
+		current = &latencySlice{start: now, buckets: map[int]uint64{}}
+		d.routes[route] = append(slices, current)
+	}
+	current.buckets[latencyBucket(latency)]++
+	current.count++
+	if failed {
+		current.errors++
+	}
+	current.sum += latency
+	if latency > current.max {
+		current.max = latency
+	}
+}
+
+// routeLatency is one route's row in /admin/latency
+type routeLatency struct {
+	Route     string  `json:"route"`
+	Count     uint64  `json:"count"`
+	Errors    uint64  `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	MeanMs    float64 `json:"mean_ms"`
+	P50Ms     float64 `json:"p50_ms"`
+	P95Ms     float64 `json:"p95_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+	MaxMs     float64 `json:"max_ms"`
+}
+
+// snapshot merges each route's live slices and reads its percentiles
+func (d *latencyDigest) snapshot() []routeLatency {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := []routeLatency{}
+	for route := range d.routes {
+		slices := d.expire(route, now)
+		if len(slices) == 0 {
+			delete(d.routes, route)
+			continue
+		}
+		out = append(out, summarizeLatency(route, slices))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Route < out[j].Route })
+	return out
+}
+
+// total merges the live slices of every route into one row, reporting
+// ok=false when the window holds no requests
+func (d *latencyDigest) total() (routeLatency, bool) {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var all []*latencySlice
+	for route := range d.routes {
+		all = append(all, d.expire(route, now)...)
+	}
+	if len(all) == 0 {
+		return routeLatency{}, false
+	}
+	return summarizeLatency("*", all), true
+}
+
+// summarizeLatency merges slices and reads their percentiles
+func summarizeLatency(route string, slices []*latencySlice) routeLatency {
+	merged := map[int]uint64{}
+	var count, errors uint64
+	var sum, max time.Duration
+	for _, s := range slices {
+		for b, n := range s.buckets {
+			merged[b] += n
+		}
+		count += s.count
+		errors += s.errors
+		sum += s.sum
+		if s.max > max {
+			max = s.max
+		}
+	}
+	buckets := make([]int, 0, len(merged))
+	for b := range merged {
+		buckets = append(buckets, b)
+	}
+	sort.Ints(buckets)
+
+	quantile := func(q float64) float64 {
+		rank := uint64(math.Ceil(q * float64(count)))
+		var seen uint64
+		for _, b := range buckets {
+			seen += merged[b]
+			if seen >= rank {
+				// The bucket bound can overshoot the largest sample
+				return durationMs(minDuration(bucketUpper(b), max))
+			}
+		}
+		return durationMs(max)
+	}
+	return routeLatency{
+		Route:     route,
+		Count:     count,
+		Errors:    errors,
+		ErrorRate: float64(errors) / float64(count),
+		MeanMs:    durationMs(sum / time.Duration(count)),
+		P50Ms:     quantile(0.50),
+		P95Ms:     quantile(0.95),
+		P99Ms:     quantile(0.99),
+		MaxMs:     durationMs(max),
+	}
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// latencyResponse is the body of GET /admin/latency
+type latencyResponse struct {
+	WindowSeconds float64        `json:"window_seconds"`
+	Routes        []routeLatency `json:"routes"`
+}
+
+// adminLatencyHandler reports per-route latency percentiles over the digest
+// window; ?route= narrows it to one route
+func adminLatencyHandler(w http.ResponseWriter, r *http.Request) {
+	routes := latencyDigests.snapshot()
+	if route := r.URL.Query().Get("route"); route != "" {
+		filtered := routes[:0]
+		for _, rl := range routes {
+			if rl.Route == route {
+				filtered = append(filtered, rl)
+			}
+		}
+		routes = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(latencyResponse{
+		WindowSeconds: latencyDigests.window.Seconds(),
+		Routes:        routes,
+	})
+}
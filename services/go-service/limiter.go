@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	inFlightRequests   metric.Int64UpDownCounter
+	limiterQueueWait   metric.Float64Histogram
+	limiterRejections  metric.Int64Counter
+	limiterQueueLength metric.Int64UpDownCounter
+	limiterLatency     metric.Float64Histogram
+
+	// limiter is nil when concurrency limiting is disabled
+	limiter *concurrencyLimiter
+)
+
+// initLimiterMetrics creates the load-shedding saturation instruments
+func initLimiterMetrics() error {
+	var err error
+
+	inFlightRequests, err = meter.Int64UpDownCounter(
+		"http_inflight_requests",
+		metric.WithDescription("Number of requests currently being served"),
+	)
+	if err != nil {
+		return err
+	}
+
+	limiterQueueLength, err = meter.Int64UpDownCounter(
+		"concurrency_limiter_queued_requests",
+		metric.WithDescription("Number of requests waiting for a concurrency slot by priority"),
+	)
+	if err != nil {
+		return err
+	}
+
+	limiterQueueWait, err = meter.Float64Histogram(
+		"concurrency_limiter_queue_wait_seconds",
+		metric.WithDescription("Time spent waiting for a concurrency slot by priority and outcome"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	limiterRejections, err = meter.Int64Counter(
+		"concurrency_limiter_rejections_total",
+		metric.WithDescription("Requests shed with 503 because no concurrency slot was available, by priority"),
+	)
+	if err != nil {
+		return err
+	}
+
+	limiterLatency, err = meter.Float64Histogram(
+		"concurrency_limiter_observed_latency_seconds",
+		metric.WithDescription("Latency samples fed into the concurrency controller"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	currentLimit, err := meter.Float64ObservableGauge(
+		"concurrency_limit",
+		metric.WithDescription("Current concurrency limit"),
+	)
+	if err != nil {
+		return err
+	}
+
+	baselineLatency, err := meter.Float64ObservableGauge(
+		"concurrency_limiter_baseline_latency_seconds",
+		metric.WithDescription("Long-term latency baseline used by the adaptive controller"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		if limiter == nil {
+			return nil
+		}
+		limit, baseline := limiter.snapshot()
+		attrs := metric.WithAttributes(attribute.String("mode", limiter.mode()))
+		o.ObserveFloat64(currentLimit, limit, attrs)
+		if limiter.adaptive {
+			o.ObserveFloat64(baselineLatency, baseline, attrs)
+		}
+		return nil
+	}, currentLimit, baselineLatency)
+	return err
+}
+
+// concurrencyLimiter admits requests up to a limit that is either fixed or
+// adjusted from observed latency with a gradient controller. Waiting requests
+// queue per priority; higher priorities are admitted first and batch requests
+// may only fill batchShare of the limit, keeping headroom for interactive ones.
+type concurrencyLimiter struct {
+	mu         sync.Mutex
+	limit      float64
+	inFlight   int
+	waiters    map[string][]chan struct{}
+	maxWait    time.Duration
+	waits      map[string]time.Duration
+	batchShare float64
+	classifier *priorityClassifier
+
+	adaptive  bool
+	minLimit  float64
+	maxLimit  float64
+	tolerance float64
+	baseline  float64
+}
+
+// newConcurrencyLimiter builds the limiter from environment configuration, or
+// returns nil when limiting is disabled
+func newConcurrencyLimiter() *concurrencyLimiter {
+	limit := envInt("MAX_IN_FLIGHT", 0)
+	adaptive := envString("CONCURRENCY_LIMITER", "fixed") == "adaptive"
+
+	if limit <= 0 && !adaptive {
+		return nil
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	batchShare := envFloat("PRIORITY_BATCH_SHARE", 0.8)
+	if batchShare <= 0 || batchShare > 1 {
+		batchShare = 0.8
+	}
+	waits := map[string]time.Duration{}
+	for _, pair := range splitList(envString("PRIORITY_QUEUE_WAITS", "batch=20ms")) {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		p, known := parsePriority(name)
+		if d, err := time.ParseDuration(strings.TrimSpace(value)); known && err == nil {
+			waits[p] = d
+		}
+	}
+
+	return &concurrencyLimiter{
+		limit:      float64(limit),
+		waiters:    map[string][]chan struct{}{},
+		maxWait:    envDuration("MAX_QUEUE_WAIT", 100*time.Millisecond),
+		waits:      waits,
+		batchShare: batchShare,
+		classifier: newPriorityClassifier(),
+		adaptive:   adaptive,
+		minLimit:   float64(envInt("ADAPTIVE_MIN_LIMIT", 1)),
+		maxLimit:   float64(envInt("ADAPTIVE_MAX_LIMIT", 1000)),
+		tolerance:  envFloat("ADAPTIVE_TOLERANCE", 2.0),
+	}
+}
+
+func (l *concurrencyLimiter) mode() string {
+	if l.adaptive {
+		return "adaptive"
+	}
+	return "fixed"
+}
+
+func (l *concurrencyLimiter) snapshot() (limit, baseline float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit, l.baseline
+}
+
+// reconfigure applies a new fixed limit (ignored in adaptive mode, or when
+// not positive) and queue wait, admitting waiters if the limit grew
+func (l *concurrencyLimiter) reconfigure(limit int, maxWait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.maxWait = maxWait
+	if l.adaptive || limit <= 0 {
+		return
+	}
+	l.limit = float64(limit)
+	l.admitWaiters()
+}
+
+// capacity is how many in-flight requests priority p may be admitted up to;
+// callers hold l.mu
+func (l *concurrencyLimiter) capacity(p string) int {
+	limit := math.Floor(l.limit)
+	if p == priorityBatch {
+		return int(math.Max(1, math.Floor(limit*l.batchShare)))
+	}
+	return int(limit)
+}
+
+// queueWait is how long priority p may wait for a slot: its
+// PRIORITY_QUEUE_WAITS override or MAX_QUEUE_WAIT; callers hold l.mu
+func (l *concurrencyLimiter) queueWait(p string) time.Duration {
+	if d, ok := l.waits[p]; ok {
+		return d
+	}
+	return l.maxWait
+}
+
+// acquire waits up to the priority's queue wait for a slot and reports
+// whether one was granted
+func (l *concurrencyLimiter) acquire(ctx context.Context, priority string) bool {
+	l.mu.Lock()
+	if l.inFlight < l.capacity(priority) && !l.queuedAhead(priority) {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+	maxWait := l.queueWait(priority)
+	if maxWait <= 0 {
+		l.mu.Unlock()
+		return false
+	}
+	ch := make(chan struct{})
+	l.waiters[priority] = append(l.waiters[priority], ch)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	select {
+	case <-ch:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	queue := l.waiters[priority]
+	for i, w := range queue {
+		if w == ch {
+			l.waiters[priority] = append(queue[:i], queue[i+1:]...)
+			return false
+		}
+	}
+	// The slot was handed over while we were timing out
+	return true
+}
+
+// release frees a slot, feeds the latency sample to the controller and wakes waiters
+func (l *concurrencyLimiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	if l.adaptive {
+		l.update(latency.Seconds())
+	}
+	l.admitWaiters()
+}
+
+// queuedAhead reports whether requests of priority p or higher are already
+// waiting, so a new arrival does not overtake them; callers hold l.mu
+func (l *concurrencyLimiter) queuedAhead(p string) bool {
+	for _, q := range priorities {
+		if len(l.waiters[q]) > 0 {
+			return true
+		}
+		if q == p {
+			return false
+		}
+	}
+	return false
+}
+
+// admitWaiters hands free slots to queued requests, highest priority first
+// and FIFO within a priority; callers hold l.mu
+func (l *concurrencyLimiter) admitWaiters() {
+	for _, p := range priorities {
+		for len(l.waiters[p]) > 0 && l.inFlight < l.capacity(p) {
+			ch := l.waiters[p][0]
+			l.waiters[p] = l.waiters[p][1:]
+			l.inFlight++
+			close(ch)
+		}
+		if len(l.waiters[p]) > 0 {
+			// Lower priorities wait until this queue drains
+			return
+		}
+	}
+}
+
+// update applies a gradient step: shrink the limit when latency rises above the
+// long-term baseline, grow it by a sqrt(limit) headroom otherwise
+func (l *concurrencyLimiter) update(sample float64) {
+	if sample <= 0 {
+		return
+	}
+	if l.baseline == 0 {
+		l.baseline = sample
+	} else {
+		l.baseline += (sample - l.baseline) / 600
+	}
+
+	gradient := math.Max(0.5, math.Min(1.0, l.tolerance*l.baseline/sample))
+	next := l.limit*gradient + math.Sqrt(l.limit)
+	next = l.limit*0.8 + next*0.2
+
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, next))
+}
+
+// limitConcurrency caps in-flight requests, queueing per priority for up to
+// the priority's queue wait before shedding with 503. A nil limiter only
+// tracks in-flight requests.
+func limitConcurrency(l *concurrencyLimiter, next http.Handler) http.Handler {
+	if l == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inFlightRequests.Add(r.Context(), 1)
+			defer inFlightRequests.Add(r.Context(), -1)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if !routeMiddleware(r, "ratelimit", true) {
+			// Route groups switched to -ratelimit are counted but never shed
+			inFlightRequests.Add(ctx, 1)
+			defer inFlightRequests.Add(ctx, -1)
+			next.ServeHTTP(w, r)
+			return
+		}
+		span := trace.SpanFromContext(ctx)
+		start := time.Now()
+		mode := attribute.String("mode", l.mode())
+		priority, source := l.classifier.classify(r)
+		prio := attribute.String("priority", priority)
+
+		limiterQueueLength.Add(ctx, 1, metric.WithAttributes(prio))
+		acquired := l.acquire(ctx, priority)
+		limiterQueueLength.Add(ctx, -1, metric.WithAttributes(prio))
+
+		wait := time.Since(start).Seconds()
+		limiterQueueWait.Record(ctx, wait, metric.WithAttributes(
+			attribute.Bool("admitted", acquired),
+			mode,
+			prio,
+		))
+
+		limit, _ := l.snapshot()
+		span.SetAttributes(
+			attribute.Float64("limiter.queue_wait_seconds", wait),
+			attribute.Float64("limiter.limit", limit),
+			attribute.String("request.priority", priority),
+			attribute.String("request.priority_source", source),
+		)
+
+		if !acquired {
+			limiterRejections.Add(ctx, 1, metric.WithAttributes(mode, prio))
+			span.SetAttributes(attribute.Bool("limiter.rejected", true))
+			logJSON(ctx, "WARN", "Request shed by concurrency limiter", map[string]interface{}{
+				"endpoint":     r.URL.Path,
+				"limit":        limit,
+				"mode":         l.mode(),
+				"priority":     priority,
+				"wait_seconds": wait,
+			})
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(errorResponse{Error: "Server is at capacity"})
+			return
+		}
+
+		inFlightRequests.Add(ctx, 1)
+		served := time.Now()
+		defer func() {
+			latency := time.Since(served)
+			inFlightRequests.Add(ctx, -1)
+			limiterLatency.Record(ctx, latency.Seconds(), metric.WithAttributes(mode))
+			l.release(latency)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
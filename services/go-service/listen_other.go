@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+func listenReusePort(addr string) (net.Listener, error) {
+	return nil, fmt.Errorf("SO_REUSEPORT is not supported on %s; run a single serve process", runtime.GOOS)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	goservicev1 "go-service/proto/goservice/v1"
+)
+
+// loadgenStats aggregates outcomes per path for the final summary
+type loadgenStats struct {
+	mu        sync.Mutex
+	requests  map[string]int
+	failures  map[string]int
+	statuses  map[int]int
+	latencies []time.Duration
+}
+
+func (s *loadgenStats) record(path string, status int, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[path]++
+	if err != nil {
+		s.failures[path]++
+		return
+	}
+	s.statuses[status]++
+	s.latencies = append(s.latencies, latency)
+}
+
+func (s *loadgenStats) percentile(p float64) float64 {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	idx := int(p * float64(len(s.latencies)-1))
+	return float64(s.latencies[idx].Microseconds()) / 1000
+}
+
+// runLoadgen sends requests to randomly chosen paths at a fixed rate and
+// prints a JSON summary, replacing generate-traffic.sh for the Go service
+func runLoadgen(args []string) int {
+	fs := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	target := fs.String("target", "http://localhost:8000", "Base URL of the service")
+	paths := fs.String("paths", "/,/data,/data,/error", "Comma-separated paths; repeat a path to weight it")
+	rps := fs.Float64("rps", 2, "Requests per second")
+	duration := fs.Duration("duration", time.Minute, "How long to generate traffic")
+	concurrency := fs.Int("concurrency", 10, "Maximum requests in flight")
+	timeout := fs.Duration("timeout", 10*time.Second, "Per-request timeout")
+	grpcAddr := fs.String("grpc", "", "Call GoService on this gRPC address instead; -paths then lists RPC names")
+	fs.Parse(args)
+
+	if *grpcAddr != "" {
+		pathsSet := false
+		fs.Visit(func(f *flag.Flag) { pathsSet = pathsSet || f.Name == "paths" })
+		if !pathsSet {
+			*paths = "GetInfo,GetData,GetData,TriggerError"
+		}
+	}
+	targets := splitList(*paths)
+	if len(targets) == 0 || *rps <= 0 || *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "loadgen: -paths must not be empty and -rps and -concurrency must be positive")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	send := httpSender(strings.TrimSuffix(*target, "/"), &http.Client{Timeout: *timeout})
+	if *grpcAddr != "" {
+		conn, err := grpc.Dial(*grpcAddr,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "loadgen:", err)
+			return 2
+		}
+		defer conn.Close()
+		send = grpcSender(goservicev1.NewGoServiceClient(conn), *timeout)
+		*target = *grpcAddr
+	}
+	stats := &loadgenStats{requests: map[string]int{}, failures: map[string]int{}, statuses: map[int]int{}}
+	slots := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / *rps))
+	defer ticker.Stop()
+
+	start := time.Now()
+	skipped := 0
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			// The target is slower than the requested rate; count rather than queue
+			skipped++
+			continue
+		}
+
+		path := targets[workloadRand.Intn(len(targets))]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			began := time.Now()
+			status, err := send(ctx, path)
+			stats.record(path, status, time.Since(began), err)
+		}()
+	}
+	wg.Wait()
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	sort.Slice(stats.latencies, func(i, j int) bool { return stats.latencies[i] < stats.latencies[j] })
+
+	statuses := map[string]int{}
+	for code, n := range stats.statuses {
+		statuses[fmt.Sprint(code)] = n
+	}
+	summary := map[string]interface{}{
+		"target":          *target,
+		"seed":            workloadSeed,
+		"elapsed_seconds": time.Since(start).Seconds(),
+		"requests":        stats.requests,
+		"failures":        stats.failures,
+		"statuses":        statuses,
+		"skipped":         skipped,
+		"latency_ms": map[string]float64{
+			"p50": stats.percentile(0.5),
+			"p90": stats.percentile(0.9),
+			"p99": stats.percentile(0.99),
+		},
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(summary)
+
+	if len(stats.latencies) == 0 {
+		return 1
+	}
+	return 0
+}
+
+// loadgenSender issues one request and returns its status; err is only set
+// when no response came back
+type loadgenSender func(ctx context.Context, path string) (int, error)
+
+func httpSender(base string, client *http.Client) loadgenSender {
+	return func(_ context.Context, path string) (int, error) {
+		resp, err := client.Get(base + path)
+		if err != nil {
+			return 0, err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+}
+
+// grpcSender calls a GoService RPC by name and reports its gRPC status code
+func grpcSender(client goservicev1.GoServiceClient, timeout time.Duration) loadgenSender {
+	return func(_ context.Context, rpc string) (int, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var err error
+		switch rpc {
+		case "GetInfo":
+			_, err = client.GetInfo(ctx, &goservicev1.GetInfoRequest{})
+		case "GetData":
+			_, err = client.GetData(ctx, &goservicev1.GetDataRequest{})
+		case "TriggerError":
+			_, err = client.TriggerError(ctx, &goservicev1.TriggerErrorRequest{})
+		default:
+			return 0, fmt.Errorf("unknown RPC %q", rpc)
+		}
+		st, ok := status.FromError(err)
+		if !ok {
+			return 0, err
+		}
+		return int(st.Code()), nil
+	}
+}
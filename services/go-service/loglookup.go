@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// logLine is one correlated log record, normalized across backends
+type logLine struct {
+	Timestamp string                 `json:"timestamp"`
+	Severity  string                 `json:"severity,omitempty"`
+	Body      string                 `json:"body"`
+	Labels    map[string]interface{} `json:"labels,omitempty"`
+}
+
+// traceLogsResponse is the body of GET /trace/{traceID}/logs
+type traceLogsResponse struct {
+	TraceID string    `json:"trace_id"`
+	Backend string    `json:"backend"`
+	Count   int       `json:"count"`
+	Logs    []logLine `json:"logs"`
+}
+
+// logBackend finds the log lines of one trace
+type logBackend interface {
+	name() string
+	lookup(ctx context.Context, traceID string, limit int) ([]logLine, error)
+}
+
+// logLookupClient traces the backend queries like any other outbound call
+var logLookupClient = &http.Client{
+	Timeout:   envDuration("LOG_LOOKUP_TIMEOUT", 5*time.Second),
+	Transport: newInstrumentedTransport(),
+}
+
+// doJSON sends req and decodes a 2xx JSON response into out
+func doJSON(req *http.Request, out interface{}) error {
+	resp, err := logLookupClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// logLookupService is the service.name lookups are scoped to, so a trace
+// that crosses services only returns this service's lines
+const logLookupService = "go-service"
+
+// elasticsearchLogs searches the index the collector's elasticsearch exporter writes to
+type elasticsearchLogs struct {
+	url          string
+	index        string
+	traceField   string
+	serviceField string
+}
+
+func (e elasticsearchLogs) name() string { return "elasticsearch" }
+
+func (e elasticsearchLogs) lookup(ctx context.Context, traceID string, limit int) ([]logLine, error) {
+	query, _ := json.Marshal(map[string]interface{}{
+		"size": limit,
+		"query": map[string]interface{}{"bool": map[string]interface{}{
+			"must":   map[string]interface{}{"match": map[string]string{e.traceField: traceID}},
+			"filter": map[string]interface{}{"term": map[string]string{e.serviceField: logLookupService}},
+		}},
+		"sort": []map[string]string{{"@timestamp": "asc"}},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url+"/"+e.index+"/_search", bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source map[string]interface{} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	lines := make([]logLine, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		src := hit.Source
+		line := logLine{
+			Timestamp: fmt.Sprint(src["@timestamp"]),
+			Body:      fmt.Sprint(src["Body"]),
+			Labels:    map[string]interface{}{},
+		}
+		if sev, ok := src["SeverityText"].(string); ok {
+			line.Severity = sev
+		}
+		for k, v := range src {
+			if k != "@timestamp" && k != "Body" && k != "SeverityText" {
+				line.Labels[k] = v
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// lokiLogs runs a line filter for the trace ID over this service's streams,
+// narrowed by any LOG_LOOKUP_LOKI_SELECTOR matchers
+type lokiLogs struct {
+	url      string
+	selector string
+	window   time.Duration
+}
+
+func (l lokiLogs) name() string { return "loki" }
+
+func (l lokiLogs) lookup(ctx context.Context, traceID string, limit int) ([]logLine, error) {
+	now := time.Now()
+	params := url.Values{
+		"query":     {fmt.Sprintf("%s |= %q", l.selector, traceID)},
+		"limit":     {strconv.Itoa(limit)},
+		"start":     {strconv.FormatInt(now.Add(-l.window).UnixNano(), 10)},
+		"end":       {strconv.FormatInt(now.UnixNano(), 10)},
+		"direction": {"forward"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.url+"/loki/api/v1/query_range?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Data struct {
+			Result []struct {
+				Stream map[string]interface{} `json:"stream"`
+				Values [][2]string            `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	var lines []logLine
+	for _, stream := range result.Data.Result {
+		for _, v := range stream.Values {
+			ts := v[0]
+			if ns, err := strconv.ParseInt(v[0], 10, 64); err == nil {
+				ts = time.Unix(0, ns).UTC().Format(time.RFC3339Nano)
+			}
+			line := logLine{Timestamp: ts, Body: v[1], Labels: stream.Stream}
+			// Our own JSON logs carry the level in the line itself
+			var parsed struct {
+				Level string `json:"level"`
+			}
+			if json.Unmarshal([]byte(v[1]), &parsed) == nil {
+				line.Severity = parsed.Level
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// lokiSelector always matches service_name to this service and adds the
+// matchers of extra, e.g. {deployment_environment="prod"}
+func lokiSelector(extra string) string {
+	matchers := fmt.Sprintf("service_name=%q", logLookupService)
+	extra = strings.TrimSpace(extra)
+	extra = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(extra, "{"), "}"))
+	if extra != "" {
+		matchers += ", " + extra
+	}
+	return "{" + matchers + "}"
+}
+
+// logLookupBackend is nil when LOG_LOOKUP_BACKEND is "none" or unknown
+var logLookupBackend = newLogBackend()
+
+func newLogBackend() logBackend {
+	switch backend := envString("LOG_LOOKUP_BACKEND", "elasticsearch"); backend {
+	case "elasticsearch":
+		return elasticsearchLogs{
+			url:          strings.TrimSuffix(envString("LOG_LOOKUP_URL", "http://elasticsearch:9200"), "/"),
+			index:        envString("LOG_LOOKUP_INDEX", "otel-logs"),
+			traceField:   envString("LOG_LOOKUP_TRACE_FIELD", "TraceId"),
+			serviceField: envString("LOG_LOOKUP_SERVICE_FIELD", "Resource.service.name.keyword"),
+		}
+	case "loki":
+		return lokiLogs{
+			url:      strings.TrimSuffix(envString("LOG_LOOKUP_URL", "http://loki:3100"), "/"),
+			selector: lokiSelector(envString("LOG_LOOKUP_LOKI_SELECTOR", "")),
+			window:   envDuration("LOG_LOOKUP_WINDOW", 24*time.Hour),
+		}
+	case "none":
+		return nil
+	default:
+		logJSON(context.Background(), "ERROR", "Unknown LOG_LOOKUP_BACKEND", map[string]interface{}{"backend": backend})
+		return nil
+	}
+}
+
+// traceLogsCredentials are the admin credentials /trace/{traceID}/logs
+// requires, loaded on first use
+var traceLogsCredentials = sync.OnceValue(loadAdminCredentials)
+
+// traceLogsHandler serves /trace/{traceID}/logs with this service's log
+// lines for the trace, fetched from the configured log backend. Log lines
+// can carry request details, so unlike the trace links it sits behind the
+// admin credentials.
+func traceLogsHandler(w http.ResponseWriter, r *http.Request, traceID string) {
+	lookup := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookupTraceLogs(w, r, traceID)
+	})
+	requireAdminAuth(traceLogsCredentials(), lookup).ServeHTTP(w, r)
+}
+
+func lookupTraceLogs(w http.ResponseWriter, r *http.Request, traceID string) {
+	ctx, span := tracer.Start(r.Context(), "log_lookup")
+	defer span.End()
+
+	writeJSON := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	if logLookupBackend == nil {
+		writeJSON(http.StatusNotFound, errorResponse{Error: "no log backend configured"})
+		return
+	}
+
+	limit := parseBoundedInt(r, "limit", envInt("LOG_LOOKUP_LIMIT", 100), 1000)
+	span.SetAttributes(
+		attribute.String("log_lookup.backend", logLookupBackend.name()),
+		attribute.String("log_lookup.trace_id", traceID),
+	)
+
+	lines, err := logLookupBackend.lookup(ctx, traceID, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "log lookup failed")
+		logJSON(ctx, "ERROR", "Log lookup failed", map[string]interface{}{
+			"backend": logLookupBackend.name(),
+			"error":   err.Error(),
+		})
+		writeJSON(http.StatusBadGateway, errorResponse{Error: "log backend query failed: " + err.Error()})
+		return
+	}
+	span.SetAttributes(attribute.Int("log_lookup.lines", len(lines)))
+
+	writeJSON(http.StatusOK, traceLogsResponse{
+		TraceID: traceID,
+		Backend: logLookupBackend.name(),
+		Count:   len(lines),
+		Logs:    lines,
+	})
+}
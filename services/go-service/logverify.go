@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runLogverify checks the log pipeline end to end for CI: it makes the
+// service log a line under a trace ID of its own, then queries Loki until
+// the line shows up and asserts its stream labels and that the trace ID was
+// extracted from it
+func runLogverify(args []string) int {
+	fs := flag.NewFlagSet("logverify", flag.ExitOnError)
+	target := fs.String("target", "http://localhost:8000", "Base URL of the service")
+	path := fs.String("path", "/", "Route requested to produce the log line")
+	loki := fs.String("loki", "http://localhost:3100", "Loki base URL")
+	selector := fs.String("selector", `{service_name="go-service"}`, "LogQL stream selector the line must land in")
+	labels := fs.String("labels", "service_name=go-service", "Comma-separated name=value labels the stream must carry")
+	traceLabel := fs.String("trace-label", "trace_id", "Label or structured metadata the trace ID must be extracted to; empty skips the check")
+	timeout := fs.Duration("timeout", time.Minute, "How long to wait for the line in Loki")
+	interval := fs.Duration("interval", 2*time.Second, "Pause between Loki queries")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var results []checkResult
+	traceID, err := writeVerifyLog(ctx, *target+*path)
+	results = append(results, checkResult{name: "log_written", err: err, detail: "GET " + *path + " trace_id " + traceID})
+	if err == nil {
+		results = append(results, verifyLokiLine(ctx, *loki, *selector, traceID, parseLabelList(*labels), *traceLabel, *timeout, *interval)...)
+	}
+
+	failed := 0
+	for _, r := range results {
+		status := "PASS"
+		detail := r.detail
+		if r.err != nil {
+			status = "FAIL"
+			failed++
+			detail = r.err.Error()
+		}
+		fmt.Printf("%-4s %-20s %s\n", status, r.name, detail)
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d of %d checks failed\n", failed, len(results))
+		return 1
+	}
+	return 0
+}
+
+// writeVerifyLog requests url under a fresh trace and returns its ID. The
+// debug trace header, with the service's DEBUG_TRACE_TOKEN, keeps the
+// handler's log line whatever LOG_LEVEL.
+func writeVerifyLog(ctx context.Context, url string) (string, error) {
+	ids := make([]byte, 24)
+	rand.Read(ids)
+	traceID, spanID := hex.EncodeToString(ids[:16]), hex.EncodeToString(ids[16:])
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return traceID, err
+	}
+	req.Header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", traceID, spanID))
+	debug := loadDebugTraceConfig()
+	if debug.token != "" {
+		req.Header.Set(debug.header, debug.token)
+	} else {
+		req.Header.Set(debug.header, "true")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return traceID, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return traceID, fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return traceID, nil
+}
+
+// verifyLokiLine polls Loki for the trace's log line and checks the stream
+// it landed in
+func verifyLokiLine(ctx context.Context, lokiURL, selector, traceID string, want map[string]string, traceLabel string, timeout, interval time.Duration) []checkResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// The lookup client's instrumented transport needs the meter that only
+	// serve sets up
+	logLookupClient = &http.Client{Timeout: logLookupClient.Timeout}
+	backend := lokiLogs{url: strings.TrimSuffix(lokiURL, "/"), selector: selector, window: timeout + time.Minute}
+
+	start := time.Now()
+	var lines []logLine
+	var lastErr error
+	for {
+		var err error
+		lines, err = backend.lookup(ctx, traceID, 10)
+		if len(lines) > 0 || ctx.Err() != nil {
+			break
+		}
+		lastErr = err
+		select {
+		case <-ctx.Done():
+		case <-time.After(interval):
+		}
+	}
+	if len(lines) == 0 {
+		err := fmt.Errorf("no line with trace_id %s in %s within %s", traceID, selector, timeout)
+		if lastErr != nil {
+			err = fmt.Errorf("%v; last query: %v", err, lastErr)
+		}
+		return []checkResult{{name: "log_arrived", err: err}}
+	}
+
+	// Only our JSON line counts; anything else matching the filter is noise
+	line := lines[0]
+	for _, l := range lines {
+		var parsed struct {
+			TraceID string `json:"trace_id"`
+		}
+		if json.Unmarshal([]byte(l.Body), &parsed) == nil && parsed.TraceID == traceID {
+			line = l
+			break
+		}
+	}
+	results := []checkResult{{
+		name:   "log_arrived",
+		detail: fmt.Sprintf("after %s, %d line(s)", time.Since(start).Round(time.Millisecond), len(lines)),
+	}}
+
+	var mismatched []string
+	for _, name := range sortedKeys(want) {
+		got, ok := line.Labels[name]
+		if !ok {
+			mismatched = append(mismatched, name+" missing")
+		} else if fmt.Sprint(got) != want[name] {
+			mismatched = append(mismatched, fmt.Sprintf("%s=%q, want %q", name, fmt.Sprint(got), want[name]))
+		}
+	}
+	labelResult := checkResult{name: "stream_labels", detail: fmt.Sprintf("%d label(s) matched", len(want))}
+	if len(mismatched) > 0 {
+		labelResult.err = fmt.Errorf("stream %v: %s", line.Labels, strings.Join(mismatched, ", "))
+	}
+	results = append(results, labelResult)
+
+	if traceLabel != "" {
+		traceResult := checkResult{name: "trace_id_extracted", detail: traceLabel + "=" + traceID}
+		if got, ok := line.Labels[traceLabel]; !ok {
+			traceResult.err = fmt.Errorf("%s is not a label or structured metadata of the line", traceLabel)
+		} else if fmt.Sprint(got) != traceID {
+			traceResult.err = fmt.Errorf("%s is %q, want %q", traceLabel, fmt.Sprint(got), traceID)
+		}
+		results = append(results, traceResult)
+	}
+	return results
+}
+
+// parseLabelList parses name=value pairs separated by commas
+func parseLabelList(value string) map[string]string {
+	labels := map[string]string{}
+	for _, pair := range splitList(value) {
+		if name, v, ok := strings.Cut(pair, "="); ok {
+			labels[strings.TrimSpace(name)] = strings.TrimSpace(v)
+		}
+	}
+	return labels
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
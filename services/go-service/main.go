@@ -2,25 +2,33 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
-	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	ocbridge "go.opentelemetry.io/otel/bridge/opencensus"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
-	sdkresource "go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mathieux51/observability/services/go-service/telemetry"
 )
 
 var (
@@ -30,97 +38,144 @@ var (
 	requestDuration metric.Float64Histogram
 )
 
-// logJSON logs a structured JSON message with trace context
-func logJSON(ctx context.Context, level string, message string, fields map[string]interface{}) {
-	span := trace.SpanFromContext(ctx)
-	spanCtx := span.SpanContext()
+// logLevels orders the levels accepted by LOG_LEVEL
+var logLevels = map[string]int32{"DEBUG": 0, "INFO": 1, "WARN": 2, "ERROR": 3}
 
-	logEntry := map[string]interface{}{
-		"timestamp": time.Now().Format(time.RFC3339),
-		"level":     level,
-		"message":   message,
-		"service":   "go-service",
-	}
+// minLogLevel drops messages below LOG_LEVEL; the config reloader can change it
+var minLogLevel atomic.Int32
 
-	if spanCtx.IsValid() {
-		logEntry["trace_id"] = spanCtx.TraceID().String()
-		logEntry["span_id"] = spanCtx.SpanID().String()
+// setLogLevel changes the minimum level logged, reporting whether the name is known
+func setLogLevel(name string) bool {
+	level, ok := logLevels[strings.ToUpper(name)]
+	if ok {
+		minLogLevel.Store(level)
 	}
+	return ok
+}
 
-	for k, v := range fields {
-		logEntry[k] = v
+// logger writes the service's log lines; Enabled and Redact apply
+// LOG_LEVEL and the secret scrubber
+var logger = serviceLogger()
+
+// serviceLogger builds the logger, adding worker_id in supervised processes
+func serviceLogger() *telemetry.Logger {
+	l := &telemetry.Logger{
+		Service: "go-service",
+		Enabled: func(ctx context.Context, level string) bool {
+			// Debug-traced requests log at every level
+			n, ok := logLevels[level]
+			return !ok || n >= minLogLevel.Load() || debugTraced(ctx)
+		},
+		Redact: func(s string) string { return secrets.Redact(s) },
+	}
+	if workerID != "" {
+		l.Fields = map[string]interface{}{"worker_id": workerID}
 	}
+	return l
+}
 
-	jsonBytes, _ := json.Marshal(logEntry)
-	log.Println(string(jsonBytes))
+// logJSON logs a structured JSON message with trace context
+func logJSON(ctx context.Context, level string, message string, fields map[string]interface{}) {
+	logger.Log(ctx, level, message, fields)
 }
 
-func initTracer(ctx context.Context) (*sdktrace.TracerProvider, error) {
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if endpoint == "" {
-		endpoint = "otel-collector:4317"
+// serviceAttributes describe this process on every exported span and metric,
+// next to the service name and version
+func serviceAttributes() []attribute.KeyValue {
+	attrs := append([]attribute.KeyValue{
+		attribute.String("deployment.track", deploymentTrack),
+	}, buildInfo.attributes()...)
+	// Processes of a supervised deployment are told apart per worker
+	if workerID != "" {
+		attrs = append(attrs, attribute.String("worker.id", workerID), semconv.ProcessPID(os.Getpid()))
 	}
+	return attrs
+}
 
-	exporter, err := otlptracegrpc.New(ctx,
-		otlptracegrpc.WithEndpoint(endpoint),
-		otlptracegrpc.WithInsecure(),
-	)
+// initTelemetry sets up the trace and metric pipelines through the telemetry
+// package, then creates the service's instruments
+func initTelemetry(ctx context.Context) (telemetry.Shutdown, error) {
+	if err := checkTelemetryProfile(); err != nil {
+		return nil, err
+	}
+	temporality, err := temporalitySelector()
 	if err != nil {
 		return nil, err
 	}
 
-	resource := sdkresource.NewWithAttributes(
-		semconv.SchemaURL,
-		semconv.ServiceName("go-service"),
-		semconv.ServiceVersion("1.0.0"),
-	)
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource),
-	)
-
-	otel.SetTracerProvider(tp)
-	tracer = tp.Tracer("go-service")
+	// OpenCensus stats are exported alongside the OTel instruments
+	producers := []sdkmetric.Producer{ocbridge.NewMetricProducer()}
+	if envBool("PROMETHEUS_BRIDGE", true) {
+		// So are metrics registered with the Prometheus default registry
+		producers = append(producers, newPrometheusProducer(prometheus.DefaultGatherer))
+	}
 
-	return tp, nil
-}
+	// METRICS_VIEWS overrides come first so they replace the built-in views
+	views, err := viewOverrides()
+	if err != nil {
+		return nil, err
+	}
+	views = append(views, responseSizeView, objectPayloadView)
+	if view, ok := exponentialHistogramView(); ok {
+		views = append(views, view)
+	}
 
-func initMeter(ctx context.Context) (*sdkmetric.MeterProvider, error) {
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if endpoint == "" {
-		endpoint = "otel-collector:4317"
+	limits := spanLimitTracker.limits
+	cfg := telemetry.Config{
+		ServiceName:    "go-service",
+		ServiceVersion: version,
+		Attributes:     serviceAttributes(),
+		Endpoint:       traceEndpoint(),
+		MetricEndpoint: metricEndpoint(),
+		Headers:        exportHeaders(),
+		Sampler:        headSampler(),
+		SpanLimits:     &limits,
+		SpanProcessors: []sdktrace.SpanProcessor{recentSpans, tracez, rpcz, spanMetrics, spanLimitTracker, spanLeakTracker},
+		ExportSpans: func(exporter sdktrace.SpanExporter) sdktrace.SpanProcessor {
+			return newDroppingSpanQueue(exportTrackingSpanExporter{redactingExporter{exporter}})
+		},
+		Temporality: temporality,
+		WrapMetricExporter: func(exporter sdkmetric.Exporter) (sdkmetric.Exporter, error) {
+			exporter, err := newTemporalityExporter(exporter)
+			if err != nil {
+				return nil, err
+			}
+			return exportTrackingMetricExporter{exporter}, nil
+		},
+		MetricProducers: producers,
+		Views:           []sdkmetric.View{firstMatch(views...)},
+	}
+	if collectorless {
+		cfg.MetricExporter = newMimirExporter(temporality)
 	}
 
-	exporter, err := otlpmetricgrpc.New(ctx,
-		otlpmetricgrpc.WithEndpoint(endpoint),
-		otlpmetricgrpc.WithInsecure(),
-	)
+	shutdown, err := telemetry.Setup(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
+	tracer = otel.Tracer("go-service")
+	meter = otel.Meter("go-service")
 
-	resource := sdkresource.NewWithAttributes(
-		semconv.SchemaURL,
-		semconv.ServiceName("go-service"),
-		semconv.ServiceVersion("1.0.0"),
-	)
+	// Spans from libraries still instrumented with OpenCensus join the same pipeline
+	ocbridge.InstallTraceBridge(ocbridge.WithTracerProvider(otel.GetTracerProvider()))
 
-	mp := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
-		sdkmetric.WithResource(resource),
-	)
+	if err := initInstruments(); err != nil {
+		shutdown(context.Background())
+		return nil, err
+	}
+	return shutdown, nil
+}
 
-	otel.SetMeterProvider(mp)
-	meter = mp.Meter("go-service")
+// initInstruments creates the service's metric instruments
+func initInstruments() error {
+	var err error
 
-	// Create custom metrics
 	requestCounter, err = meter.Int64Counter(
 		"http_requests_total",
 		metric.WithDescription("Total number of HTTP requests"),
 	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	requestDuration, err = meter.Float64Histogram(
@@ -128,25 +183,254 @@ func initMeter(ctx context.Context) (*sdkmetric.MeterProvider, error) {
 		metric.WithDescription("HTTP request duration in seconds"),
 	)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if err := initBurnMetrics(); err != nil {
+		return err
+	}
+
+	if err := initMaxProcsMetrics(); err != nil {
+		return err
+	}
+
+	if err := initMemoryLimitMetrics(); err != nil {
+		return err
+	}
+
+	if err := initLimiterMetrics(); err != nil {
+		return err
+	}
+
+	if err := initApdexMetrics(); err != nil {
+		return err
+	}
+
+	if err := initExpvarBridge(); err != nil {
+		return err
+	}
+
+	if err := initAuthMetrics(); err != nil {
+		return err
+	}
+
+	if err := initCORSMetrics(); err != nil {
+		return err
+	}
+
+	if err := initTLSMetrics(); err != nil {
+		return err
+	}
+
+	if err := initMTLSMetrics(); err != nil {
+		return err
+	}
+
+	if err := initPollMetrics(); err != nil {
+		return err
+	}
+
+	if err := initDownloadMetrics(); err != nil {
+		return err
+	}
+
+	if err := initRUMMetrics(); err != nil {
+		return err
+	}
+
+	if err := initOTLPProxyMetrics(); err != nil {
+		return err
+	}
+
+	if err := initSpanMetrics(); err != nil {
+		return err
+	}
+
+	if err := initHeartbeatMetrics(); err != nil {
+		return err
+	}
+
+	if err := initConfigReloadMetrics(); err != nil {
+		return err
+	}
+
+	if err := initWatchdogMetrics(); err != nil {
+		return err
+	}
+
+	if err := initSlowRequestMetrics(); err != nil {
+		return err
+	}
+
+	if err := initResponseSizeMetrics(); err != nil {
+		return err
+	}
+
+	if err := initClientMetrics(); err != nil {
+		return err
+	}
+
+	if err := initGeoMetrics(); err != nil {
+		return err
+	}
+
+	if err := initCanaryMetrics(); err != nil {
+		return err
+	}
+
+	if err := initShadowMetrics(); err != nil {
+		return err
+	}
+
+	if err := initGatewayMetrics(); err != nil {
+		return err
+	}
+
+	if err := initRetryBudgetMetrics(); err != nil {
+		return err
+	}
+
+	if err := initChaosMetrics(); err != nil {
+		return err
+	}
+
+	if err := initFaultRuleMetrics(); err != nil {
+		return err
+	}
+
+	if err := initRequestCaptureMetrics(); err != nil {
+		return err
+	}
+
+	if err := initAuditMetrics(); err != nil {
+		return err
+	}
+
+	if err := initConnPoolMetrics(); err != nil {
+		return err
+	}
+
+	if err := initObjectStoreMetrics(); err != nil {
+		return err
+	}
+
+	if err := initSearchMetrics(); err != nil {
+		return err
+	}
+
+	if err := initAnalyticsMetrics(); err != nil {
+		return err
 	}
 
-	return mp, nil
+	if err := initAPIVersionMetrics(); err != nil {
+		return err
+	}
+
+	if err := initIdempotencyMetrics(); err != nil {
+		return err
+	}
+
+	if err := initConditionalMetrics(); err != nil {
+		return err
+	}
+
+	if err := initNegotiationMetrics(); err != nil {
+		return err
+	}
+
+	if err := initDisconnectMetrics(); err != nil {
+		return err
+	}
+
+	if err := initHedgeMetrics(); err != nil {
+		return err
+	}
+
+	if err := initBulkheadMetrics(); err != nil {
+		return err
+	}
+
+	if err := initSpanLimitMetrics(); err != nil {
+		return err
+	}
+
+	if err := initTelemetryDropMetrics(); err != nil {
+		return err
+	}
+
+	if err := initDebugTraceMetrics(); err != nil {
+		return err
+	}
+
+	if err := initFanoutMetrics(); err != nil {
+		return err
+	}
+
+	if err := initSpanLeakMetrics(); err != nil {
+		return err
+	}
+
+	if err := initSelftestMetrics(); err != nil {
+		return err
+	}
+
+	if err := initGrafanaAnnotationMetrics(); err != nil {
+		return err
+	}
+
+	if err := initDeploymentMetrics(); err != nil {
+		return err
+	}
+
+	if err := initSupervisorMetrics(); err != nil {
+		return err
+	}
+
+	if err := initUpgradeMetrics(); err != nil {
+		return err
+	}
+
+	if err := initAlertMetrics(); err != nil {
+		return err
+	}
+
+	if err := initErrorBudgetMetrics(); err != nil {
+		return err
+	}
+
+	if err := initMigrationMetrics(); err != nil {
+		return err
+	}
+
+	return nil
 }
 
-func enableCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "*")
+// infoResponse is the body of GET /
+type infoResponse struct {
+	Service   string `json:"service"`
+	Message   string `json:"message"`
+	Timestamp int64  `json:"timestamp"`
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+// dataItem is one row returned by GET /data, as every data store reads it
+type dataItem struct {
+	ID     int64  `json:"id" bson:"id"`
+	Value  string `json:"value" bson:"value"`
+	Source string `json:"source,omitempty" bson:"-"`
+}
 
-		next.ServeHTTP(w, r)
-	})
+// dataResponse is the body of GET /data; Partial is set when an optional
+// fan-out source failed and its items are missing
+type dataResponse struct {
+	Data          []dataItem `json:"data"`
+	Count         int        `json:"count"`
+	Partial       bool       `json:"partial,omitempty"`
+	FailedSources []string   `json:"failed_sources,omitempty"`
+}
+
+// errorResponse is the body of every JSON error response
+type errorResponse struct {
+	Error string `json:"error"`
 }
 
 func rootHandler(w http.ResponseWriter, r *http.Request) {
@@ -163,31 +447,26 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 
 	logJSON(ctx, "INFO", "Processing root request", nil)
 
-	response := map[string]interface{}{
-		"service":   "go",
-		"message":   "Hello from Go service!",
-		"timestamp": time.Now().Unix(),
+	response := infoResponse{
+		Service:   "go",
+		Message:   "Hello from Go service!",
+		Timestamp: time.Now().Unix(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 
 	duration := time.Since(start).Seconds()
-	requestCounter.Add(ctx, 1, metric.WithAttributes(
-		attribute.String("method", "GET"),
-		attribute.String("endpoint", "/"),
-	))
-	requestDuration.Record(ctx, duration, metric.WithAttributes(
-		attribute.String("method", "GET"),
-		attribute.String("endpoint", "/"),
-	))
+	countRequest(ctx, "GET", "/")
+	observeRequestDuration(ctx, "GET", "/", duration)
 }
 
 func dataHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	ctx := r.Context()
 
-	_, span := tracer.Start(ctx, "get_data_handler")
+	// The fan-out spans are children of the handler span
+	ctx, span := tracer.Start(ctx, "get_data_handler")
 	defer span.End()
 
 	span.SetAttributes(
@@ -197,40 +476,56 @@ func dataHandler(w http.ResponseWriter, r *http.Request) {
 
 	logJSON(ctx, "INFO", "Fetching data", nil)
 
-	// Simulate database query
-	_, dbSpan := tracer.Start(ctx, "database_query")
-	time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
+	result, err := dataFanout.fetchDataSources(ctx, dataFanout.dataSources(10))
+	if err != nil && clientDisconnected(ctx) {
+		// Nobody is waiting for the answer; trackClientDisconnects records it
+		countRequest(ctx, "GET", "/data", attribute.String("status", "canceled"))
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "data store query failed")
+		logJSON(ctx, "ERROR", "Data store query failed", map[string]interface{}{
+			"store": dataLayer.name(),
+			"error": err.Error(),
+		})
+		countRequest(ctx, "GET", "/data", attribute.String("status", "error"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(errorResponse{Error: "data store unavailable"})
+		return
+	}
 
-	data := make([]map[string]interface{}, 10)
-	for i := 0; i < 10; i++ {
-		data[i] = map[string]interface{}{
-			"id":    i,
-			"value": fmt.Sprintf("item-%d", i),
-		}
+	var extra []attribute.KeyValue
+	if len(result.failed) > 0 {
+		span.SetAttributes(
+			attribute.Bool("data.partial", true),
+			attribute.StringSlice("data.failed_sources", result.failed),
+		)
+		logJSON(ctx, "WARN", "Serving partial data", map[string]interface{}{
+			"failed_sources": result.failed,
+		})
+		extra = append(extra, attribute.String("status", "partial"))
 	}
-	dbSpan.End()
 
 	logJSON(ctx, "INFO", "Retrieved items", map[string]interface{}{
-		"item_count": len(data),
+		"item_count": len(result.items),
 	})
 
-	response := map[string]interface{}{
-		"data":  data,
-		"count": len(data),
+	response := dataResponse{
+		Data:          result.items,
+		Count:         len(result.items),
+		Partial:       len(result.failed) > 0,
+		FailedSources: result.failed,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	if writeNegotiated(ctx, w, r, "/data", response) == http.StatusNotModified {
+		extra = []attribute.KeyValue{attribute.String("status", "not_modified")}
+	}
 
 	duration := time.Since(start).Seconds()
-	requestCounter.Add(ctx, 1, metric.WithAttributes(
-		attribute.String("method", "GET"),
-		attribute.String("endpoint", "/data"),
-	))
-	requestDuration.Record(ctx, duration, metric.WithAttributes(
-		attribute.String("method", "GET"),
-		attribute.String("endpoint", "/data"),
-	))
+	countRequest(ctx, "GET", "/data", extra...)
+	observeRequestDuration(ctx, "GET", "/data", duration)
 }
 
 func errorHandler(w http.ResponseWriter, r *http.Request) {
@@ -249,46 +544,273 @@ func errorHandler(w http.ResponseWriter, r *http.Request) {
 		"error_type": "SimulatedError",
 	})
 
-	requestCounter.Add(ctx, 1, metric.WithAttributes(
-		attribute.String("method", "GET"),
-		attribute.String("endpoint", "/error"),
-		attribute.String("status", "error"),
-	))
+	countRequest(ctx, "GET", "/error", attribute.String("status", "error"))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusInternalServerError)
-	json.NewEncoder(w).Encode(map[string]string{
-		"error": "This is a simulated error",
-	})
+	json.NewEncoder(w).Encode(errorResponse{Error: "This is a simulated error"})
 }
 
-func main() {
-	ctx := context.Background()
+// runServe starts the HTTP service; it is the default subcommand
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: go-service serve\n\nRuns the HTTP service, configured through environment variables.")
+	}
+	fs.Parse(args)
+
+	// Cancelled once a binary upgrade handed over, to stop the background
+	// goroutines before the deferred shutdowns flush telemetry
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	setLogLevel(envString("LOG_LEVEL", "INFO"))
+	log.SetOutput(logDropWriter{os.Stderr})
+	// Without a collector to ship stderr, the collectorless profile pushes
+	// the same lines to Loki
+	if pusher := newLokiPusher(); pusher != nil {
+		log.SetOutput(logDropWriter{io.MultiWriter(os.Stderr, pusher)})
+		goWithCrashReport("loki_pusher", pusher.run)
+		defer pusher.close()
+	}
+	// Logged even when unset, so a run can be repeated with its seed
+	logJSON(ctx, "INFO", "Workload randomness seeded", map[string]interface{}{
+		"seed":  workloadSeed,
+		"fixed": workloadSeeded,
+	})
+	adjustMaxProcs()
+	configureMemoryLimit()
+
+	limiter = newConcurrencyLimiter()
+
+	var err error
+	socketActivation, err = takeSystemdListeners()
+	if err != nil {
+		log.Fatalf("Failed to adopt inherited sockets: %v", err)
+	}
+	if len(socketActivation.http) > 0 || socketActivation.admin != nil || socketActivation.grpc != nil || socketActivation.unix != nil {
+		logJSON(ctx, "INFO", "Adopted inherited listeners", socketActivation.addresses())
+	}
+	serverCerts, err = loadServerCertificates()
+	if err != nil {
+		log.Fatalf("Failed to load TLS certificates: %v", err)
+	}
+	cors, err := loadCORSPolicy()
+	if err != nil {
+		log.Fatalf("Invalid CORS configuration: %v", err)
+	}
 
 	// Initialize OpenTelemetry
-	tp, err := initTracer(ctx)
+	shutdownTelemetry, err := initTelemetry(ctx)
 	if err != nil {
-		log.Fatalf("Failed to initialize tracer: %v", err)
+		log.Fatalf("Failed to initialize telemetry: %v", err)
 	}
-	defer tp.Shutdown(ctx)
+	defer shutdownTelemetry(context.Background())
+	auditLog = newAuditLogger()
+	annotations = newGrafanaAnnotator()
+	recordDeployment(ctx)
 
-	mp, err := initMeter(ctx)
+	proxy, err := newOTLPProxy()
 	if err != nil {
-		log.Fatalf("Failed to initialize meter: %v", err)
+		log.Fatalf("Failed to start OTLP proxy: %v", err)
+	}
+	if proxy != nil {
+		defer proxy.Close()
 	}
-	defer mp.Shutdown(ctx)
 
-	// Setup HTTP routes
+	// Background goroutines write a crash report if they panic
+	goWithCrashReport("memory_limit_watcher", func() { watchMemoryLimit(ctx) })
+	goWithCrashReport("heartbeat", func() { beat(ctx) })
+	goWithCrashReport("watchdog", func() { watchdog.run(ctx) })
+	if reloader := newConfigReloader(); reloader != nil {
+		goWithCrashReport("config_reloader", func() { reloader.watch(ctx) })
+	}
+	bus := newEventBus()
+	defer bus.Close()
+	if err := subscribePollEvents(ctx, bus); err != nil {
+		log.Fatalf("Failed to subscribe to poll events: %v", err)
+	}
+	goWithCrashReport("poll_events", func() { simulatePollEvents(ctx, bus) })
+	store, err := openDataStore(ctx)
+	if err != nil {
+		// Flush first so a failed migration's trace reaches the backend
+		shutdownTelemetry(context.Background())
+		var migrationErr *migrationError
+		if errors.As(err, &migrationErr) {
+			log.Fatalf("Failed to migrate data store: %v", err)
+		}
+		log.Fatalf("Failed to open data store: %v", err)
+	}
+	dataLayer = withBulkhead(store)
+	defer dataLayer.close(context.Background())
+	objects = newObjectStore()
+	setReady(false)
+	goWithCrashReport("grpc_server", func() { serveGRPC(ctx) })
+	if annotations != nil {
+		annotations.started(ctx)
+	}
+	analytics := newAnalyticsWriter()
+	if analytics != nil {
+		goWithCrashReport("analytics_writer", func() { analytics.run(ctx) })
+	}
+	if alerts := newAlertNotifier(); alerts != nil {
+		goWithCrashReport("alert_notifier", func() { alerts.run(ctx) })
+	}
+	goWithCrashReport("error_budget", func() { sloBudget.run(ctx) })
+
+	gatewayRoutes, err := loadGatewayRoutes()
+	if err != nil {
+		log.Fatalf("Failed to configure gateway: %v", err)
+	}
+	if middlewareGroups, err = loadMiddlewareGroups(); err != nil {
+		log.Fatalf("Failed to configure route middleware: %v", err)
+	}
+
+	// Setup HTTP routes; gateway prefixes are mounted first and a "/" prefix
+	// replaces the demo root handler
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", rootHandler)
-	mux.HandleFunc("/data", dataHandler)
-	mux.HandleFunc("/error", errorHandler)
+	gatewayRoot := false
+	for _, route := range gatewayRoutes {
+		mux.Handle(route.prefix, route)
+		gatewayRoot = gatewayRoot || route.prefix == "/"
+	}
+	var mounted []apiRoute
+	for _, route := range apiRoutes() {
+		if route.pattern == "/" && gatewayRoot {
+			continue
+		}
+		mux.HandleFunc(route.pattern, route.handler)
+		mounted = append(mounted, route)
+	}
+	versionedRoutes(mux, mounted)
+	mux.HandleFunc("/openapi.json", openAPIHandler(mounted))
+	if proxy != nil {
+		mux.Handle(otlpProxyPath, proxy)
+	}
+	router = mux
+
+	// Admin and debug endpoints move to ADMIN_ADDR, or a systemd "admin"
+	// socket, when there is one
+	adminAddr := os.Getenv("ADMIN_ADDR")
+	separateAdmin := adminAddr != "" || socketActivation.admin != nil
+	adminMux := mux
+	if separateAdmin {
+		adminMux = http.NewServeMux()
+	}
+	registerAdminRoutes(adminMux)
+	if separateAdmin {
+		goWithCrashReport("admin_server", func() { serveAdmin(adminAddr, adminMux) })
+	}
+
+	// Wrap with panic recovery, CORS and security headers, OTEL
+	// instrumentation, latency tracking and load shedding; the chain keeps
+	// the stages in order
+	var middleware middlewareChain
+	middleware.Use(stageRecovery, recoverPanics)
+	middleware.Use(stageCORS, enableCORS(cors), secureHeaders)
+	middleware.Use(stageAuth, requireRouteAuth(loadAdminCredentials()), markDebugTraces)
+	middleware.Use(stageOTel,
+		withRoute,
+		unixRemoteAddr,
+		func(next http.Handler) http.Handler {
+			return otelhttp.NewHandler(next, "go-service", otelhttp.WithFilter(traceFilter))
+		},
+		tagUnixPeers,
+		tagDebugTraces,
+	)
+	middleware.Use(stageMetrics,
+		routeCanary,
+		func(next http.Handler) http.Handler { return recordWideEvents(analytics, next) },
+		serverTiming,
+		shadowTraffic,
+		watchRequests,
+		captureRequests,
+		captureHeaders,
+		captureBodies,
+		trackClientCertificates,
+		tagExperimentVariant,
+		trackGeo,
+		trackClients,
+		trackResponseSize,
+		trackSlowRequests,
+		trackApdex,
+		enforceErrorBudget,
+		idempotentRequests,
+		func(next http.Handler) http.Handler { return limitConcurrency(limiter, next) },
+		injectFaults,
+		trackClientDisconnects,
+	)
+	handler := middleware.Chain(mux)
+
+	// Sockets from systemd replace :8000; past the first they serve plain HTTP
+	server := &http.Server{Addr: ":8000", Handler: handler, ConnContext: unixConnContext}
+	var lis net.Listener
+	if len(socketActivation.http) > 0 {
+		lis = socketActivation.http[0]
+		for _, extra := range socketActivation.http[1:] {
+			extra := extra
+			goWithCrashReport("systemd_listener", func() {
+				if err := server.Serve(extra); err != nil && err != http.ErrServerClosed {
+					log.Fatalf("Server on %s failed: %v", extra.Addr(), err)
+				}
+			})
+		}
+	} else if lis, err = listen(server.Addr); err != nil {
+		log.Fatal(err)
+	}
+	for _, l := range append([]net.Listener{lis}, socketActivation.http[min(1, len(socketActivation.http)):]...) {
+		binaryUpgrader.inherit("http", l)
+	}
+	// A sidecar proxy can reach the same handlers over a Unix socket; TLS
+	// stays on the TCP listener
+	if path := os.Getenv("HTTP_UNIX_SOCKET"); path != "" {
+		unixLis := socketActivation.unix
+		if unixLis == nil {
+			if unixLis, err = listenUnix(path); err != nil {
+				log.Fatalf("Failed to listen on %s: %v", path, err)
+			}
+		}
+		defer unixLis.Close()
+		binaryUpgrader.inherit("unix", unixLis)
+		goWithCrashReport("unix_listener", func() {
+			log.Printf("Go service listening on unix:%s", path)
+			if err := server.Serve(unixLis); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Unix socket server failed: %v", err)
+			}
+		})
+	}
+	binaryUpgrader.onDrain(func(ctx context.Context) { server.Shutdown(ctx) })
+	goWithCrashReport("binary_upgrader", func() { binaryUpgrader.watch(ctx) })
+	setReady(true)
+
+	if serverCerts != nil {
+		server.TLSConfig = &tls.Config{
+			GetCertificate: serverCerts.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+		if err := configureClientAuth(server.TLSConfig); err != nil {
+			log.Fatalf("Failed to configure mTLS: %v", err)
+		}
+		goWithCrashReport("tls_reloader", func() { serverCerts.watch(ctx) })
 
-	// Wrap with OTEL instrumentation and CORS
-	handler := enableCORS(otelhttp.NewHandler(mux, "go-service"))
+		log.Printf("Go service starting on %s (HTTPS)", lis.Addr())
+		socketActivation.signalReady()
+		if err := server.ServeTLS(lis, "", ""); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+		<-binaryUpgrader.drained
+		cancel()
+		return 0
+	}
 
-	log.Println("Go service starting on :8000")
-	if err := http.ListenAndServe(":8000", handler); err != nil {
+	log.Printf("Go service starting on %s", lis.Addr())
+	socketActivation.signalReady()
+	if err := server.Serve(lis); err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+	// A new process took over; wait for the drain so the deferred shutdowns
+	// flush its spans
+	<-binaryUpgrader.drained
+	cancel()
+	return 0
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedContext carries a sampled span context, as a request's would
+func tracedContext() context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+	}))
+}
+
+func BenchmarkLogJSON(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	ctx := tracedContext()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logJSON(ctx, "INFO", "Request completed", map[string]interface{}{
+			"method":      "GET",
+			"path":        "/data",
+			"status":      200,
+			"duration_ms": 12.5,
+		})
+	}
+}
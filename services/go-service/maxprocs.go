@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// cpuQuota returns the container CPU limit in cores from cgroup v2 or v1
+func cpuQuota() (float64, bool) {
+	if data, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		quota, err1 := strconv.ParseFloat(fields[0], 64)
+		period, err2 := strconv.ParseFloat(fields[1], 64)
+		if err1 != nil || err2 != nil || period <= 0 {
+			return 0, false
+		}
+		return quota / period, true
+	}
+
+	quota, err1 := readCgroupInt("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+	period, err2 := readCgroupInt("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	if err1 != nil || err2 != nil || quota <= 0 || period <= 0 {
+		return 0, false
+	}
+	return float64(quota) / float64(period), true
+}
+
+func readCgroupInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// adjustMaxProcs sizes GOMAXPROCS to the cgroup CPU quota unless GOMAXPROCS is set explicitly
+func adjustMaxProcs() {
+	ctx := context.Background()
+
+	if v := os.Getenv("GOMAXPROCS"); v != "" {
+		logJSON(ctx, "INFO", "GOMAXPROCS set from environment", map[string]interface{}{
+			"gomaxprocs": runtime.GOMAXPROCS(0),
+		})
+		return
+	}
+
+	quota, ok := cpuQuota()
+	if !ok {
+		return
+	}
+
+	procs := int(math.Floor(quota))
+	if procs < 1 {
+		procs = 1
+	}
+	prev := runtime.GOMAXPROCS(procs)
+
+	logJSON(ctx, "INFO", "GOMAXPROCS adjusted to CPU quota", map[string]interface{}{
+		"cpu_quota":  quota,
+		"gomaxprocs": procs,
+		"previous":   prev,
+		"num_cpu":    runtime.NumCPU(),
+	})
+}
+
+// initMaxProcsMetrics exports the effective GOMAXPROCS and container CPU quota
+func initMaxProcsMetrics() error {
+	gomaxprocs, err := meter.Int64ObservableGauge(
+		"runtime_gomaxprocs",
+		metric.WithDescription("Effective GOMAXPROCS value"),
+	)
+	if err != nil {
+		return err
+	}
+
+	numCPU, err := meter.Int64ObservableGauge(
+		"runtime_num_cpu",
+		metric.WithDescription("Number of logical CPUs visible to the process"),
+	)
+	if err != nil {
+		return err
+	}
+
+	quota, err := meter.Float64ObservableGauge(
+		"container_cpu_quota_cores",
+		metric.WithDescription("CPU limit from the cgroup quota, in cores"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(gomaxprocs, int64(runtime.GOMAXPROCS(0)))
+		o.ObserveInt64(numCPU, int64(runtime.NumCPU()))
+		if q, ok := cpuQuota(); ok {
+			o.ObserveFloat64(quota, q)
+		}
+		return nil
+	}, gomaxprocs, numCPU, quota)
+	return err
+}
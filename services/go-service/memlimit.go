@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	metricGCCycles      = "/gc/cycles/total:gc-cycles"
+	metricGCPercent     = "/gc/gogc:percent"
+	metricHeapGoal      = "/gc/heap/goal:bytes"
+	metricMemoryLimit   = "/gc/gomemlimit:bytes"
+	metricMemoryTotal   = "/memory/classes/total:bytes"
+	metricMemoryRelease = "/memory/classes/heap/released:bytes"
+)
+
+// readRuntimeMetrics samples the runtime metrics used for GC tuning visibility
+func readRuntimeMetrics() map[string]uint64 {
+	samples := []metrics.Sample{
+		{Name: metricGCCycles},
+		{Name: metricGCPercent},
+		{Name: metricHeapGoal},
+		{Name: metricMemoryLimit},
+		{Name: metricMemoryTotal},
+		{Name: metricMemoryRelease},
+	}
+	metrics.Read(samples)
+
+	values := make(map[string]uint64, len(samples))
+	for _, s := range samples {
+		if s.Value.Kind() == metrics.KindUint64 {
+			values[s.Name] = s.Value.Uint64()
+		}
+	}
+	return values
+}
+
+// cgroupMemoryLimit returns the container memory limit in bytes from cgroup v2 or v1
+func cgroupMemoryLimit() (int64, bool) {
+	paths := []string{
+		"/sys/fs/cgroup/memory.max",
+		"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		limit, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil || limit <= 0 || limit > 1<<60 {
+			return 0, false
+		}
+		return limit, true
+	}
+	return 0, false
+}
+
+// configureMemoryLimit applies GC_PERCENT and MEMORY_LIMIT_RATIO on top of GOGC/GOMEMLIMIT
+func configureMemoryLimit() {
+	ctx := context.Background()
+
+	if v := os.Getenv("GC_PERCENT"); v != "" {
+		if percent, err := strconv.Atoi(v); err == nil {
+			debug.SetGCPercent(percent)
+		}
+	}
+
+	// An explicit GOMEMLIMIT always wins over the cgroup-derived limit
+	if os.Getenv("GOMEMLIMIT") == "" {
+		ratio := envFloat("MEMORY_LIMIT_RATIO", 0)
+		if limit, ok := cgroupMemoryLimit(); ok && ratio > 0 && ratio <= 1 {
+			debug.SetMemoryLimit(int64(float64(limit) * ratio))
+		}
+	}
+
+	values := readRuntimeMetrics()
+	logJSON(ctx, "INFO", "GC tuning configured", map[string]interface{}{
+		"gc_percent":         int64(values[metricGCPercent]),
+		"memory_limit_bytes": int64(values[metricMemoryLimit]),
+	})
+}
+
+// watchMemoryLimit logs when process memory approaches the configured soft limit
+func watchMemoryLimit(ctx context.Context) {
+	threshold := envFloat("MEMORY_LIMIT_WARN_RATIO", 0.9)
+	ticker := time.NewTicker(envDuration("MEMORY_LIMIT_CHECK_INTERVAL", 10*time.Second))
+	defer ticker.Stop()
+
+	warned := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		values := readRuntimeMetrics()
+		limit := values[metricMemoryLimit]
+		if limit == 0 || limit == math.MaxInt64 {
+			continue
+		}
+
+		used := values[metricMemoryTotal] - values[metricMemoryRelease]
+		ratio := float64(used) / float64(limit)
+		fields := map[string]interface{}{
+			"used_bytes":         used,
+			"memory_limit_bytes": limit,
+			"ratio":              ratio,
+			"gc_cycles":          values[metricGCCycles],
+		}
+
+		if ratio >= threshold && !warned {
+			logJSON(ctx, "WARN", "Memory usage approaching GOMEMLIMIT", fields)
+			warned = true
+		} else if ratio < threshold && warned {
+			logJSON(ctx, "INFO", "Memory usage back under GOMEMLIMIT threshold", fields)
+			warned = false
+		}
+	}
+}
+
+// initMemoryLimitMetrics exports the configured GC knobs and GC cycle counts
+func initMemoryLimitMetrics() error {
+	memoryLimit, err := meter.Int64ObservableGauge(
+		"go_memory_limit_bytes",
+		metric.WithDescription("Configured Go soft memory limit (GOMEMLIMIT)"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
+
+	gcPercent, err := meter.Int64ObservableGauge(
+		"go_gc_percent",
+		metric.WithDescription("Configured GOGC percentage"),
+	)
+	if err != nil {
+		return err
+	}
+
+	heapGoal, err := meter.Int64ObservableGauge(
+		"go_gc_heap_goal_bytes",
+		metric.WithDescription("Heap size target for the end of the current GC cycle"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
+
+	gcCycles, err := meter.Int64ObservableCounter(
+		"go_gc_cycles_total",
+		metric.WithDescription("Number of completed GC cycles"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		values := readRuntimeMetrics()
+		o.ObserveInt64(memoryLimit, int64(values[metricMemoryLimit]))
+		o.ObserveInt64(gcPercent, int64(values[metricGCPercent]))
+		o.ObserveInt64(heapGoal, int64(values[metricHeapGoal]))
+		o.ObserveInt64(gcCycles, int64(values[metricGCCycles]))
+		return nil
+	}, memoryLimit, gcPercent, heapGoal, gcCycles)
+	return err
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// parseAggregation reads one METRICS_VIEWS aggregation: drop, last_value,
+// sum, default, exponential, or histogram with optional "|"-separated
+// boundaries ("histogram:0.1|0.5|1")
+func parseAggregation(spec string) (sdkmetric.Aggregation, error) {
+	kind, args, _ := strings.Cut(strings.ToLower(spec), ":")
+	switch kind {
+	case "drop":
+		return sdkmetric.AggregationDrop{}, nil
+	case "last_value":
+		return sdkmetric.AggregationLastValue{}, nil
+	case "sum":
+		return sdkmetric.AggregationSum{}, nil
+	case "default":
+		return sdkmetric.AggregationDefault{}, nil
+	case "exponential":
+		return sdkmetric.AggregationBase2ExponentialHistogram{
+			MaxSize:  int32(envInt("METRICS_EXPONENTIAL_MAX_SIZE", 160)),
+			MaxScale: int32(envInt("METRICS_EXPONENTIAL_MAX_SCALE", 20)),
+		}, nil
+	case "histogram":
+		if args == "" {
+			// The SDK's default boundaries; a zero-value aggregation has none
+			return sdkmetric.AggregationExplicitBucketHistogram{
+				Boundaries: []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000},
+			}, nil
+		}
+		var boundaries []float64
+		for _, b := range strings.Split(args, "|") {
+			v, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid histogram boundary %q", b)
+			}
+			if n := len(boundaries); n > 0 && v <= boundaries[n-1] {
+				return nil, fmt.Errorf("histogram boundaries must increase, got %v after %v", v, boundaries[n-1])
+			}
+			boundaries = append(boundaries, v)
+		}
+		return sdkmetric.AggregationExplicitBucketHistogram{Boundaries: boundaries}, nil
+	}
+	return nil, fmt.Errorf("unknown aggregation %q", spec)
+}
+
+// viewOverrides builds a view per METRICS_VIEWS entry, e.g.
+// "runtime_*=drop,http_response_size_bytes=histogram:1024|65536|1048576".
+// Names may use * and ? wildcards.
+func viewOverrides() ([]sdkmetric.View, error) {
+	var views []sdkmetric.View
+	for _, kv := range keyValues(envString("METRICS_VIEWS", "")) {
+		aggregation, err := parseAggregation(kv.value)
+		if err != nil {
+			return nil, fmt.Errorf("METRICS_VIEWS %s: %w", kv.key, err)
+		}
+		views = append(views, sdkmetric.NewView(
+			sdkmetric.Instrument{Name: kv.key},
+			sdkmetric.Stream{Aggregation: aggregation},
+		))
+	}
+	return views, nil
+}
+
+// firstMatch combines views so only the first one matching an instrument
+// applies; an operator override then replaces a built-in view for the same
+// instrument instead of exporting a second stream
+func firstMatch(views ...sdkmetric.View) sdkmetric.View {
+	return func(inst sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+		for _, v := range views {
+			if s, ok := v(inst); ok {
+				return s, true
+			}
+		}
+		return sdkmetric.Stream{}, false
+	}
+}
+
+func parseTemporality(value string) (metricdata.Temporality, error) {
+	switch strings.ToLower(value) {
+	case "cumulative":
+		return metricdata.CumulativeTemporality, nil
+	case "delta":
+		return metricdata.DeltaTemporality, nil
+	}
+	return 0, fmt.Errorf("unknown temporality %q", value)
+}
+
+// temporalitySelector applies METRICS_TEMPORALITY to the exporter. Delta
+// follows the OTLP "delta" preference: up-down counters stay cumulative.
+func temporalitySelector() (sdkmetric.TemporalitySelector, error) {
+	temporality, err := parseTemporality(envString("METRICS_TEMPORALITY", "cumulative"))
+	if err != nil {
+		return nil, fmt.Errorf("METRICS_TEMPORALITY: %w", err)
+	}
+	if temporality == metricdata.CumulativeTemporality {
+		return sdkmetric.DefaultTemporalitySelector, nil
+	}
+	return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+		switch kind {
+		case sdkmetric.InstrumentKindUpDownCounter, sdkmetric.InstrumentKindObservableUpDownCounter:
+			return metricdata.CumulativeTemporality
+		}
+		return metricdata.DeltaTemporality
+	}, nil
+}
+
+// seriesKey identifies one exported time series
+type seriesKey struct {
+	name  string
+	attrs attribute.Distinct
+}
+
+type sumState[N int64 | float64] struct {
+	start, time time.Time
+	value       N
+}
+
+type histogramState[N int64 | float64] struct {
+	start, time time.Time
+	count       uint64
+	sum         N
+	buckets     []uint64
+	min, max    metricdata.Extrema[N]
+}
+
+// temporalityExporter converts sums and histograms named in
+// METRICS_TEMPORALITY_OVERRIDES ("http_requests_total=delta") to the
+// requested temporality before export, remembering the previous point of
+// every converted series. The SDK only selects temporality per instrument
+// kind, so per-instrument overrides are applied here.
+type temporalityExporter struct {
+	sdkmetric.Exporter
+	overrides []keyValue
+
+	mu    sync.Mutex
+	state map[seriesKey]interface{}
+}
+
+// newTemporalityExporter wraps exporter when overrides are configured
+func newTemporalityExporter(exporter sdkmetric.Exporter) (sdkmetric.Exporter, error) {
+	overrides := keyValues(envString("METRICS_TEMPORALITY_OVERRIDES", ""))
+	if len(overrides) == 0 {
+		return exporter, nil
+	}
+	for _, kv := range overrides {
+		if _, err := parseTemporality(kv.value); err != nil {
+			return nil, fmt.Errorf("METRICS_TEMPORALITY_OVERRIDES %s: %w", kv.key, err)
+		}
+		if _, err := path.Match(kv.key, ""); err != nil {
+			return nil, fmt.Errorf("METRICS_TEMPORALITY_OVERRIDES %s: %w", kv.key, err)
+		}
+	}
+	return &temporalityExporter{Exporter: exporter, overrides: overrides, state: map[seriesKey]interface{}{}}, nil
+}
+
+// wanted returns the override for an instrument name, first match wins
+func (e *temporalityExporter) wanted(name string) (metricdata.Temporality, bool) {
+	for _, kv := range e.overrides {
+		if ok, _ := path.Match(kv.key, name); ok {
+			t, _ := parseTemporality(kv.value)
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+func (e *temporalityExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	e.mu.Lock()
+	for i := range rm.ScopeMetrics {
+		metrics := rm.ScopeMetrics[i].Metrics
+		for j := range metrics {
+			want, ok := e.wanted(metrics[j].Name)
+			if !ok {
+				continue
+			}
+			name := metrics[j].Name
+			switch data := metrics[j].Data.(type) {
+			case metricdata.Sum[int64]:
+				if data.Temporality != want {
+					metrics[j].Data = convertSum(e.state, name, data, want)
+				}
+			case metricdata.Sum[float64]:
+				if data.Temporality != want {
+					metrics[j].Data = convertSum(e.state, name, data, want)
+				}
+			case metricdata.Histogram[int64]:
+				if data.Temporality != want {
+					metrics[j].Data = convertHistogram(e.state, name, data, want)
+				}
+			case metricdata.Histogram[float64]:
+				if data.Temporality != want {
+					metrics[j].Data = convertHistogram(e.state, name, data, want)
+				}
+			}
+		}
+	}
+	e.mu.Unlock()
+	return e.Exporter.Export(ctx, rm)
+}
+
+// convertSum turns cumulative points into the change since the previous
+// export, or accumulates delta points into running totals
+func convertSum[N int64 | float64](state map[seriesKey]interface{}, name string, s metricdata.Sum[N], want metricdata.Temporality) metricdata.Sum[N] {
+	out := metricdata.Sum[N]{Temporality: want, IsMonotonic: s.IsMonotonic}
+	for _, dp := range s.DataPoints {
+		key := seriesKey{name, dp.Attributes.Equivalent()}
+		prev, seen := state[key].(sumState[N])
+		next := sumState[N]{start: dp.StartTime, time: dp.Time, value: dp.Value}
+
+		switch {
+		// A monotonic sum that went down was reset, so it is sent as is
+		case want == metricdata.DeltaTemporality && seen && (!s.IsMonotonic || dp.Value >= prev.value):
+			dp.StartTime, dp.Value = prev.time, dp.Value-prev.value
+		case want == metricdata.CumulativeTemporality && seen:
+			next.start, next.value = prev.start, prev.value+dp.Value
+			dp.StartTime, dp.Value = next.start, next.value
+		}
+		state[key] = next
+		out.DataPoints = append(out.DataPoints, dp)
+	}
+	return out
+}
+
+// convertHistogram is convertSum for histograms. Delta points derived from
+// cumulative ones have no min or max, since those cannot be subtracted.
+func convertHistogram[N int64 | float64](state map[seriesKey]interface{}, name string, h metricdata.Histogram[N], want metricdata.Temporality) metricdata.Histogram[N] {
+	out := metricdata.Histogram[N]{Temporality: want}
+	for _, dp := range h.DataPoints {
+		key := seriesKey{name, dp.Attributes.Equivalent()}
+		prev, seen := state[key].(histogramState[N])
+		// The SDK reuses these slices between collections
+		dp.Bounds = append([]float64(nil), dp.Bounds...)
+		dp.BucketCounts = append([]uint64(nil), dp.BucketCounts...)
+		next := histogramState[N]{
+			start:   dp.StartTime,
+			time:    dp.Time,
+			count:   dp.Count,
+			sum:     dp.Sum,
+			buckets: append([]uint64(nil), dp.BucketCounts...),
+			min:     dp.Min,
+			max:     dp.Max,
+		}
+		compatible := seen && len(prev.buckets) == len(dp.BucketCounts)
+
+		switch {
+		case want == metricdata.DeltaTemporality && compatible && dp.Count >= prev.count:
+			dp.StartTime = prev.time
+			dp.Count -= prev.count
+			dp.Sum -= prev.sum
+			for i := range dp.BucketCounts {
+				dp.BucketCounts[i] -= prev.buckets[i]
+			}
+			dp.Min, dp.Max = metricdata.Extrema[N]{}, metricdata.Extrema[N]{}
+		case want == metricdata.CumulativeTemporality && compatible:
+			next.start = prev.start
+			next.count += prev.count
+			next.sum += prev.sum
+			for i := range next.buckets {
+				next.buckets[i] += prev.buckets[i]
+			}
+			next.min = extremum(prev.min, dp.Min, func(a, b N) bool { return a < b })
+			next.max = extremum(prev.max, dp.Max, func(a, b N) bool { return a > b })
+			dp.StartTime, dp.Count, dp.Sum, dp.Min, dp.Max = next.start, next.count, next.sum, next.min, next.max
+			dp.BucketCounts = append([]uint64(nil), next.buckets...)
+		}
+		state[key] = next
+		out.DataPoints = append(out.DataPoints, dp)
+	}
+	return out
+}
+
+// extremum returns whichever defined value of a and b wins by better
+func extremum[N int64 | float64](a, b metricdata.Extrema[N], better func(x, y N) bool) metricdata.Extrema[N] {
+	av, aok := a.Value()
+	bv, bok := b.Value()
+	switch {
+	case !aok:
+		return b
+	case !bok:
+		return a
+	case better(bv, av):
+		return b
+	}
+	return a
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// router is the application mux, used by middleware to resolve route patterns
+var router *http.ServeMux
+
+// routeOf returns the registered pattern serving r, keeping metric labels bounded
+func routeOf(r *http.Request) string {
+	if router == nil {
+		return r.URL.Path
+	}
+	_, pattern := router.Handler(r)
+	if pattern == "" {
+		return "unmatched"
+	}
+	return pattern
+}
+
+// trustedProxies are the load balancers and edge proxies whose
+// X-Forwarded-For and location headers are believed
+var trustedProxies = parseCIDRs("TRUSTED_PROXIES", envString("TRUSTED_PROXIES", ""))
+
+// parseCIDRs parses a comma-separated CIDR list, skipping invalid entries
+// with an error log
+func parseCIDRs(name, value string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range splitList(value) {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			logJSON(context.Background(), "ERROR", "Invalid CIDR, ignoring it", map[string]interface{}{
+				"setting": name,
+				"cidr":    cidr,
+			})
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func trustedProxy(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerIP returns the address of the connection's other end
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// fromTrustedProxy reports whether r's connection comes from a trusted proxy
+func fromTrustedProxy(r *http.Request) bool {
+	return trustedProxy(net.ParseIP(peerIP(r)))
+}
+
+// clientIP returns the connection's remote address or, when that is a
+// trusted proxy, the nearest X-Forwarded-For hop that is not one. Any client
+// can send X-Forwarded-For, so it is ignored from everyone else.
+func clientIP(r *http.Request) string {
+	peer := peerIP(r)
+	if !trustedProxy(net.ParseIP(peer)) {
+		return peer
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if ip := net.ParseIP(hop); ip == nil || !trustedProxy(ip) || i == 0 {
+			return hop
+		}
+	}
+	return peer
+}
+
+// statusRecorder captures the status code and body size written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	// Informational responses such as 103 Early Hints precede the real header
+	if code >= 200 {
+		s.wroteHeader = true
+	}
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Flush forwards to the underlying writer so streaming handlers keep working
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	saved := trustedProxies
+	trustedProxies = []*net.IPNet{network}
+	t.Cleanup(func() { trustedProxies = saved })
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"no header", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"spoofed by an untrusted peer", "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:5000", "198.51.100.1", "198.51.100.1"},
+		{"client prepends a hop", "10.0.0.2:5000", "192.0.2.9, 198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:5000", "198.51.100.1, 10.1.1.1, 10.2.2.2", "198.51.100.1"},
+		{"only trusted hops", "10.0.0.2:5000", "10.1.1.1", "10.1.1.1"},
+		{"trusted proxy without header", "10.0.0.2:5000", "", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// middlewareStage is where a middleware sits in the HTTP chain. Stages run
+// outermost first in this order, whatever order they are added in:
+//
+//	recovery → CORS → auth → otel → metrics → handler
+//
+// so a panic anywhere is answered, preflights and response headers never
+// depend on auth, and the server span covers everything the metrics see.
+type middlewareStage int
+
+const (
+	// stageRecovery turns a panicking request into a 500
+	stageRecovery middlewareStage = iota
+	// stageCORS answers preflights and sets the response header policy
+	stageCORS
+	// stageAuth decides what a request may do before its span starts, such
+	// as forcing a debug trace
+	stageAuth
+	// stageOTel starts the server span and what it reads from the request
+	stageOTel
+	// stageMetrics measures, captures and shapes requests inside the span
+	stageMetrics
+	middlewareStages
+)
+
+// middlewareChain composes HTTP middleware by stage. Within a stage the
+// first middleware added is the outermost.
+type middlewareChain struct {
+	stages [middlewareStages][]func(http.Handler) http.Handler
+}
+
+// Use adds middleware to a stage
+func (c *middlewareChain) Use(stage middlewareStage, mw ...func(http.Handler) http.Handler) {
+	if stage < 0 || stage >= middlewareStages {
+		panic(fmt.Sprintf("middleware stage %d out of range", stage))
+	}
+	c.stages[stage] = append(c.stages[stage], mw...)
+}
+
+// Chain wraps h in every stage's middleware
+func (c *middlewareChain) Chain(h http.Handler) http.Handler {
+	for stage := middlewareStages - 1; stage >= 0; stage-- {
+		mws := c.stages[stage]
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+	}
+	return h
+}
+
+// recoverPanics answers a request whose handler panicked with a 500 and
+// logs the panic with its stack, instead of net/http dropping the
+// connection. http.ErrAbortHandler keeps aborting the response. A handler
+// that had already sent its header cannot be answered with a 500, so its
+// response is aborted instead of ending as if it were complete.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newStatusRecorder(w)
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			logJSON(r.Context(), "ERROR", "Request handler panicked", map[string]interface{}{
+				"panic":  fmt.Sprint(v),
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"stack":  string(debug.Stack()),
+			})
+			if rec.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tagging returns middleware that appends name to the X-Order request
+// header on the way in, so the handler sees the order middleware ran in
+func tagging(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Add("X-Order", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(c *middlewareChain)
+		want  string
+	}{
+		{
+			name: "stages added in order",
+			build: func(c *middlewareChain) {
+				c.Use(stageRecovery, tagging("recovery"))
+				c.Use(stageCORS, tagging("cors"))
+				c.Use(stageAuth, tagging("auth"))
+				c.Use(stageOTel, tagging("otel"))
+				c.Use(stageMetrics, tagging("metrics"))
+			},
+			want: "recovery,cors,auth,otel,metrics",
+		},
+		{
+			name: "stages added in reverse",
+			build: func(c *middlewareChain) {
+				c.Use(stageMetrics, tagging("metrics"))
+				c.Use(stageOTel, tagging("otel"))
+				c.Use(stageAuth, tagging("auth"))
+				c.Use(stageCORS, tagging("cors"))
+				c.Use(stageRecovery, tagging("recovery"))
+			},
+			want: "recovery,cors,auth,otel,metrics",
+		},
+		{
+			name: "stages interleaved",
+			build: func(c *middlewareChain) {
+				c.Use(stageMetrics, tagging("metrics1"))
+				c.Use(stageAuth, tagging("auth"))
+				c.Use(stageMetrics, tagging("metrics2"))
+				c.Use(stageRecovery, tagging("recovery"))
+			},
+			want: "recovery,auth,metrics1,metrics2",
+		},
+		{
+			name: "several in one call",
+			build: func(c *middlewareChain) {
+				c.Use(stageOTel, tagging("otel1"), tagging("otel2"))
+				c.Use(stageCORS, tagging("cors"))
+			},
+			want: "cors,otel1,otel2",
+		},
+		{
+			name:  "empty chain",
+			build: func(c *middlewareChain) {},
+			want:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c middlewareChain
+			tt.build(&c)
+
+			var got string
+			h := c.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = strings.Join(r.Header.Values("X-Order"), ",")
+			}))
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/data", nil))
+			if got != tt.want {
+				t.Errorf("middleware ran as %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareChainUseOutOfRange(t *testing.T) {
+	for _, stage := range []middlewareStage{-1, middlewareStages} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Use(%d) did not panic", stage)
+				}
+			}()
+			var c middlewareChain
+			c.Use(stage, tagging("x"))
+		}()
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+	}{
+		{
+			name:       "no panic",
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusAccepted) },
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "panic with a value",
+			handler:    func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "panic with an error",
+			handler:    func(w http.ResponseWriter, r *http.Request) { panic(http.ErrBodyNotAllowed) },
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			recoverPanics(tt.handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/data", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRecoverPanicsRepanicsAbort(t *testing.T) {
+	h := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/data", nil))
+	t.Error("http.ErrAbortHandler was swallowed")
+}
+
+func TestRecoverPanicsAfterHeaderAborts(t *testing.T) {
+	h := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+		}
+		if rec.Code != http.StatusOK || rec.Body.String() != "partial" {
+			t.Errorf("response = %d %q, want the handler's 200 %q left alone", rec.Code, rec.Body.String(), "partial")
+		}
+	}()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/data", nil))
+	t.Error("panic after the header was written did not abort the response")
+}
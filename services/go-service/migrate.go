@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// migration is one versioned schema change of a data store backend
+type migration struct {
+	version     int
+	description string
+	up          func(ctx context.Context) error
+}
+
+// migrator is implemented by data store backends with a schema: they list
+// their migrations, keep the version last applied and hold a lock while
+// migrating. Only the mongo store (-tags mongo) has one; the simulated
+// default has no schema to migrate.
+type migrator interface {
+	migrations() []migration
+	schemaVersion(ctx context.Context) (int, error)
+	setSchemaVersion(ctx context.Context, version int) error
+	// lockSchema takes the migration lock; ok is false while another
+	// process holds it
+	lockSchema(ctx context.Context) (unlock func(), ok bool, err error)
+}
+
+// migrationLockRetry is how often a process waiting on another's
+// migrations tries the lock again
+const migrationLockRetry = time.Second
+
+// appliedSchema is what the schema_version gauge reports; backend stays
+// empty while the data layer has no schema
+var appliedSchema struct {
+	mu      sync.Mutex
+	backend string
+	version int
+}
+
+func setAppliedSchema(backend string, version int) {
+	appliedSchema.mu.Lock()
+	defer appliedSchema.mu.Unlock()
+	appliedSchema.backend = backend
+	appliedSchema.version = version
+}
+
+// initMigrationMetrics creates the schema version gauge
+func initMigrationMetrics() error {
+	version, err := meter.Int64ObservableGauge(
+		"schema_version",
+		metric.WithDescription("Schema version of the data store after the startup migrations, by backend"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		appliedSchema.mu.Lock()
+		defer appliedSchema.mu.Unlock()
+		if appliedSchema.backend != "" {
+			o.ObserveInt64(version, int64(appliedSchema.version), metric.WithAttributes(
+				attribute.String("backend", appliedSchema.backend),
+			))
+		}
+		return nil
+	}, version)
+	return err
+}
+
+// migrationError is a failed schema migration, told apart from other
+// startup errors so it can be reported as one
+type migrationError struct {
+	backend string
+	err     error
+}
+
+func (e *migrationError) Error() string {
+	return fmt.Sprintf("%s schema: %v", e.backend, e.err)
+}
+
+func (e *migrationError) Unwrap() error { return e.err }
+
+// migrateDataStore applies the store's pending migrations in version order
+// under a "schema_migrate" span, one "schema_migration" child per step, so a
+// startup that fails on a migration shows which step and why in its trace.
+// Each step's version is saved as soon as it succeeds, so a rerun resumes
+// after the last good one. Processes starting together (supervised workers,
+// replicas) take the store's migration lock first and read the version under
+// it, so only one applies each step.
+func migrateDataStore(ctx context.Context, store dataStore) error {
+	m, ok := store.(migrator)
+	if !ok {
+		return nil
+	}
+	ctx, span := tracer.Start(ctx, "schema_migrate", trace.WithAttributes(
+		attribute.String("db.system", store.name()),
+	))
+	defer span.End()
+
+	fail := func(err error) error {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "schema migration failed")
+		logJSON(ctx, "ERROR", "Schema migration failed", map[string]interface{}{
+			"backend": store.name(),
+			"error":   err.Error(),
+		})
+		return &migrationError{backend: store.name(), err: err}
+	}
+
+	unlock, err := waitForSchemaLock(ctx, m)
+	if err != nil {
+		return fail(fmt.Errorf("taking the migration lock: %w", err))
+	}
+	defer unlock()
+
+	current, err := m.schemaVersion(ctx)
+	if err != nil {
+		return fail(fmt.Errorf("reading schema version: %w", err))
+	}
+	span.SetAttributes(attribute.Int("db.schema.from_version", current))
+	setAppliedSchema(store.name(), current)
+
+	steps := m.migrations()
+	sort.Slice(steps, func(i, j int) bool { return steps[i].version < steps[j].version })
+	applied := 0
+	for _, step := range steps {
+		if step.version <= current {
+			continue
+		}
+		if err := runMigration(ctx, m, step); err != nil {
+			return fail(fmt.Errorf("migration %d (%s): %w", step.version, step.description, err))
+		}
+		current = step.version
+		applied++
+		setAppliedSchema(store.name(), current)
+	}
+	span.SetAttributes(
+		attribute.Int("db.schema.to_version", current),
+		attribute.Int("db.schema.migrations_applied", applied),
+	)
+	if applied > 0 {
+		logJSON(ctx, "INFO", "Schema migrated", map[string]interface{}{
+			"backend": store.name(),
+			"version": current,
+			"applied": applied,
+		})
+	}
+	return nil
+}
+
+// waitForSchemaLock takes the migration lock, retrying while another process
+// holds it for up to MIGRATION_LOCK_TIMEOUT
+func waitForSchemaLock(ctx context.Context, m migrator) (func(), error) {
+	lockCtx, cancel := context.WithTimeout(ctx, envDuration("MIGRATION_LOCK_TIMEOUT", 5*time.Minute))
+	defer cancel()
+	start := time.Now()
+	waiting := false
+	for {
+		unlock, ok, err := m.lockSchema(lockCtx)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if waiting {
+				trace.SpanFromContext(ctx).AddEvent("migration lock acquired", trace.WithAttributes(
+					attribute.Float64("wait_ms", durationMs(time.Since(start))),
+				))
+			}
+			return unlock, nil
+		}
+		if !waiting {
+			waiting = true
+			trace.SpanFromContext(ctx).AddEvent("waiting for migration lock")
+			logJSON(ctx, "INFO", "Another process is migrating the schema, waiting", nil)
+		}
+		select {
+		case <-lockCtx.Done():
+			return nil, lockCtx.Err()
+		case <-time.After(migrationLockRetry):
+		}
+	}
+}
+
+// runMigration applies one step in its own span and records its version
+func runMigration(ctx context.Context, m migrator, step migration) error {
+	ctx, span := tracer.Start(ctx, "schema_migration", trace.WithAttributes(
+		attribute.Int("db.migration.version", step.version),
+		attribute.String("db.migration.description", step.description),
+	))
+	defer span.End()
+
+	start := time.Now()
+	err := step.up(ctx)
+	if err == nil {
+		err = m.setSchemaVersion(ctx, step.version)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "migration failed")
+		return err
+	}
+	logJSON(ctx, "INFO", "Applied schema migration", map[string]interface{}{
+		"version":     step.version,
+		"description": step.description,
+		"duration_ms": durationMs(time.Since(start)),
+	})
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// lockingMigrator reports the lock as held by another process for the first
+// busy attempts
+type lockingMigrator struct {
+	busy     int
+	attempts int
+	unlocked bool
+}
+
+func (m *lockingMigrator) migrations() []migration                     { return nil }
+func (m *lockingMigrator) schemaVersion(context.Context) (int, error)  { return 0, nil }
+func (m *lockingMigrator) setSchemaVersion(context.Context, int) error { return nil }
+func (m *lockingMigrator) lockSchema(context.Context) (func(), bool, error) {
+	m.attempts++
+	if m.attempts <= m.busy {
+		return nil, false, nil
+	}
+	return func() { m.unlocked = true }, true, nil
+}
+
+func TestWaitForSchemaLockRetries(t *testing.T) {
+	m := &lockingMigrator{busy: 1}
+	unlock, err := waitForSchemaLock(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.attempts != 2 {
+		t.Fatalf("took the lock on attempt %d, want 2", m.attempts)
+	}
+	unlock()
+	if !m.unlocked {
+		t.Fatal("unlock did not release the lock")
+	}
+}
+
+func TestWaitForSchemaLockTimesOut(t *testing.T) {
+	t.Setenv("MIGRATION_LOCK_TIMEOUT", "10ms")
+	if _, err := waitForSchemaLock(context.Background(), &lockingMigrator{busy: 1 << 30}); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var clientCertRequests metric.Int64Counter
+
+// initMTLSMetrics creates the per-client request counter
+func initMTLSMetrics() error {
+	var err error
+	clientCertRequests, err = meter.Int64Counter(
+		"mtls_client_requests_total",
+		metric.WithDescription("Requests authenticated with a client certificate, by client identity"),
+	)
+	return err
+}
+
+// configureClientAuth enables mTLS from TLS_CLIENT_CA_FILE; TLS_CLIENT_AUTH
+// selects "require" (default) or "optional" verification
+func configureClientAuth(cfg *tls.Config) error {
+	caFile := os.Getenv("TLS_CLIENT_CA_FILE")
+	if caFile == "" {
+		return nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	if envString("TLS_CLIENT_AUTH", "require") == "optional" {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return nil
+}
+
+// clientIdentity returns the certificate CN, falling back to the first SAN
+func clientIdentity(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return "unknown"
+}
+
+// trackClientCertificates records the verified client certificate identity on
+// the request span and in per-client metrics
+func trackClientCertificates(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			ctx := r.Context()
+			cert := r.TLS.PeerCertificates[0]
+			client := clientIdentity(cert)
+
+			sans := append([]string(nil), cert.DNSNames...)
+			for _, uri := range cert.URIs {
+				sans = append(sans, uri.String())
+			}
+
+			trace.SpanFromContext(ctx).SetAttributes(
+				attribute.String("tls.client.subject", cert.Subject.String()),
+				attribute.String("tls.client.issuer", cert.Issuer.String()),
+				attribute.String("tls.client.common_name", cert.Subject.CommonName),
+				attribute.String("tls.client.san", strings.Join(sans, ",")),
+				attribute.String("tls.client.not_after", cert.NotAfter.UTC().Format("2006-01-02T15:04:05Z")),
+			)
+			clientCertRequests.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("client", client),
+			))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
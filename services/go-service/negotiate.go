@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
+
+	goservicev1 "go-service/proto/goservice/v1"
+)
+
+var (
+	encodeDuration metric.Float64Histogram
+	encodedSize    metric.Int64Histogram
+)
+
+// initNegotiationMetrics creates the per-format serialization instruments
+func initNegotiationMetrics() error {
+	var err error
+
+	encodeDuration, err = meter.Float64Histogram(
+		"http_response_encode_duration_seconds",
+		metric.WithDescription("Time spent serializing response bodies by endpoint and format"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	encodedSize, err = meter.Int64Histogram(
+		"http_response_encoded_bytes",
+		metric.WithDescription("Serialized response body size by endpoint and format"),
+		metric.WithUnit("By"),
+	)
+	return err
+}
+
+// protoResponse is implemented by response types with a protobuf form
+type protoResponse interface {
+	toProto() proto.Message
+}
+
+func (d dataResponse) toProto() proto.Message {
+	resp := &goservicev1.GetDataResponse{Store: dataLayer.name()}
+	for _, item := range d.Data {
+		resp.Items = append(resp.Items, &goservicev1.Item{Id: item.ID, Value: item.Value})
+	}
+	return resp
+}
+
+// responseFormat is a negotiable body encoding
+type responseFormat struct {
+	name        string
+	contentType string
+	aliases     []string
+	encode      func(v interface{}) ([]byte, error)
+}
+
+var responseFormats = []responseFormat{
+	{
+		name:        "json",
+		contentType: "application/json",
+		encode: func(v interface{}) ([]byte, error) {
+			body, err := json.Marshal(v)
+			return append(body, '\n'), err
+		},
+	},
+	{
+		name:        "msgpack",
+		contentType: "application/msgpack",
+		aliases:     []string{"application/x-msgpack", "application/vnd.msgpack"},
+		encode: func(v interface{}) ([]byte, error) {
+			var buf bytes.Buffer
+			enc := msgpack.NewEncoder(&buf)
+			// Same field names as the JSON form
+			enc.SetCustomStructTag("json")
+			err := enc.Encode(v)
+			return buf.Bytes(), err
+		},
+	},
+	{
+		name:        "protobuf",
+		contentType: "application/x-protobuf",
+		aliases:     []string{"application/protobuf", "application/vnd.google.protobuf"},
+		encode: func(v interface{}) ([]byte, error) {
+			return proto.Marshal(v.(protoResponse).toProto())
+		},
+	},
+}
+
+// negotiateFormat picks the most preferred format in the Accept header that
+// can encode v; ok is false when nothing acceptable is available. A missing
+// Accept header means JSON.
+func negotiateFormat(accept string, v interface{}) (format responseFormat, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		return responseFormats[0], true
+	}
+	_, hasProto := v.(protoResponse)
+
+	type ranged struct {
+		mediaType   string
+		q           float64
+		specificity int
+	}
+	var ranges []ranged
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		specificity := 2
+		switch {
+		case mediaType == "*/*":
+			specificity = 0
+		case strings.HasSuffix(mediaType, "/*"):
+			specificity = 1
+		}
+		if q > 0 {
+			ranges = append(ranges, ranged{mediaType, q, specificity})
+		}
+	}
+	// Higher q first; at equal q a specific type beats a wildcard
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return ranges[i].specificity > ranges[j].specificity
+	})
+
+	for _, rng := range ranges {
+		for _, f := range responseFormats {
+			if f.name == "protobuf" && !hasProto {
+				continue
+			}
+			if rng.mediaType == "*/*" || rng.mediaType == "application/*" || rng.mediaType == f.contentType {
+				return f, true
+			}
+			for _, alias := range f.aliases {
+				if rng.mediaType == alias {
+					return f, true
+				}
+			}
+		}
+	}
+	return responseFormat{}, false
+}
+
+// writeNegotiated encodes v in the format the Accept header asks for, with
+// an ETag per representation, and records the serialization cost per
+// format. It returns the status written.
+func writeNegotiated(ctx context.Context, w http.ResponseWriter, r *http.Request, endpoint string, v interface{}) int {
+	w.Header().Add("Vary", "Accept")
+	span := trace.SpanFromContext(ctx)
+
+	format, ok := negotiateFormat(r.Header.Get("Accept"), v)
+	if !ok {
+		span.SetAttributes(attribute.String("http.response.format", "none"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotAcceptable)
+		json.NewEncoder(w).Encode(errorResponse{Error: "no acceptable representation; try application/json, application/msgpack or application/x-protobuf"})
+		return http.StatusNotAcceptable
+	}
+
+	start := time.Now()
+	body, err := format.encode(v)
+	elapsed := time.Since(start)
+	if err != nil {
+		span.RecordError(err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+		return http.StatusInternalServerError
+	}
+
+	labels := metric.WithAttributes(attribute.String("endpoint", endpoint), attribute.String("format", format.name))
+	encodeDuration.Record(ctx, elapsed.Seconds(), labels)
+	encodedSize.Record(ctx, int64(len(body)), labels)
+	span.SetAttributes(
+		attribute.String("http.response.format", format.name),
+		attribute.Float64("http.response.encode_ms", float64(elapsed.Microseconds())/1000),
+		attribute.Int("http.response.encoded_size", len(body)),
+	)
+	recordTiming(ctx, "encode", elapsed)
+
+	return writeWithETag(ctx, w, r, endpoint, format.contentType, body)
+}
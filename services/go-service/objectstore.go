@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// objectPayloadView gives the payload histogram byte-scale buckets
+var objectPayloadView = sdkmetric.NewView(
+	sdkmetric.Instrument{Name: "object_storage_payload_bytes"},
+	sdkmetric.Stream{Aggregation: sdkmetric.AggregationExplicitBucketHistogram{
+		Boundaries: []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216},
+	}},
+)
+
+var (
+	objectOpDuration  metric.Float64Histogram
+	objectPayloadSize metric.Int64Histogram
+)
+
+// initObjectStoreMetrics creates the object storage instruments
+func initObjectStoreMetrics() error {
+	var err error
+
+	objectOpDuration, err = meter.Float64Histogram(
+		"object_storage_operation_duration_seconds",
+		metric.WithDescription("Duration of object storage calls by operation and outcome"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	objectPayloadSize, err = meter.Int64Histogram(
+		"object_storage_payload_bytes",
+		metric.WithDescription("Object sizes written and read, by operation"),
+		metric.WithUnit("By"),
+	)
+	return err
+}
+
+var (
+	// errNoSuchObject is returned by getObject for a missing key
+	errNoSuchObject = errors.New("no such object")
+	errNoSuchBucket = errors.New("no such bucket")
+)
+
+// objectStore is a path-style S3 client (MinIO, LocalStack or AWS) whose
+// calls each get an aws-api client span from the otelaws middleware, with
+// the HTTP client span of the instrumented transport beneath it
+type objectStore struct {
+	bucket string
+	client *s3.Client
+}
+
+// objects is nil until runServe builds it, and stays nil without credentials
+var objects *objectStore
+
+// newObjectStore returns nil unless OBJECT_STORE_ACCESS_KEY and
+// OBJECT_STORE_SECRET_KEY resolve through the secrets chain
+func newObjectStore() *objectStore {
+	accessKey, secretKey := secrets.Get("OBJECT_STORE_ACCESS_KEY"), secrets.Get("OBJECT_STORE_SECRET_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil
+	}
+	opts := s3.Options{
+		Region:       envString("OBJECT_STORE_REGION", "us-east-1"),
+		BaseEndpoint: aws.String(strings.TrimSuffix(envString("OBJECT_STORE_URL", "http://minio:9000"), "/")),
+		Credentials:  credentials.NewStaticCredentialsProvider(accessKey, secretKey, ""),
+		// MinIO serves buckets under the path, not as subdomains
+		UsePathStyle: true,
+		HTTPClient: &http.Client{
+			Timeout:   envDuration("OBJECT_STORE_TIMEOUT", 30*time.Second),
+			Transport: newInstrumentedTransport(),
+		},
+	}
+	otelaws.AppendMiddlewares(&opts.APIOptions, otelaws.WithAttributeSetter(s3AttributeSetter))
+	return &objectStore{
+		bucket: envString("OBJECT_STORE_BUCKET", "go-service"),
+		client: s3.New(opts),
+	}
+}
+
+// s3AttributeSetter adds the bucket and key of an object call to its span
+func s3AttributeSetter(_ context.Context, in middleware.InitializeInput) []attribute.KeyValue {
+	switch params := in.Parameters.(type) {
+	case *s3.PutObjectInput:
+		return []attribute.KeyValue{
+			attribute.String("aws.s3.bucket", aws.ToString(params.Bucket)),
+			attribute.String("aws.s3.key", aws.ToString(params.Key)),
+		}
+	case *s3.GetObjectInput:
+		return []attribute.KeyValue{
+			attribute.String("aws.s3.bucket", aws.ToString(params.Bucket)),
+			attribute.String("aws.s3.key", aws.ToString(params.Key)),
+		}
+	case *s3.CreateBucketInput:
+		return []attribute.KeyValue{attribute.String("aws.s3.bucket", aws.ToString(params.Bucket))}
+	}
+	return nil
+}
+
+// s3ErrorCode returns the S3 error code of a failed call, or "". Operations
+// only model some of the errors they return, so the code is compared rather
+// than the error type.
+func s3ErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+// recordOperation records the outcome metrics of one storage operation;
+// size is negative when nothing was transferred
+func recordOperation(ctx context.Context, operation string, start time.Time, size int, err error) {
+	outcome := "success"
+	if errors.Is(err, errNoSuchObject) {
+		outcome = "not_found"
+	} else if err != nil {
+		outcome = "error"
+	}
+	if size >= 0 {
+		objectPayloadSize.Record(ctx, int64(size), metric.WithAttributes(attribute.String("operation", operation)))
+	}
+	objectOpDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("operation", operation),
+		attribute.String("outcome", outcome),
+	))
+}
+
+// putObject stores body under key, creating the bucket on first use
+func (s *objectStore) putObject(ctx context.Context, key, contentType string, body []byte) (string, error) {
+	start := time.Now()
+	etag, err := s.put(ctx, key, contentType, body)
+	if errors.Is(err, errNoSuchBucket) {
+		if err = s.createBucket(ctx); err == nil {
+			etag, err = s.put(ctx, key, contentType, body)
+		}
+	}
+	recordOperation(ctx, "PutObject", start, len(body), err)
+	return etag, err
+}
+
+func (s *objectStore) put(ctx context.Context, key, contentType string, body []byte) (string, error) {
+	out, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(body),
+		ContentLength: aws.Int64(int64(len(body))),
+		ContentType:   aws.String(contentType),
+	})
+	if s3ErrorCode(err) == "NoSuchBucket" {
+		return "", errNoSuchBucket
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(aws.ToString(out.ETag), `"`), nil
+}
+
+func (s *objectStore) createBucket(ctx context.Context) error {
+	start := time.Now()
+	_, err := s.client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(s.bucket)})
+	// Another instance may have created it in the meantime
+	if code := s3ErrorCode(err); code == "BucketAlreadyOwnedByYou" || code == "BucketAlreadyExists" {
+		err = nil
+	}
+	recordOperation(ctx, "CreateBucket", start, -1, err)
+	return err
+}
+
+// getObject reads key, returning errNoSuchObject when it does not exist
+func (s *objectStore) getObject(ctx context.Context, key string, maxBytes int64) ([]byte, string, error) {
+	start := time.Now()
+	data, contentType, err := s.get(ctx, key, maxBytes)
+	size := len(data)
+	if err != nil {
+		size = -1
+	}
+	recordOperation(ctx, "GetObject", start, size, err)
+	return data, contentType, err
+}
+
+func (s *objectStore) get(ctx context.Context, key string, maxBytes int64) ([]byte, string, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if code := s3ErrorCode(err); code == "NoSuchKey" || code == "NotFound" {
+		return nil, "", errNoSuchObject
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer out.Body.Close()
+	if size := aws.ToInt64(out.ContentLength); size > maxBytes {
+		return nil, "", fmt.Errorf("object is %d bytes, above the %d byte limit", size, maxBytes)
+	}
+	data, err := io.ReadAll(io.LimitReader(out.Body, maxBytes))
+	return data, aws.ToString(out.ContentType), err
+}
+
+// objectKeyPattern keeps keys free of characters that would need URI encoding
+var objectKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,255}$`)
+
+// objectPutResponse is the body of PUT /objects/{key}
+type objectPutResponse struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	Size   int    `json:"size"`
+	ETag   string `json:"etag"`
+}
+
+// objectsHandler serves PUT and GET /objects/{key} against the object store
+func objectsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	writeJSON := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	if objects == nil {
+		writeJSON(http.StatusServiceUnavailable, errorResponse{Error: "object store credentials not configured"})
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/objects/")
+	if !objectKeyPattern.MatchString(key) || strings.Contains(key, "..") {
+		writeJSON(http.StatusBadRequest, errorResponse{Error: "key must match " + objectKeyPattern.String()})
+		return
+	}
+	maxBytes := int64(envInt("OBJECT_STORE_MAX_BYTES", 10<<20))
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+		if err != nil {
+			writeJSON(http.StatusRequestEntityTooLarge, errorResponse{Error: err.Error()})
+			return
+		}
+		contentType := r.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		etag, err := objects.putObject(ctx, key, contentType, body)
+		if err != nil {
+			logJSON(ctx, "ERROR", "Object upload failed", map[string]interface{}{"key": key, "error": err.Error()})
+			writeJSON(http.StatusBadGateway, errorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(http.StatusCreated, objectPutResponse{
+			Bucket: objects.bucket,
+			Key:    key,
+			Size:   len(body),
+			ETag:   etag,
+		})
+	case http.MethodGet:
+		data, contentType, err := objects.getObject(ctx, key, maxBytes)
+		if errors.Is(err, errNoSuchObject) {
+			writeJSON(http.StatusNotFound, errorResponse{Error: "no such object"})
+			return
+		}
+		if err != nil {
+			logJSON(ctx, "ERROR", "Object download failed", map[string]interface{}{"key": key, "error": err.Error()})
+			writeJSON(http.StatusBadGateway, errorResponse{Error: err.Error()})
+			return
+		}
+		// The content type is whatever the uploader sent, so the object is
+		// served as a download the browser will not sniff or render inline
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Disposition", "attachment")
+		w.Write(data)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeJSON(http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiRoute is one public HTTP route: the ServeMux pattern it is mounted on
+// and the operations it documents in /openapi.json
+type apiRoute struct {
+	pattern     string
+	path        string // OpenAPI path template when it differs from pattern
+	unversioned bool   // served only at pattern, not under /v1 and /v2
+	handler     http.HandlerFunc
+	operations  []apiOperation
+}
+
+// apiOperation describes one method on a route. Request and response bodies
+// are typed zero values; their JSON schemas are derived by reflection.
+type apiOperation struct {
+	method    string
+	summary   string
+	params    []apiParam
+	body      interface{}
+	responses map[int]apiResponse
+}
+
+type apiParam struct {
+	name        string
+	in          string // query, path or header
+	kind        string // OpenAPI type: string, integer, number
+	description string
+}
+
+// apiResponse documents a status code; body is a typed zero value for JSON
+// responses, and contentType names a raw body instead
+type apiResponse struct {
+	body        interface{}
+	contentType string
+}
+
+var jsonError = apiResponse{body: errorResponse{}}
+
+// apiRoutes lists the public API; runServe mounts exactly these routes, so
+// the spec cannot drift from what is served
+func apiRoutes() []apiRoute {
+	return []apiRoute{
+		{pattern: "/", handler: rootHandler, operations: []apiOperation{{
+			method:    http.MethodGet,
+			summary:   "Service greeting",
+			responses: map[int]apiResponse{200: {body: infoResponse{}}},
+		}}},
+		{pattern: "/data", handler: dataHandler, operations: []apiOperation{{
+			method:  http.MethodGet,
+			summary: "Items read from the configured data store",
+			params: []apiParam{
+				{name: "Accept", in: "header", kind: "string", description: "application/json (default), application/msgpack or application/x-protobuf (goservice.v1.GetDataResponse)"},
+				{name: "If-None-Match", in: "header", kind: "string", description: "ETag from a previous response; answered with 304 when unchanged"},
+			},
+			responses: map[int]apiResponse{200: {body: dataResponse{}}, 304: {}, 406: jsonError, 503: jsonError},
+		}}},
+		{pattern: "/error", handler: errorHandler, operations: []apiOperation{{
+			method:    http.MethodGet,
+			summary:   "Always fails, for exercising error telemetry",
+			responses: map[int]apiResponse{500: jsonError},
+		}}},
+		{pattern: "/burn", handler: burnHandler, operations: []apiOperation{{
+			method:  http.MethodGet,
+			summary: "Keep CPU cores busy for a while",
+			params: []apiParam{
+				{name: "seconds", in: "query", kind: "integer", description: "How long to burn, capped at 60"},
+				{name: "cores", in: "query", kind: "integer", description: "Cores to keep busy, capped at the CPU count"},
+			},
+			responses: map[int]apiResponse{200: {body: burnResponse{}}},
+		}}},
+		{pattern: "/poll", handler: pollHandler, operations: []apiOperation{{
+			method:  http.MethodGet,
+			summary: "Long-poll for the next event",
+			params: []apiParam{
+				{name: "timeout", in: "query", kind: "string", description: "Go duration to wait, at most 60s (default 30s)"},
+			},
+			responses: map[int]apiResponse{200: {body: pollResponse{}}, 204: {}},
+		}}},
+		{pattern: "/download", handler: downloadHandler, operations: []apiOperation{{
+			method:  http.MethodGet,
+			summary: "Stream a generated file",
+			params: []apiParam{
+				{name: "mb", in: "query", kind: "integer", description: "Size in MiB, capped at DOWNLOAD_MAX_MB"},
+			},
+			responses: map[int]apiResponse{200: {contentType: "application/octet-stream"}},
+		}}},
+		{pattern: "/rum", handler: rumHandler, operations: []apiOperation{{
+			method:    http.MethodPost,
+			summary:   "Browser web-vitals and error beacon",
+			body:      rumBeacon{},
+			responses: map[int]apiResponse{204: {}, 400: {contentType: "text/plain"}},
+		}}},
+		{pattern: "/trace/", path: "/trace/{traceID}", handler: traceLinkHandler, operations: []apiOperation{{
+			method:  http.MethodGet,
+			summary: "Deep links to a trace in the configured UIs",
+			params: []apiParam{
+				{name: "traceID", in: "path", kind: "string", description: "32 hex character trace ID"},
+				{name: "redirect", in: "query", kind: "string", description: "Redirect to one backend (grafana, jaeger, tempo)"},
+			},
+			responses: map[int]apiResponse{200: {body: traceLinksResponse{}}, 302: {}, 400: jsonError, 404: jsonError},
+		}}},
+		{pattern: "/objects/", path: "/objects/{key}", handler: objectsHandler, operations: []apiOperation{
+			{
+				method:    http.MethodPut,
+				summary:   "Upload an object to the object store",
+				params:    []apiParam{{name: "key", in: "path", kind: "string", description: "Object key"}},
+				responses: map[int]apiResponse{201: {body: objectPutResponse{}}, 400: jsonError, 413: jsonError, 502: jsonError, 503: jsonError},
+			},
+			{
+				method:    http.MethodGet,
+				summary:   "Download an object from the object store",
+				params:    []apiParam{{name: "key", in: "path", kind: "string", description: "Object key"}},
+				responses: map[int]apiResponse{200: {contentType: "application/octet-stream"}, 400: jsonError, 404: jsonError, 502: jsonError, 503: jsonError},
+			},
+		}},
+		{pattern: "/search", handler: searchHandler, operations: []apiOperation{{
+			method:  http.MethodGet,
+			summary: "Query the search cluster",
+			params: []apiParam{
+				{name: "q", in: "query", kind: "string", description: "query_string query (default *)"},
+				{name: "index", in: "query", kind: "string", description: "Index, one of SEARCH_INDICES"},
+				{name: "size", in: "query", kind: "integer", description: "Hits to return, capped at 100"},
+			},
+			responses: map[int]apiResponse{
+				200: {body: searchResponse{}}, 400: jsonError, 401: jsonError, 404: jsonError,
+				502: jsonError, 503: jsonError, 504: jsonError,
+			},
+		}}},
+		{pattern: "/version", unversioned: true, handler: versionHandler, operations: []apiOperation{{
+			method:    http.MethodGet,
+			summary:   "Build provenance: version, VCS commit and dirty flag, builder and Go toolchain",
+			responses: map[int]apiResponse{200: {body: buildProvenance{}}},
+		}}},
+		{pattern: "/healthz", unversioned: true, handler: healthzHandler, operations: []apiOperation{{
+			method:    http.MethodGet,
+			summary:   "Liveness probe",
+			responses: map[int]apiResponse{200: {body: statusResponse{}}},
+		}}},
+		{pattern: "/readyz", unversioned: true, handler: readyzHandler, operations: []apiOperation{{
+			method:    http.MethodGet,
+			summary:   "Readiness probe",
+			responses: map[int]apiResponse{200: {body: statusResponse{}}, 503: {body: statusResponse{}}},
+		}}},
+	}
+}
+
+// openAPIDocument builds an OpenAPI 3.0 document for routes, including
+// their /v1 (deprecated) and /v2 copies
+func openAPIDocument(routes []apiRoute) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]interface{}{}
+
+	for _, route := range routes {
+		base := route.path
+		if base == "" {
+			base = route.pattern
+		}
+		prefixes := []string{""}
+		if !route.unversioned {
+			prefixes = append(prefixes, "/v1", "/v2")
+		}
+		for _, prefix := range prefixes {
+			path := prefix + base
+			paths[path] = openAPIPathItem(route, path, prefix == "/v1", schemas)
+		}
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":   "go-service",
+			"version": version,
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+	if server := envString("OPENAPI_SERVER_URL", ""); server != "" {
+		doc["servers"] = []map[string]string{{"url": server}}
+	}
+	return doc
+}
+
+func openAPIPathItem(route apiRoute, path string, deprecated bool, schemas map[string]interface{}) map[string]interface{} {
+	item := map[string]interface{}{}
+	for _, op := range route.operations {
+		if op.method != http.MethodGet {
+			op = withIdempotencyKey(op)
+		}
+		operation := map[string]interface{}{
+			"summary":     op.summary,
+			"operationId": strings.ToLower(op.method) + operationName(path),
+			"responses":   openAPIResponses(op.responses, schemas),
+		}
+		if deprecated {
+			operation["deprecated"] = true
+		}
+		if len(op.params) > 0 {
+			var params []map[string]interface{}
+			for _, p := range op.params {
+				params = append(params, map[string]interface{}{
+					"name":        p.name,
+					"in":          p.in,
+					"required":    p.in == "path",
+					"description": p.description,
+					"schema":      map[string]string{"type": p.kind},
+				})
+			}
+			operation["parameters"] = params
+		}
+		if op.body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": jsonSchema(reflect.TypeOf(op.body), schemas)},
+				},
+			}
+		}
+		item[strings.ToLower(op.method)] = operation
+	}
+	return item
+}
+
+// withIdempotencyKey documents the Idempotency-Key header and its error
+// responses on a mutating operation
+func withIdempotencyKey(op apiOperation) apiOperation {
+	op.params = append(op.params[:len(op.params):len(op.params)], apiParam{
+		name: idempotencyHeader, in: "header", kind: "string",
+		description: "Makes retries safe: the first response is replayed for the same key and body",
+	})
+	responses := map[int]apiResponse{409: jsonError, 422: jsonError}
+	for code, resp := range op.responses {
+		responses[code] = resp
+	}
+	op.responses = responses
+	return op
+}
+
+func openAPIResponses(responses map[int]apiResponse, schemas map[string]interface{}) map[string]interface{} {
+	codes := make([]int, 0, len(responses))
+	for code := range responses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	out := map[string]interface{}{}
+	for _, code := range codes {
+		resp := responses[code]
+		entry := map[string]interface{}{"description": http.StatusText(code)}
+		switch {
+		case resp.body != nil:
+			entry["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": jsonSchema(reflect.TypeOf(resp.body), schemas)},
+			}
+		case resp.contentType != "":
+			schema := map[string]string{"type": "string"}
+			if !strings.HasPrefix(resp.contentType, "text/") {
+				schema["format"] = "binary"
+			}
+			entry["content"] = map[string]interface{}{
+				resp.contentType: map[string]interface{}{"schema": schema},
+			}
+		}
+		out[strconv.Itoa(code)] = entry
+	}
+	return out
+}
+
+// operationName turns a path template into a camel-cased operationId suffix
+func operationName(path string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '{' || r == '}' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	if b.Len() == 0 {
+		return "Root"
+	}
+	return b.String()
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// jsonSchema returns the schema for t, adding named structs to schemas and
+// referring to them by $ref
+func jsonSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return jsonSchema(t.Elem(), schemas)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		if _, ok := schemas[name]; ok {
+			return ref
+		}
+		// Reserve the name first so recursive types terminate
+		schemas[name] = nil
+
+		properties := map[string]interface{}{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			tag := strings.Split(f.Tag.Get("json"), ",")
+			if tag[0] == "-" {
+				continue
+			}
+			fieldName := tag[0]
+			if fieldName == "" {
+				fieldName = f.Name
+			}
+			properties[fieldName] = jsonSchema(f.Type, schemas)
+			omitempty := false
+			for _, opt := range tag[1:] {
+				omitempty = omitempty || opt == "omitempty"
+			}
+			if !omitempty {
+				required = append(required, fieldName)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		schemas[name] = schema
+		return ref
+	}
+	// interface{} and anything else accepts any value
+	return map[string]interface{}{}
+}
+
+// openAPIHandler serves the document built from the mounted routes
+func openAPIHandler(routes []apiRoute) http.HandlerFunc {
+	body, err := json.MarshalIndent(openAPIDocument(routes), "", "  ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const otlpProxyPath = "/v1/traces"
+
+var (
+	otlpProxyRequests metric.Int64Counter
+	otlpProxySpans    metric.Int64Counter
+)
+
+// initOTLPProxyMetrics creates the instruments describing proxied browser telemetry
+func initOTLPProxyMetrics() error {
+	var err error
+
+	otlpProxyRequests, err = meter.Int64Counter(
+		"otlp_proxy_requests_total",
+		metric.WithDescription("OTLP/HTTP export requests received from browsers, by outcome"),
+	)
+	if err != nil {
+		return err
+	}
+
+	otlpProxySpans, err = meter.Int64Counter(
+		"otlp_proxy_spans_total",
+		metric.WithDescription("Spans received on the OTLP proxy, by outcome"),
+	)
+	return err
+}
+
+// otlpProxy accepts OTLP/HTTP trace exports from browsers and forwards them
+// to the collector over gRPC, so the collector never has to be public
+type otlpProxy struct {
+	conn     *grpc.ClientConn
+	client   collectortrace.TraceServiceClient
+	headers  grpcmetadata.MD
+	maxBytes int64
+	maxSpans int
+	timeout  time.Duration
+}
+
+// newOTLPProxy dials the collector when OTLP_PROXY is enabled; it returns nil otherwise
+func newOTLPProxy() (*otlpProxy, error) {
+	if !envBool("OTLP_PROXY", false) {
+		return nil, nil
+	}
+	conn, err := grpc.Dial(traceEndpoint(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &otlpProxy{
+		conn:     conn,
+		client:   collectortrace.NewTraceServiceClient(conn),
+		headers:  grpcmetadata.New(exportHeaders()),
+		maxBytes: int64(envInt("OTLP_PROXY_MAX_BYTES", 1<<20)),
+		maxSpans: envInt("OTLP_PROXY_MAX_SPANS", 1000),
+		timeout:  envDuration("OTLP_PROXY_TIMEOUT", 10*time.Second),
+	}, nil
+}
+
+// Close closes the connection to the collector
+func (p *otlpProxy) Close() error {
+	return p.conn.Close()
+}
+
+// otlpIDFields are the OTLP/JSON fields encoded as hex rather than protobuf's base64
+var otlpIDFields = map[string]bool{"traceId": true, "spanId": true, "parentSpanId": true}
+
+// hexIDsToBase64 rewrites OTLP/JSON hex IDs in place so protojson can decode them
+func hexIDsToBase64(v interface{}) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, child := range node {
+			if s, ok := child.(string); ok && otlpIDFields[k] {
+				if raw, err := hex.DecodeString(s); err == nil {
+					node[k] = base64.StdEncoding.EncodeToString(raw)
+				}
+				continue
+			}
+			hexIDsToBase64(child)
+		}
+	case []interface{}:
+		for _, child := range node {
+			hexIDsToBase64(child)
+		}
+	}
+}
+
+func decodeOTLPJSON(body []byte, req *collectortrace.ExportTraceServiceRequest) error {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return err
+	}
+	hexIDsToBase64(doc)
+	normalized, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(normalized, req)
+}
+
+// validate rejects exports with malformed IDs, unnamed spans or too many spans
+func (p *otlpProxy) validate(req *collectortrace.ExportTraceServiceRequest) (int, error) {
+	count := 0
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				count++
+				if len(s.TraceId) != 16 || len(s.SpanId) != 8 {
+					return count, fmt.Errorf("span %q has an invalid trace or span ID", s.Name)
+				}
+				if s.Name == "" {
+					return count, errors.New("span without a name")
+				}
+			}
+		}
+	}
+	if count == 0 {
+		return 0, errors.New("no spans in export")
+	}
+	if count > p.maxSpans {
+		return count, fmt.Errorf("%d spans exceeds the limit of %d", count, p.maxSpans)
+	}
+	return count, nil
+}
+
+func stringKV(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+// enrich stamps every resource with the browser's address and geo bucket
+func enrich(req *collectortrace.ExportTraceServiceRequest, ip, geo string) {
+	for _, rs := range req.ResourceSpans {
+		if rs.Resource == nil {
+			rs.Resource = &resourcepb.Resource{}
+		}
+		rs.Resource.Attributes = append(rs.Resource.Attributes,
+			stringKV("client.address", ip),
+			stringKV("client.geo.bucket", geo),
+			stringKV("telemetry.proxy", "go-service"),
+		)
+	}
+}
+
+func (p *otlpProxy) reject(w http.ResponseWriter, r *http.Request, status int, outcome string, spans int, err error) {
+	ctx := r.Context()
+	otlpProxyRequests.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", outcome)))
+	if spans > 0 {
+		otlpProxySpans.Add(ctx, int64(spans), metric.WithAttributes(attribute.String("outcome", outcome)))
+	}
+	logJSON(ctx, "WARN", "OTLP proxy export rejected", map[string]interface{}{
+		"outcome": outcome,
+		"error":   err.Error(),
+	})
+	http.Error(w, err.Error(), status)
+}
+
+func (p *otlpProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" && mediaType != "application/x-protobuf" {
+		p.reject(w, r, http.StatusUnsupportedMediaType, "unsupported", 0, fmt.Errorf("unsupported content type %q", mediaType))
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, p.maxBytes)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			p.reject(w, r, http.StatusBadRequest, "invalid", 0, err)
+			return
+		}
+		defer gz.Close()
+		// One byte past the limit tells a body that inflates too far apart
+		// from one that is exactly maxBytes
+		body = io.LimitReader(gz, p.maxBytes+1)
+	}
+	raw, err := io.ReadAll(body)
+	if err == nil && int64(len(raw)) > p.maxBytes {
+		err = fmt.Errorf("decompressed body exceeds %d bytes", p.maxBytes)
+	}
+	if err != nil {
+		p.reject(w, r, http.StatusRequestEntityTooLarge, "too_large", 0, err)
+		return
+	}
+
+	req := &collectortrace.ExportTraceServiceRequest{}
+	if mediaType == "application/json" {
+		err = decodeOTLPJSON(raw, req)
+	} else {
+		err = proto.Unmarshal(raw, req)
+	}
+	if err != nil {
+		p.reject(w, r, http.StatusBadRequest, "invalid", 0, err)
+		return
+	}
+
+	spans, err := p.validate(req)
+	if err != nil {
+		p.reject(w, r, http.StatusBadRequest, "invalid", spans, err)
+		return
+	}
+
+	// The geo bucket is the country GeoIP resolves: edge headers from
+	// TRUSTED_PROXIES, then GEOIP_CSV, "internal" for private addresses and
+	// "unknown" otherwise
+	enrich(req, clientIP(r), geoIP.locate(r).Country)
+
+	ctx, cancel := context.WithTimeout(grpcmetadata.NewOutgoingContext(r.Context(), p.headers), p.timeout)
+	defer cancel()
+	resp, err := p.client.Export(ctx, req)
+	if err != nil {
+		p.reject(w, r, http.StatusBadGateway, "failed", spans, err)
+		return
+	}
+
+	otlpProxyRequests.Add(r.Context(), 1, metric.WithAttributes(attribute.String("outcome", "forwarded")))
+	otlpProxySpans.Add(r.Context(), int64(spans), metric.WithAttributes(attribute.String("outcome", "forwarded")))
+
+	// Reply in the encoding the browser used, passing partial-success details through
+	var out []byte
+	if mediaType == "application/json" {
+		out, err = protojson.Marshal(resp)
+	} else {
+		out, err = proto.Marshal(resp)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Write(out)
+}
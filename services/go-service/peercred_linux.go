@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredentials reads SO_PEERCRED: the process that connected to the socket
+func peerCredentials(conn *net.UnixConn) (pid int32, uid, gid uint32, ok bool) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	var cred *unix.Ucred
+	raw.Control(func(fd uintptr) {
+		cred, err = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil || cred == nil {
+		return 0, 0, 0, false
+	}
+	return cred.Pid, cred.Uid, cred.Gid, true
+}
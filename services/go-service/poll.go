@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"go-service/events"
+	eventsv1 "go-service/proto/events/v1"
+)
+
+const maxPollTimeout = 60 * time.Second
+
+var (
+	pollParked metric.Int64UpDownCounter
+	pollWait   metric.Float64Histogram
+)
+
+// initPollMetrics creates the long-polling instruments
+func initPollMetrics() error {
+	var err error
+
+	pollParked, err = meter.Int64UpDownCounter(
+		"poll_parked_requests",
+		metric.WithDescription("Long-poll requests currently waiting for data"),
+	)
+	if err != nil {
+		return err
+	}
+
+	pollWait, err = meter.Float64Histogram(
+		"poll_wait_seconds",
+		metric.WithDescription("Time long-poll requests were held, by outcome"),
+		metric.WithUnit("s"),
+	)
+	return err
+}
+
+// pollEvent is the payload delivered to waiting pollers
+type pollEvent struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Source    string    `json:"source"`
+}
+
+// pollResponse is the body of GET /poll when an event arrived
+type pollResponse struct {
+	Event       pollEvent `json:"event"`
+	PreviousID  int64     `json:"previous_id"`
+	WaitSeconds float64   `json:"wait_seconds"`
+}
+
+// pollHub wakes every parked poller when a new event is published
+type pollHub struct {
+	mu     sync.Mutex
+	latest pollEvent
+	ready  chan struct{}
+}
+
+var polls = &pollHub{ready: make(chan struct{})}
+
+func (h *pollHub) publish(e *eventsv1.PollEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.latest = pollEvent{ID: h.latest.ID + 1, Timestamp: e.GetOccurredAt().AsTime(), Source: e.GetSource()}
+	close(h.ready)
+	h.ready = make(chan struct{})
+}
+
+// wait returns the current event channel and the last event ID seen
+func (h *pollHub) wait() (<-chan struct{}, int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ready, h.latest.ID
+}
+
+func (h *pollHub) current() pollEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.latest
+}
+
+// simulatePollEvents publishes events on the bus at random intervals up to
+// POLL_EVENT_INTERVAL, encoded as events.v1.PollEvent
+func simulatePollEvents(ctx context.Context, bus events.Publisher) {
+	maxInterval := envDuration("POLL_EVENT_INTERVAL", 10*time.Second)
+	for {
+		delay := time.Duration(workloadRand.Int63n(int64(maxInterval) + 1))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+			payload, err := proto.Marshal(&eventsv1.PollEvent{OccurredAt: timestamppb.Now(), Source: "simulator"})
+			if err == nil {
+				err = bus.Publish(ctx, pollEventsTopic, events.Message{Payload: payload})
+			}
+			if err != nil {
+				logJSON(ctx, "ERROR", "Failed to publish poll event", map[string]interface{}{"error": err.Error()})
+			}
+		}
+	}
+}
+
+// subscribePollEvents wakes parked pollers for every event on the bus
+func subscribePollEvents(ctx context.Context, bus events.Subscriber) error {
+	_, err := bus.Subscribe(ctx, pollEventsTopic, "", func(ctx context.Context, msg events.Message) error {
+		var event eventsv1.PollEvent
+		if err := proto.Unmarshal(msg.Payload, &event); err != nil {
+			// Redelivering a payload that cannot be decoded will not help
+			logJSON(ctx, "WARN", "Dropping malformed poll event", map[string]interface{}{"error": err.Error()})
+			return nil
+		}
+		polls.publish(&event)
+		return nil
+	})
+	return err
+}
+
+func pollHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ctx := r.Context()
+
+	timeout, err := time.ParseDuration(r.URL.Query().Get("timeout"))
+	if err != nil || timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	if timeout > maxPollTimeout {
+		timeout = maxPollTimeout
+	}
+
+	ctx, span := tracer.Start(ctx, "long_poll")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("http.method", r.Method),
+		attribute.String("http.route", "/poll"),
+		attribute.Float64("poll.timeout_seconds", timeout.Seconds()),
+	)
+
+	ready, lastID := polls.wait()
+	pollParked.Add(ctx, 1)
+
+	timer := time.NewTimer(timeout)
+	outcome := "data"
+	select {
+	case <-ready:
+		span.AddEvent("data_available")
+	case <-timer.C:
+		outcome = "timeout"
+		span.AddEvent("poll_timeout")
+	case <-ctx.Done():
+		outcome = "canceled"
+	}
+	timer.Stop()
+	pollParked.Add(ctx, -1)
+
+	waited := time.Since(start).Seconds()
+	span.SetAttributes(
+		attribute.Float64("poll.wait_seconds", waited),
+		attribute.String("poll.outcome", outcome),
+	)
+	pollWait.Record(ctx, waited, metric.WithAttributes(attribute.String("outcome", outcome)))
+
+	logJSON(ctx, "INFO", "Long poll completed", map[string]interface{}{
+		"outcome":      outcome,
+		"wait_seconds": waited,
+	})
+
+	if outcome == "canceled" {
+		return
+	}
+
+	if outcome == "timeout" {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		event := polls.current()
+		span.SetAttributes(attribute.Int64("poll.event_id", event.ID))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pollResponse{
+			Event:       event,
+			PreviousID:  lastID,
+			WaitSeconds: waited,
+		})
+	}
+
+	countRequest(ctx, r.Method, "/poll", attribute.String("outcome", outcome))
+	observeRequestDuration(ctx, r.Method, "/poll", waited)
+}
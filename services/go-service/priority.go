@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Request priorities, highest first. The concurrency limiter drains its
+// queues in this order, so under overload batch traffic is shed before
+// interactive traffic and critical traffic is admitted first.
+const (
+	priorityCritical    = "critical"
+	priorityInteractive = "interactive"
+	priorityBatch       = "batch"
+)
+
+var priorities = []string{priorityCritical, priorityInteractive, priorityBatch}
+
+// parsePriority normalizes a priority name; ok is false for unknown values
+func parsePriority(value string) (priority string, ok bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, p := range priorities {
+		if value == p {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// priorityClassifier assigns a priority from the PRIORITY_HEADER request
+// header, then PRIORITY_ROUTES ("/burn=batch,/healthz=critical"), then
+// PRIORITY_DEFAULT. Any caller can send the header, so PRIORITY_HEADER_TRUST
+// decides whose is honoured: "authenticated" (default) callers with the
+// admin credentials or a verified client certificate, "all", or "none".
+type priorityClassifier struct {
+	header   string
+	trust    string
+	creds    adminCredentials
+	routes   map[string]string
+	fallback string
+}
+
+func newPriorityClassifier() *priorityClassifier {
+	c := &priorityClassifier{
+		header:   envString("PRIORITY_HEADER", "X-Priority"),
+		trust:    envString("PRIORITY_HEADER_TRUST", "authenticated"),
+		routes:   map[string]string{},
+		fallback: priorityInteractive,
+	}
+	if c.trust == "authenticated" {
+		c.creds = loadAdminCredentials()
+	}
+	if p, ok := parsePriority(envString("PRIORITY_DEFAULT", "")); ok {
+		c.fallback = p
+	}
+	for _, pair := range splitList(envString("PRIORITY_ROUTES", "/healthz=critical,/readyz=critical")) {
+		route, value, found := strings.Cut(pair, "=")
+		if !found {
+			continue
+		}
+		if p, ok := parsePriority(value); ok {
+			c.routes[strings.TrimSpace(route)] = p
+		}
+	}
+	return c
+}
+
+// classify returns r's priority and where it came from (header, route or default)
+func (c *priorityClassifier) classify(r *http.Request) (priority, source string) {
+	if p, ok := parsePriority(r.Header.Get(c.header)); ok && c.trusted(r) {
+		return p, "header"
+	}
+	if p, ok := c.routes[routeOf(r)]; ok {
+		return p, "route"
+	}
+	return c.fallback, "default"
+}
+
+// trusted reports whether r may choose its own priority
+func (c *priorityClassifier) trusted(r *http.Request) bool {
+	switch c.trust {
+	case "all":
+		return true
+	case "authenticated":
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			return true
+		}
+		return c.creds.enabled() && c.creds.check(r) == ""
+	default:
+		return false
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// prometheusProducer feeds metrics registered with a Prometheus gatherer (for
+// example promauto metrics from third-party libraries) into the OTel pipeline
+type prometheusProducer struct {
+	gatherer prometheus.Gatherer
+	start    time.Time
+}
+
+func newPrometheusProducer(g prometheus.Gatherer) *prometheusProducer {
+	return &prometheusProducer{gatherer: g, start: time.Now()}
+}
+
+// Produce converts counters, gauges and histograms; summaries have no OTel
+// equivalent and are only available on /metrics
+func (p *prometheusProducer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	families, err := p.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return nil, err
+	}
+
+	now := time.Now()
+	scope := metricdata.ScopeMetrics{
+		Scope: instrumentation.Scope{Name: "github.com/prometheus/client_golang"},
+	}
+
+	for _, mf := range families {
+		m := metricdata.Metrics{Name: mf.GetName(), Description: mf.GetHelp()}
+
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			sum := metricdata.Sum[float64]{
+				Temporality: metricdata.CumulativeTemporality,
+				IsMonotonic: true,
+			}
+			for _, metric := range mf.GetMetric() {
+				sum.DataPoints = append(sum.DataPoints, metricdata.DataPoint[float64]{
+					Attributes: promLabels(metric),
+					StartTime:  p.start,
+					Time:       now,
+					Value:      metric.GetCounter().GetValue(),
+				})
+			}
+			m.Data = sum
+
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			gauge := metricdata.Gauge[float64]{}
+			for _, metric := range mf.GetMetric() {
+				value := metric.GetGauge().GetValue()
+				if mf.GetType() == dto.MetricType_UNTYPED {
+					value = metric.GetUntyped().GetValue()
+				}
+				gauge.DataPoints = append(gauge.DataPoints, metricdata.DataPoint[float64]{
+					Attributes: promLabels(metric),
+					Time:       now,
+					Value:      value,
+				})
+			}
+			m.Data = gauge
+
+		case dto.MetricType_HISTOGRAM:
+			hist := metricdata.Histogram[float64]{Temporality: metricdata.CumulativeTemporality}
+			for _, metric := range mf.GetMetric() {
+				hist.DataPoints = append(hist.DataPoints, promHistogram(metric, p.start, now))
+			}
+			m.Data = hist
+
+		default:
+			continue
+		}
+
+		scope.Metrics = append(scope.Metrics, m)
+	}
+
+	return []metricdata.ScopeMetrics{scope}, nil
+}
+
+func promLabels(metric *dto.Metric) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(metric.GetLabel()))
+	for _, l := range metric.GetLabel() {
+		kvs = append(kvs, attribute.String(l.GetName(), l.GetValue()))
+	}
+	return attribute.NewSet(kvs...)
+}
+
+// promHistogram turns cumulative Prometheus buckets into OTel per-bucket counts
+func promHistogram(metric *dto.Metric, start, now time.Time) metricdata.HistogramDataPoint[float64] {
+	h := metric.GetHistogram()
+	dp := metricdata.HistogramDataPoint[float64]{
+		Attributes: promLabels(metric),
+		StartTime:  start,
+		Time:       now,
+		Count:      h.GetSampleCount(),
+		Sum:        h.GetSampleSum(),
+	}
+
+	var previous uint64
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		dp.Bounds = append(dp.Bounds, b.GetUpperBound())
+		dp.BucketCounts = append(dp.BucketCounts, b.GetCumulativeCount()-previous)
+		previous = b.GetCumulativeCount()
+	}
+	// The implicit +Inf bucket holds whatever the explicit buckets did not
+	dp.BucketCounts = append(dp.BucketCounts, h.GetSampleCount()-previous)
+	return dp
+}
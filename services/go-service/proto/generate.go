@@ -0,0 +1,6 @@
+// Package proto holds the service API and event payload definitions. The Go
+// code next to each .proto file is generated; run go generate ./proto after
+// editing them (the Docker build does so as well).
+package proto
+
+//go:generate protoc -I . --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative goservice/v1/goservice.proto events/v1/events.proto
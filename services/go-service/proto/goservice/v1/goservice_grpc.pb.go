@@ -0,0 +1,189 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.1
+// source: goservice/v1/goservice.proto
+
+package goservicev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	GoService_GetInfo_FullMethodName      = "/goservice.v1.GoService/GetInfo"
+	GoService_GetData_FullMethodName      = "/goservice.v1.GoService/GetData"
+	GoService_TriggerError_FullMethodName = "/goservice.v1.GoService/TriggerError"
+)
+
+// GoServiceClient is the client API for GoService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GoServiceClient interface {
+	// GetInfo mirrors GET /
+	GetInfo(ctx context.Context, in *GetInfoRequest, opts ...grpc.CallOption) (*GetInfoResponse, error)
+	// GetData mirrors GET /data and reads from the configured data store
+	GetData(ctx context.Context, in *GetDataRequest, opts ...grpc.CallOption) (*GetDataResponse, error)
+	// TriggerError mirrors GET /error and always fails
+	TriggerError(ctx context.Context, in *TriggerErrorRequest, opts ...grpc.CallOption) (*TriggerErrorResponse, error)
+}
+
+type goServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGoServiceClient(cc grpc.ClientConnInterface) GoServiceClient {
+	return &goServiceClient{cc}
+}
+
+func (c *goServiceClient) GetInfo(ctx context.Context, in *GetInfoRequest, opts ...grpc.CallOption) (*GetInfoResponse, error) {
+	out := new(GetInfoResponse)
+	err := c.cc.Invoke(ctx, GoService_GetInfo_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goServiceClient) GetData(ctx context.Context, in *GetDataRequest, opts ...grpc.CallOption) (*GetDataResponse, error) {
+	out := new(GetDataResponse)
+	err := c.cc.Invoke(ctx, GoService_GetData_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goServiceClient) TriggerError(ctx context.Context, in *TriggerErrorRequest, opts ...grpc.CallOption) (*TriggerErrorResponse, error) {
+	out := new(TriggerErrorResponse)
+	err := c.cc.Invoke(ctx, GoService_TriggerError_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GoServiceServer is the server API for GoService service.
+// All implementations must embed UnimplementedGoServiceServer
+// for forward compatibility
+type GoServiceServer interface {
+	// GetInfo mirrors GET /
+	GetInfo(context.Context, *GetInfoRequest) (*GetInfoResponse, error)
+	// GetData mirrors GET /data and reads from the configured data store
+	GetData(context.Context, *GetDataRequest) (*GetDataResponse, error)
+	// TriggerError mirrors GET /error and always fails
+	TriggerError(context.Context, *TriggerErrorRequest) (*TriggerErrorResponse, error)
+	mustEmbedUnimplementedGoServiceServer()
+}
+
+// UnimplementedGoServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedGoServiceServer struct {
+}
+
+func (UnimplementedGoServiceServer) GetInfo(context.Context, *GetInfoRequest) (*GetInfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInfo not implemented")
+}
+func (UnimplementedGoServiceServer) GetData(context.Context, *GetDataRequest) (*GetDataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetData not implemented")
+}
+func (UnimplementedGoServiceServer) TriggerError(context.Context, *TriggerErrorRequest) (*TriggerErrorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerError not implemented")
+}
+func (UnimplementedGoServiceServer) mustEmbedUnimplementedGoServiceServer() {}
+
+// UnsafeGoServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GoServiceServer will
+// result in compilation errors.
+type UnsafeGoServiceServer interface {
+	mustEmbedUnimplementedGoServiceServer()
+}
+
+func RegisterGoServiceServer(s grpc.ServiceRegistrar, srv GoServiceServer) {
+	s.RegisterService(&GoService_ServiceDesc, srv)
+}
+
+func _GoService_GetInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoServiceServer).GetInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GoService_GetInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoServiceServer).GetInfo(ctx, req.(*GetInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoService_GetData_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoServiceServer).GetData(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GoService_GetData_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoServiceServer).GetData(ctx, req.(*GetDataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoService_TriggerError_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerErrorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoServiceServer).TriggerError(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GoService_TriggerError_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoServiceServer).TriggerError(ctx, req.(*TriggerErrorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// GoService_ServiceDesc is the grpc.ServiceDesc for GoService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GoService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "goservice.v1.GoService",
+	HandlerType: (*GoServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetInfo",
+			Handler:    _GoService_GetInfo_Handler,
+		},
+		{
+			MethodName: "GetData",
+			Handler:    _GoService_GetData_Handler,
+		},
+		{
+			MethodName: "TriggerError",
+			Handler:    _GoService_TriggerError_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "goservice/v1/goservice.proto",
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// spanRecord is a flattened copy of a finished span kept for the debug viewer
+type spanRecord struct {
+	Name         string            `json:"name"`
+	TraceID      string            `json:"trace_id"`
+	SpanID       string            `json:"span_id"`
+	ParentSpanID string            `json:"parent_span_id,omitempty"`
+	Kind         string            `json:"kind"`
+	Start        time.Time         `json:"start"`
+	DurationMs   float64           `json:"duration_ms"`
+	Sampled      bool              `json:"sampled"`
+	Status       string            `json:"status"`
+	StatusDesc   string            `json:"status_description,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Events       int               `json:"events"`
+}
+
+// newSpanRecord flattens a finished span for the debug viewers, scrubbing
+// secrets as the exporter does since the viewers show what they record
+func newSpanRecord(s sdktrace.ReadOnlySpan) spanRecord {
+	if !secrets.empty() {
+		s = redactedSpan{s}
+	}
+	sc := s.SpanContext()
+	rec := spanRecord{
+		Name:       s.Name(),
+		TraceID:    sc.TraceID().String(),
+		SpanID:     sc.SpanID().String(),
+		Kind:       s.SpanKind().String(),
+		Start:      s.StartTime(),
+		DurationMs: float64(s.EndTime().Sub(s.StartTime()).Microseconds()) / 1000,
+		Sampled:    sc.IsSampled(),
+		Status:     s.Status().Code.String(),
+		StatusDesc: s.Status().Description,
+		Events:     len(s.Events()),
+	}
+	if parent := s.Parent(); parent.IsValid() {
+		rec.ParentSpanID = parent.SpanID().String()
+	}
+	if attrs := s.Attributes(); len(attrs) > 0 {
+		rec.Attributes = make(map[string]string, len(attrs))
+		for _, kv := range attrs {
+			rec.Attributes[string(kv.Key)] = kv.Value.Emit()
+		}
+	}
+	return rec
+}
+
+// recentSpanProcessor keeps the last N finished spans in a ring buffer
+type recentSpanProcessor struct {
+	mu    sync.Mutex
+	spans []spanRecord
+	next  int
+	full  bool
+}
+
+var recentSpans = newRecentSpanProcessor(envInt("RECENT_SPANS_SIZE", 500))
+
+func newRecentSpanProcessor(size int) *recentSpanProcessor {
+	if size < 1 {
+		size = 1
+	}
+	return &recentSpanProcessor{spans: make([]spanRecord, size)}
+}
+
+func (p *recentSpanProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p *recentSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	rec := newSpanRecord(s)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.spans[p.next] = rec
+	p.next = (p.next + 1) % len(p.spans)
+	if p.next == 0 {
+		p.full = true
+	}
+}
+
+func (p *recentSpanProcessor) Shutdown(context.Context) error   { return nil }
+func (p *recentSpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// snapshot returns buffered spans newest first, optionally filtered by trace ID
+func (p *recentSpanProcessor) snapshot(traceID string) []spanRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	count := p.next
+	if p.full {
+		count = len(p.spans)
+	}
+
+	out := make([]spanRecord, 0, count)
+	for i := 1; i <= count; i++ {
+		rec := p.spans[(p.next-i+len(p.spans))%len(p.spans)]
+		if traceID != "" && rec.TraceID != traceID {
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+var recentSpansTemplate = template.Must(template.New("traces").Parse(`<!DOCTYPE html>
+<html>
+<head><title>go-service recent spans</title>
+<style>
+body { font-family: monospace; font-size: 13px; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 6px; text-align: left; vertical-align: top; }
+.Error { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>Recent spans ({{len .}})</h1>
+<table>
+<tr><th>Start</th><th>Name</th><th>Kind</th><th>Duration (ms)</th><th>Status</th><th>Trace</th><th>Span</th><th>Attributes</th></tr>
+{{range .}}<tr class="{{.Status}}">
+<td>{{.Start.Format "15:04:05.000"}}</td>
+<td>{{.Name}}</td>
+<td>{{.Kind}}</td>
+<td>{{printf "%.2f" .DurationMs}}</td>
+<td>{{.Status}} {{.StatusDesc}}</td>
+<td><a href="?trace_id={{.TraceID}}">{{.TraceID}}</a></td>
+<td>{{.SpanID}}</td>
+<td>{{range $k, $v := .Attributes}}{{$k}}={{$v}}<br>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// recentSpansResponse is the JSON body of GET /debug/traces
+type recentSpansResponse struct {
+	Count int          `json:"count"`
+	Spans []spanRecord `json:"spans"`
+}
+
+// debugTracesHandler renders the recent spans as HTML, or JSON with ?format=json
+func debugTracesHandler(w http.ResponseWriter, r *http.Request) {
+	spans := recentSpans.snapshot(r.URL.Query().Get("trace_id"))
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(recentSpansResponse{Count: len(spans), Spans: spans})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	recentSpansTemplate.Execute(w, spans)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// runReplay re-issues captured requests from a JSON lines file (written by
+// REQUEST_CAPTURE_FILE or downloaded from /admin/captures?format=jsonl) and
+// prints one JSON result per request
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	file := fs.String("file", "-", "JSON lines file of captured requests, or - for stdin")
+	target := fs.String("target", "http://localhost:8000", "Base URL to replay against")
+	id := fs.String("id", "", "Only replay the capture with this ID")
+	delay := fs.Duration("delay", 0, "Pause between requests")
+	timeout := fs.Duration("timeout", 30*time.Second, "Per-request timeout")
+	fs.Parse(args)
+
+	var in io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := &http.Client{Timeout: *timeout}
+	enc := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	replayed, failed := 0, 0
+	for scanner.Scan() && ctx.Err() == nil {
+		var c capturedRequest
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil || c.Method == "" {
+			continue
+		}
+		if *id != "" && c.ID != *id {
+			continue
+		}
+		if c.BodyTruncated {
+			fmt.Fprintf(os.Stderr, "replay: %s has a truncated body; replaying the captured prefix\n", c.ID)
+		}
+
+		res := replayCapture(ctx, client, *target, c)
+		enc.Encode(res)
+		replayed++
+		if res.Error != "" {
+			failed++
+		}
+		if *delay > 0 {
+			time.Sleep(*delay)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "replayed %d requests, %d failed\n", replayed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
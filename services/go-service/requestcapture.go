@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// replayHeader marks replayed requests so they are tagged and never re-captured
+const replayHeader = "X-Replay-Of"
+
+// droppedCaptureHeaders are never stored: credentials, and trace context so a
+// replay starts a fresh trace
+var droppedCaptureHeaders = map[string]bool{
+	"traceparent": true,
+	"tracestate":  true,
+	"baggage":     true,
+	"x-api-key":   true,
+}
+
+var requestCaptures metric.Int64Counter
+
+// initRequestCaptureMetrics creates the capture and replay counter
+func initRequestCaptureMetrics() error {
+	var err error
+	requestCaptures, err = meter.Int64Counter(
+		"request_captures_total",
+		metric.WithDescription("Requests captured for replay, and replays served, by endpoint and action"),
+	)
+	return err
+}
+
+// capturedRequest is a sanitized request that can be re-issued later
+type capturedRequest struct {
+	ID            string              `json:"id"`
+	Time          time.Time           `json:"time"`
+	Method        string              `json:"method"`
+	URI           string              `json:"uri"`
+	Route         string              `json:"route"`
+	Header        map[string][]string `json:"header"`
+	Body          string              `json:"body,omitempty"`
+	BodyTruncated bool                `json:"body_truncated,omitempty"`
+	Status        int                 `json:"status"`
+	DurationMs    float64             `json:"duration_ms"`
+	TraceID       string              `json:"trace_id,omitempty"`
+}
+
+// requestCaptureStore keeps the most recent captures and optionally appends
+// them as JSON lines to REQUEST_CAPTURE_FILE
+type requestCaptureStore struct {
+	mu      sync.Mutex
+	entries []capturedRequest
+	next    int
+	size    int
+	seq     int
+	file    *os.File
+}
+
+var requestCaptureLog = newRequestCaptureStore()
+
+func newRequestCaptureStore() *requestCaptureStore {
+	s := &requestCaptureStore{size: envInt("REQUEST_CAPTURE_SIZE", 100)}
+	if path := os.Getenv("REQUEST_CAPTURE_FILE"); path != "" && envBool("REQUEST_CAPTURE", false) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			logJSON(context.Background(), "ERROR", "Failed to open request capture file", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+		} else {
+			s.file = f
+		}
+	}
+	return s
+}
+
+func (s *requestCaptureStore) add(c capturedRequest) capturedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	c.ID = fmt.Sprintf("%d-%d", processStart.Unix(), s.seq)
+	if s.size > 0 {
+		if len(s.entries) < s.size {
+			s.entries = append(s.entries, c)
+		} else {
+			s.entries[s.next] = c
+		}
+		s.next = (s.next + 1) % s.size
+	}
+	if s.file != nil {
+		line, _ := json.Marshal(c)
+		s.file.Write(append(line, '\n'))
+	}
+	return c
+}
+
+// snapshot returns the buffered captures, oldest first
+func (s *requestCaptureStore) snapshot() []capturedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]capturedRequest, 0, len(s.entries))
+	if len(s.entries) == s.size {
+		out = append(out, s.entries[s.next:]...)
+		return append(out, s.entries[:s.next]...)
+	}
+	return append(out, s.entries...)
+}
+
+func (s *requestCaptureStore) get(id string) (capturedRequest, bool) {
+	for _, c := range s.snapshot() {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return capturedRequest{}, false
+}
+
+func (s *requestCaptureStore) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries, s.next = nil, 0
+}
+
+// requestCaptureFilter selects which requests are recorded
+type requestCaptureFilter struct {
+	routes    map[string]bool
+	methods   map[string]bool
+	minStatus int
+	maxBody   int
+}
+
+func loadRequestCaptureFilter() requestCaptureFilter {
+	f := requestCaptureFilter{
+		routes:    routeSet(envString("REQUEST_CAPTURE_ROUTES", "")),
+		methods:   map[string]bool{},
+		minStatus: envInt("REQUEST_CAPTURE_MIN_STATUS", 0),
+		maxBody:   envInt("REQUEST_CAPTURE_MAX_BODY_BYTES", 64*1024),
+	}
+	for _, m := range splitList(envString("REQUEST_CAPTURE_METHODS", "")) {
+		f.methods[strings.ToUpper(m)] = true
+	}
+	return f
+}
+
+func (f requestCaptureFilter) wants(r *http.Request, route string) bool {
+	if strings.HasPrefix(r.URL.Path, "/admin/") || telemetryExcluded(r) {
+		return false
+	}
+	if len(f.routes) > 0 && !f.routes[route] {
+		return false
+	}
+	return len(f.methods) == 0 || f.methods[r.Method]
+}
+
+// sanitizeHeaders drops credentials and trace context and redacts known secrets
+func sanitizeHeaders(h http.Header) map[string][]string {
+	out := map[string][]string{}
+	for name, values := range h {
+		lower := strings.ToLower(name)
+		if droppedCaptureHeaders[lower] || sensitiveHeaders[lower] {
+			continue
+		}
+		clean := make([]string, len(values))
+		for i, v := range values {
+			clean[i] = secrets.Redact(v)
+		}
+		out[name] = clean
+	}
+	return out
+}
+
+// captureRequests records sanitized requests matching the capture filter
+// when REQUEST_CAPTURE is enabled, and tags replayed requests on their span
+func captureRequests(next http.Handler) http.Handler {
+	if !envBool("REQUEST_CAPTURE", false) {
+		return next
+	}
+	filter := loadRequestCaptureFilter()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		route := routeOf(r)
+
+		if of := r.Header.Get(replayHeader); of != "" {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("replay.of", of))
+			requestCaptures.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("endpoint", route),
+				attribute.String("action", "replayed"),
+			))
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Capture pauses in protective mode
+		if !filter.wants(r, route) || protectiveMode() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		truncated := false
+		if r.Body != nil {
+			head, err := io.ReadAll(io.LimitReader(r.Body, int64(filter.maxBody)+1))
+			if err == nil {
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+				if len(head) > filter.maxBody {
+					head, truncated = head[:filter.maxBody], true
+				}
+				body = head
+			}
+		}
+
+		start := time.Now()
+		rec := newStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+		if rec.status < filter.minStatus {
+			return
+		}
+
+		c := requestCaptureLog.add(capturedRequest{
+			Time:          start,
+			Method:        r.Method,
+			URI:           r.URL.RequestURI(),
+			Route:         route,
+			Header:        sanitizeHeaders(r.Header),
+			Body:          redactBody(body),
+			BodyTruncated: truncated,
+			Status:        rec.status,
+			DurationMs:    float64(time.Since(start).Microseconds()) / 1000,
+			TraceID:       trace.SpanFromContext(ctx).SpanContext().TraceID().String(),
+		})
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("capture.id", c.ID))
+		requestCaptures.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("endpoint", route),
+			attribute.String("action", "captured"),
+		))
+	})
+}
+
+// replayResult is the outcome of re-issuing one capture
+type replayResult struct {
+	ID             string  `json:"id"`
+	Method         string  `json:"method"`
+	URI            string  `json:"uri"`
+	OriginalStatus int     `json:"original_status"`
+	Status         int     `json:"status,omitempty"`
+	DurationMs     float64 `json:"duration_ms"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// replayCapture re-issues c against target. No trace context is sent, so the
+// service starts a fresh trace tagged with replay.of.
+func replayCapture(ctx context.Context, client *http.Client, target string, c capturedRequest) replayResult {
+	res := replayResult{ID: c.ID, Method: c.Method, URI: c.URI, OriginalStatus: c.Status}
+	req, err := http.NewRequestWithContext(ctx, c.Method, strings.TrimSuffix(target, "/")+c.URI, strings.NewReader(c.Body))
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	for name, values := range c.Header {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	req.Header.Set(replayHeader, c.ID)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	res.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	res.Status = resp.StatusCode
+	return res
+}
+
+// capturesResponse is the JSON body of GET /admin/captures
+type capturesResponse struct {
+	Count    int               `json:"count"`
+	Captures []capturedRequest `json:"captures"`
+}
+
+// adminCapturesHandler serves GET /admin/captures (JSON, or JSON lines with
+// ?format=jsonl for the replay command), DELETE /admin/captures, and
+// POST /admin/captures/{id}/replay against REQUEST_CAPTURE_REPLAY_TARGET
+func adminCapturesHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/captures"), "/")
+	id, action, _ := strings.Cut(rest, "/")
+
+	writeJSON := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		captures := requestCaptureLog.snapshot()
+		if r.URL.Query().Get("format") == "jsonl" {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			enc := json.NewEncoder(w)
+			for _, c := range captures {
+				enc.Encode(c)
+			}
+			return
+		}
+		writeJSON(http.StatusOK, capturesResponse{Count: len(captures), Captures: captures})
+
+	case id == "" && r.Method == http.MethodDelete:
+		requestCaptureLog.clear()
+		w.WriteHeader(http.StatusNoContent)
+
+	case id != "" && action == "replay" && r.Method == http.MethodPost:
+		c, ok := requestCaptureLog.get(id)
+		if !ok {
+			writeJSON(http.StatusNotFound, errorResponse{Error: "capture not found"})
+			return
+		}
+		client := &http.Client{Timeout: envDuration("REQUEST_CAPTURE_REPLAY_TIMEOUT", 30*time.Second)}
+		target := envString("REQUEST_CAPTURE_REPLAY_TARGET", "http://localhost:8000")
+		writeJSON(http.StatusOK, replayCapture(r.Context(), client, target, c))
+
+	default:
+		writeJSON(http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// responseSizeView gives the size histogram byte-scale buckets instead of the
+// SDK defaults, which top out at 10000
+var responseSizeView = sdkmetric.NewView(
+	sdkmetric.Instrument{Name: "http_response_size_bytes"},
+	sdkmetric.Stream{Aggregation: sdkmetric.AggregationExplicitBucketHistogram{
+		Boundaries: []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216},
+	}},
+)
+
+var (
+	responseSize       metric.Int64Histogram
+	oversizedResponses metric.Int64Counter
+)
+
+// initResponseSizeMetrics creates the response size instruments
+func initResponseSizeMetrics() error {
+	var err error
+
+	responseSize, err = meter.Int64Histogram(
+		"http_response_size_bytes",
+		metric.WithDescription("Response body size by route"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
+
+	oversizedResponses, err = meter.Int64Counter(
+		"http_oversized_responses_total",
+		metric.WithDescription("Responses larger than RESPONSE_SIZE_THRESHOLD (or the route override)"),
+	)
+	return err
+}
+
+// sizeThresholds flags responses above a default or per-route byte count
+type sizeThresholds struct {
+	threshold int64
+	overrides map[string]int64
+}
+
+// loadSizeThresholds reads RESPONSE_SIZE_THRESHOLD and
+// RESPONSE_SIZE_ROUTE_THRESHOLDS ("/data=65536,/download=0")
+func loadSizeThresholds() sizeThresholds {
+	t := sizeThresholds{
+		threshold: int64(envInt("RESPONSE_SIZE_THRESHOLD", 1<<20)),
+		overrides: map[string]int64{},
+	}
+	for _, pair := range splitList(envString("RESPONSE_SIZE_ROUTE_THRESHOLDS", "/download=0")) {
+		route, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			t.overrides[strings.TrimSpace(route)] = n
+		}
+	}
+	return t
+}
+
+func (t sizeThresholds) thresholdFor(route string) int64 {
+	if n, ok := t.overrides[route]; ok {
+		return n
+	}
+	return t.threshold
+}
+
+// trackResponseSize records every response size and flags the ones above
+// their threshold, so payloads that silently grow show up before they hurt
+func trackResponseSize(next http.Handler) http.Handler {
+	thresholds := loadSizeThresholds()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if telemetryExcluded(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := newStatusRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		ctx := r.Context()
+		route := routeOf(r)
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.Int64("http.response.body.size", rec.bytes))
+
+		label, ok := metricRoute(route)
+		if ok {
+			responseSize.Record(ctx, rec.bytes, metric.WithAttributes(attribute.String("endpoint", label)))
+		}
+
+		threshold := thresholds.thresholdFor(route)
+		if threshold <= 0 || rec.bytes <= threshold {
+			return
+		}
+
+		span.SetAttributes(
+			attribute.Bool("response.oversized", true),
+			attribute.Int64("response.size_threshold_bytes", threshold),
+		)
+		if ok {
+			oversizedResponses.Add(ctx, 1, metric.WithAttributes(attribute.String("endpoint", label)))
+		}
+		logJSON(ctx, "WARN", "Oversized response", map[string]interface{}{
+			"endpoint":        route,
+			"method":          r.Method,
+			"bytes":           rec.bytes,
+			"threshold_bytes": threshold,
+		})
+	})
+}
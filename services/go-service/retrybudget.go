@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	retriesSuppressed metric.Int64Counter
+
+	retryBudgetsMu sync.Mutex
+	retryBudgets   = map[string]*retryBudget{}
+)
+
+// initRetryBudgetMetrics creates the retry budget consumption instruments
+func initRetryBudgetMetrics() error {
+	var err error
+
+	retriesSuppressed, err = meter.Int64Counter(
+		"retries_suppressed_total",
+		metric.WithDescription("Retries skipped because the upstream's retry budget was exhausted"),
+	)
+	if err != nil {
+		return err
+	}
+
+	used, err := meter.Float64ObservableGauge(
+		"retry_budget_used_ratio",
+		metric.WithDescription("Retries in the current window as a fraction of the allowed retries, by upstream"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		retryBudgetsMu.Lock()
+		defer retryBudgetsMu.Unlock()
+		for upstream, b := range retryBudgets {
+			o.ObserveFloat64(used, b.usedRatio(), metric.WithAttributes(attribute.String("upstream", upstream)))
+		}
+		return nil
+	}, used)
+	return err
+}
+
+// retryBudget caps retries to a fraction of recent requests, plus a small
+// floor so low-traffic upstreams can still retry. Counts cover the current
+// and previous window so the budget does not reset abruptly.
+type retryBudget struct {
+	ratio      float64
+	minRetries float64
+	window     time.Duration
+
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    [2]float64
+	retries     [2]float64
+}
+
+// newRetryBudget returns the budget for upstream, shared by every route to it
+func newRetryBudget(upstream string) *retryBudget {
+	retryBudgetsMu.Lock()
+	defer retryBudgetsMu.Unlock()
+	if b, ok := retryBudgets[upstream]; ok {
+		return b
+	}
+	b := &retryBudget{
+		ratio:       envFloat("RETRY_BUDGET_RATIO", 0.1),
+		minRetries:  float64(envInt("RETRY_BUDGET_MIN_RETRIES", 3)),
+		window:      envDuration("RETRY_BUDGET_WINDOW", 10*time.Second),
+		windowStart: time.Now(),
+	}
+	retryBudgets[upstream] = b
+	return b
+}
+
+// rotate moves to a new window when the current one has elapsed; callers hold mu
+func (b *retryBudget) rotate() {
+	elapsed := time.Since(b.windowStart)
+	if elapsed < b.window {
+		return
+	}
+	if elapsed < 2*b.window {
+		b.requests[1], b.retries[1] = b.requests[0], b.retries[0]
+	} else {
+		b.requests[1], b.retries[1] = 0, 0
+	}
+	b.requests[0], b.retries[0] = 0, 0
+	b.windowStart = time.Now()
+}
+
+// allowed is the number of retries the last two windows permit; callers hold mu
+func (b *retryBudget) allowed() float64 {
+	return b.minRetries + b.ratio*(b.requests[0]+b.requests[1])
+}
+
+// request records an original (non-retry) request
+func (b *retryBudget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate()
+	b.requests[0]++
+}
+
+// tryRetry consumes budget for one retry, or reports that it is exhausted
+func (b *retryBudget) tryRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate()
+	if b.retries[0]+b.retries[1]+1 > b.allowed() {
+		return false
+	}
+	b.retries[0]++
+	return true
+}
+
+func (b *retryBudget) usedRatio() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate()
+	allowed := b.allowed()
+	if allowed <= 0 {
+		return 1
+	}
+	return (b.retries[0] + b.retries[1]) / allowed
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// otherRoute is the shared label for routes collapsed by METRICS_EXCLUDE_MODE=other
+const otherRoute = "other"
+
+var (
+	metricsExcludedRoutes = routeSet(envString("METRICS_EXCLUDE_ROUTES", ""))
+	metricsExcludeMode    = envString("METRICS_EXCLUDE_MODE", "drop")
+)
+
+func routeSet(value string) map[string]bool {
+	set := map[string]bool{}
+	for _, route := range splitList(value) {
+		set[route] = true
+	}
+	return set
+}
+
+// metricRoute maps a route to the label used in custom metrics; ok is false
+// when the route is excluded and should not be recorded at all
+func metricRoute(route string) (label string, ok bool) {
+	if !metricsExcludedRoutes[route] {
+		return route, true
+	}
+	if metricsExcludeMode == otherRoute {
+		return otherRoute, true
+	}
+	return "", false
+}
+
+// requestAttributes are the labels shared by the request metrics, including
+// the deployment track; the experiment variant and API version are added for
+// requests that carry one. The set is built from a pooled slice.
+func requestAttributes(ctx context.Context, method, endpoint string, extra ...attribute.KeyValue) attribute.Set {
+	attrs := getAttrs()
+	defer putAttrs(attrs)
+
+	*attrs = append(*attrs,
+		attribute.String("method", method),
+		attribute.String("endpoint", endpoint),
+		attribute.String("track", deploymentTrack),
+	)
+	if variant := variantFromContext(ctx); variant != "" {
+		*attrs = append(*attrs, attribute.String("variant", variant))
+	}
+	if v := apiVersionFromContext(ctx); v != "" {
+		*attrs = append(*attrs, attribute.String("api.version", v))
+	}
+	*attrs = append(*attrs, extra...)
+	return attribute.NewSet(*attrs...)
+}
+
+// countRequest increments http_requests_total for a route unless it is excluded
+func countRequest(ctx context.Context, method, endpoint string, extra ...attribute.KeyValue) {
+	label, ok := metricRoute(endpoint)
+	if !ok {
+		return
+	}
+	requestCounter.Add(ctx, 1, metric.WithAttributeSet(requestAttributes(ctx, method, label, extra...)))
+}
+
+// observeRequestDuration records http_request_duration_seconds unless the route is excluded
+func observeRequestDuration(ctx context.Context, method, endpoint string, seconds float64) {
+	label, ok := metricRoute(endpoint)
+	if !ok {
+		return
+	}
+	requestDuration.Record(ctx, seconds, metric.WithAttributeSet(requestAttributes(ctx, method, label)))
+}
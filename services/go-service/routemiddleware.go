@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// switchableMiddleware are the middleware ROUTE_MIDDLEWARE can turn on or
+// off for a route group
+var switchableMiddleware = map[string]bool{
+	"auth":        true,
+	"ratelimit":   true,
+	"bodycapture": true,
+	"tracing":     true,
+}
+
+// middlewareGroup switches middleware on or off for the paths under prefix
+type middlewareGroup struct {
+	prefix   string
+	switches map[string]bool
+}
+
+// middlewareGroups is ROUTE_MIDDLEWARE, longest prefix first; loaded at the start
+// of serve
+var middlewareGroups []middlewareGroup
+
+// loadMiddlewareGroups parses ROUTE_MIDDLEWARE ("/admin/=+auth|+tracing,
+// /healthz=-auth|-ratelimit"): a path prefix and the middleware switched
+// on (+) or off (-) under it. Invalid entries fail startup.
+func loadMiddlewareGroups() ([]middlewareGroup, error) {
+	var groups []middlewareGroup
+	for _, pair := range splitList(envString("ROUTE_MIDDLEWARE", "")) {
+		prefix, raw, ok := strings.Cut(pair, "=")
+		prefix = strings.TrimSpace(prefix)
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("invalid ROUTE_MIDDLEWARE entry %q", pair)
+		}
+		group := middlewareGroup{prefix: prefix, switches: map[string]bool{}}
+		for _, sw := range strings.Split(raw, "|") {
+			sw = strings.TrimSpace(sw)
+			if len(sw) < 2 || (sw[0] != '+' && sw[0] != '-') || !switchableMiddleware[sw[1:]] {
+				return nil, fmt.Errorf("invalid middleware switch %q for %s: use +name or -name with auth, ratelimit, bodycapture or tracing", sw, prefix)
+			}
+			group.switches[sw[1:]] = sw[0] == '+'
+		}
+		groups = append(groups, group)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return len(groups[i].prefix) > len(groups[j].prefix) })
+	return groups, nil
+}
+
+// routeMiddleware reports whether the named middleware runs for r: the
+// longest ROUTE_MIDDLEWARE prefix that switches it decides, and def applies
+// when none does
+func routeMiddleware(r *http.Request, name string, def bool) bool {
+	for _, g := range middlewareGroups {
+		if !strings.HasPrefix(r.URL.Path, g.prefix) {
+			continue
+		}
+		if on, ok := g.switches[name]; ok {
+			return on
+		}
+	}
+	return def
+}
+
+// middlewareGroupsEnable reports whether any route group switches the named
+// middleware on, for middleware that is otherwise off
+func middlewareGroupsEnable(name string) bool {
+	for _, g := range middlewareGroups {
+		if g.switches[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// requireRouteAuth applies the admin credentials to route groups switched
+// to +auth; admin endpoints check them on their own unless switched to -auth
+func requireRouteAuth(creds adminCredentials) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !creds.enabled() {
+			return next
+		}
+		protected := authenticate(creds, next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if routeMiddleware(r, "auth", false) {
+				protected.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
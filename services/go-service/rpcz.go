@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"google.golang.org/grpc/codes"
+)
+
+// rpczKey is one row of /debug/rpcz: a gRPC method seen from one side
+type rpczKey struct {
+	Kind   string
+	Method string
+}
+
+// rpczStats aggregates the finished otelgrpc spans of one method and kind
+type rpczStats struct {
+	count    int64
+	errors   int64
+	total    time.Duration
+	max      time.Duration
+	statuses map[codes.Code]int64
+}
+
+// rpczProcessor is the zPages rpcz counterpart of tracezProcessor: it keeps
+// per-method call counts, latency and status codes of gRPC client and server
+// spans. Methods beyond maxMethods share an "other" row.
+type rpczProcessor struct {
+	maxMethods int
+
+	mu      sync.Mutex
+	methods map[rpczKey]*rpczStats
+}
+
+var rpcz = &rpczProcessor{
+	maxMethods: envInt("TRACEZ_MAX_NAMES", 200),
+	methods:    map[rpczKey]*rpczStats{},
+}
+
+func (p *rpczProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p *rpczProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	var system string
+	status := codes.OK
+	for _, kv := range s.Attributes() {
+		switch kv.Key {
+		case semconv.RPCSystemKey:
+			system = kv.Value.AsString()
+		case semconv.RPCGRPCStatusCodeKey:
+			status = codes.Code(kv.Value.AsInt64())
+		}
+	}
+	if system != "grpc" {
+		return
+	}
+	// otelgrpc names spans after the full method, e.g. goservice.v1.GoService/GetItem
+	key := rpczKey{Kind: strings.ToLower(s.SpanKind().String()), Method: s.Name()}
+	latency := s.EndTime().Sub(s.StartTime())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats, ok := p.methods[key]
+	if !ok && len(p.methods) >= p.maxMethods {
+		key.Method = tracezOtherName
+		stats, ok = p.methods[key]
+	}
+	if !ok {
+		stats = &rpczStats{statuses: map[codes.Code]int64{}}
+		p.methods[key] = stats
+	}
+	stats.count++
+	if status != codes.OK {
+		stats.errors++
+	}
+	stats.total += latency
+	stats.max = max(stats.max, latency)
+	stats.statuses[status]++
+}
+
+func (p *rpczProcessor) Shutdown(context.Context) error   { return nil }
+func (p *rpczProcessor) ForceFlush(context.Context) error { return nil }
+
+// rpczRow is one method and kind in the rpcz table
+type rpczRow struct {
+	rpczKey
+	Count    int64
+	Errors   int64
+	AvgMs    float64
+	MaxMs    float64
+	Statuses string
+}
+
+var rpczTemplate = template.Must(template.New("rpcz").Parse(`<!DOCTYPE html>
+<html>
+<head><title>go-service rpcz</title>
+<style>
+body { font-family: monospace; font-size: 13px; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 2px 6px; text-align: right; }
+td:first-child, td:nth-child(2), td:last-child { text-align: left; }
+</style>
+</head>
+<body>
+<h1>rpcz</h1>
+<table>
+<tr><th>Method</th><th>Kind</th><th>Calls</th><th>Errors</th><th>Avg (ms)</th><th>Max (ms)</th><th>Status codes</th></tr>
+{{range .}}<tr><td>{{.Method}}</td><td>{{.Kind}}</td><td>{{.Count}}</td><td>{{.Errors}}</td><td>{{printf "%.3f" .AvgMs}}</td><td>{{printf "%.3f" .MaxMs}}</td><td>{{.Statuses}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// debugRpczHandler renders per-method gRPC call statistics from otelgrpc spans
+func debugRpczHandler(w http.ResponseWriter, r *http.Request) {
+	var rows []rpczRow
+	rpcz.mu.Lock()
+	for key, stats := range rpcz.methods {
+		var statuses []string
+		for code, n := range stats.statuses {
+			statuses = append(statuses, code.String()+"="+strconv.FormatInt(n, 10))
+		}
+		sort.Strings(statuses)
+		rows = append(rows, rpczRow{
+			rpczKey:  key,
+			Count:    stats.count,
+			Errors:   stats.errors,
+			AvgMs:    durationMs(stats.total) / float64(stats.count),
+			MaxMs:    durationMs(stats.max),
+			Statuses: strings.Join(statuses, " "),
+		})
+	}
+	rpcz.mu.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Method != rows[j].Method {
+			return rows[i].Method < rows[j].Method
+		}
+		return rows[i].Kind < rows[j].Kind
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rpczTemplate.Execute(w, rows)
+}
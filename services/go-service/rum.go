@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// webVitals are the metric names accepted from beacons; anything else is labelled "other"
+var webVitals = map[string]bool{"LCP": true, "CLS": true, "INP": true, "FCP": true, "TTFB": true, "FID": true}
+
+// rumErrorTypes are the error types used as labels: the built-in JavaScript
+// errors and the frontend's UnhandledRejection; anything else is "other"
+var rumErrorTypes = map[string]bool{
+	"Error": true, "TypeError": true, "ReferenceError": true, "SyntaxError": true, "RangeError": true,
+	"URIError": true, "EvalError": true, "AggregateError": true, "UnhandledRejection": true,
+}
+
+// rumPages are the page paths used as labels; beacons come from any
+// client, so other paths are labelled "other"
+var rumPages = routeSet(envString("RUM_PAGES", "/"))
+
+var (
+	rumVitals  metric.Float64Histogram
+	rumErrors  metric.Int64Counter
+	rumBeacons metric.Int64Counter
+)
+
+// initRUMMetrics creates the instruments fed by browser beacons
+func initRUMMetrics() error {
+	var err error
+
+	rumVitals, err = meter.Float64Histogram(
+		"rum_web_vital",
+		metric.WithDescription("Web vitals reported by browsers (milliseconds, CLS is unitless)"),
+	)
+	if err != nil {
+		return err
+	}
+
+	rumErrors, err = meter.Int64Counter(
+		"rum_errors_total",
+		metric.WithDescription("Frontend errors reported by browsers"),
+	)
+	if err != nil {
+		return err
+	}
+
+	rumBeacons, err = meter.Int64Counter(
+		"rum_beacons_total",
+		metric.WithDescription("RUM beacons received, by outcome"),
+	)
+	return err
+}
+
+// rumVital is one web-vitals measurement as reported by the web-vitals library
+type rumVital struct {
+	Name   string  `json:"name"`
+	Value  float64 `json:"value"`
+	Rating string  `json:"rating"`
+	ID     string  `json:"id"`
+}
+
+// rumError is an uncaught error or unhandled rejection seen in the browser
+type rumError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Source  string `json:"source"`
+	Stack   string `json:"stack"`
+}
+
+// rumBeacon is the payload the frontend sends with navigator.sendBeacon
+type rumBeacon struct {
+	SessionID string     `json:"session_id"`
+	Page      string     `json:"page"`
+	Metrics   []rumVital `json:"metrics"`
+	Errors    []rumError `json:"errors"`
+}
+
+// validate rejects beacons the frontend never sends, so a broken or hostile
+// client cannot skew the vitals histogram
+func (b *rumBeacon) validate() error {
+	if len(b.Metrics) == 0 && len(b.Errors) == 0 {
+		return errors.New("beacon has no metrics or errors")
+	}
+	for _, v := range b.Metrics {
+		if v.Name == "" {
+			return errors.New("metric name is required")
+		}
+		if math.IsNaN(v.Value) || math.IsInf(v.Value, 0) || v.Value < 0 {
+			return fmt.Errorf("metric %s: value must be a non-negative number", v.Name)
+		}
+	}
+	return nil
+}
+
+// rumPage reduces a page URL to its path, folding paths outside RUM_PAGES
+// into "other" so metric labels stay bounded
+func rumPage(page string) string {
+	u, err := url.Parse(page)
+	if err != nil || u.Path == "" {
+		return "unknown"
+	}
+	if rumPages[u.Path] {
+		return u.Path
+	}
+	return "other"
+}
+
+func rumErrorType(errType string) string {
+	if errType == "" {
+		return "Error"
+	}
+	if rumErrorTypes[errType] {
+		return errType
+	}
+	return "other"
+}
+
+func rumVitalName(name string) string {
+	name = strings.ToUpper(name)
+	if webVitals[name] {
+		return name
+	}
+	return "other"
+}
+
+func rumRating(rating string) string {
+	switch rating {
+	case "good", "needs-improvement", "poor":
+		return rating
+	}
+	return "unknown"
+}
+
+// rumHandler accepts web-vitals and error beacons from the browser and turns
+// them into OTel metrics and a span carrying the session attributes, so they
+// reach the collector through the service's own exporters
+func rumHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "rum_beacon")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("http.method", r.Method),
+		attribute.String("http.route", "/rum"),
+	)
+
+	// sendBeacon posts text/plain to avoid a preflight, so the content type is not checked
+	var beacon rumBeacon
+	body := http.MaxBytesReader(w, r.Body, int64(envInt("RUM_MAX_BEACON_BYTES", 64*1024)))
+	err := json.NewDecoder(body).Decode(&beacon)
+	if err == nil {
+		err = beacon.validate()
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid beacon")
+		rumBeacons.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "invalid")))
+		countRequest(ctx, r.Method, "/rum", attribute.String("status", "error"))
+		http.Error(w, "invalid beacon: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page := rumPage(beacon.Page)
+	span.SetAttributes(
+		attribute.String("session.id", beacon.SessionID),
+		attribute.String("rum.page", page),
+		attribute.String("rum.page_url", beacon.Page),
+		attribute.Int("rum.metric_count", len(beacon.Metrics)),
+		attribute.Int("rum.error_count", len(beacon.Errors)),
+	)
+
+	for _, v := range beacon.Metrics {
+		name := rumVitalName(v.Name)
+		rating := rumRating(v.Rating)
+		rumVitals.Record(ctx, v.Value, metric.WithAttributes(
+			attribute.String("name", name),
+			attribute.String("rating", rating),
+			attribute.String("page", page),
+		))
+		span.AddEvent("web_vital", trace.WithAttributes(
+			attribute.String("rum.vital.name", name),
+			attribute.Float64("rum.vital.value", v.Value),
+			attribute.String("rum.vital.rating", rating),
+			attribute.String("rum.vital.id", v.ID),
+		))
+	}
+
+	for _, e := range beacon.Errors {
+		errType := e.Type
+		if errType == "" {
+			errType = "Error"
+		}
+		rumErrors.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("page", page),
+			attribute.String("type", rumErrorType(e.Type)),
+		))
+		span.RecordError(errors.New(e.Message), trace.WithAttributes(
+			attribute.String("exception.type", errType),
+			attribute.String("exception.stacktrace", e.Stack),
+			attribute.String("rum.error.source", e.Source),
+		))
+	}
+	if len(beacon.Errors) > 0 {
+		span.SetStatus(codes.Error, "frontend errors reported")
+		logJSON(ctx, "WARN", "Frontend errors reported", map[string]interface{}{
+			"session_id":  beacon.SessionID,
+			"page":        page,
+			"error_count": len(beacon.Errors),
+			"first_error": beacon.Errors[0].Message,
+		})
+	}
+
+	rumBeacons.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "accepted")))
+	w.WriteHeader(http.StatusNoContent)
+
+	countRequest(ctx, r.Method, "/rum")
+	observeRequestDuration(ctx, r.Method, "/rum", time.Since(start).Seconds())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type routeContextKey struct{}
+
+// withRoute stores the matched route pattern in the request context so the
+// sampler can see it before the server span starts
+func withRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), routeContextKey{}, routeOf(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func routeFromContext(ctx context.Context) string {
+	route, _ := ctx.Value(routeContextKey{}).(string)
+	return route
+}
+
+// headSampler is the tracer provider's sampler: debug-traced requests are
+// always kept, remote parents decide for their traces and root spans use
+// per-route ratios
+func headSampler() sdktrace.Sampler {
+	sampler := sdktrace.ParentBased(traceSampler)
+	if spanMetrics.enabled {
+		// Span metrics must count every span, not just the sampled ones
+		sampler = recordingSampler{sampler}
+	}
+	return debugSampler{sampler}
+}
+
+// routeSampler applies a per-route ratio, falling back to a default ratio
+type routeSampler struct {
+	mu       sync.RWMutex
+	ratio    float64
+	fallback sdktrace.Sampler
+	ratios   map[string]float64
+	routes   map[string]sdktrace.Sampler
+}
+
+// traceSampler is shared with the config reloader so ratios can change at runtime
+var traceSampler = newRouteSampler()
+
+// newRouteSampler reads TRACE_SAMPLE_RATIO and TRACE_ROUTE_SAMPLE_RATIOS ("/error=1,/=0.01")
+func newRouteSampler() *routeSampler {
+	s := &routeSampler{}
+	s.configure(envFloat("TRACE_SAMPLE_RATIO", 1.0), envString("TRACE_ROUTE_SAMPLE_RATIOS", ""))
+	return s
+}
+
+// configure replaces the default ratio and the per-route ratios
+func (s *routeSampler) configure(ratio float64, routeRatios string) {
+	ratios := map[string]float64{}
+	routes := map[string]sdktrace.Sampler{}
+	for _, pair := range splitList(routeRatios) {
+		route, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if ratio, err := strconv.ParseFloat(value, 64); err == nil {
+			ratios[strings.TrimSpace(route)] = ratio
+			routes[strings.TrimSpace(route)] = sdktrace.TraceIDRatioBased(ratio)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ratio = ratio
+	s.fallback = sdktrace.TraceIDRatioBased(ratio)
+	s.ratios = ratios
+	s.routes = routes
+}
+
+// ratioFor returns the ratio root spans of route are sampled at, and whether
+// it comes from TRACE_ROUTE_SAMPLE_RATIOS rather than the default
+func (s *routeSampler) ratioFor(route string) (ratio float64, perRoute bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if ratio, ok := s.ratios[route]; ok {
+		return ratio, true
+	}
+	return s.ratio, false
+}
+
+func (s *routeSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	s.mu.RLock()
+	sampler, ok := s.routes[routeFromContext(p.ParentContext)]
+	if !ok {
+		sampler = s.fallback
+	}
+	s.mu.RUnlock()
+	return sampler.ShouldSample(p)
+}
+
+func (s *routeSampler) Description() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	routes := make([]string, 0, len(s.routes))
+	for route, sampler := range s.routes {
+		routes = append(routes, route+"="+sampler.Description())
+	}
+	sort.Strings(routes)
+	return fmt.Sprintf("RouteSampler{default=%s,routes=[%s]}", s.fallback.Description(), strings.Join(routes, ","))
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// placeholderTraceID stands in when no trace ID is given and the decision
+// does not depend on it
+var placeholderTraceID = trace.TraceID{0: 1}
+
+// samplingExplanation says which sampling rule applies to a request and why
+type samplingExplanation struct {
+	Route    string       `json:"route,omitempty"`
+	Path     string       `json:"path,omitempty"`
+	Parent   string       `json:"parent"`
+	TraceID  string       `json:"trace_id,omitempty"`
+	Error    bool         `json:"error"`
+	Debug    bool         `json:"debug"`
+	Decision string       `json:"decision"`
+	Rule     string       `json:"rule"`
+	Ratio    *float64     `json:"ratio,omitempty"`
+	Sampler  string       `json:"sampler"`
+	Reasons  []string     `json:"reasons"`
+	Recent   *recentTrace `json:"recent,omitempty"`
+}
+
+// recentTrace is what the recent span buffer holds for a trace ID
+type recentTrace struct {
+	Spans   int    `json:"spans"`
+	Sampled bool   `json:"sampled"`
+	Root    string `json:"root,omitempty"`
+}
+
+// decisionName maps a sampler decision to the explanation's wording
+func decisionName(d sdktrace.SamplingDecision) string {
+	switch d {
+	case sdktrace.RecordAndSample:
+		return "sampled"
+	case sdktrace.RecordOnly:
+		return "recorded_only"
+	}
+	return "dropped"
+}
+
+// explainSampling runs the head sampler on hypothetical inputs, or on a
+// recent trace, and spells out the rule that decided
+func explainSampling(route, path, parent, traceID string, failed, debug bool) (samplingExplanation, error) {
+	e := samplingExplanation{Route: route, Path: path, Parent: parent, Error: failed, Debug: debug, Sampler: headSampler().Description()}
+
+	id := placeholderTraceID
+	if traceID != "" {
+		parsed, err := trace.TraceIDFromHex(traceID)
+		if err != nil {
+			return e, fmt.Errorf("invalid trace_id %q", traceID)
+		}
+		id = parsed
+		e.TraceID = parsed.String()
+
+		if spans := recentSpans.snapshot(e.TraceID); len(spans) > 0 {
+			e.Recent = &recentTrace{Spans: len(spans), Sampled: spans[0].Sampled}
+			inTrace := map[string]bool{}
+			for _, s := range spans {
+				inTrace[s.SpanID] = true
+				// Handler spans carry the route; the server span does not
+				if e.Route == "" && path == "" {
+					e.Route = s.Attributes["http.route"]
+				}
+			}
+			for _, s := range spans {
+				if s.ParentSpanID != "" && inTrace[s.ParentSpanID] {
+					continue
+				}
+				e.Recent.Root = s.Name
+				if e.Parent == "" && s.ParentSpanID != "" {
+					// The first span here continued a caller's trace, so its flag decided
+					e.Parent = "unsampled"
+					if s.Sampled {
+						e.Parent = "sampled"
+					}
+				}
+				break
+			}
+			e.Reasons = append(e.Reasons, fmt.Sprintf("%d spans of this trace are in the recent span buffer (sampled=%t)", len(spans), e.Recent.Sampled))
+		} else {
+			e.Reasons = append(e.Reasons, "the trace is not in the recent span buffer (RECENT_SPANS_SIZE): it aged out, was never recorded, or ran on another instance")
+		}
+	}
+	if e.Parent == "" {
+		e.Parent = "none"
+	}
+
+	if path != "" {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			return e, fmt.Errorf("invalid path %q", path)
+		}
+		if telemetryExcluded(req) {
+			e.Decision, e.Rule = "not_traced", "telemetry_exclude_paths"
+			e.Reasons = append(e.Reasons, "the path matches TELEMETRY_EXCLUDE_PATHS (or is a preflight or OTLP proxy call), so no span is started at all")
+			return e, nil
+		}
+		if e.Route == "" {
+			e.Route = routeOf(req)
+		}
+	}
+
+	ctx := context.WithValue(context.Background(), routeContextKey{}, e.Route)
+	if debug {
+		ctx = context.WithValue(ctx, debugTraceContextKey{}, "header")
+	}
+	switch e.Parent {
+	case "sampled", "unsampled":
+		flags := trace.TraceFlags(0)
+		if e.Parent == "sampled" {
+			flags = trace.FlagsSampled
+		}
+		ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    id,
+			SpanID:     trace.SpanID{0: 1},
+			TraceFlags: flags,
+			Remote:     true,
+		}))
+		e.Rule = "parent_based"
+		e.Reasons = append(e.Reasons, fmt.Sprintf("the request carries a traceparent from an upstream service that was %s; ParentBased follows that decision and ignores the ratios", e.Parent))
+	case "none":
+		ratio, perRoute := traceSampler.ratioFor(e.Route)
+		e.Ratio = &ratio
+		if perRoute {
+			e.Rule = "route_ratio"
+			e.Reasons = append(e.Reasons, fmt.Sprintf("root span of %s, sampled at its TRACE_ROUTE_SAMPLE_RATIOS ratio %g", e.Route, ratio))
+		} else {
+			e.Rule = "default_ratio"
+			e.Reasons = append(e.Reasons, fmt.Sprintf("root span with no per-route ratio for %q, sampled at TRACE_SAMPLE_RATIO %g", e.Route, ratio))
+		}
+	default:
+		return e, fmt.Errorf("parent must be none, sampled or unsampled")
+	}
+
+	result := headSampler().ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: ctx,
+		TraceID:       id,
+		Name:          e.Route,
+		Kind:          trace.SpanKindServer,
+	})
+	e.Decision = decisionName(result.Decision)
+	if debug {
+		e.Rule = "debug_header"
+		e.Reasons = append(e.Reasons, "the DEBUG_TRACE_HEADER header (or debug.trace baggage) forces sampling, overriding the rule above")
+	} else if e.Rule != "parent_based" && e.TraceID == "" && *e.Ratio > 0 && *e.Ratio < 1 {
+		// Ratio decisions hash the trace ID, so without one only the odds are known
+		e.Decision = "probabilistic"
+		e.Reasons = append(e.Reasons, fmt.Sprintf("about %g%% of these traces are kept; pass trace_id to evaluate a specific one", *e.Ratio*100))
+	}
+	if result.Decision == sdktrace.RecordOnly {
+		e.Reasons = append(e.Reasons, "SPAN_METRICS records the span for span metrics, but it is not exported")
+	}
+	if failed {
+		e.Reasons = append(e.Reasons, "errors do not change the decision: it is made when the server span starts, before the outcome is known")
+	}
+	return e, nil
+}
+
+// debugSamplingHandler explains the head sampling decision for ?route= or
+// ?path=, ?parent=none|sampled|unsampled, ?error= and ?debug=, or for a
+// recent ?trace_id=
+func debugSamplingHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	writeJSON := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	if q.Get("route") == "" && q.Get("path") == "" && q.Get("trace_id") == "" {
+		writeJSON(http.StatusBadRequest, errorResponse{Error: "route, path or trace_id is required"})
+		return
+	}
+	failed, _ := strconv.ParseBool(q.Get("error"))
+	debug, _ := strconv.ParseBool(q.Get("debug"))
+
+	e, err := explainSampling(q.Get("route"), q.Get("path"), q.Get("parent"), q.Get("trace_id"), failed, debug)
+	if err != nil {
+		writeJSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(http.StatusOK, e)
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	searchRequests metric.Int64Counter
+	searchDuration metric.Float64Histogram
+	searchTook     metric.Float64Histogram
+)
+
+// initSearchMetrics creates the search dependency instruments
+func initSearchMetrics() error {
+	var err error
+
+	searchRequests, err = meter.Int64Counter(
+		"search_requests_total",
+		metric.WithDescription("Search queries by index and error type (none on success)"),
+	)
+	if err != nil {
+		return err
+	}
+
+	searchDuration, err = meter.Float64Histogram(
+		"search_request_duration_seconds",
+		metric.WithDescription("Client-side duration of search queries, including the network"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	searchTook, err = meter.Float64Histogram(
+		"search_took_seconds",
+		metric.WithDescription("Server-side query time reported by the search cluster (took)"),
+		metric.WithUnit("s"),
+	)
+	return err
+}
+
+// searchError classifies a failed query so dashboards can tell a slow
+// cluster from a bad query or a missing index
+type searchError struct {
+	kind   string
+	status int
+	reason string
+}
+
+func (e *searchError) Error() string {
+	if e.status != 0 {
+		return fmt.Sprintf("search %s (%d): %s", e.kind, e.status, e.reason)
+	}
+	return fmt.Sprintf("search %s: %s", e.kind, e.reason)
+}
+
+// classifySearchFailure maps a transport error or an error response to the
+// error taxonomy: canceled, timeout, connection, bad_query, index_not_found,
+// rejected, unauthorized, server
+func classifySearchFailure(err error, status int, errType, reason string) *searchError {
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case errors.Is(err, context.Canceled):
+			return &searchError{kind: "canceled", reason: err.Error()}
+		case errors.Is(err, errBulkheadFull):
+			return &searchError{kind: "rejected", reason: err.Error()}
+		case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+			return &searchError{kind: "timeout", reason: err.Error()}
+		default:
+			return &searchError{kind: "connection", reason: err.Error()}
+		}
+	}
+
+	e := &searchError{status: status, reason: reason}
+	switch {
+	case errType == "index_not_found_exception":
+		e.kind = "index_not_found"
+	case status == http.StatusTooManyRequests || errType == "es_rejected_execution_exception":
+		e.kind = "rejected"
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		e.kind = "unauthorized"
+	case status == http.StatusBadRequest:
+		e.kind = "bad_query"
+	default:
+		e.kind = "server"
+	}
+	if errType != "" {
+		e.reason = errType + ": " + reason
+	}
+	return e
+}
+
+// searchResult is the part of a _search response /search returns
+type searchResult struct {
+	Took     int  `json:"took"`
+	TimedOut bool `json:"timed_out"`
+	Shards   struct {
+		Total  int `json:"total"`
+		Failed int `json:"failed"`
+	} `json:"_shards"`
+	Hits struct {
+		Total struct {
+			Value    int    `json:"value"`
+			Relation string `json:"relation"`
+		} `json:"total"`
+		Hits []json.RawMessage `json:"hits"`
+	} `json:"hits"`
+}
+
+// searchBackend queries an Elasticsearch or OpenSearch cluster; both speak
+// the same _search API and only differ in the db.system attribute
+type searchBackend struct {
+	url     string
+	system  string
+	indices map[string]bool
+	index   string
+	client  *http.Client
+}
+
+// searcher is built on first use, since SEARCH_URL is read as a secret: the
+// URL may carry credentials
+var searcher = sync.OnceValue(newSearchBackend)
+
+func newSearchBackend() searchBackend {
+	url := secrets.Get("SEARCH_URL")
+	if url == "" {
+		url = "http://elasticsearch:9200"
+	}
+	return searchBackend{
+		url:     strings.TrimSuffix(url, "/"),
+		system:  envString("SEARCH_SYSTEM", "elasticsearch"),
+		index:   envString("SEARCH_INDEX", "otel-logs"),
+		indices: routeSet(envString("SEARCH_INDICES", envString("SEARCH_INDEX", "otel-logs"))),
+		client: &http.Client{
+			Timeout:   envDuration("SEARCH_TIMEOUT", 5*time.Second),
+			Transport: newInstrumentedTransport(),
+		},
+	}
+}
+
+// search runs a query_string query under a span carrying the query shape,
+// the server-side took time and the error taxonomy
+func (s searchBackend) search(ctx context.Context, index, query string, size int) (*searchResult, error) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, "search "+index,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", s.system),
+			attribute.String("db.operation", "search"),
+			attribute.String("db.elasticsearch.index", index),
+			attribute.Int("search.size", size),
+			attribute.Int("search.query_length", len(query)),
+		),
+	)
+	defer span.End()
+
+	result, err := s.query(ctx, index, query, size)
+
+	errorType := "none"
+	var se *searchError
+	if errors.As(err, &se) {
+		errorType = se.kind
+		span.SetAttributes(attribute.String("search.error_type", se.kind))
+		if se.status != 0 {
+			span.SetAttributes(attribute.Int("http.response.status_code", se.status))
+		}
+		// A query abandoned by our own caller is not a search cluster failure
+		if se.kind != "canceled" {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "search "+se.kind)
+		}
+	} else if err != nil {
+		errorType = "decode"
+		span.SetAttributes(attribute.String("search.error_type", errorType))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "search response not decodable")
+	}
+
+	labels := []attribute.KeyValue{attribute.String("index", index), attribute.String("error_type", errorType)}
+	searchRequests.Add(ctx, 1, metric.WithAttributes(labels...))
+	searchDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(labels...))
+
+	if result != nil {
+		span.SetAttributes(
+			attribute.Int("search.took_ms", result.Took),
+			attribute.Bool("search.timed_out", result.TimedOut),
+			attribute.Int("search.hits.total", result.Hits.Total.Value),
+			attribute.Int("search.hits.returned", len(result.Hits.Hits)),
+			attribute.Int("search.shards.total", result.Shards.Total),
+			attribute.Int("search.shards.failed", result.Shards.Failed),
+		)
+		searchTook.Record(ctx, float64(result.Took)/1000, metric.WithAttributes(attribute.String("index", index)))
+		// A partial result is still returned, but flagged on the span
+		if result.TimedOut || result.Shards.Failed > 0 {
+			span.AddEvent("partial_results")
+		}
+	}
+	return result, err
+}
+
+func (s searchBackend) query(ctx context.Context, index, query string, size int) (*searchResult, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"size":  size,
+		"query": map[string]interface{}{"query_string": map[string]string{"query": query}},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+"/"+index+"/_search", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, classifySearchFailure(err, 0, "", "")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		var failure struct {
+			Error struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		}
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		reason := strings.TrimSpace(string(raw))
+		if json.Unmarshal(raw, &failure) == nil && failure.Error.Type != "" {
+			reason = failure.Error.Reason
+		}
+		return nil, classifySearchFailure(nil, resp.StatusCode, failure.Error.Type, reason)
+	}
+
+	var result searchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// searchResponse is the body of GET /search
+type searchResponse struct {
+	Index    string            `json:"index"`
+	TookMs   int               `json:"took_ms"`
+	TimedOut bool              `json:"timed_out"`
+	Total    int               `json:"total"`
+	Hits     []json.RawMessage `json:"hits"`
+}
+
+// searchCredentials are the admin credentials /search requires, loaded on
+// first use
+var searchCredentials = sync.OnceValue(loadAdminCredentials)
+
+// searchHandler serves GET /search?q=...&index=...&size=N. The default index
+// holds every service's log lines, so like /trace/{traceID}/logs it sits
+// behind the admin credentials.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	requireAdminAuth(searchCredentials(), http.HandlerFunc(searchIndex)).ServeHTTP(w, r)
+}
+
+func searchIndex(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	backend := searcher()
+	writeJSON := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		query = "*"
+	}
+	index := r.URL.Query().Get("index")
+	if index == "" {
+		index = backend.index
+	}
+	if !backend.indices[index] {
+		writeJSON(http.StatusBadRequest, errorResponse{Error: "index not allowed by SEARCH_INDICES"})
+		return
+	}
+	size := parseBoundedInt(r, "size", 10, 100)
+
+	result, err := backend.search(ctx, index, query, size)
+	if err != nil && clientDisconnected(ctx) {
+		return
+	}
+	if err != nil {
+		status := http.StatusBadGateway
+		var se *searchError
+		if errors.As(err, &se) {
+			switch se.kind {
+			case "bad_query":
+				status = http.StatusBadRequest
+			case "index_not_found":
+				status = http.StatusNotFound
+			case "timeout":
+				status = http.StatusGatewayTimeout
+			case "rejected":
+				status = http.StatusServiceUnavailable
+			}
+		}
+		logJSON(ctx, "ERROR", "Search failed", map[string]interface{}{
+			"index": index,
+			"error": err.Error(),
+		})
+		writeJSON(status, errorResponse{Error: err.Error()})
+		return
+	}
+
+	writeJSON(http.StatusOK, searchResponse{
+		Index:    index,
+		TookMs:   result.Took,
+		TimedOut: result.TimedOut,
+		Total:    result.Hits.Total.Value,
+		Hits:     result.Hits.Hits,
+	})
+}
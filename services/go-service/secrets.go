@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const redacted = "[REDACTED]"
+
+// minRedactLength is the shortest secret scrubbed wherever it appears; shorter
+// ones are only redacted when they make up the whole value
+const minRedactLength = 4
+
+// vaultRetryInterval is how long a failed Vault fetch is remembered before
+// the next lookup tries again
+const vaultRetryInterval = 10 * time.Second
+
+// secretProvider resolves a named secret; ok is false when it has no value
+type secretProvider interface {
+	lookup(name string) (value string, ok bool, err error)
+}
+
+// envSecrets reads NAME from the environment
+type envSecrets struct{}
+
+func (envSecrets) lookup(name string) (string, bool, error) {
+	v := os.Getenv(name)
+	return v, v != "", nil
+}
+
+// fileSecrets reads the file named by NAME_FILE, or SECRETS_DIR/<name>
+type fileSecrets struct {
+	dir string
+}
+
+func (f fileSecrets) lookup(name string) (string, bool, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" && f.dir != "" {
+		path = filepath.Join(f.dir, strings.ToLower(name))
+		if _, err := os.Stat(path); err != nil {
+			return "", false, nil
+		}
+	}
+	if path == "" {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+// vaultSecrets reads keys from a Vault KV v2 secret at VAULT_SECRET_PATH
+type vaultSecrets struct {
+	addr   string
+	token  string
+	path   string
+	client *http.Client
+
+	mu      sync.Mutex
+	data    map[string]string
+	err     error
+	retryAt time.Time
+}
+
+func (v *vaultSecrets) fetch() (map[string]string, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(v.addr, "/")+"/v1/"+v.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return body.Data.Data, nil
+}
+
+// lookup fetches the secret once it succeeds; a failed fetch is returned to
+// lookups for vaultRetryInterval, then retried, so a Vault outage at startup
+// does not last for the life of the process
+func (v *vaultSecrets) lookup(name string) (string, bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.data == nil && (v.err == nil || !time.Now().Before(v.retryAt)) {
+		v.data, v.err = v.fetch()
+		if v.err != nil {
+			v.retryAt = time.Now().Add(vaultRetryInterval)
+		} else if v.data == nil {
+			v.data = map[string]string{}
+		}
+	}
+	if v.err != nil {
+		return "", false, v.err
+	}
+	value, ok := v.data[name]
+	return value, ok && value != "", nil
+}
+
+// secretStore resolves secrets through the provider chain and remembers every
+// value handed out so it can be scrubbed from logs and spans
+type secretStore struct {
+	providers []secretProvider
+
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+var secrets = newSecretStore()
+
+func newSecretStore() *secretStore {
+	s := &secretStore{
+		providers: []secretProvider{envSecrets{}, fileSecrets{dir: os.Getenv("SECRETS_DIR")}},
+		values:    map[string]string{},
+	}
+	if addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN"); addr != "" && token != "" {
+		s.providers = append(s.providers, &vaultSecrets{
+			addr:   addr,
+			token:  token,
+			path:   envString("VAULT_SECRET_PATH", "secret/data/go-service"),
+			client: &http.Client{Timeout: 5 * time.Second},
+		})
+	}
+	return s
+}
+
+// Get returns the first value found for name, or "" when no provider has it
+func (s *secretStore) Get(name string) string {
+	for _, p := range s.providers {
+		value, ok, err := p.lookup(name)
+		if err != nil {
+			logJSON(context.Background(), "ERROR", "Failed to load secret", map[string]interface{}{
+				"secret": name,
+				"error":  err.Error(),
+			})
+			continue
+		}
+		if ok {
+			s.mu.Lock()
+			s.values[name] = value
+			s.mu.Unlock()
+			return value
+		}
+	}
+	return ""
+}
+
+// Redact replaces any known secret value in text. Values shorter than
+// minRedactLength are only replaced when they are the whole text, so they
+// cannot mangle unrelated output.
+func (s *secretStore) Redact(text string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, value := range s.values {
+		switch {
+		case value == "":
+		case text == value:
+			return redacted
+		case len(value) >= minRedactLength && strings.Contains(text, value):
+			text = strings.ReplaceAll(text, value, redacted)
+		}
+	}
+	return text
+}
+
+func (s *secretStore) empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.values) == 0
+}
+
+// parseHeaders turns "k1=v1,k2=v2" (OTEL_EXPORTER_OTLP_HEADERS format) into a map
+func parseHeaders(value string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range splitList(value) {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return headers
+}
+
+// redactingExporter scrubs secret values from span, event and link attributes
+// and the status description before export
+type redactingExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (e redactingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if secrets.empty() {
+		return e.SpanExporter.ExportSpans(ctx, spans)
+	}
+	scrubbed := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, s := range spans {
+		scrubbed[i] = redactedSpan{s}
+	}
+	return e.SpanExporter.ExportSpans(ctx, scrubbed)
+}
+
+// redactedSpan overrides the accessors of a finished span that carry strings
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+// redactAttributes returns attrs itself when nothing needs redacting, which
+// is nearly every span; it is only copied once a value changes
+func redactAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	out, copied := attrs, false
+	for i, kv := range attrs {
+		clean, changed := redactValue(kv)
+		if !changed {
+			continue
+		}
+		if !copied {
+			out, copied = append([]attribute.KeyValue(nil), attrs...), true
+		}
+		out[i] = clean
+	}
+	return out
+}
+
+// redactValue scrubs a string or string slice attribute
+func redactValue(kv attribute.KeyValue) (attribute.KeyValue, bool) {
+	switch kv.Value.Type() {
+	case attribute.STRING:
+		if clean := secrets.Redact(kv.Value.AsString()); clean != kv.Value.AsString() {
+			return kv.Key.String(clean), true
+		}
+	case attribute.STRINGSLICE:
+		values := kv.Value.AsStringSlice()
+		changed := false
+		for i, v := range values {
+			if clean := secrets.Redact(v); clean != v {
+				values[i], changed = clean, true
+			}
+		}
+		if changed {
+			return kv.Key.StringSlice(values), true
+		}
+	}
+	return kv, false
+}
+
+func (s redactedSpan) Attributes() []attribute.KeyValue {
+	return redactAttributes(s.ReadOnlySpan.Attributes())
+}
+
+func (s redactedSpan) Events() []sdktrace.Event {
+	events := s.ReadOnlySpan.Events()
+	out := make([]sdktrace.Event, len(events))
+	for i, ev := range events {
+		ev.Attributes = redactAttributes(ev.Attributes)
+		out[i] = ev
+	}
+	return out
+}
+
+func (s redactedSpan) Links() []sdktrace.Link {
+	links := s.ReadOnlySpan.Links()
+	out := make([]sdktrace.Link, len(links))
+	for i, l := range links {
+		l.Attributes = redactAttributes(l.Attributes)
+		out[i] = l
+	}
+	return out
+}
+
+func (s redactedSpan) Status() sdktrace.Status {
+	status := s.ReadOnlySpan.Status()
+	status.Description = secrets.Redact(status.Description)
+	return status
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// withSecrets swaps the process secret store for one holding values
+func withSecrets(t *testing.T, values map[string]string) {
+	t.Helper()
+	saved := secrets
+	secrets = &secretStore{values: values}
+	t.Cleanup(func() { secrets = saved })
+}
+
+func TestRedact(t *testing.T) {
+	withSecrets(t, map[string]string{
+		"API_TOKEN": "s3cr3t-token",
+		"PIN":       "42x",
+		"EMPTY":     "",
+	})
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"whole value", "s3cr3t-token", redacted},
+		{"embedded value", "Authorization: Bearer s3cr3t-token", "Authorization: Bearer " + redacted},
+		{"repeated value", "s3cr3t-token/s3cr3t-token", redacted + "/" + redacted},
+		{"short whole value", "42x", redacted},
+		{"short embedded value kept", "order 42x7 shipped", "order 42x7 shipped"},
+		{"no secret", "nothing to see", "nothing to see"},
+		{"empty text", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := secrets.Redact(tt.in); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactAttributes(t *testing.T) {
+	withSecrets(t, map[string]string{"DB_PASSWORD": "hunter22"})
+
+	tests := []struct {
+		name string
+		in   attribute.KeyValue
+		want attribute.KeyValue
+	}{
+		{"string", attribute.String("db.url", "postgres://app:hunter22@db"), attribute.String("db.url", "postgres://app:"+redacted+"@db")},
+		{"string slice", attribute.StringSlice("args", []string{"-p", "hunter22"}), attribute.StringSlice("args", []string{"-p", redacted})},
+		{"clean string", attribute.String("route", "/data"), attribute.String("route", "/data")},
+		{"int", attribute.Int("status", 200), attribute.Int("status", 200)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactAttributes([]attribute.KeyValue{tt.in})
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("redactAttributes(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactAttributesKeepsInput(t *testing.T) {
+	withSecrets(t, map[string]string{"DB_PASSWORD": "hunter22"})
+
+	attrs := []attribute.KeyValue{attribute.StringSlice("args", []string{"hunter22"})}
+	redactAttributes(attrs)
+	if got := attrs[0].Value.AsStringSlice()[0]; got != "hunter22" {
+		t.Errorf("input attribute modified to %q", got)
+	}
+}
+
+func TestRedactedSpan(t *testing.T) {
+	const secret = "hunter22"
+	withSecrets(t, map[string]string{"DB_PASSWORD": secret})
+
+	span := redactedSpan{tracetest.SpanStub{
+		Name:       "query",
+		Attributes: []attribute.KeyValue{attribute.String("db.statement", "login "+secret)},
+		Events: []sdktrace.Event{{
+			Name:       "exception",
+			Attributes: []attribute.KeyValue{attribute.StringSlice("exception.args", []string{secret})},
+		}},
+		Links: []sdktrace.Link{{
+			Attributes: []attribute.KeyValue{attribute.String("peer", "user:"+secret)},
+		}},
+		Status: sdktrace.Status{Code: codes.Error, Description: "auth failed for " + secret},
+	}.Snapshot()}
+
+	tests := []struct {
+		name  string
+		value func() string
+	}{
+		{"attributes", func() string { return attrString(span.Attributes()) }},
+		{"event attributes", func() string { return attrString(span.Events()[0].Attributes) }},
+		{"link attributes", func() string { return attrString(span.Links()[0].Attributes) }},
+		{"status description", func() string { return span.Status().Description }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.value()
+			if strings.Contains(got, secret) || !strings.Contains(got, redacted) {
+				t.Errorf("%s not redacted: %q", tt.name, got)
+			}
+		})
+	}
+}
+
+func TestDebugTracesRedacted(t *testing.T) {
+	const secret = "hunter22"
+	withSecrets(t, map[string]string{"DB_PASSWORD": secret})
+	saved := recentSpans
+	recentSpans = newRecentSpanProcessor(10)
+	t.Cleanup(func() { recentSpans = saved })
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recentSpans))
+	defer tp.Shutdown(context.Background())
+	_, span := tp.Tracer("test").Start(context.Background(), "query")
+	span.SetAttributes(attribute.String("db.statement", "login "+secret))
+	span.SetStatus(codes.Error, "auth failed for "+secret)
+	span.End()
+
+	for _, format := range []string{"json", "html"} {
+		rec := httptest.NewRecorder()
+		debugTracesHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/traces?format="+format, nil))
+		body := rec.Body.String()
+		if strings.Contains(body, secret) || !strings.Contains(body, redacted) {
+			t.Errorf("/debug/traces as %s not redacted: %s", format, body)
+		}
+	}
+}
+
+func attrString(attrs []attribute.KeyValue) string {
+	var b strings.Builder
+	for _, kv := range attrs {
+		b.WriteString(string(kv.Key) + "=" + kv.Value.Emit() + " ")
+	}
+	return b.String()
+}
+
+func TestVaultSecretsRetriesFailedFetch(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "sealed", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"API_TOKEN":"from-vault"}}}`))
+	}))
+	defer srv.Close()
+
+	v := &vaultSecrets{addr: srv.URL, token: "t", path: "secret/data/go-service", client: srv.Client()}
+	if _, _, err := v.lookup("API_TOKEN"); err == nil {
+		t.Fatal("lookup succeeded against a failing Vault")
+	}
+	if _, _, err := v.lookup("API_TOKEN"); err == nil || calls.Load() != 1 {
+		t.Fatalf("lookup within the retry interval: err %v after %d fetches, want the cached error after 1", err, calls.Load())
+	}
+
+	v.retryAt = time.Now()
+	value, ok, err := v.lookup("API_TOKEN")
+	if err != nil || !ok || value != "from-vault" {
+		t.Fatalf("lookup after the retry interval = %q, %v, %v; want from-vault", value, ok, err)
+	}
+	v.lookup("API_TOKEN")
+	if calls.Load() != 2 {
+		t.Errorf("Vault fetched %d times, want 2", calls.Load())
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// selftestMarkerMetric is the gauge set to the time of the last self-test;
+// the prometheus exporter may prefix it with a namespace
+const selftestMarkerMetric = "selftest_marker_timestamp_seconds"
+
+// selftestMarker is the Unix time, in seconds, of the last self-test marker
+var selftestMarker atomic.Int64
+
+// initSelftestMetrics creates the self-test marker gauge
+func initSelftestMetrics() error {
+	marker, err := meter.Int64ObservableGauge(
+		selftestMarkerMetric,
+		metric.WithDescription("Unix time of the last /selftest marker, looked up in Prometheus to confirm metrics arrive"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		if s := selftestMarker.Load(); s > 0 {
+			o.ObserveInt64(marker, s)
+		}
+		return nil
+	}, marker)
+	return err
+}
+
+// selftestClient queries the backends; its calls are traced like any other
+var selftestClient = &http.Client{
+	Timeout:   5 * time.Second,
+	Transport: newInstrumentedTransport(),
+}
+
+// selftestCheck is the outcome for one signal. Status is "exported" when
+// the collector accepted it and nothing was verified, "arrived" when the
+// backend has it, or "export_failed", "missing", "error" or "skipped".
+type selftestCheck struct {
+	Signal    string  `json:"signal"`
+	Backend   string  `json:"backend,omitempty"`
+	Status    string  `json:"status"`
+	Detail    string  `json:"detail,omitempty"`
+	ArrivalMs float64 `json:"arrival_ms,omitempty"`
+}
+
+func (c selftestCheck) failed() bool {
+	return c.Status != "exported" && c.Status != "arrived" && c.Status != "skipped"
+}
+
+// selftestResult is the body of /selftest
+type selftestResult struct {
+	ID       string          `json:"id"`
+	TraceID  string          `json:"trace_id"`
+	Verified bool            `json:"verified"`
+	Passed   bool            `json:"passed"`
+	Checks   []selftestCheck `json:"checks"`
+}
+
+// flusher is implemented by the SDK tracer and meter providers
+type flusher interface {
+	ForceFlush(ctx context.Context) error
+}
+
+// selftestBackend confirms that a marker reached a backend; found is false
+// until it has
+type selftestBackend struct {
+	signal string
+	name   string
+	found  func(ctx context.Context) (bool, error)
+}
+
+// selftestBackends are the lookups for the marker's trace, metric and log;
+// an empty SELFTEST_TEMPO_URL, SELFTEST_PROMETHEUS_URL or a LOG_LOOKUP_BACKEND
+// of "none" skips that signal
+func selftestBackends(traceID string, marker int64) map[string]selftestBackend {
+	backends := map[string]selftestBackend{}
+	if tempo := strings.TrimSuffix(envString("SELFTEST_TEMPO_URL", "http://tempo:3200"), "/"); tempo != "" {
+		backends["traces"] = selftestBackend{signal: "traces", name: "tempo", found: func(ctx context.Context) (bool, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, tempo+"/api/traces/"+traceID, nil)
+			if err != nil {
+				return false, err
+			}
+			status, err := selftestGet(req, nil)
+			if status == http.StatusNotFound {
+				return false, nil
+			}
+			return err == nil, err
+		}}
+	}
+	if prom := strings.TrimSuffix(envString("SELFTEST_PROMETHEUS_URL", "http://prometheus:9090"), "/"); prom != "" {
+		backends["metrics"] = selftestBackend{signal: "metrics", name: "prometheus", found: func(ctx context.Context) (bool, error) {
+			query := fmt.Sprintf(`max({__name__=~".*%s"})`, selftestMarkerMetric)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, prom+"/api/v1/query?"+url.Values{"query": {query}}.Encode(), nil)
+			if err != nil {
+				return false, err
+			}
+			var result struct {
+				Data struct {
+					Result []struct {
+						Value [2]interface{} `json:"value"`
+					} `json:"result"`
+				} `json:"data"`
+			}
+			if _, err := selftestGet(req, &result); err != nil {
+				return false, err
+			}
+			for _, r := range result.Data.Result {
+				s, _ := r.Value[1].(string)
+				if v, err := strconv.ParseFloat(s, 64); err == nil && int64(v) >= marker {
+					return true, nil
+				}
+			}
+			return false, nil
+		}}
+	}
+	if logLookupBackend != nil {
+		backends["logs"] = selftestBackend{signal: "logs", name: logLookupBackend.name(), found: func(ctx context.Context) (bool, error) {
+			lines, err := logLookupBackend.lookup(ctx, traceID, 1)
+			return len(lines) > 0, err
+		}}
+	}
+	return backends
+}
+
+// selftestGet sends req and decodes a 2xx JSON response into out when it
+// is set; the status is returned either way
+func selftestGet(req *http.Request, out interface{}) (int, error) {
+	resp, err := selftestClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// runSelftest emits a marker span, metric and log, flushes them to the
+// collector and, when verify is set, polls the backends until each marker
+// shows up. The flush and the polls share one deadline, timeout from the
+// start, so the whole self-test ends within it.
+func runSelftest(ctx context.Context, verify bool, timeout time.Duration) selftestResult {
+	start := time.Now()
+	deadlineCtx, cancel := context.WithDeadline(ctx, start.Add(timeout))
+	defer cancel()
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	// The debug flag keeps the marker trace whatever the sampling ratio,
+	// and its log whatever LOG_LEVEL
+	markerCtx := context.WithValue(context.WithoutCancel(ctx), debugTraceContextKey{}, "selftest")
+	markerCtx, span := tracer.Start(markerCtx, "selftest_marker")
+	span.SetAttributes(attribute.String("selftest.id", id))
+	traceID := span.SpanContext().TraceID().String()
+	marker := time.Now().Unix()
+	selftestMarker.Store(marker)
+	logJSON(markerCtx, "INFO", "Self-test marker", map[string]interface{}{"selftest_id": id})
+	span.End()
+
+	// Flush so the markers do not wait for the next batch or export
+	// interval; the export trackers confirm the collector accepted them
+	flushed := map[string]error{}
+	for signal, provider := range map[string]interface{}{"traces": otel.GetTracerProvider(), "metrics": otel.GetMeterProvider()} {
+		f, ok := provider.(flusher)
+		if !ok {
+			flushed[signal] = fmt.Errorf("%s provider is not initialized", signal)
+			continue
+		}
+		flushed[signal] = f.ForceFlush(deadlineCtx)
+	}
+	endpoints := map[string]string{"traces": traceEndpoint(), "metrics": metricEndpoint()}
+	for signal, last := range map[string]*atomic.Int64{"traces": &lastTraceExport, "metrics": &lastMetricExport} {
+		if flushed[signal] == nil && last.Load() < start.UnixNano() {
+			flushed[signal] = fmt.Errorf("not accepted by %s", endpoints[signal])
+		}
+	}
+
+	result := selftestResult{ID: id, TraceID: traceID, Verified: verify, Passed: true}
+	backends := selftestBackends(traceID, marker)
+	checks := make([]selftestCheck, 3)
+	var wg sync.WaitGroup
+	for i, signal := range []string{"traces", "metrics", "logs"} {
+		check := selftestCheck{Signal: signal, Status: "exported"}
+		if err := flushed[signal]; err != nil {
+			check.Status, check.Detail = "export_failed", err.Error()
+		} else if signal == "logs" {
+			// Logs go to stdout and reach the backend through the log shipper
+			check.Status, check.Detail = "skipped", "written to stdout"
+		}
+		backend, ok := backends[signal]
+		if !verify || check.Status == "export_failed" {
+			checks[i] = check
+			continue
+		}
+		if !ok {
+			check.Status, check.Detail = "skipped", "no backend configured"
+			checks[i] = check
+			continue
+		}
+		check.Backend = backend.name
+
+		wg.Add(1)
+		go func(i int, check selftestCheck) {
+			defer wg.Done()
+			checks[i] = pollSelftestBackend(deadlineCtx, backend, check, start, timeout)
+		}(i, check)
+	}
+	wg.Wait()
+
+	result.Checks = checks
+	for _, c := range checks {
+		if c.failed() {
+			result.Passed = false
+		}
+	}
+	return result
+}
+
+// pollSelftestBackend asks the backend for the marker every
+// SELFTEST_POLL_INTERVAL until it is found or ctx, which carries the
+// self-test deadline, is done
+func pollSelftestBackend(ctx context.Context, backend selftestBackend, check selftestCheck, start time.Time, timeout time.Duration) selftestCheck {
+	ticker := time.NewTicker(envDuration("SELFTEST_POLL_INTERVAL", time.Second))
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		found, err := backend.found(ctx)
+		if found {
+			check.Status, check.Detail = "arrived", ""
+			check.ArrivalMs = float64(time.Since(start).Microseconds()) / 1000
+			return check
+		}
+		if err != nil && ctx.Err() == nil {
+			lastErr = err
+		}
+		select {
+		case <-ctx.Done():
+			check.Status = "missing"
+			check.Detail = fmt.Sprintf("not found in %s within %s", backend.name, timeout)
+			if lastErr != nil {
+				check.Status, check.Detail = "error", lastErr.Error()
+			}
+			return check
+		case <-ticker.C:
+		}
+	}
+}
+
+// selftestHandler serves /selftest: it emits marker telemetry and, unless
+// ?verify=false, waits up to ?timeout= (SELFTEST_TIMEOUT), at most
+// SELFTEST_MAX_TIMEOUT, for it to reach the backends. It answers 200 when
+// every check passed and 503 otherwise.
+func selftestHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	verify := true
+	if v, err := strconv.ParseBool(q.Get("verify")); err == nil {
+		verify = v
+	}
+	timeout := envDuration("SELFTEST_TIMEOUT", 30*time.Second)
+	if t, err := time.ParseDuration(q.Get("timeout")); err == nil && t > 0 {
+		timeout = t
+	}
+	timeout = min(timeout, envDuration("SELFTEST_MAX_TIMEOUT", 2*time.Minute))
+
+	result := runSelftest(r.Context(), verify, timeout)
+	logJSON(r.Context(), "INFO", "Self-test finished", map[string]interface{}{
+		"selftest_id": result.ID,
+		"passed":      result.Passed,
+		"verified":    result.Verified,
+	})
+
+	status := http.StatusOK
+	if !result.Passed {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
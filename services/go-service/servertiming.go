@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type timingContextKey struct{}
+
+// timingPhase is one named duration reported in the Server-Timing header
+type timingPhase struct {
+	name     string
+	duration time.Duration
+}
+
+// serverTimings collects the phases recorded by handlers for one request
+type serverTimings struct {
+	mu     sync.Mutex
+	phases []timingPhase
+}
+
+// recordTiming adds a phase to the request's Server-Timing header; phases
+// recorded after the response headers are written are dropped
+func recordTiming(ctx context.Context, name string, d time.Duration) {
+	if t, ok := ctx.Value(timingContextKey{}).(*serverTimings); ok {
+		t.mu.Lock()
+		t.phases = append(t.phases, timingPhase{name: name, duration: d})
+		t.mu.Unlock()
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.1f", float64(d.Microseconds())/1000)
+}
+
+// timingWriter sets the Server-Timing and trace headers just before the
+// response headers go out
+type timingWriter struct {
+	http.ResponseWriter
+	r             *http.Request
+	start         time.Time
+	timings       *serverTimings
+	traceHeaders  bool
+	headerWritten bool
+}
+
+func (t *timingWriter) writeTimingHeaders() {
+	if t.headerWritten {
+		return
+	}
+	t.headerWritten = true
+
+	entries := []string{"app;dur=" + formatDuration(time.Since(t.start))}
+	t.timings.mu.Lock()
+	for _, p := range t.timings.phases {
+		entries = append(entries, p.name+";dur="+formatDuration(p.duration))
+	}
+	t.timings.mu.Unlock()
+
+	h := t.Header()
+	sc := trace.SpanContextFromContext(t.r.Context())
+	if sc.IsValid() {
+		traceparent := fmt.Sprintf("00-%s-%s-%02x", sc.TraceID(), sc.SpanID(), byte(sc.TraceFlags()))
+		entries = append(entries, fmt.Sprintf("traceparent;desc=%q", traceparent))
+		if t.traceHeaders {
+			h.Set("traceparent", traceparent)
+			h.Set("X-Trace-Id", sc.TraceID().String())
+		}
+	}
+	h.Set("Server-Timing", strings.Join(entries, ", "))
+}
+
+func (t *timingWriter) WriteHeader(code int) {
+	t.writeTimingHeaders()
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *timingWriter) Write(b []byte) (int, error) {
+	t.writeTimingHeaders()
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *timingWriter) Flush() {
+	t.writeTimingHeaders()
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (t *timingWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// serverTiming emits a Server-Timing header with the total handler time, any
+// phases recorded via recordTiming and the trace ID, so browser devtools can
+// link a response to its backend trace. SERVER_TIMING_TRACE_HEADERS also sets
+// traceparent and X-Trace-Id response headers.
+func serverTiming(next http.Handler) http.Handler {
+	if !envBool("SERVER_TIMING", true) {
+		return next
+	}
+	traceHeaders := envBool("SERVER_TIMING_TRACE_HEADERS", false)
+	allowOrigin := envString("SERVER_TIMING_ALLOW_ORIGIN", "*")
+
+	exposed := "Server-Timing"
+	if traceHeaders {
+		exposed += ", traceparent, X-Trace-Id"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if telemetryExcluded(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Cross-origin pages only see timings and headers that are explicitly allowed
+		if allowOrigin != "" {
+			w.Header().Set("Timing-Allow-Origin", allowOrigin)
+		}
+		w.Header().Add("Access-Control-Expose-Headers", exposed)
+
+		timings := &serverTimings{}
+		ctx := context.WithValue(r.Context(), timingContextKey{}, timings)
+		r = r.WithContext(ctx)
+
+		tw := &timingWriter{
+			ResponseWriter: w,
+			r:              r,
+			start:          time.Now(),
+			timings:        timings,
+			traceHeaders:   traceHeaders,
+		}
+		next.ServeHTTP(tw, r)
+		tw.writeTimingHeaders()
+	})
+}
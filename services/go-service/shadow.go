@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"go-service/workerpool"
+)
+
+var (
+	shadowRequests     metric.Int64Counter
+	shadowLatencyDelta metric.Float64Histogram
+)
+
+// initShadowMetrics creates the mirror outcome and divergence instruments
+func initShadowMetrics() error {
+	var err error
+
+	shadowRequests, err = meter.Int64Counter(
+		"shadow_requests_total",
+		metric.WithDescription("Mirrored requests by result (match, status_mismatch, body_mismatch, error, dropped)"),
+	)
+	if err != nil {
+		return err
+	}
+
+	shadowLatencyDelta, err = meter.Float64Histogram(
+		"shadow_latency_delta_seconds",
+		metric.WithDescription("Shadow latency minus primary latency"),
+		metric.WithUnit("s"),
+	)
+	return err
+}
+
+// shadowConfig selects which requests are mirrored and where
+type shadowConfig struct {
+	target  *url.URL
+	routes  map[string]bool
+	ratio   float64
+	maxBody int64
+	pool    *workerpool.Pool
+	client  *http.Client
+	compare bool
+}
+
+// loadShadowConfig returns nil when SHADOW_URL is unset or invalid
+func loadShadowConfig() *shadowConfig {
+	raw := os.Getenv("SHADOW_URL")
+	if raw == "" {
+		return nil
+	}
+	target, err := url.Parse(raw)
+	if err != nil {
+		logJSON(context.Background(), "ERROR", "Invalid SHADOW_URL", map[string]interface{}{"error": err.Error()})
+		return nil
+	}
+	return &shadowConfig{
+		target:  target,
+		routes:  routeSet(envString("SHADOW_ROUTES", "/,/data")),
+		ratio:   envFloat("SHADOW_SAMPLE_RATIO", 1.0),
+		maxBody: int64(envInt("SHADOW_MAX_BODY_BYTES", 64*1024)),
+		pool: workerpool.New(workerpool.Config{
+			Name:      "shadow",
+			Workers:   envInt("SHADOW_MAX_IN_FLIGHT", 50),
+			QueueSize: envInt("SHADOW_QUEUE_SIZE", 0),
+			Go:        goWithCrashReport,
+		}),
+		client: &http.Client{
+			Timeout:   envDuration("SHADOW_TIMEOUT", 5*time.Second),
+			Transport: newInstrumentedTransport(),
+		},
+		compare: envBool("SHADOW_COMPARE_BODY", true),
+	}
+}
+
+// hashingWriter hashes the primary response body for comparison with the shadow
+type hashingWriter struct {
+	*statusRecorder
+	hash hash.Hash
+}
+
+func (h *hashingWriter) Write(b []byte) (int, error) {
+	n, err := h.statusRecorder.Write(b)
+	h.hash.Write(b[:n])
+	return n, err
+}
+
+// shadowOutcome is what the primary request produced
+type shadowOutcome struct {
+	status   int
+	bodyHash []byte
+	latency  time.Duration
+}
+
+// send replays the request against the mirror and compares the result with
+// the primary; it runs on the shadow worker pool, in the shadow_request span
+func (c *shadowConfig) send(ctx context.Context, route string, req *http.Request, primary shadowOutcome) error {
+	span := trace.SpanFromContext(ctx)
+
+	start := time.Now()
+	result := "match"
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		result = "error"
+	} else {
+		hasher := sha256.New()
+		io.Copy(hasher, resp.Body)
+		resp.Body.Close()
+		latency := time.Since(start)
+
+		span.SetAttributes(
+			attribute.Int("shadow.status", resp.StatusCode),
+			attribute.Int("shadow.primary_status", primary.status),
+			attribute.Float64("shadow.latency_delta_seconds", (latency-primary.latency).Seconds()),
+		)
+		shadowLatencyDelta.Record(ctx, (latency - primary.latency).Seconds(), metric.WithAttributes(
+			attribute.String("endpoint", route),
+		))
+
+		switch {
+		case resp.StatusCode != primary.status:
+			result = "status_mismatch"
+		case c.compare && !bytes.Equal(hasher.Sum(nil), primary.bodyHash):
+			result = "body_mismatch"
+		}
+	}
+
+	span.SetAttributes(attribute.String("shadow.result", result))
+	shadowRequests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("endpoint", route),
+		attribute.String("result", result),
+	))
+	if result != "match" {
+		logJSON(ctx, "WARN", "Shadow response diverged", map[string]interface{}{
+			"endpoint": route,
+			"result":   result,
+		})
+	}
+	// Only a failed request fails the task; divergence is counted above
+	return err
+}
+
+// shadowTraffic asynchronously mirrors SHADOW_ROUTES to SHADOW_URL. The
+// shadow runs in its own trace linked to the primary span, and its status
+// and body are compared with the primary response; the shadow response is
+// never returned to the client.
+func shadowTraffic(next http.Handler) http.Handler {
+	cfg := loadShadowConfig()
+	if cfg == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeOf(r)
+		// Mirroring pauses in protective mode
+		if !cfg.routes[route] || workloadRand.Float64() >= cfg.ratio || r.Header.Get("X-Shadow-Request") != "" || protectiveMode() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Buffer the body so both requests can read it; larger bodies are not mirrored
+		var body []byte
+		if r.Body != nil && r.ContentLength != 0 {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, cfg.maxBody+1))
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+			if err != nil || int64(len(body)) > cfg.maxBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		ctx := r.Context()
+		primarySpan := trace.SpanFromContext(ctx)
+		start := time.Now()
+		hw := &hashingWriter{statusRecorder: newStatusRecorder(w), hash: sha256.New()}
+		next.ServeHTTP(hw, r)
+		primary := shadowOutcome{status: hw.status, bodyHash: hw.hash.Sum(nil), latency: time.Since(start)}
+
+		u := *cfg.target
+		u.Path = r.URL.Path
+		u.RawQuery = r.URL.RawQuery
+		req, err := http.NewRequest(r.Method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header = r.Header.Clone()
+		req.Header.Set("X-Shadow-Request", "true")
+
+		shadow, err := cfg.pool.TrySubmit(ctx, "shadow_request",
+			func(ctx context.Context) error { return cfg.send(ctx, route, req, primary) },
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("http.route", route),
+				attribute.String("shadow.target", cfg.target.Host),
+			),
+		)
+		if err != nil {
+			shadowRequests.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("endpoint", route),
+				attribute.String("result", "dropped"),
+			))
+			return
+		}
+		primarySpan.SetAttributes(attribute.String("shadow.trace_id", shadow.TraceID().String()))
+	})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var slowRequestCounter metric.Int64Counter
+
+// initSlowRequestMetrics creates the per-route slow request counter
+func initSlowRequestMetrics() error {
+	var err error
+	slowRequestCounter, err = meter.Int64Counter(
+		"slow_requests_total",
+		metric.WithDescription("Requests slower than SLOW_REQUEST_THRESHOLD (or the route override)"),
+	)
+	return err
+}
+
+// slowThresholds flags requests slower than a default or per-route threshold
+type slowThresholds struct {
+	threshold time.Duration
+	overrides map[string]time.Duration
+}
+
+var slowRequestThresholds = slowThresholds{
+	threshold: envDuration("SLOW_REQUEST_THRESHOLD", time.Second),
+	overrides: routeDurations(envString("SLOW_REQUEST_ROUTE_THRESHOLDS", "/poll=0,/download=0,/burn=0")),
+}
+
+func (t slowThresholds) thresholdFor(route string) time.Duration {
+	if d, ok := t.overrides[route]; ok {
+		return d
+	}
+	return t.threshold
+}
+
+// flagSlowRequest marks a request over its threshold on the span, in the logs
+// and in slow_requests_total; a zero threshold disables flagging for the route
+func flagSlowRequest(ctx context.Context, route, method string, status int, duration time.Duration) {
+	threshold := slowRequestThresholds.thresholdFor(route)
+	if threshold <= 0 || duration <= threshold {
+		return
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Bool("slow", true),
+		attribute.Float64("slow.threshold_seconds", threshold.Seconds()),
+	)
+	span.AddEvent("slow_request", trace.WithAttributes(
+		attribute.Float64("slow.duration_seconds", duration.Seconds()),
+	))
+
+	if label, ok := metricRoute(route); ok {
+		slowRequestCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("endpoint", label),
+			attribute.String("method", method),
+		))
+	}
+
+	logJSON(ctx, "WARN", "Slow request", map[string]interface{}{
+		"endpoint":          route,
+		"method":            method,
+		"status":            status,
+		"duration_seconds":  duration.Seconds(),
+		"threshold_seconds": threshold.Seconds(),
+	})
+}
+
+// slowRequest is one entry in the slow request log
+type slowRequest struct {
+	Route      string    `json:"route"`
+	Method     string    `json:"method"`
+	Status     int       `json:"status"`
+	DurationMs float64   `json:"duration_ms"`
+	TraceID    string    `json:"trace_id,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// slowLog keeps the N slowest requests seen within a sliding window
+type slowLog struct {
+	mu      sync.Mutex
+	size    int
+	window  time.Duration
+	min     time.Duration
+	entries []slowRequest
+}
+
+var slowRequests = &slowLog{
+	size:   envInt("SLOW_LOG_SIZE", 20),
+	window: envDuration("SLOW_LOG_WINDOW", 15*time.Minute),
+	min:    envDuration("SLOW_LOG_MIN_DURATION", 100*time.Millisecond),
+}
+
+// prune drops entries older than the window; callers must hold mu
+func (s *slowLog) prune(now time.Time) {
+	kept := s.entries[:0]
+	for _, e := range s.entries {
+		if now.Sub(e.Timestamp) <= s.window {
+			kept = append(kept, e)
+		}
+	}
+	s.entries = kept
+}
+
+// record keeps the request if it is among the slowest N recent ones
+func (s *slowLog) record(e slowRequest, duration time.Duration) {
+	if duration < s.min || s.size <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(e.Timestamp)
+	if len(s.entries) < s.size {
+		s.entries = append(s.entries, e)
+		return
+	}
+
+	fastest := 0
+	for i, existing := range s.entries {
+		if existing.DurationMs < s.entries[fastest].DurationMs {
+			fastest = i
+		}
+	}
+	if e.DurationMs > s.entries[fastest].DurationMs {
+		s.entries[fastest] = e
+	}
+}
+
+// snapshot returns the recent slow requests, slowest first
+func (s *slowLog) snapshot() []slowRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(time.Now())
+	out := make([]slowRequest, len(s.entries))
+	copy(out, s.entries)
+	sort.Slice(out, func(i, j int) bool { return out[i].DurationMs > out[j].DurationMs })
+	return out
+}
+
+// trackSlowRequests flags requests over the slow threshold and records
+// request durations into the slow request log and the latency digest
+func trackSlowRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if telemetryExcluded(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := newStatusRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		route := routeOf(r)
+		flagSlowRequest(r.Context(), route, r.Method, rec.status, duration)
+		latencyDigests.record(route, duration, rec.status >= 500)
+
+		entry := slowRequest{
+			Route:      route,
+			Method:     r.Method,
+			Status:     rec.status,
+			DurationMs: float64(duration.Microseconds()) / 1000,
+			Timestamp:  start,
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			entry.TraceID = sc.TraceID().String()
+		}
+		slowRequests.record(entry, duration)
+	})
+}
+
+// slowRequestsResponse is the body of GET /admin/slow
+type slowRequestsResponse struct {
+	WindowSeconds float64       `json:"window_seconds"`
+	Count         int           `json:"count"`
+	Requests      []slowRequest `json:"requests"`
+}
+
+func adminSlowHandler(w http.ResponseWriter, r *http.Request) {
+	entries := slowRequests.snapshot()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slowRequestsResponse{
+		WindowSeconds: slowRequests.window.Seconds(),
+		Count:         len(entries),
+		Requests:      entries,
+	})
+}
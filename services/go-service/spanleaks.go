@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanLeakStackDepth is how many frames of a span's creation stack are kept
+const spanLeakStackDepth = 32
+
+var spanLeaks metric.Int64Counter
+
+// initSpanLeakMetrics creates the leaked span counter
+func initSpanLeakMetrics() error {
+	var err error
+
+	spanLeaks, err = meter.Int64Counter(
+		"spans_leaked_total",
+		metric.WithDescription("Spans still open after SPAN_LEAK_TIMEOUT, by span name; only counted with SPAN_LEAK_DETECTOR on"),
+	)
+	return err
+}
+
+// openSpan is a started span and where it was started from
+type openSpan struct {
+	name     string
+	ctx      trace.SpanContext
+	start    time.Time
+	pcs      []uintptr
+	reported bool
+}
+
+// spanLeakDetector is a development aid: it remembers the creation stack of
+// every span and logs spans that are still open after SPAN_LEAK_TIMEOUT,
+// which is how an End missing on an early return shows up. Capturing a stack
+// per span is too costly to leave on in production.
+type spanLeakDetector struct {
+	enabled bool
+	timeout time.Duration
+
+	mu   sync.Mutex
+	open map[trace.SpanID]*openSpan
+	scan sync.Once
+	stop chan struct{}
+}
+
+var spanLeakTracker = newSpanLeakDetector()
+
+func newSpanLeakDetector() *spanLeakDetector {
+	return &spanLeakDetector{
+		enabled: envBool("SPAN_LEAK_DETECTOR", false),
+		timeout: envDuration("SPAN_LEAK_TIMEOUT", time.Minute),
+		open:    map[trace.SpanID]*openSpan{},
+		stop:    make(chan struct{}),
+	}
+}
+
+func (d *spanLeakDetector) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	if !d.enabled {
+		return
+	}
+	d.scan.Do(func() { goWithCrashReport("span_leak_detector", d.run) })
+
+	// Skip runtime.Callers and OnStart; SDK frames are dropped when formatting
+	pcs := make([]uintptr, spanLeakStackDepth)
+	pcs = pcs[:runtime.Callers(2, pcs)]
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.open[s.SpanContext().SpanID()] = &openSpan{
+		name:  s.Name(),
+		ctx:   s.SpanContext(),
+		start: s.StartTime(),
+		pcs:   pcs,
+	}
+}
+
+func (d *spanLeakDetector) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !d.enabled {
+		return
+	}
+	d.mu.Lock()
+	span, ok := d.open[s.SpanContext().SpanID()]
+	delete(d.open, s.SpanContext().SpanID())
+	d.mu.Unlock()
+
+	if ok && span.reported {
+		logJSON(trace.ContextWithSpanContext(context.Background(), span.ctx), "WARN", "Leaked span ended late", map[string]interface{}{
+			"span_name":    span.name,
+			"open_seconds": s.EndTime().Sub(span.start).Seconds(),
+		})
+	}
+}
+
+// run reports newly leaked spans a few times per timeout
+func (d *spanLeakDetector) run() {
+	interval := d.timeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case now := <-ticker.C:
+			for _, span := range d.leaked(now) {
+				d.report(now, span)
+			}
+		}
+	}
+}
+
+// leaked marks and returns the spans that crossed the timeout since the last scan
+func (d *spanLeakDetector) leaked(now time.Time) []openSpan {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var spans []openSpan
+	for _, span := range d.open {
+		if !span.reported && now.Sub(span.start) >= d.timeout {
+			span.reported = true
+			spans = append(spans, *span)
+		}
+	}
+	return spans
+}
+
+func (d *spanLeakDetector) report(now time.Time, span openSpan) {
+	ctx := trace.ContextWithSpanContext(context.Background(), span.ctx)
+	if spanLeaks != nil {
+		spanLeaks.Add(ctx, 1, metric.WithAttributes(attribute.String("span_name", span.name)))
+	}
+	logJSON(ctx, "ERROR", "Span not ended", map[string]interface{}{
+		"span_name":    span.name,
+		"open_seconds": now.Sub(span.start).Seconds(),
+		"stack":        creationStack(span.pcs),
+	})
+}
+
+// creationStack formats the frames that started a span, leaving out the
+// SDK's own
+func creationStack(pcs []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "go.opentelemetry.io/otel/sdk/") && !strings.HasPrefix(frame.Function, "runtime.") {
+			fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+func (d *spanLeakDetector) Shutdown(context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	select {
+	case <-d.stop:
+	default:
+		close(d.stop)
+	}
+	return nil
+}
+
+func (d *spanLeakDetector) ForceFlush(context.Context) error { return nil }
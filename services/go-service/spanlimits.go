@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var spanLimitDrops metric.Int64Counter
+
+// initSpanLimitMetrics creates the span limit truncation counter
+func initSpanLimitMetrics() error {
+	var err error
+
+	spanLimitDrops, err = meter.Int64Counter(
+		"span_limit_dropped_total",
+		metric.WithDescription("Span data dropped or truncated by the span limits, by span name and limit"),
+	)
+	return err
+}
+
+// spanLimits reads the standard OTEL_SPAN_*_LIMIT, OTEL_EVENT_* and
+// OTEL_LINK_* variables. Attribute values are capped at 4096 characters
+// unless configured, where the SDK would leave them unlimited.
+func spanLimits() sdktrace.SpanLimits {
+	limits := sdktrace.NewSpanLimits()
+	if os.Getenv("OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT") == "" && os.Getenv("OTEL_ATTRIBUTE_VALUE_LENGTH_LIMIT") == "" {
+		limits.AttributeValueLengthLimit = 4096
+	}
+	return limits
+}
+
+// spanLimitProcessor counts what the span limits cut from finished spans, so
+// a runaway attribute or event loop shows up before exporter payloads do
+type spanLimitProcessor struct {
+	limits sdktrace.SpanLimits
+}
+
+var spanLimitTracker = &spanLimitProcessor{limits: spanLimits()}
+
+func (p *spanLimitProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p *spanLimitProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	// Spans can end before initTelemetry has created the instruments
+	if spanLimitDrops == nil {
+		return
+	}
+
+	dropped := map[string]int{
+		"attributes": s.DroppedAttributes(),
+		"events":     s.DroppedEvents(),
+		"links":      s.DroppedLinks(),
+	}
+	for _, e := range s.Events() {
+		dropped["event_attributes"] += e.DroppedAttributeCount
+		dropped["attribute_value_length"] += p.truncated(e.Attributes)
+	}
+	for _, l := range s.Links() {
+		dropped["link_attributes"] += l.DroppedAttributeCount
+	}
+	dropped["attribute_value_length"] += p.truncated(s.Attributes())
+
+	for limit, n := range dropped {
+		if n == 0 {
+			continue
+		}
+		spanLimitDrops.Add(context.Background(), int64(n), metric.WithAttributes(
+			attribute.String("span_name", s.Name()),
+			attribute.String("limit", limit),
+		))
+	}
+}
+
+// truncated counts string values cut to the length limit. The SDK does not
+// report truncation, so a value exactly at the limit is taken as cut.
+func (p *spanLimitProcessor) truncated(attrs []attribute.KeyValue) int {
+	max := p.limits.AttributeValueLengthLimit
+	if max < 0 {
+		return 0
+	}
+	n := 0
+	for _, kv := range attrs {
+		switch kv.Value.Type() {
+		case attribute.STRING:
+			if len(kv.Value.AsString()) == max {
+				n++
+			}
+		case attribute.STRINGSLICE:
+			for _, v := range kv.Value.AsStringSlice() {
+				if len(v) == max {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+func (p *spanLimitProcessor) Shutdown(context.Context) error   { return nil }
+func (p *spanLimitProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var (
+	spanCalls    metric.Int64Counter
+	spanDuration metric.Float64Histogram
+)
+
+// initSpanMetrics creates the RED instruments fed by spanMetrics
+func initSpanMetrics() error {
+	var err error
+
+	spanCalls, err = meter.Int64Counter(
+		"span_calls_total",
+		metric.WithDescription("Finished spans by name, kind and status (requests and errors)"),
+	)
+	if err != nil {
+		return err
+	}
+
+	spanDuration, err = meter.Float64Histogram(
+		"span_duration_seconds",
+		metric.WithDescription("Duration of finished spans by name, kind and status"),
+		metric.WithUnit("s"),
+	)
+	return err
+}
+
+// spanMetricsProcessor derives request, error and duration metrics from
+// finished spans, like the collector's spanmetrics connector, for pipelines
+// that do not run it
+type spanMetricsProcessor struct {
+	enabled    bool
+	dimensions []attribute.Key
+}
+
+var spanMetrics = newSpanMetricsProcessor()
+
+// newSpanMetricsProcessor reads SPAN_METRICS and the span attributes copied
+// onto the metrics from SPAN_METRICS_DIMENSIONS
+func newSpanMetricsProcessor() *spanMetricsProcessor {
+	p := &spanMetricsProcessor{enabled: envBool("SPAN_METRICS", false)}
+	for _, key := range splitList(envString("SPAN_METRICS_DIMENSIONS", "http.route,http.method")) {
+		p.dimensions = append(p.dimensions, attribute.Key(key))
+	}
+	return p
+}
+
+func (p *spanMetricsProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p *spanMetricsProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	// Spans can end before initTelemetry has created the instruments
+	if !p.enabled || spanCalls == nil {
+		return
+	}
+
+	status := "unset"
+	switch s.Status().Code {
+	case codes.Ok:
+		status = "ok"
+	case codes.Error:
+		status = "error"
+	}
+
+	attrs := getAttrs()
+	defer putAttrs(attrs)
+
+	*attrs = append(*attrs,
+		attribute.String("span_name", s.Name()),
+		attribute.String("span_kind", s.SpanKind().String()),
+		attribute.String("status_code", status),
+	)
+	for _, kv := range s.Attributes() {
+		for _, key := range p.dimensions {
+			if kv.Key == key {
+				*attrs = append(*attrs, kv)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	opt := metric.WithAttributeSet(attribute.NewSet(*attrs...))
+	spanCalls.Add(ctx, 1, opt)
+	spanDuration.Record(ctx, s.EndTime().Sub(s.StartTime()).Seconds(), opt)
+}
+
+func (p *spanMetricsProcessor) Shutdown(context.Context) error   { return nil }
+func (p *spanMetricsProcessor) ForceFlush(context.Context) error { return nil }
+
+// recordingSampler turns the wrapped sampler's drop decisions into
+// record-only ones, so unsampled spans still reach span processors (and span
+// metrics stay exact) without being exported
+type recordingSampler struct {
+	sdktrace.Sampler
+}
+
+func (s recordingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	res := s.Sampler.ShouldSample(p)
+	if res.Decision == sdktrace.Drop {
+		res.Decision = sdktrace.RecordOnly
+	}
+	return res
+}
+
+func (s recordingSampler) Description() string {
+	return "Recording{" + s.Sampler.Description() + "}"
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// supervisorProcess is the worker.id of the supervise parent itself
+const supervisorProcess = "supervisor"
+
+// workerID tells the processes of "go-service supervise" apart: "0" to
+// "N-1" for the workers, "supervisor" for the parent and empty for a plain
+// serve. It is stamped on their telemetry as worker.id.
+var workerID = os.Getenv("WORKER_ID")
+
+// listen binds a TCP address; under a supervisor every worker binds the same
+// ports, so they are opened with SO_REUSEPORT
+func listen(addr string) (net.Listener, error) {
+	if workerID != "" {
+		return listenReusePort(addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+var (
+	workerRestarts metric.Int64Counter
+	workersRunning atomic.Int64
+)
+
+// initSupervisorMetrics creates the worker restart counter and running gauge,
+// which only the supervisor reports
+func initSupervisorMetrics() error {
+	var err error
+
+	workerRestarts, err = meter.Int64Counter(
+		"supervisor_worker_restarts_total",
+		metric.WithDescription("Workers restarted by the supervisor after exiting on their own, by worker_id and exit_code"),
+	)
+	if err != nil {
+		return err
+	}
+
+	running, err := meter.Int64ObservableGauge(
+		"supervisor_workers_running",
+		metric.WithDescription("Worker processes currently running under the supervisor"),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		if workerID == supervisorProcess {
+			o.ObserveInt64(running, workersRunning.Load())
+		}
+		return nil
+	}, running)
+	return err
+}
+
+// runSupervise starts N copies of "go-service serve" sharing the service
+// ports, restarts the ones that exit and stops them all on SIGINT or SIGTERM
+func runSupervise(args []string) int {
+	fs := flag.NewFlagSet("supervise", flag.ExitOnError)
+	workers := fs.Int("workers", envInt("SUPERVISOR_WORKERS", runtime.NumCPU()), "Number of worker processes")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 10*time.Second, "How long workers get to exit after SIGTERM before they are killed")
+	fs.Parse(args)
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "supervise: %v\n", err)
+		return 1
+	}
+	// Fail here rather than in every worker when the platform lacks SO_REUSEPORT
+	if _, err := listenReusePort("127.0.0.1:0"); err != nil {
+		fmt.Fprintf(os.Stderr, "supervise: %v\n", err)
+		return 1
+	}
+
+	workerID = supervisorProcess
+	logger = serviceLogger()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdown, err := initTelemetry(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "supervise: failed to initialize telemetry: %v\n", err)
+		return 1
+	}
+	defer shutdown(context.Background())
+
+	// A Unix socket cannot be shared with SO_REUSEPORT, and every worker
+	// binding it would replace the others' socket file, so the supervisor
+	// binds it once and the workers adopt it as the "unix" LISTEN_FDS socket
+	var unixSocket *os.File
+	if path := os.Getenv("HTTP_UNIX_SOCKET"); path != "" {
+		lis, err := listenUnix(path)
+		if err == nil {
+			defer lis.Close()
+			unixSocket, err = lis.(*net.UnixListener).File()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "supervise: failed to listen on %s: %v\n", path, err)
+			return 1
+		}
+		defer unixSocket.Close()
+	}
+
+	logJSON(ctx, "INFO", "Supervisor starting workers", map[string]interface{}{
+		"workers": *workers,
+		"pid":     os.Getpid(),
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		id := strconv.Itoa(i)
+		go func() {
+			defer wg.Done()
+			superviseWorker(ctx, exe, id, unixSocket, *shutdownTimeout)
+		}()
+	}
+	wg.Wait()
+
+	logJSON(context.Background(), "INFO", "Supervisor stopped", nil)
+	return 0
+}
+
+// superviseWorker runs one worker until ctx is done, restarting it after a
+// delay that doubles up to 30s while it keeps exiting within a minute.
+// unixSocket, when set, is passed to the worker as its HTTP_UNIX_SOCKET
+// listener.
+func superviseWorker(ctx context.Context, exe, id string, unixSocket *os.File, shutdownTimeout time.Duration) {
+	delay := time.Second
+	for {
+		cmd := exec.Command(exe, "serve")
+		cmd.Env = append(os.Environ(), "WORKER_ID="+id)
+		if unixSocket != nil {
+			cmd.ExtraFiles = []*os.File{unixSocket}
+			cmd.Env = append(cmd.Env,
+				"SUPERVISOR_PID="+strconv.Itoa(os.Getpid()),
+				"LISTEN_FDS=1",
+				"LISTEN_FDNAMES=unix",
+			)
+		}
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+
+		started := time.Now()
+		err := cmd.Start()
+		if err == nil {
+			workersRunning.Add(1)
+			done := make(chan error, 1)
+			go func() { done <- cmd.Wait() }()
+			select {
+			case err = <-done:
+			case <-ctx.Done():
+				cmd.Process.Signal(syscall.SIGTERM)
+				select {
+				case <-done:
+				case <-time.After(shutdownTimeout):
+					cmd.Process.Kill()
+					<-done
+				}
+			}
+			workersRunning.Add(-1)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		exitCode := -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		} else if err == nil {
+			exitCode = 0
+		}
+		if time.Since(started) > time.Minute {
+			delay = time.Second
+		}
+		fields := map[string]interface{}{
+			"worker_id":      id,
+			"exit_code":      exitCode,
+			"uptime_seconds": time.Since(started).Seconds(),
+			"restart_in":     delay.String(),
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		}
+		logJSON(ctx, "WARN", "Worker exited, restarting", fields)
+		workerRestarts.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("worker_id", id),
+			attribute.String("exit_code", strconv.Itoa(exitCode)),
+		))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, 30*time.Second)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemdFirstFD is where systemd's passed sockets start (SD_LISTEN_FDS_START)
+const systemdFirstFD = 3
+
+// systemdSockets are the listeners of a socket-activated unit, sorted by
+// FileDescriptorName: "admin" and "grpc" replace ADMIN_ADDR and GRPC_ADDR,
+// and every other socket serves the HTTP API. A binary upgrade hands over
+// its listeners the same way, adding "unix" for HTTP_UNIX_SOCKET and the
+// pipe that tells the old process this one is serving.
+type systemdSockets struct {
+	http  []net.Listener
+	admin net.Listener
+	grpc  net.Listener
+	unix  net.Listener
+	ready *os.File
+}
+
+// socketActivation is set at the start of serve, before telemetry is
+// initialized; the sockets queue connections until the handlers are ready
+var socketActivation systemdSockets
+
+// takeSystemdListeners adopts the sockets systemd passed through LISTEN_FDS
+// when LISTEN_PID names this process, or the ones a parent passed when
+// UPGRADE_FROM_PID (an upgrading process) or SUPERVISOR_PID (the supervisor
+// sharing HTTP_UNIX_SOCKET) names it. The variables are cleared so child
+// processes, such as supervised workers, do not adopt them too.
+func takeSystemdListeners() (systemdSockets, error) {
+	var sockets systemdSockets
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	parent, _ := strconv.Atoi(os.Getenv("UPGRADE_FROM_PID"))
+	if parent == 0 {
+		parent, _ = strconv.Atoi(os.Getenv("SUPERVISOR_PID"))
+	}
+	if (err != nil || pid != os.Getpid()) && (parent == 0 || parent != os.Getppid()) {
+		return sockets, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return sockets, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	os.Unsetenv("UPGRADE_FROM_PID")
+	os.Unsetenv("SUPERVISOR_PID")
+
+	for i := 0; i < n; i++ {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(systemdFirstFD+i), name)
+		if name == upgradeReadyName {
+			sockets.ready = f
+			continue
+		}
+		// FileListener duplicates the descriptor with close-on-exec set
+		lis, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return sockets, fmt.Errorf("socket %d (%q) from systemd: %w", systemdFirstFD+i, name, err)
+		}
+
+		switch {
+		case name == "admin" && sockets.admin == nil:
+			sockets.admin = lis
+		case name == "grpc" && sockets.grpc == nil:
+			sockets.grpc = lis
+		case name == "unix" && sockets.unix == nil:
+			sockets.unix = lis
+		default:
+			sockets.http = append(sockets.http, lis)
+		}
+	}
+	return sockets, nil
+}
+
+// signalReady tells the process that handed over the listeners that this
+// one is serving, so it can drain
+func (s *systemdSockets) signalReady() {
+	if s.ready == nil {
+		return
+	}
+	s.ready.Write([]byte{1})
+	s.ready.Close()
+	s.ready = nil
+}
+
+// addresses describes the adopted sockets for the startup log
+func (s systemdSockets) addresses() map[string]interface{} {
+	addrs := map[string]interface{}{}
+	var http []string
+	for _, lis := range s.http {
+		http = append(http, lis.Addr().Network()+":"+lis.Addr().String())
+	}
+	addrs["http"] = http
+	if s.admin != nil {
+		addrs["admin"] = s.admin.Addr().Network() + ":" + s.admin.Addr().String()
+	}
+	if s.grpc != nil {
+		addrs["grpc"] = s.grpc.Addr().Network() + ":" + s.grpc.Addr().String()
+	}
+	if s.unix != nil {
+		addrs["unix"] = s.unix.Addr().String()
+	}
+	if s.ready != nil {
+		addrs["upgraded_from"] = os.Getppid()
+	}
+	return addrs
+}
@@ -0,0 +1,104 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Logger writes one JSON object per line with the timestamp, level,
+// message and service, plus the trace and span IDs of the span in ctx so a
+// line leads to its trace and back. Its fields must not change once it
+// logs.
+type Logger struct {
+	// Service is the "service" field of every line
+	Service string
+	// Fields are added to every line, e.g. a worker ID
+	Fields map[string]interface{}
+	// Output defaults to the standard library's default logger
+	Output *log.Logger
+	// Enabled drops lines it returns false for; every line is written when
+	// it is nil
+	Enabled func(ctx context.Context, level string) bool
+	// Redact scrubs the message and string field values, e.g. of secrets
+	Redact func(string) string
+}
+
+// Log writes message at level with fields; the line's own fields override
+// Fields and the standard ones
+func (l *Logger) Log(ctx context.Context, level string, message string, fields map[string]interface{}) {
+	if l.Enabled != nil && !l.Enabled(ctx, level) {
+		return
+	}
+
+	entry := logEntryPool.Get().(*logEntry)
+	defer entry.release()
+
+	for k, v := range l.Fields {
+		entry.fields[k] = v
+	}
+	entry.fields["timestamp"] = time.Now().Format(time.RFC3339)
+	entry.fields["level"] = level
+	entry.fields["message"] = l.redact(message)
+	entry.fields["service"] = l.Service
+
+	if spanCtx := trace.SpanFromContext(ctx).SpanContext(); spanCtx.IsValid() {
+		entry.fields["trace_id"] = spanCtx.TraceID().String()
+		entry.fields["span_id"] = spanCtx.SpanID().String()
+	}
+
+	for k, v := range fields {
+		if str, ok := v.(string); ok {
+			v = l.redact(str)
+		}
+		entry.fields[k] = v
+	}
+
+	// Encode ends the line with the newline log.Println would add
+	entry.enc.Encode(entry.fields)
+	if l.Output != nil {
+		l.Output.Output(2, entry.buf.String())
+	} else {
+		log.Output(2, entry.buf.String())
+	}
+}
+
+func (l *Logger) redact(s string) string {
+	if l.Redact == nil {
+		return s
+	}
+	return l.Redact(s)
+}
+
+// logEntry is a reusable map and encode buffer for one line, saving a map,
+// a marshal buffer and a string copy per line
+type logEntry struct {
+	fields map[string]interface{}
+	buf    bytes.Buffer
+	enc    *json.Encoder
+}
+
+// maxPooledLogLine keeps an occasional huge line from pinning its buffer
+const maxPooledLogLine = 64 << 10
+
+var logEntryPool = sync.Pool{
+	New: func() interface{} {
+		e := &logEntry{fields: make(map[string]interface{}, 16)}
+		e.enc = json.NewEncoder(&e.buf)
+		return e
+	},
+}
+
+func (e *logEntry) release() {
+	if e.buf.Cap() > maxPooledLogLine {
+		return
+	}
+	clear(e.fields)
+	e.buf.Reset()
+	logEntryPool.Put(e)
+}
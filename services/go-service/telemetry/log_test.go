@@ -0,0 +1,27 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+)
+
+func BenchmarkLog(b *testing.B) {
+	l := &Logger{
+		Service: "bench",
+		Fields:  map[string]interface{}{"worker_id": "1"},
+		Output:  log.New(io.Discard, "", 0),
+		Redact:  func(s string) string { return s },
+	}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Log(ctx, "INFO", "Request completed", map[string]interface{}{
+			"method": "GET",
+			"path":   "/data",
+			"status": 200,
+		})
+	}
+}
@@ -0,0 +1,198 @@
+// Package telemetry sets up OpenTelemetry the way go-service does: traces
+// and metrics exported over OTLP/gRPC, W3C trace context and baggage
+// propagation, and JSON log lines carrying the active trace and span IDs.
+// Another Go service gets the same instrumentation from one Setup call and
+// a Logger.
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"google.golang.org/grpc/credentials"
+)
+
+// defaultEndpoint is the collector's OTLP/gRPC port on the same host
+const defaultEndpoint = "localhost:4317"
+
+// Config describes a service and where its telemetry goes. Only
+// ServiceName is required; the hooks let a service add its own processing
+// without giving up the shared pipelines.
+type Config struct {
+	ServiceName    string
+	ServiceVersion string
+	// Attributes are added to the resource on every span and metric
+	Attributes []attribute.KeyValue
+
+	// Endpoint is the collector's OTLP/gRPC host:port; it defaults to
+	// OTEL_EXPORTER_OTLP_ENDPOINT, then localhost:4317
+	Endpoint string
+	// MetricEndpoint sends metrics elsewhere than Endpoint
+	MetricEndpoint string
+	// Headers are sent with every export, e.g. for authentication
+	Headers map[string]string
+	// TLS encrypts the exports; they are plaintext when it is nil
+	TLS *tls.Config
+
+	// Sampler defaults to recording every trace not sampled out upstream
+	Sampler sdktrace.Sampler
+	// SpanLimits defaults to the SDK's limits
+	SpanLimits *sdktrace.SpanLimits
+	// SpanProcessors see every span next to the export, e.g. for in-process
+	// debugging pages
+	SpanProcessors []sdktrace.SpanProcessor
+	// ExportSpans builds the processor that exports spans; it defaults to a
+	// batch processor and lets the caller wrap the exporter or bound the queue
+	ExportSpans func(sdktrace.SpanExporter) sdktrace.SpanProcessor
+
+	// MetricExporter replaces the OTLP/gRPC exporter, e.g. for a backend
+	// without a gRPC receiver
+	MetricExporter sdkmetric.Exporter
+	// WrapMetricExporter decorates the exporter, e.g. to track deliveries
+	WrapMetricExporter func(sdkmetric.Exporter) (sdkmetric.Exporter, error)
+	// Temporality defaults to cumulative for every instrument
+	Temporality sdkmetric.TemporalitySelector
+	// MetricProducers add metrics from outside the SDK, such as OpenCensus
+	MetricProducers []sdkmetric.Producer
+	Views           []sdkmetric.View
+}
+
+// Shutdown flushes and stops the providers Setup installed
+type Shutdown func(ctx context.Context) error
+
+// Setup installs the global tracer and meter providers and propagator. The
+// returned Shutdown should run before the process exits, so the last spans
+// and metrics are exported.
+func Setup(ctx context.Context, cfg Config) (Shutdown, error) {
+	if cfg.ServiceName == "" {
+		return nil, errors.New("telemetry: ServiceName is required")
+	}
+	resource := sdkresource.NewWithAttributes(semconv.SchemaURL, append([]attribute.KeyValue{
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(cfg.ServiceVersion),
+	}, cfg.Attributes...)...)
+
+	tp, err := newTracerProvider(ctx, cfg, resource)
+	if err != nil {
+		return nil, err
+	}
+	mp, err := newMeterProvider(ctx, cfg, resource)
+	if err != nil {
+		tp.Shutdown(ctx)
+		return nil, err
+	}
+
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+	// W3C trace context joins incoming traces; baggage carries values such
+	// as experiment variants downstream
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		return errors.Join(tp.Shutdown(ctx), mp.Shutdown(ctx))
+	}, nil
+}
+
+// endpoint returns the configured endpoint, the environment's or the default
+func (cfg Config) endpoint() string {
+	if cfg.Endpoint != "" {
+		return cfg.Endpoint
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		return v
+	}
+	return defaultEndpoint
+}
+
+func (cfg Config) metricEndpoint() string {
+	if cfg.MetricEndpoint != "" {
+		return cfg.MetricEndpoint
+	}
+	return cfg.endpoint()
+}
+
+func newTracerProvider(ctx context.Context, cfg Config, resource *sdkresource.Resource) (*sdktrace.TracerProvider, error) {
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(cfg.endpoint()),
+		otlptracegrpc.WithHeaders(cfg.Headers),
+	}
+	if cfg.TLS != nil {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(cfg.TLS)))
+	} else {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	export := sdktrace.NewBatchSpanProcessor(exporter)
+	if cfg.ExportSpans != nil {
+		export = cfg.ExportSpans(exporter)
+	}
+	tpOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSpanProcessor(export),
+		sdktrace.WithResource(resource),
+	}
+	for _, sp := range cfg.SpanProcessors {
+		tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(sp))
+	}
+	if cfg.SpanLimits != nil {
+		tpOpts = append(tpOpts, sdktrace.WithRawSpanLimits(*cfg.SpanLimits))
+	}
+	if cfg.Sampler != nil {
+		tpOpts = append(tpOpts, sdktrace.WithSampler(cfg.Sampler))
+	}
+	return sdktrace.NewTracerProvider(tpOpts...), nil
+}
+
+func newMeterProvider(ctx context.Context, cfg Config, resource *sdkresource.Resource) (*sdkmetric.MeterProvider, error) {
+	exporter := cfg.MetricExporter
+	if exporter == nil {
+		opts := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithEndpoint(cfg.metricEndpoint()),
+			otlpmetricgrpc.WithHeaders(cfg.Headers),
+		}
+		if cfg.TLS != nil {
+			opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(cfg.TLS)))
+		} else {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+		if cfg.Temporality != nil {
+			opts = append(opts, otlpmetricgrpc.WithTemporalitySelector(cfg.Temporality))
+		}
+		var err error
+		exporter, err = otlpmetricgrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.WrapMetricExporter != nil {
+		var err error
+		exporter, err = cfg.WrapMetricExporter(exporter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var readerOpts []sdkmetric.PeriodicReaderOption
+	for _, p := range cfg.MetricProducers {
+		readerOpts = append(readerOpts, sdkmetric.WithProducer(p))
+	}
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, readerOpts...)),
+		sdkmetric.WithResource(resource),
+		sdkmetric.WithView(cfg.Views...),
+	), nil
+}
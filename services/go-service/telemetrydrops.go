@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var telemetryDropped metric.Int64Counter
+
+// initTelemetryDropMetrics creates the lost telemetry counter
+func initTelemetryDropMetrics() error {
+	var err error
+
+	telemetryDropped, err = meter.Int64Counter(
+		"telemetry_dropped_total",
+		metric.WithDescription("Telemetry lost before leaving the process by signal (traces, metrics, logs, wide_events) and reason"),
+	)
+	return err
+}
+
+// recordTelemetryDrop counts n lost spans, data points, log lines or events;
+// losses before initTelemetry are not counted
+func recordTelemetryDrop(signal, reason string, n int) {
+	if telemetryDropped == nil || n <= 0 {
+		return
+	}
+	telemetryDropped.Add(context.Background(), int64(n), metric.WithAttributes(
+		attribute.String("signal", signal),
+		attribute.String("reason", reason),
+	))
+}
+
+// spanQueueItem is an ended span, or a flush marker closed once every span
+// queued before it has reached the batcher
+type spanQueueItem struct {
+	span    sdktrace.ReadOnlySpan
+	flushed chan struct{}
+}
+
+// droppingSpanQueue sits in front of a blocking batch span processor. Ended
+// spans wait in a bounded queue of OTEL_BSP_MAX_QUEUE_SIZE; when the
+// exporter falls behind and it fills up, spans are dropped and counted,
+// where the SDK batcher would drop them silently.
+type droppingSpanQueue struct {
+	next  sdktrace.SpanProcessor
+	queue chan spanQueueItem
+	done  chan struct{}
+
+	mu      sync.RWMutex
+	stopped bool
+}
+
+func newDroppingSpanQueue(exporter sdktrace.SpanExporter) *droppingSpanQueue {
+	q := &droppingSpanQueue{
+		next:  sdktrace.NewBatchSpanProcessor(exporter, sdktrace.WithBlocking()),
+		queue: make(chan spanQueueItem, envInt("OTEL_BSP_MAX_QUEUE_SIZE", sdktrace.DefaultMaxQueueSize)),
+		done:  make(chan struct{}),
+	}
+	go q.forward()
+	return q
+}
+
+func (q *droppingSpanQueue) forward() {
+	defer close(q.done)
+	for item := range q.queue {
+		if item.flushed != nil {
+			close(item.flushed)
+			continue
+		}
+		q.next.OnEnd(item.span)
+	}
+}
+
+func (q *droppingSpanQueue) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	q.next.OnStart(ctx, s)
+}
+
+func (q *droppingSpanQueue) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.stopped {
+		recordTelemetryDrop("traces", "shutdown", 1)
+		return
+	}
+	select {
+	case q.queue <- spanQueueItem{span: s}:
+	default:
+		recordTelemetryDrop("traces", "queue_full", 1)
+	}
+}
+
+// ForceFlush hands every queued span to the batcher, then flushes it
+func (q *droppingSpanQueue) ForceFlush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	q.mu.RLock()
+	if q.stopped {
+		q.mu.RUnlock()
+		return nil
+	}
+	select {
+	case q.queue <- spanQueueItem{flushed: flushed}:
+	case <-ctx.Done():
+		q.mu.RUnlock()
+		return ctx.Err()
+	}
+	q.mu.RUnlock()
+
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return q.next.ForceFlush(ctx)
+}
+
+// Shutdown drains the queue into the batcher and shuts it down
+func (q *droppingSpanQueue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.stopped {
+		q.stopped = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return q.next.Shutdown(ctx)
+}
+
+// dataPoints counts the points in a metrics export
+func dataPoints(rm *metricdata.ResourceMetrics) int {
+	n := 0
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				n += len(data.DataPoints)
+			case metricdata.Sum[float64]:
+				n += len(data.DataPoints)
+			case metricdata.Gauge[int64]:
+				n += len(data.DataPoints)
+			case metricdata.Gauge[float64]:
+				n += len(data.DataPoints)
+			case metricdata.Histogram[int64]:
+				n += len(data.DataPoints)
+			case metricdata.Histogram[float64]:
+				n += len(data.DataPoints)
+			case metricdata.ExponentialHistogram[int64]:
+				n += len(data.DataPoints)
+			case metricdata.ExponentialHistogram[float64]:
+				n += len(data.DataPoints)
+			}
+		}
+	}
+	return n
+}
+
+// logDropWriter counts log lines that could not be written, which the log
+// package otherwise discards without a trace
+type logDropWriter struct {
+	w io.Writer
+}
+
+func (l logDropWriter) Write(p []byte) (int, error) {
+	n, err := l.w.Write(p)
+	if err != nil {
+		recordTelemetryDrop("logs", "write_failed", 1)
+	}
+	return n, err
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// excludedPrefixes lists paths skipped by tracing and request metrics
+var excludedPrefixes = splitList(envString("TELEMETRY_EXCLUDE_PATHS", "/healthz,/readyz,/favicon.ico,/static/"))
+
+// telemetryExcluded reports whether a request should bypass tracing and
+// request metrics: health checks, static assets, CORS preflights and
+// browser telemetry passing through the OTLP proxy
+func telemetryExcluded(r *http.Request) bool {
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		return true
+	}
+	if r.URL.Path == otlpProxyPath {
+		return true
+	}
+	for _, prefix := range excludedPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// traceFilter is the otelhttp filter; it returns true for requests to trace.
+// ROUTE_MIDDLEWARE groups switched to +tracing or -tracing override the
+// exclusions.
+func traceFilter(r *http.Request) bool {
+	return routeMiddleware(r, "tracing", !telemetryExcluded(r))
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	certReloads metric.Int64Counter
+
+	// serverCerts is nil when the main listener serves plain HTTP
+	serverCerts *certReloader
+)
+
+// certReloader serves the certificate pair from disk and swaps it when the
+// files change or the process receives SIGHUP
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	notAfter time.Time
+	modTime  time.Time
+}
+
+// loadServerCertificates reads TLS_CERT_FILE/TLS_KEY_FILE, returning nil when unset
+func loadServerCertificates() (*certReloader, error) {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile == "" || keyFile == "" {
+		return nil, nil
+	}
+	return newCertReloader(certFile, keyFile)
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload parses the pair from disk, keeping the previous one on failure
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	cert.Leaf = leaf
+
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.notAfter = leaf.NotAfter
+	c.modTime = info.ModTime()
+	return nil
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+func (c *certReloader) expiry() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.notAfter
+}
+
+// changed reports whether either file on disk is newer than the loaded pair
+func (c *certReloader) changed() bool {
+	c.mu.RLock()
+	loaded := c.modTime
+	c.mu.RUnlock()
+
+	for _, path := range []string{c.certFile, c.keyFile} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(loaded) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads on SIGHUP and whenever the files change on disk
+func (c *certReloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(envDuration("TLS_RELOAD_INTERVAL", 30*time.Second))
+	defer ticker.Stop()
+
+	for {
+		trigger := "file_change"
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			trigger = "sighup"
+		case <-ticker.C:
+			if !c.changed() {
+				continue
+			}
+		}
+
+		result := "success"
+		fields := map[string]interface{}{"trigger": trigger, "cert_file": c.certFile}
+		if err := c.reload(); err != nil {
+			result = "failure"
+			fields["error"] = err.Error()
+			logJSON(ctx, "ERROR", "TLS certificate reload failed", fields)
+		} else {
+			fields["not_after"] = c.expiry().Format(time.RFC3339)
+			logJSON(ctx, "INFO", "TLS certificate reloaded", fields)
+		}
+
+		certReloads.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("trigger", trigger),
+			attribute.String("result", result),
+		))
+	}
+}
+
+// initTLSMetrics exports reload outcomes and the certificate expiry for alerting
+func initTLSMetrics() error {
+	var err error
+	certReloads, err = meter.Int64Counter(
+		"tls_certificate_reloads_total",
+		metric.WithDescription("TLS certificate reload attempts by trigger and result"),
+	)
+	if err != nil {
+		return err
+	}
+
+	expiry, err := meter.Float64ObservableGauge(
+		"tls_certificate_expiry_timestamp_seconds",
+		metric.WithDescription("NotAfter of the served TLS certificate as a Unix timestamp"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		if serverCerts != nil {
+			o.ObserveFloat64(expiry, float64(serverCerts.expiry().Unix()), metric.WithAttributes(
+				attribute.String("cert_file", serverCerts.certFile),
+			))
+		}
+		return nil
+	}, expiry)
+	return err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceLinkConfig holds the UI base URLs trace links are built from; a
+// backend with no URL is left out
+type traceLinkConfig struct {
+	grafanaURL        string
+	grafanaDatasource string
+	grafanaOrgID      string
+	jaegerURL         string
+	tempoURL          string
+}
+
+var traceLinks = loadTraceLinkConfig()
+
+func loadTraceLinkConfig() traceLinkConfig {
+	return traceLinkConfig{
+		grafanaURL:        strings.TrimSuffix(envString("TRACE_LINK_GRAFANA_URL", "http://localhost:3000"), "/"),
+		grafanaDatasource: envString("TRACE_LINK_GRAFANA_DATASOURCE", "Tempo"),
+		grafanaOrgID:      envString("TRACE_LINK_GRAFANA_ORG_ID", "1"),
+		jaegerURL:         strings.TrimSuffix(envString("TRACE_LINK_JAEGER_URL", ""), "/"),
+		tempoURL:          strings.TrimSuffix(envString("TRACE_LINK_TEMPO_URL", ""), "/"),
+	}
+}
+
+// links returns the deep links for traceID by backend name
+func (c traceLinkConfig) links(traceID string) map[string]string {
+	links := map[string]string{}
+	if c.grafanaURL != "" {
+		// Explore's "left" pane state; the datasource may be a name or UID
+		left, _ := json.Marshal(map[string]interface{}{
+			"datasource": c.grafanaDatasource,
+			"queries": []map[string]string{{
+				"refId":     "A",
+				"queryType": "traceql",
+				"query":     traceID,
+			}},
+			"range": map[string]string{"from": "now-1h", "to": "now"},
+		})
+		links["grafana"] = c.grafanaURL + "/explore?" + url.Values{
+			"orgId": {c.grafanaOrgID},
+			"left":  {string(left)},
+		}.Encode()
+	}
+	if c.jaegerURL != "" {
+		links["jaeger"] = c.jaegerURL + "/trace/" + traceID
+	}
+	if c.tempoURL != "" {
+		links["tempo"] = c.tempoURL + "/api/traces/" + traceID
+	}
+	return links
+}
+
+// traceLinksResponse is the body of GET /trace/{traceID}
+type traceLinksResponse struct {
+	TraceID string            `json:"trace_id"`
+	Links   map[string]string `json:"links"`
+}
+
+// traceLinkHandler serves /trace/{traceID}: the deep links as JSON, or a
+// redirect to one backend with ?redirect=grafana|jaeger|tempo. The trace's
+// log lines are served under /trace/{traceID}/logs.
+func traceLinkHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	raw, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/trace/"), "/")
+	id, err := trace.TraceIDFromHex(strings.ToLower(raw))
+	if err != nil || (sub != "" && sub != "logs") {
+		writeJSON(http.StatusBadRequest, errorResponse{
+			Error: "expected /trace/{traceID} or /trace/{traceID}/logs with a 32-character hex trace ID",
+		})
+		return
+	}
+	traceID := id.String()
+	if sub == "logs" {
+		traceLogsHandler(w, r, traceID)
+		return
+	}
+	links := traceLinks.links(traceID)
+
+	if backend := r.URL.Query().Get("redirect"); backend != "" {
+		target, ok := links[backend]
+		if !ok {
+			writeJSON(http.StatusNotFound, errorResponse{Error: "no trace link configured for " + backend})
+			return
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+
+	writeJSON(http.StatusOK, traceLinksResponse{
+		TraceID: traceID,
+		Links:   links,
+	})
+}
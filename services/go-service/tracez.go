@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracezBoundaries are the latency bucket lower bounds used by OpenCensus/OTel zPages
+var tracezBoundaries = []time.Duration{
+	0,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	100 * time.Second,
+}
+
+const tracezSamplesPerBucket = 5
+
+// tracezOtherName collects the spans of every name beyond TRACEZ_MAX_NAMES
+const tracezOtherName = "other"
+
+// runningSpan describes a span that has started but not ended yet
+type runningSpan struct {
+	Name    string
+	TraceID string
+	SpanID  string
+	Start   time.Time
+}
+
+// tracezSummary aggregates per-span-name counts and samples for /debug/tracez
+type tracezSummary struct {
+	running       map[trace.SpanID]runningSpan
+	latencyCounts []int64
+	latency       [][]spanRecord
+	errorCount    int64
+	errors        []spanRecord
+}
+
+// tracezProcessor is a zPages-style span processor sampling live and finished
+// spans into latency buckets without any external backend. Span names that
+// carry IDs would grow names without bound, so past maxNames new names share
+// the "other" row.
+type tracezProcessor struct {
+	maxNames int
+
+	mu    sync.Mutex
+	names map[string]*tracezSummary
+}
+
+var tracez = &tracezProcessor{
+	maxNames: envInt("TRACEZ_MAX_NAMES", 200),
+	names:    map[string]*tracezSummary{},
+}
+
+// summary returns the row of a span name. Names are never removed, so a span
+// that started in the "other" row also ends in it.
+func (p *tracezProcessor) summary(name string) *tracezSummary {
+	s, ok := p.names[name]
+	if !ok && name != tracezOtherName && len(p.names) >= p.maxNames {
+		name = tracezOtherName
+		s, ok = p.names[name]
+	}
+	if !ok {
+		s = &tracezSummary{
+			running:       map[trace.SpanID]runningSpan{},
+			latencyCounts: make([]int64, len(tracezBoundaries)),
+			latency:       make([][]spanRecord, len(tracezBoundaries)),
+		}
+		p.names[name] = s
+	}
+	return s
+}
+
+func (p *tracezProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	sc := s.SpanContext()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.summary(s.Name()).running[sc.SpanID()] = runningSpan{
+		Name:    s.Name(),
+		TraceID: sc.TraceID().String(),
+		SpanID:  sc.SpanID().String(),
+		Start:   s.StartTime(),
+	}
+}
+
+func (p *tracezProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	rec := newSpanRecord(s)
+	latency := s.EndTime().Sub(s.StartTime())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sum := p.summary(s.Name())
+	delete(sum.running, s.SpanContext().SpanID())
+
+	if rec.Status == "Error" {
+		sum.errorCount++
+		sum.errors = appendSample(sum.errors, rec)
+		return
+	}
+
+	bucket := 0
+	for i, lower := range tracezBoundaries {
+		if latency >= lower {
+			bucket = i
+		}
+	}
+	sum.latencyCounts[bucket]++
+	sum.latency[bucket] = appendSample(sum.latency[bucket], rec)
+}
+
+// running returns every span that has started but not ended, across names
+func (p *tracezProcessor) running() []runningSpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var spans []runningSpan
+	for _, sum := range p.names {
+		for _, rs := range sum.running {
+			spans = append(spans, rs)
+		}
+	}
+	return spans
+}
+
+func (p *tracezProcessor) Shutdown(context.Context) error   { return nil }
+func (p *tracezProcessor) ForceFlush(context.Context) error { return nil }
+
+// appendSample keeps the most recent samples per bucket
+func appendSample(samples []spanRecord, rec spanRecord) []spanRecord {
+	samples = append(samples, rec)
+	if len(samples) > tracezSamplesPerBucket {
+		samples = samples[len(samples)-tracezSamplesPerBucket:]
+	}
+	return samples
+}
+
+// tracezRow is one span name in the summary table
+type tracezRow struct {
+	Name    string
+	Running int
+	Latency []int64
+	Errors  int64
+}
+
+// tracezPage is the data rendered by the tracez template
+type tracezPage struct {
+	Buckets []string
+	Rows    []tracezRow
+	Detail  string
+	Name    string
+	Running []runningSpan
+	Samples []spanRecord
+}
+
+var tracezTemplate = template.Must(template.New("tracez").Parse(`<!DOCTYPE html>
+<html>
+<head><title>go-service tracez</title>
+<style>
+body { font-family: monospace; font-size: 13px; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 2px 6px; text-align: right; }
+td:first-child { text-align: left; }
+</style>
+</head>
+<body>
+<h1>tracez</h1>
+<table>
+<tr><th>Span name</th><th>Running</th>{{range .Buckets}}<th>&ge;{{.}}</th>{{end}}<th>Errors</th></tr>
+{{range .Rows}}{{$name := .Name}}<tr>
+<td>{{.Name}}</td>
+<td><a href="?name={{.Name}}&type=running">{{.Running}}</a></td>
+{{range $i, $c := .Latency}}<td><a href="?name={{$name}}&type=latency&bucket={{$i}}">{{$c}}</a></td>{{end}}
+<td><a href="?name={{.Name}}&type=error">{{.Errors}}</a></td>
+</tr>
+{{end}}</table>
+{{if .Detail}}<h2>{{.Name}}: {{.Detail}}</h2>
+<table>
+<tr><th>Start</th><th>Duration (ms)</th><th>Trace</th><th>Span</th><th>Status</th></tr>
+{{range .Running}}<tr><td>{{.Start.Format "15:04:05.000"}}</td><td>running</td><td>{{.TraceID}}</td><td>{{.SpanID}}</td><td></td></tr>
+{{end}}{{range .Samples}}<tr><td>{{.Start.Format "15:04:05.000"}}</td><td>{{printf "%.3f" .DurationMs}}</td><td>{{.TraceID}}</td><td>{{.SpanID}}</td><td>{{.Status}} {{.StatusDesc}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// debugTracezHandler renders the zPages-style latency bucket summary and samples
+func debugTracezHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	page := tracezPage{Name: q.Get("name")}
+	for _, b := range tracezBoundaries {
+		page.Buckets = append(page.Buckets, b.String())
+	}
+
+	tracez.mu.Lock()
+	for name, sum := range tracez.names {
+		page.Rows = append(page.Rows, tracezRow{
+			Name:    name,
+			Running: len(sum.running),
+			Latency: append([]int64(nil), sum.latencyCounts...),
+			Errors:  sum.errorCount,
+		})
+	}
+	if sum, ok := tracez.names[page.Name]; ok {
+		switch q.Get("type") {
+		case "running":
+			page.Detail = "running"
+			for _, rs := range sum.running {
+				page.Running = append(page.Running, rs)
+			}
+		case "error":
+			page.Detail = "errors"
+			page.Samples = append(page.Samples, sum.errors...)
+		case "latency":
+			bucket, err := strconv.Atoi(q.Get("bucket"))
+			if err == nil && bucket >= 0 && bucket < len(tracezBoundaries) {
+				page.Detail = "latency >= " + tracezBoundaries[bucket].String()
+				page.Samples = append(page.Samples, sum.latency[bucket]...)
+			}
+		}
+	}
+	tracez.mu.Unlock()
+
+	sort.Slice(page.Rows, func(i, j int) bool { return page.Rows[i].Name < page.Rows[j].Name })
+	sort.Slice(page.Running, func(i, j int) bool { return page.Running[i].Start.Before(page.Running[j].Start) })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tracezTemplate.Execute(w, page)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// unixPeer is the other end of a Unix socket connection, usually a sidecar
+// proxy; the credentials are only known on Linux
+type unixPeer struct {
+	socket string
+	pid    int32
+	uid    uint32
+	gid    uint32
+	creds  bool
+}
+
+type unixPeerContextKey struct{}
+
+// unixConnContext remembers the peer of Unix socket connections for
+// tagUnixPeers; TCP connections are left alone
+func unixConnContext(ctx context.Context, c net.Conn) context.Context {
+	conn, ok := c.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	peer := unixPeer{socket: conn.LocalAddr().String()}
+	peer.pid, peer.uid, peer.gid, peer.creds = peerCredentials(conn)
+	return context.WithValue(ctx, unixPeerContextKey{}, peer)
+}
+
+// unixRemoteAddr replaces the "@" that unnamed client sockets report as the
+// remote address with the socket path, before otelhttp records it as
+// net.sock.peer.addr and clientIP falls back to it
+func unixRemoteAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if peer, ok := r.Context().Value(unixPeerContextKey{}).(unixPeer); ok {
+			r.RemoteAddr = peer.socket
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tagUnixPeers describes Unix socket requests on the server span: the
+// socket path instead of an address and port, and the connecting process
+func tagUnixPeers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if peer, ok := r.Context().Value(unixPeerContextKey{}).(unixPeer); ok {
+			span := trace.SpanFromContext(r.Context())
+			span.SetAttributes(
+				semconv.NetworkTransportUnix,
+				semconv.NetSockFamilyUnix,
+				semconv.NetSockHostAddr(peer.socket),
+			)
+			if peer.creds {
+				span.SetAttributes(
+					attribute.Int("unix.peer.pid", int(peer.pid)),
+					attribute.Int("unix.peer.uid", int(peer.uid)),
+					attribute.Int("unix.peer.gid", int(peer.gid)),
+				)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listenUnix binds the HTTP_UNIX_SOCKET path, replacing a socket left by a
+// previous run, and opens it to HTTP_UNIX_SOCKET_MODE
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := strconv.ParseUint(envString("HTTP_UNIX_SOCKET_MODE", "0660"), 8, 32)
+	if err != nil {
+		lis.Close()
+		return nil, err
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
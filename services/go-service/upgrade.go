@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// upgradeReadyName is the LISTEN_FDNAMES entry of the pipe a new process
+// writes to once it serves
+const upgradeReadyName = "upgrade_ready"
+
+var (
+	binaryUpgrades      metric.Int64Counter
+	binaryUpgradePhases metric.Float64Histogram
+)
+
+// initUpgradeMetrics creates the binary upgrade instruments
+func initUpgradeMetrics() error {
+	var err error
+
+	binaryUpgrades, err = meter.Int64Counter(
+		"binary_upgrades_total",
+		metric.WithDescription("In-place binary upgrades by result (success, start_failed, not_ready)"),
+	)
+	if err != nil {
+		return err
+	}
+
+	binaryUpgradePhases, err = meter.Float64Histogram(
+		"binary_upgrade_phase_seconds",
+		metric.WithDescription("Time spent in each upgrade phase: start (new process until it serves) and drain (old process finishing its requests)"),
+		metric.WithUnit("s"),
+	)
+	return err
+}
+
+// inheritedListener is a listener handed to the new process under name
+type inheritedListener struct {
+	name string
+	lis  net.Listener
+}
+
+// upgrader replaces the running binary without dropping connections: on
+// SIGUSR2 it starts the binary found on disk with this process's listeners,
+// waits until the new process serves, then drains and lets serve return.
+// Both processes accept on the same sockets in between, so no connection is
+// refused.
+type upgrader struct {
+	mu        sync.Mutex
+	listeners []inheritedListener
+	drains    []func(ctx context.Context)
+
+	// drained is closed once a handover finished and this process drained
+	drained chan struct{}
+}
+
+var binaryUpgrader = &upgrader{drained: make(chan struct{})}
+
+// inherit registers a listener to hand over
+func (u *upgrader) inherit(name string, lis net.Listener) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.listeners = append(u.listeners, inheritedListener{name: name, lis: lis})
+}
+
+// onDrain registers a graceful stop run after a handover
+func (u *upgrader) onDrain(fn func(ctx context.Context)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.drains = append(u.drains, fn)
+}
+
+// watch upgrades on each upgrade signal until one hands over
+func (u *upgrader) watch(ctx context.Context) {
+	if len(upgradeSignals) == 0 {
+		return
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, upgradeSignals...)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+		}
+		if u.upgrade(ctx) {
+			close(u.drained)
+			return
+		}
+	}
+}
+
+// upgrade runs one handover under a root "binary_upgrade" span and reports
+// whether this process has handed over and drained
+func (u *upgrader) upgrade(ctx context.Context) bool {
+	ctx, span := tracer.Start(ctx, "binary_upgrade", trace.WithNewRoot())
+	defer span.End()
+
+	result := "success"
+	defer func() {
+		span.SetAttributes(attribute.String("upgrade.result", result))
+		binaryUpgrades.Add(ctx, 1, metric.WithAttributes(attribute.String("result", result)))
+	}()
+
+	start := time.Now()
+	pid, err := u.startNew(ctx)
+	binaryUpgradePhases.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attribute.String("phase", "start")))
+	if err != nil {
+		result = "start_failed"
+		var notReady *upgradeNotReadyError
+		if errors.As(err, &notReady) {
+			result = "not_ready"
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "upgrade failed")
+		logJSON(ctx, "ERROR", "Binary upgrade failed, still serving", map[string]interface{}{"error": err.Error()})
+		return false
+	}
+	span.SetAttributes(attribute.Int("upgrade.new_pid", pid))
+	logJSON(ctx, "INFO", "New process is serving, draining", map[string]interface{}{"new_pid": pid})
+
+	start = time.Now()
+	u.drain(ctx)
+	binaryUpgradePhases.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attribute.String("phase", "drain")))
+	return true
+}
+
+// upgradeNotReadyError is a new process that started but never served
+type upgradeNotReadyError struct {
+	err error
+}
+
+func (e *upgradeNotReadyError) Error() string {
+	return "new process did not become ready: " + e.err.Error()
+}
+
+// startNew starts the binary on disk with the listeners as LISTEN_FDS and
+// waits for it to signal readiness within UPGRADE_READY_TIMEOUT
+func (u *upgrader) startNew(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "start_new_process")
+	defer span.End()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	u.mu.Lock()
+	listeners := append([]inheritedListener(nil), u.listeners...)
+	u.mu.Unlock()
+
+	// The listeners' own descriptors are passed rather than File() copies:
+	// os/exec switches the files it hands down to blocking mode, which the
+	// copies share with the listeners and would leave Shutdown stuck in accept
+	files := []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()}
+	var names []string
+	for _, l := range listeners {
+		fd, err := listenerFD(l.lis)
+		if err != nil {
+			return 0, fmt.Errorf("%s listener cannot be handed over: %w", l.name, err)
+		}
+		// Closing the old Unix listener must leave the socket file to the new process
+		if ul, ok := l.lis.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+		files = append(files, fd)
+		names = append(names, l.name)
+	}
+
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer ready.Close()
+	files = append(files, readyW.Fd())
+
+	env := append(os.Environ(),
+		"UPGRADE_FROM_PID="+strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS="+strconv.Itoa(len(names)+1),
+		"LISTEN_FDNAMES="+strings.Join(append(names, upgradeReadyName), ":"),
+	)
+	span.SetAttributes(
+		attribute.String("upgrade.executable", exe),
+		attribute.StringSlice("upgrade.listeners", names),
+	)
+	pid, _, err := syscall.StartProcess(exe, os.Args, &syscall.ProcAttr{Env: env, Files: files})
+	// Only the new process may hold the write end, so its exit reads as EOF
+	readyW.Close()
+	if err != nil {
+		return 0, err
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	signaled := make(chan error, 1)
+	go func() {
+		_, err := ready.Read(make([]byte, 1))
+		signaled <- err
+	}()
+
+	timeout := envDuration("UPGRADE_READY_TIMEOUT", 30*time.Second)
+	select {
+	case err = <-signaled:
+	case <-time.After(timeout):
+		err = fmt.Errorf("no signal within %s", timeout)
+	}
+	if err != nil {
+		proc.Kill()
+		go proc.Wait()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "new process not ready")
+		return 0, &upgradeNotReadyError{err: err}
+	}
+	// The new process outlives this one; Release lets it be reparented
+	proc.Release()
+	return pid, nil
+}
+
+// listenerFD returns the descriptor a listener accepts on
+func listenerFD(lis net.Listener) (uintptr, error) {
+	sc, ok := lis.(syscall.Conn)
+	if !ok {
+		return 0, fmt.Errorf("%T has no descriptor", lis)
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var fd uintptr
+	if err := raw.Control(func(f uintptr) { fd = f }); err != nil {
+		return 0, err
+	}
+	return fd, nil
+}
+
+// drain stops accepting and lets in-flight requests finish within
+// UPGRADE_DRAIN_TIMEOUT
+func (u *upgrader) drain(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "drain_connections")
+	defer span.End()
+
+	setReady(false)
+	ctx, cancel := context.WithTimeout(ctx, envDuration("UPGRADE_DRAIN_TIMEOUT", 30*time.Second))
+	defer cancel()
+
+	u.mu.Lock()
+	drains := append([]func(context.Context){}, u.drains...)
+	u.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, fn := range drains {
+		wg.Add(1)
+		go func(fn func(context.Context)) {
+			defer wg.Done()
+			fn(ctx)
+		}(fn)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "drain timed out")
+	}
+}
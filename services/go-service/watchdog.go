@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var watchdogAlerts metric.Int64Counter
+
+// initWatchdogMetrics creates the alert counter and the stuck request gauge
+func initWatchdogMetrics() error {
+	var err error
+	watchdogAlerts, err = meter.Int64Counter(
+		"watchdog_alerts_total",
+		metric.WithDescription("Watchdog alerts by kind (stuck_request, goroutine_growth)"),
+	)
+	if err != nil {
+		return err
+	}
+
+	stuck, err := meter.Int64ObservableGauge(
+		"watchdog_stuck_requests",
+		metric.WithDescription("Requests currently running longer than WATCHDOG_REQUEST_CEILING"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(stuck, int64(watchdog.stuckCount()))
+		return nil
+	}, stuck)
+	return err
+}
+
+// watchedRequest is an in-flight request tracked by the watchdog
+type watchedRequest struct {
+	route   string
+	method  string
+	start   time.Time
+	span    trace.Span
+	flagged bool
+}
+
+// requestWatchdog flags requests exceeding a hard ceiling and goroutine
+// counts growing well beyond their recent baseline
+type requestWatchdog struct {
+	mu       sync.Mutex
+	requests map[*watchedRequest]struct{}
+
+	ceiling      time.Duration
+	excluded     map[string]bool
+	growth       float64
+	minGoroutine int
+	baseline     float64
+}
+
+var watchdog = &requestWatchdog{
+	requests:     map[*watchedRequest]struct{}{},
+	ceiling:      envDuration("WATCHDOG_REQUEST_CEILING", 30*time.Second),
+	excluded:     routeSet(envString("WATCHDOG_EXCLUDE_ROUTES", "/poll,/download,/burn")),
+	growth:       envFloat("WATCHDOG_GOROUTINE_GROWTH", 3.0),
+	minGoroutine: envInt("WATCHDOG_GOROUTINE_MIN", 200),
+}
+
+func (d *requestWatchdog) stuckCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for req := range d.requests {
+		if time.Since(req.start) > d.ceiling {
+			n++
+		}
+	}
+	return n
+}
+
+// watchRequests registers every request with the watchdog for its lifetime,
+// except routes that are slow by design (long polls, downloads, /burn)
+func watchRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeOf(r)
+		if watchdog.excluded[route] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		req := &watchedRequest{
+			route:  route,
+			method: r.Method,
+			start:  time.Now(),
+			span:   trace.SpanFromContext(r.Context()),
+		}
+		watchdog.mu.Lock()
+		watchdog.requests[req] = struct{}{}
+		watchdog.mu.Unlock()
+
+		defer func() {
+			watchdog.mu.Lock()
+			delete(watchdog.requests, req)
+			watchdog.mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkRequests flags each request over the ceiling once, on its span and in the logs
+func (d *requestWatchdog) checkRequests(ctx context.Context) {
+	d.mu.Lock()
+	var stuck []*watchedRequest
+	for req := range d.requests {
+		if !req.flagged && time.Since(req.start) > d.ceiling {
+			req.flagged = true
+			stuck = append(stuck, req)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, req := range stuck {
+		elapsed := time.Since(req.start).Seconds()
+		req.span.AddEvent("watchdog.stuck_request", trace.WithAttributes(
+			attribute.Float64("watchdog.elapsed_seconds", elapsed),
+			attribute.Float64("watchdog.ceiling_seconds", d.ceiling.Seconds()),
+		))
+		watchdogAlerts.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("kind", "stuck_request"),
+			attribute.String("endpoint", req.route),
+		))
+
+		fields := map[string]interface{}{
+			"endpoint":        req.route,
+			"method":          req.method,
+			"elapsed_seconds": elapsed,
+			"ceiling_seconds": d.ceiling.Seconds(),
+		}
+		if sc := req.span.SpanContext(); sc.IsValid() {
+			fields["stuck_trace_id"] = sc.TraceID().String()
+		}
+		logJSON(ctx, "WARN", "Request exceeded watchdog ceiling", fields)
+	}
+}
+
+// checkGoroutines compares the goroutine count with a slow moving baseline;
+// the baseline only absorbs a spike gradually, so sustained leaks keep alerting
+func (d *requestWatchdog) checkGoroutines(ctx context.Context) {
+	count := float64(runtime.NumGoroutine())
+	if d.baseline == 0 {
+		d.baseline = count
+		return
+	}
+	if int(count) > d.minGoroutine && count > d.baseline*d.growth {
+		watchdogAlerts.Add(ctx, 1, metric.WithAttributes(attribute.String("kind", "goroutine_growth")))
+		logJSON(ctx, "WARN", "Abnormal goroutine growth", map[string]interface{}{
+			"goroutines": int(count),
+			"baseline":   d.baseline,
+			"growth":     count / d.baseline,
+		})
+	}
+	d.baseline += (count - d.baseline) / 30
+}
+
+// run checks requests and goroutines every WATCHDOG_INTERVAL
+func (d *requestWatchdog) run(ctx context.Context) {
+	ticker := time.NewTicker(envDuration("WATCHDOG_INTERVAL", 5*time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		d.checkRequests(ctx)
+		d.checkGoroutines(ctx)
+	}
+}
@@ -0,0 +1,278 @@
+// Package workerpool runs background tasks on a bounded set of goroutines.
+// Every task runs in its own trace, linked to the span that submitted it,
+// and the pools report their utilization and queue depth as metrics.
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "go-service/workerpool"
+
+var (
+	// ErrFull is returned by TrySubmit when every worker is busy and the queue is full
+	ErrFull = errors.New("workerpool: full")
+	// ErrClosed is returned for tasks submitted after Close
+	ErrClosed = errors.New("workerpool: closed")
+)
+
+var (
+	tracer = otel.Tracer(instrumentationName)
+	meter  = otel.Meter(instrumentationName)
+
+	tasks, _ = meter.Int64Counter(
+		"workerpool_tasks_total",
+		metric.WithDescription("Tasks by pool, task and outcome (success, error, rejected)"),
+	)
+	queueWait, _ = meter.Float64Histogram(
+		"workerpool_queue_wait_seconds",
+		metric.WithDescription("Time tasks waited for a free worker"),
+		metric.WithUnit("s"),
+	)
+	taskDuration, _ = meter.Float64Histogram(
+		"workerpool_task_duration_seconds",
+		metric.WithDescription("Time tasks ran on a worker"),
+		metric.WithUnit("s"),
+	)
+	workerGauge, _ = meter.Int64ObservableGauge(
+		"workerpool_workers",
+		metric.WithDescription("Workers by pool and state (busy, idle); busy over the total is the pool's utilization"),
+	)
+	queueGauge, _ = meter.Int64ObservableGauge(
+		"workerpool_queue_length",
+		metric.WithDescription("Tasks waiting for a free worker"),
+	)
+
+	// pools are the open pools reported by the gauges
+	poolsMu sync.Mutex
+	pools   = map[*Pool]bool{}
+
+	_, _ = meter.RegisterCallback(observePools, workerGauge, queueGauge)
+)
+
+func observePools(_ context.Context, o metric.Observer) error {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	for p := range pools {
+		busy := p.busy.Load()
+		name := attribute.String("pool", p.name)
+		o.ObserveInt64(workerGauge, busy, metric.WithAttributes(name, attribute.String("state", "busy")))
+		o.ObserveInt64(workerGauge, int64(p.workers)-busy, metric.WithAttributes(name, attribute.String("state", "idle")))
+		o.ObserveInt64(queueGauge, int64(len(p.queue)), metric.WithAttributes(name))
+	}
+	return nil
+}
+
+// Task is the work submitted to a pool. Its context carries the values of
+// the submitting context and the task's span, but not its cancellation:
+// it is cancelled only when Close gives up waiting.
+type Task func(ctx context.Context) error
+
+// Config sizes a pool
+type Config struct {
+	Name string
+	// Workers is the number of goroutines running tasks
+	Workers int
+	// QueueSize is how many tasks may wait for a free worker
+	QueueSize int
+	// Go starts each worker; it defaults to a plain goroutine and lets the
+	// caller add panic handling
+	Go func(name string, fn func())
+}
+
+// Pool runs tasks on Workers goroutines
+type Pool struct {
+	name    string
+	workers int
+	// slots holds a token per queued or running task; queue is as large, so
+	// a submitter holding a token never blocks on it
+	slots  chan struct{}
+	queue  chan *task
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	busy   atomic.Int64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// task is a submitted Task with the span it runs in
+type task struct {
+	name      string
+	fn        Task
+	ctx       context.Context
+	span      trace.Span
+	submitted time.Time
+}
+
+// New starts a pool's workers
+func New(cfg Config) *Pool {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize < 0 {
+		cfg.QueueSize = 0
+	}
+	if cfg.Go == nil {
+		cfg.Go = func(_ string, fn func()) { go fn() }
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		name:    cfg.Name,
+		workers: cfg.Workers,
+		slots:   make(chan struct{}, cfg.Workers+cfg.QueueSize),
+		queue:   make(chan *task, cfg.Workers+cfg.QueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	p.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		cfg.Go(cfg.Name+"_worker", p.work)
+	}
+
+	poolsMu.Lock()
+	pools[p] = true
+	poolsMu.Unlock()
+	return p
+}
+
+// Submit queues fn, waiting for room until ctx is done. The task's span is
+// a new root named name, started now so it covers the wait for a worker,
+// with a link to the span in ctx; its span context is returned so the
+// submitter can point at it. opts add to the span, e.g. its kind.
+func (p *Pool) Submit(ctx context.Context, name string, fn Task, opts ...trace.SpanStartOption) (trace.SpanContext, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		p.reject(ctx, name)
+		return trace.SpanContext{}, ctx.Err()
+	}
+	return p.enqueue(ctx, name, fn, opts)
+}
+
+// TrySubmit is Submit without waiting: it fails with ErrFull when every
+// worker is busy and the queue is full
+func (p *Pool) TrySubmit(ctx context.Context, name string, fn Task, opts ...trace.SpanStartOption) (trace.SpanContext, error) {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		p.reject(ctx, name)
+		return trace.SpanContext{}, ErrFull
+	}
+	return p.enqueue(ctx, name, fn, opts)
+}
+
+func (p *Pool) enqueue(ctx context.Context, name string, fn Task, opts []trace.SpanStartOption) (trace.SpanContext, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		<-p.slots
+		p.reject(ctx, name)
+		return trace.SpanContext{}, ErrClosed
+	}
+
+	start := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("workerpool.name", p.name),
+			attribute.String("workerpool.task", name),
+		),
+	}
+	if submitter := trace.SpanContextFromContext(ctx); submitter.IsValid() {
+		start = append(start, trace.WithLinks(trace.Link{
+			SpanContext: submitter,
+			Attributes:  []attribute.KeyValue{attribute.String("workerpool.link", "submitter")},
+		}))
+	}
+	opts = append(start, opts...)
+	taskCtx, span := tracer.Start(context.WithoutCancel(ctx), name, opts...)
+	p.queue <- &task{name: name, fn: fn, ctx: taskCtx, span: span, submitted: time.Now()}
+	return span.SpanContext(), nil
+}
+
+func (p *Pool) reject(ctx context.Context, name string) {
+	tasks.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("pool", p.name),
+		attribute.String("task", name),
+		attribute.String("outcome", "rejected"),
+	))
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for t := range p.queue {
+		p.run(t)
+	}
+}
+
+func (p *Pool) run(t *task) {
+	p.busy.Add(1)
+	defer func() {
+		p.busy.Add(-1)
+		<-p.slots
+	}()
+	defer t.span.End()
+
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	stop := context.AfterFunc(p.ctx, cancel)
+	defer stop()
+
+	pool := attribute.String("pool", p.name)
+	start := time.Now()
+	wait := start.Sub(t.submitted)
+	t.span.AddEvent("worker started", trace.WithAttributes(attribute.Float64("workerpool.queue_wait_ms", float64(wait.Microseconds())/1000)))
+	queueWait.Record(ctx, wait.Seconds(), metric.WithAttributes(pool))
+
+	outcome := "success"
+	if err := t.fn(ctx); err != nil {
+		outcome = "error"
+		t.span.RecordError(err)
+		t.span.SetStatus(codes.Error, err.Error())
+	}
+
+	name := attribute.String("task", t.name)
+	taskDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(pool, name))
+	tasks.Add(ctx, 1, metric.WithAttributes(pool, name, attribute.String("outcome", outcome)))
+}
+
+// Close stops accepting tasks and waits for the queued and running ones;
+// when ctx is done first, the running tasks are cancelled
+func (p *Pool) Close(ctx context.Context) error {
+	defer p.cancel()
+
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	poolsMu.Lock()
+	delete(pools, p)
+	poolsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockedRand is a math/rand source safe for concurrent use
+type lockedRand struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rand.Float64()
+}
+
+func (l *lockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rand.Intn(n)
+}
+
+func (l *lockedRand) Int63n(n int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rand.Int63n(n)
+}
+
+func (l *lockedRand) Read(p []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rand.Read(p)
+}
+
+// workloadSeed seeds workloadRand, the one source of randomness behind the
+// simulated workload: query latency, fault rule odds, traffic mirroring,
+// poll events, download payloads and loadgen's path choice. Setting
+// WORKLOAD_SEED makes two runs draw the same sequence, so their dashboards
+// can be compared; trace IDs stay random so traces never collide.
+var (
+	workloadSeed, workloadSeeded = loadWorkloadSeed()
+	workloadRand                 = &lockedRand{rand: rand.New(rand.NewSource(workloadSeed))}
+)
+
+func loadWorkloadSeed() (seed int64, fixed bool) {
+	if seed := int64(envInt("WORKLOAD_SEED", 0)); seed != 0 {
+		return seed, true
+	}
+	return time.Now().UnixNano(), false
+}
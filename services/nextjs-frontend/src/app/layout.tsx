@@ -1,4 +1,5 @@
 import type { Metadata } from 'next'
+import { WebVitals } from './web-vitals'
 
 export const metadata: Metadata = {
   title: 'Observability Stack Demo',
@@ -12,7 +13,10 @@ export default function RootLayout({
 }) {
   return (
     <html lang="en">
-      <body>{children}</body>
+      <body>
+        <WebVitals />
+        {children}
+      </body>
     </html>
   )
 }
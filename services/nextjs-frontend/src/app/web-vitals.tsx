@@ -0,0 +1,17 @@
+'use client';
+
+import { useEffect } from 'react';
+import { useReportWebVitals } from 'next/web-vitals';
+import { initializeRum, reportMetric } from '../lib/rum';
+
+export function WebVitals() {
+  useEffect(() => {
+    initializeRum();
+  }, []);
+
+  useReportWebVitals((metric) => {
+    reportMetric(metric);
+  });
+
+  return null;
+}
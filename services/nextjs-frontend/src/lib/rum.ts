@@ -0,0 +1,71 @@
+// Batches web vitals and errors and ships them to the Go service's /rum endpoint
+const RUM_ENDPOINT = `${process.env.NEXT_PUBLIC_API_GO || 'http://localhost:8002'}/rum`;
+
+type RumMetric = { name: string; value: number; rating?: string; id?: string };
+type RumError = { message: string; type?: string; source?: string; stack?: string };
+
+let metrics: RumMetric[] = [];
+let errors: RumError[] = [];
+let isInitialized = false;
+
+function sessionId(): string {
+  let id = sessionStorage.getItem('rum_session_id');
+  if (!id) {
+    id = Math.random().toString(36).slice(2) + Date.now().toString(36);
+    sessionStorage.setItem('rum_session_id', id);
+  }
+  return id;
+}
+
+function flush() {
+  if (metrics.length === 0 && errors.length === 0) {
+    return;
+  }
+  const body = JSON.stringify({
+    session_id: sessionId(),
+    page: window.location.href,
+    metrics,
+    errors,
+  });
+  metrics = [];
+  errors = [];
+  // text/plain keeps the beacon a simple CORS request
+  if (!navigator.sendBeacon(RUM_ENDPOINT, body)) {
+    fetch(RUM_ENDPOINT, { method: 'POST', body, keepalive: true }).catch(() => {});
+  }
+}
+
+export function reportMetric(metric: RumMetric) {
+  metrics.push({ name: metric.name, value: metric.value, rating: metric.rating, id: metric.id });
+}
+
+export function initializeRum() {
+  if (typeof window === 'undefined' || isInitialized) {
+    return;
+  }
+  isInitialized = true;
+
+  window.addEventListener('error', (event) => {
+    errors.push({
+      message: event.message,
+      type: event.error?.name,
+      source: `${event.filename}:${event.lineno}:${event.colno}`,
+      stack: event.error?.stack,
+    });
+  });
+  window.addEventListener('unhandledrejection', (event) => {
+    errors.push({
+      message: String(event.reason?.message ?? event.reason),
+      type: 'UnhandledRejection',
+      stack: event.reason?.stack,
+    });
+  });
+
+  // Flush when the page is hidden, the last reliable moment on mobile
+  document.addEventListener('visibilitychange', () => {
+    if (document.visibilityState === 'hidden') {
+      flush();
+    }
+  });
+  window.setInterval(flush, 10000);
+}
@@ -38,10 +38,12 @@ export function initializeTelemetry() {
       resource,
     });
 
-    // Configure OTLP exporter to send traces to the collector
+    // Configure OTLP exporter to send traces to the collector, or to the Go
+    // service's OTLP proxy when the endpoint points at it
     // Note: Browser can only use HTTP, not gRPC
+    const endpoint = process.env.NEXT_PUBLIC_OTEL_EXPORTER_OTLP_ENDPOINT || 'http://localhost:4318';
     const exporter = new OTLPTraceExporter({
-      url: 'http://localhost:4318/v1/traces', // HTTP endpoint for browser
+      url: `${endpoint}/v1/traces`, // HTTP endpoint for browser
       headers: {},
     });
 